@@ -0,0 +1,301 @@
+package chatapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// speechSampleRate 返回wav和pcm时的采样率
+	speechSampleRate = 24000
+	// asrSampleRate ASR提供者接收16k单声道PCM
+	asrSampleRate = 16000
+	// asrChunkBytes 每次送入ASR的PCM长度，60ms
+	asrChunkBytes = asrSampleRate * 2 * 60 / 1000
+
+	// asrTrailingSilence 音频结束后补充的静音，帮助ASR判断句尾
+	asrTrailingSilence = time.Second
+	// asrIdleWait 没有新的识别结果超过该时间视为识别完成
+	asrIdleWait = 1500 * time.Millisecond
+	// asrSilentWait 音频送完后超过该时间仍没有任何识别结果，视为没有语音
+	asrSilentWait = 3 * time.Second
+	// asrTimeout 单次识别的最长等待时间
+	asrTimeout = 30 * time.Second
+)
+
+// SpeechRequest 语音合成请求
+type SpeechRequest struct {
+	Model          string `json:"model"`
+	Input          string `json:"input"           binding:"required" example:"你好，我是小智"`
+	Voice          string `json:"voice"           example:"zh-CN-XiaoxiaoNeural"`
+	ResponseFormat string `json:"response_format" example:"mp3"`
+	User           string `json:"user"`
+}
+
+// TranscriptionResponse 语音识别结果
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+type ttsConfigGetter interface {
+	Config() *tts.Config
+}
+
+// @Summary 语音合成
+// @Description 使用资源池中的TTS合成语音，response_format支持mp3(需TTS输出mp3)、wav、pcm(24k 16位单声道)
+// @Tags OpenAI
+// @Accept json
+// @Produce octet-stream
+// @Param request body SpeechRequest true "合成请求"
+// @Success 200 {file} binary
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /v1/audio/speech [post]
+func (s *DefaultChatAPIService) handleSpeech(c *gin.Context) {
+	var req SpeechRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "请求格式错误: "+err.Error())
+		return
+	}
+	format := strings.ToLower(req.ResponseFormat)
+	if format != "" && format != "mp3" && format != "wav" && format != "pcm" {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "不支持的音频格式: "+req.ResponseFormat)
+		return
+	}
+	subject := usageSubject(req.User)
+	if !checkQuota(c, subject) {
+		return
+	}
+
+	pm, ok := s.poolManager(c)
+	if !ok {
+		return
+	}
+	ttsProvider, err := pm.GetTTS()
+	if err != nil {
+		abortWithError(c, http.StatusServiceUnavailable, "server_error", err.Error())
+		return
+	}
+	defer pm.ReturnProviderSet(&pool.ProviderSet{TTS: ttsProvider})
+
+	if req.Voice != "" {
+		// 池中的TTS会被设备连接复用，合成后恢复原来的音色
+		if getter, ok := ttsProvider.(ttsConfigGetter); ok {
+			defer ttsProvider.SetVoice(getter.Config().Voice)
+		}
+		if err := ttsProvider.SetVoice(req.Voice); err != nil {
+			abortWithError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("设置音色%s失败: %v", req.Voice, err))
+			return
+		}
+	}
+
+	audioFile, err := ttsProvider.ToTTS(req.Input)
+	if err != nil {
+		abortWithError(c, http.StatusBadGateway, "server_error", "语音合成失败: "+err.Error())
+		return
+	}
+	usage.Default().Record(subject, usage.MetricTTSChars, float64(utf8.RuneCountInString(req.Input)))
+	if s.config.DeleteAudio {
+		defer os.Remove(audioFile)
+	}
+
+	isMP3 := strings.HasSuffix(strings.ToLower(audioFile), ".mp3")
+	switch {
+	case format == "" && isMP3, format == "mp3" && isMP3:
+		c.File(audioFile)
+	case format == "mp3":
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "当前TTS不输出mp3，请使用wav或pcm")
+	default:
+		params := utils.AudioParams{Format: "pcm", SampleRate: speechSampleRate, Channels: 1}
+		frames, _, err := utils.AudioToFrames(audioFile, params)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "server_error", "音频转换失败: "+err.Error())
+			return
+		}
+		pcmData := bytes.Join(frames, nil)
+		if format == "pcm" {
+			c.Data(http.StatusOK, "audio/pcm", pcmData)
+			return
+		}
+		c.Data(http.StatusOK, "audio/wav", utils.WavBytes(pcmData, speechSampleRate))
+	}
+}
+
+// @Summary 语音识别
+// @Description 使用资源池中的ASR识别上传的wav或mp3音频，response_format为text时直接返回文本
+// @Tags OpenAI
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "wav或mp3音频"
+// @Param response_format formData string false "json或text"
+// @Param user formData string false "调用方标识，用于用量统计"
+// @Success 200 {object} TranscriptionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /v1/audio/transcriptions [post]
+func (s *DefaultChatAPIService) handleTranscriptions(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "缺少音频文件")
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".wav" && ext != ".mp3" {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "仅支持wav和mp3格式")
+		return
+	}
+	subject := usageSubject(c.PostForm("user"))
+	if !checkQuota(c, subject) {
+		return
+	}
+
+	tmpDir := filepath.Join("tmp", "api")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		abortWithError(c, http.StatusInternalServerError, "server_error", "创建临时目录失败")
+		return
+	}
+	tmpFile := filepath.Join(tmpDir, uuid.New().String()+ext)
+	if err := c.SaveUploadedFile(file, tmpFile); err != nil {
+		abortWithError(c, http.StatusInternalServerError, "server_error", "保存音频失败")
+		return
+	}
+	defer os.Remove(tmpFile)
+
+	params := utils.AudioParams{Format: "pcm", SampleRate: asrSampleRate, Channels: 1}
+	frames, _, err := utils.AudioToFrames(tmpFile, params)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "音频解析失败: "+err.Error())
+		return
+	}
+
+	pm, ok := s.poolManager(c)
+	if !ok {
+		return
+	}
+	asrProvider, err := pm.GetASR()
+	if err != nil {
+		abortWithError(c, http.StatusServiceUnavailable, "server_error", err.Error())
+		return
+	}
+	defer pm.ReturnProviderSet(&pool.ProviderSet{ASR: asrProvider})
+
+	pcmData := bytes.Join(frames, nil)
+	text, err := transcribe(asrProvider, pcmData)
+	if err != nil {
+		abortWithError(c, http.StatusBadGateway, "server_error", "语音识别失败: "+err.Error())
+		return
+	}
+	s.logger.Info("OpenAI接口识别结果: %s", text)
+	usage.Default().Record(subject, usage.MetricASRSeconds, float64(len(pcmData))/float64(2*asrSampleRate))
+
+	if c.PostForm("response_format") == "text" {
+		c.String(http.StatusOK, text)
+		return
+	}
+	c.JSON(http.StatusOK, TranscriptionResponse{Text: text})
+}
+
+// transcribe 以流式方式把PCM送入ASR，收集所有分句的最终结果
+func transcribe(asrProvider providers.ASRProvider, pcmData []byte) (string, error) {
+	listener := newTranscriptListener()
+	asrProvider.SetListener(listener)
+	defer asrProvider.SetListener(nil)
+	asrProvider.ResetStartListenTime()
+
+	silence := make([]byte, asrSampleRate*2*int(asrTrailingSilence/time.Millisecond)/1000)
+	pcmData = append(pcmData, silence...)
+	for start := 0; start < len(pcmData); start += asrChunkBytes {
+		end := start + asrChunkBytes
+		if end > len(pcmData) {
+			end = len(pcmData)
+		}
+		if err := asrProvider.AddAudio(pcmData[start:end]); err != nil {
+			return "", err
+		}
+	}
+	listener.audioSent()
+	return listener.wait(asrIdleWait, asrSilentWait, asrTimeout), nil
+}
+
+// transcriptListener 收集ASR回调的识别结果
+type transcriptListener struct {
+	mu      sync.Mutex
+	finals  []string
+	partial string
+	updated time.Time
+}
+
+func newTranscriptListener() *transcriptListener {
+	return &transcriptListener{updated: time.Now()}
+}
+
+// OnAsrResult 记录分句的最终结果，返回false继续识别后续音频
+func (l *transcriptListener) OnAsrResult(result string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if result != "" {
+		l.finals = append(l.finals, result)
+	}
+	l.partial = ""
+	l.updated = time.Now()
+	return false
+}
+
+// OnAsrPartialResult 记录当前分句的中间结果，超时未确定时作为结果返回
+func (l *transcriptListener) OnAsrPartialResult(result string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partial = result
+	l.updated = time.Now()
+}
+
+// audioSent 音频全部送出后调用，没有识别结果时从此刻开始计算等待时间
+func (l *transcriptListener) audioSent() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.updated = time.Now()
+}
+
+// wait 等待识别结果稳定，有结果后超过idle没有更新、没有结果超过silent或总时长超过timeout时返回
+func (l *transcriptListener) wait(idle, silent, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		quiet := silent
+		if len(l.finals) > 0 || l.partial != "" {
+			quiet = idle
+		}
+		done := time.Since(l.updated) > quiet
+		l.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	texts := append([]string{}, l.finals...)
+	if l.partial != "" {
+		texts = append(texts, l.partial)
+	}
+	return strings.Join(texts, "")
+}
@@ -0,0 +1,453 @@
+package chatapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/core/kb"
+	coremcp "xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// defaultModel 不指定角色时使用的model名称
+	defaultModel = "default"
+
+	// toolCallPrefix 部分模型以文本形式输出工具调用
+	toolCallPrefix = "<tool_call>"
+)
+
+// deviceOnlyTools 需要设备连接才能执行的本地工具，HTTP接口不提供给LLM
+var deviceOnlyTools = []string{"exit", "change_role", "change_voice", "play_music"}
+
+// chatSession 一次对话请求的上下文
+type chatSession struct {
+	id       string
+	subject  string // 用量统计主体
+	model    string
+	llm      providers.LLMProvider
+	mcp      *coremcp.Manager
+	role     *models.Role
+	tools    []openai.Tool
+	messages []types.Message
+}
+
+// @Summary 对话补全
+// @Description OpenAI兼容的对话接口，model为角色名时使用该角色的提示词、温度、工具和知识库，支持stream
+// @Tags OpenAI
+// @Accept json
+// @Produce json
+// @Param request body openai.ChatCompletionRequest true "对话请求"
+// @Success 200 {object} openai.ChatCompletionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /v1/chat/completions [post]
+func (s *DefaultChatAPIService) handleChatCompletions(c *gin.Context) {
+	var req openai.ChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "请求格式错误: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		abortWithError(c, http.StatusBadRequest, "invalid_request_error", "messages不能为空")
+		return
+	}
+
+	subject := usageSubject(req.User)
+	if !checkQuota(c, subject) {
+		return
+	}
+
+	role, err := s.resolveRole(req.Model)
+	if err != nil {
+		abortWithError(c, http.StatusInternalServerError, "server_error", "读取角色失败: "+err.Error())
+		return
+	}
+	pm, ok := s.poolManager(c)
+	if !ok {
+		return
+	}
+	llmProvider, err := pm.GetLLM()
+	if err != nil {
+		abortWithError(c, http.StatusServiceUnavailable, "server_error", err.Error())
+		return
+	}
+	set := &pool.ProviderSet{LLM: llmProvider}
+	defer pm.ReturnProviderSet(set)
+
+	session := &chatSession{
+		id:       "chatcmpl-" + uuid.New().String(),
+		subject:  subject,
+		model:    req.Model,
+		llm:      llmProvider,
+		role:     role,
+		messages: s.buildMessages(role, req.Messages),
+	}
+	if session.model == "" {
+		session.model = defaultModel
+	}
+	// MCP管理器不可用时仍可对话，只是没有工具
+	if mcpManager, err := pm.GetMCP(); err == nil {
+		set.MCP = mcpManager
+		session.mcp = mcpManager
+		session.tools = s.filterTools(role, mcpManager.ServerTools())
+	} else {
+		s.logger.Warn("OpenAI接口获取MCP管理器失败，本次对话不使用工具: %v", err)
+	}
+
+	ctx := s.requestContext(c.Request.Context(), role, req)
+	if req.Stream {
+		s.streamChat(c, ctx, session)
+		return
+	}
+
+	content, err := s.runChat(ctx, session, nil)
+	if err != nil {
+		abortWithError(c, http.StatusBadGateway, "server_error", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, openai.ChatCompletionResponse{
+		ID:      session.id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   session.model,
+		Choices: []openai.ChatCompletionChoice{{
+			Index:        0,
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	})
+}
+
+// streamChat 以SSE返回chat.completion.chunk，工具调用在服务端完成，只推送最终回复的文本
+func (s *DefaultChatAPIService) streamChat(c *gin.Context, ctx context.Context, session *chatSession) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	created := time.Now().Unix()
+	send := func(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) {
+		chunk := openai.ChatCompletionStreamResponse{
+			ID:      session.id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   session.model,
+			Choices: []openai.ChatCompletionStreamChoice{{
+				Index:        0,
+				Delta:        delta,
+				FinishReason: finishReason,
+			}},
+		}
+		writeEvent(c, chunk)
+	}
+
+	send(openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant}, "")
+	_, err := s.runChat(ctx, session, func(content string) {
+		send(openai.ChatCompletionStreamChoiceDelta{Content: content}, "")
+	})
+	if err != nil {
+		// 响应头已发出，按OpenAI流式接口的方式在数据中返回错误
+		writeEvent(c, ErrorResponse{Error: ErrorDetail{Message: err.Error(), Type: "server_error"}})
+	} else {
+		send(openai.ChatCompletionStreamChoiceDelta{}, openai.FinishReasonStop)
+	}
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
+
+func writeEvent(c *gin.Context, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+	c.Writer.Flush()
+}
+
+// runChat 调用LLM并在服务端执行工具，直到LLM给出最终回复，emit不为空时逐段推送回复文本
+func (s *DefaultChatAPIService) runChat(ctx context.Context, session *chatSession, emit func(string)) (string, error) {
+	maxRounds := s.config.OpenAIAPI.MaxToolRounds
+	if maxRounds <= 0 {
+		maxRounds = 5
+	}
+
+	for round := 0; ; round++ {
+		tools := session.tools
+		if round >= maxRounds {
+			// 超过工具调用轮数后不再提供工具，要求LLM直接回复
+			tools = nil
+		}
+		content, toolCalls, err := s.generate(ctx, session, tools, emit)
+		if err != nil {
+			return "", err
+		}
+		if len(toolCalls) == 0 {
+			return content, nil
+		}
+
+		session.messages = append(session.messages, types.Message{Role: "assistant", ToolCalls: toolCalls})
+		for i := range toolCalls {
+			result := s.executeTool(ctx, session, &toolCalls[i])
+			session.messages = append(session.messages, types.Message{Role: "tool", ToolCallID: toolCalls[i].ID, Content: result})
+		}
+	}
+}
+
+// recordLLMUsage 按输入消息和输出文本估算并记录LLM token
+func recordLLMUsage(session *chatSession, output string) {
+	tokens := usage.EstimateTokens(output)
+	for _, msg := range session.messages {
+		tokens += usage.EstimateTokens(msg.Content)
+	}
+	usage.Default().Record(session.subject, usage.MetricLLMTokens, float64(tokens))
+}
+
+// generate 调用一次LLM，返回回复文本或本轮的所有工具调用
+func (s *DefaultChatAPIService) generate(ctx context.Context, session *chatSession, tools []openai.Tool, emit func(string)) (string, []types.ToolCall, error) {
+	responses, err := session.llm.ResponseWithFunctions(ctx, session.id, session.messages, tools)
+	if err != nil {
+		return "", nil, fmt.Errorf("LLM生成回复失败: %v", err)
+	}
+
+	var content strings.Builder
+	emitted := 0
+	toolCallFlag := false
+	var toolCalls []types.ToolCall
+	for response := range responses {
+		if response.Error != "" {
+			return "", nil, fmt.Errorf("LLM响应错误: %s", response.Error)
+		}
+		if len(response.ToolCalls) > 0 {
+			toolCallFlag = true
+			toolCalls = mergeToolCalls(toolCalls, response.ToolCalls)
+		}
+		if response.Content == "" {
+			continue
+		}
+		content.WriteString(response.Content)
+		text := content.String()
+		if !toolCallFlag && strings.HasPrefix(strings.TrimSpace(text), toolCallPrefix) {
+			toolCallFlag = true
+		}
+		// 文本可能是<tool_call>的开头，确认不是工具调用后再推送
+		if emit != nil && !toolCallFlag && !strings.HasPrefix(toolCallPrefix, strings.TrimSpace(text)) {
+			emit(text[emitted:])
+			emitted = len(text)
+		}
+	}
+
+	text := content.String()
+	output := text
+	for _, toolCall := range toolCalls {
+		output += toolCall.Function.Arguments
+	}
+	recordLLMUsage(session, output)
+	if !toolCallFlag {
+		if emit != nil && emitted < len(text) {
+			emit(text[emitted:])
+		}
+		return text, nil, nil
+	}
+
+	if len(toolCalls) == 0 {
+		// 文本形式的工具调用
+		parsed := utils.Extract_json_from_string(text)
+		if parsed == nil {
+			return "", nil, fmt.Errorf("工具调用解析失败: %s", text)
+		}
+		toolCall := types.ToolCall{ID: uuid.New().String(), Type: "function"}
+		toolCall.Function.Name, _ = parsed["name"].(string)
+		arguments, _ := json.Marshal(parsed["arguments"])
+		toolCall.Function.Arguments = string(arguments)
+		toolCalls = append(toolCalls, toolCall)
+	}
+	for i := range toolCalls {
+		if toolCalls[i].ID == "" {
+			toolCalls[i].ID = uuid.New().String()
+		}
+	}
+	return "", toolCalls, nil
+}
+
+// mergeToolCalls 按Index合并流式返回的工具调用片段，同一轮可能有多个并行的工具调用
+func mergeToolCalls(toolCalls []types.ToolCall, deltas []types.ToolCall) []types.ToolCall {
+	for _, delta := range deltas {
+		pos := -1
+		for i := range toolCalls {
+			if toolCalls[i].Index == delta.Index {
+				pos = i
+				break
+			}
+		}
+		if pos < 0 {
+			toolCalls = append(toolCalls, types.ToolCall{Type: "function", Index: delta.Index})
+			pos = len(toolCalls) - 1
+		}
+		call := &toolCalls[pos]
+		if delta.ID != "" {
+			call.ID = delta.ID
+		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
+	}
+	return toolCalls
+}
+
+// executeTool 执行工具调用，返回交给LLM的结果文本
+func (s *DefaultChatAPIService) executeTool(ctx context.Context, session *chatSession, toolCall *types.ToolCall) string {
+	name := toolCall.Function.Name
+	if session.mcp == nil || !hasTool(session.tools, name) {
+		s.logger.Warn("OpenAI接口拒绝调用未提供的工具: %s", name)
+		return "当前不能使用该工具"
+	}
+
+	arguments := make(map[string]interface{})
+	if toolCall.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &arguments); err != nil {
+			s.logger.Error("工具调用参数解析失败: %v", err)
+		}
+	}
+	s.logger.Info("OpenAI接口调用工具: %s, 参数: %v", name, arguments)
+
+	result, err := session.mcp.ExecuteServerTool(ctx, name, arguments)
+	if err != nil {
+		s.logger.Error("OpenAI接口工具调用失败: %v", err)
+		return "工具调用失败"
+	}
+	return toolResultText(result)
+}
+
+// toolResultText 工具结果转换为文本，需要设备处理的结果只保留文字说明
+func toolResultText(result interface{}) string {
+	action, ok := result.(types.ActionResponse)
+	if !ok {
+		return fmt.Sprintf("%v", result)
+	}
+	switch value := action.Result.(type) {
+	case string:
+		return value
+	case types.ActionResponseCall:
+		if toolResult, ok := value.Args.(coremcp.ToolResult); ok {
+			if text := toolResult.Text(); text != "" {
+				return text
+			}
+			return "工具返回了图片或音频，当前接口无法展示"
+		}
+		return "该工具需要在设备上使用"
+	}
+	if action.Response != nil {
+		return fmt.Sprintf("%v", action.Response)
+	}
+	return fmt.Sprintf("%v", action.Result)
+}
+
+// buildMessages 角色提示词作为第一条系统消息，客户端传入的系统消息追加在后面
+func (s *DefaultChatAPIService) buildMessages(role *models.Role, input []openai.ChatCompletionMessage) []types.Message {
+	prompt := s.config.DefaultPrompt
+	if role != nil && role.Prompt != "" {
+		prompt = role.Prompt
+	}
+
+	messages := make([]types.Message, 0, len(input)+1)
+	if prompt != "" {
+		messages = append(messages, types.Message{Role: "system", Content: prompt})
+	}
+	for _, msg := range input {
+		message := types.Message{
+			Role:       msg.Role,
+			Content:    messageText(msg),
+			ToolCallID: msg.ToolCallID,
+		}
+		for i, call := range msg.ToolCalls {
+			message.ToolCalls = append(message.ToolCalls, types.ToolCall{
+				ID:    call.ID,
+				Type:  string(call.Type),
+				Index: i,
+				Function: types.FunctionCall{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				},
+			})
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// messageText 多段内容只保留文本部分
+func messageText(msg openai.ChatCompletionMessage) string {
+	if len(msg.MultiContent) == 0 {
+		return msg.Content
+	}
+	texts := make([]string, 0, len(msg.MultiContent))
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// filterTools 去掉需要设备的工具，再按角色允许的工具过滤
+func (s *DefaultChatAPIService) filterTools(role *models.Role, tools []openai.Tool) []openai.Tool {
+	filtered := make([]openai.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		name := strings.TrimPrefix(tool.Function.Name, "local_")
+		if utils.IsInArray(name, deviceOnlyTools) {
+			continue
+		}
+		if role != nil && !role.AllowsTool(tool.Function.Name) {
+			continue
+		}
+		filtered = append(filtered, tool)
+	}
+	return filtered
+}
+
+// requestContext 请求指定的温度优先于角色温度，知识库工具只检索角色绑定的集合
+func (s *DefaultChatAPIService) requestContext(ctx context.Context, role *models.Role, req openai.ChatCompletionRequest) context.Context {
+	roleName := ""
+	var roleCollections []string
+	if role != nil {
+		roleName = role.Name
+		roleCollections = role.Collections()
+		if role.Temperature != nil {
+			ctx = llm.WithTemperature(ctx, *role.Temperature)
+		}
+	}
+	if req.Temperature > 0 {
+		ctx = llm.WithTemperature(ctx, float64(req.Temperature))
+	}
+	collections := kb.BoundCollections(&s.config.KnowledgeBase, "", roleName, roleCollections)
+	return kb.WithCollections(ctx, collections)
+}
+
+func hasTool(tools []openai.Tool, name string) bool {
+	for _, tool := range tools {
+		if tool.Function != nil && tool.Function.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package chatapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse 错误返回结构，与OpenAI接口的错误格式一致，方便现有SDK解析
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail 错误详情
+type ErrorDetail struct {
+	Message string `json:"message" example:"无效的API token"`
+	Type    string `json:"type"    example:"invalid_request_error"`
+}
+
+// DefaultChatAPIService OpenAI兼容的对话和语音接口，复用设备连接使用的资源池、角色和MCP工具
+type DefaultChatAPIService struct {
+	config *configs.Config
+	logger *utils.Logger
+}
+
+// NewDefaultChatAPIService 构造函数
+func NewDefaultChatAPIService(config *configs.Config, logger *utils.Logger) *DefaultChatAPIService {
+	return &DefaultChatAPIService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册/v1路由，路径与OpenAI保持一致，不挂在/api下
+func (s *DefaultChatAPIService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	if !s.config.OpenAIAPI.Enabled {
+		s.logger.Info("OpenAI兼容接口未启用")
+		return nil
+	}
+	if len(s.tokens()) == 0 {
+		s.logger.Warn("OpenAI兼容接口未配置token，跳过")
+		return nil
+	}
+
+	group := engine.Group("/v1", s.tokenAuth)
+	group.GET("/models", s.handleModels)
+	group.POST("/chat/completions", s.handleChatCompletions)
+	group.POST("/audio/speech", s.handleSpeech)
+	group.POST("/audio/transcriptions", s.handleTranscriptions)
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+
+	s.logger.Info("OpenAI兼容接口路由注册完成: /v1/chat/completions, /v1/audio/speech, /v1/audio/transcriptions")
+	return nil
+}
+
+// tokens 允许访问的token，未单独配置时使用server.token
+func (s *DefaultChatAPIService) tokens() []string {
+	if len(s.config.OpenAIAPI.Tokens) > 0 {
+		return s.config.OpenAIAPI.Tokens
+	}
+	if s.config.Server.Token != "" {
+		return []string{s.config.Server.Token}
+	}
+	return nil
+}
+
+// tokenAuth 校验Bearer token，浏览器跨域预检直接放行
+func (s *DefaultChatAPIService) tokenAuth(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	if c.Request.Method == http.MethodOptions {
+		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	for _, allowed := range s.tokens() {
+		if auth.TokenEqual(token, allowed) {
+			c.Next()
+			return
+		}
+	}
+	abortWithError(c, http.StatusUnauthorized, "invalid_api_key", "无效的API token")
+}
+
+// @Summary 模型列表
+// @Description 列出可用的model，default表示默认角色，其余为角色名
+// @Tags OpenAI
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} ErrorResponse
+// @Router /v1/models [get]
+func (s *DefaultChatAPIService) handleModels(c *gin.Context) {
+	names := []string{defaultModel}
+	if roleDB := database.GetRoleDB(); roleDB != nil {
+		if roles, err := roleDB.ListRoles(); err == nil {
+			for _, role := range roles {
+				names = append(names, role.Name)
+			}
+		}
+	}
+
+	data := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		data = append(data, gin.H{"id": name, "object": "model", "owned_by": "xiaozhi"})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// resolveRole model为角色名时使用该角色，否则使用配置的默认角色，都没有时返回nil表示使用default_prompt
+func (s *DefaultChatAPIService) resolveRole(model string) (*models.Role, error) {
+	roleDB := database.GetRoleDB()
+	if roleDB == nil {
+		return nil, nil
+	}
+	for _, name := range []string{model, s.config.OpenAIAPI.DefaultRole} {
+		if name == "" || name == defaultModel {
+			continue
+		}
+		role, err := roleDB.GetRole(name)
+		if err == nil {
+			return role, nil
+		}
+		if !errors.Is(err, database.ErrRoleNotFound) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// usageSubject 用量统计的主体，按请求中的user区分调用方
+func usageSubject(user string) string {
+	if user == "" {
+		return "api"
+	}
+	return "api:" + user
+}
+
+// checkQuota 检查调用方的用量配额，超出时返回429
+func checkQuota(c *gin.Context, subject string) bool {
+	meter := usage.Default()
+	if err := meter.Check(subject); err != nil {
+		abortWithError(c, http.StatusTooManyRequests, "insufficient_quota", meter.OverQuotaMessage())
+		return false
+	}
+	return true
+}
+
+// poolManager 全局资源池，传输层启动后才可用
+func (s *DefaultChatAPIService) poolManager(c *gin.Context) (*pool.PoolManager, bool) {
+	pm := pool.Default()
+	if pm == nil {
+		abortWithError(c, http.StatusServiceUnavailable, "server_error", "资源池尚未初始化")
+		return nil, false
+	}
+	return pm, true
+}
+
+func abortWithError(c *gin.Context, status int, errType, message string) {
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: ErrorDetail{Message: message, Type: errType}})
+}
@@ -0,0 +1,131 @@
+package configs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const commandUsage = `用法: xiaozhi-server [--config 文件] [--set key.path=value ...] config <命令> [参数]
+
+命令:
+  validate      检查未知配置项、密钥文件和所选模块的凭证，有错误时返回非0
+  show          输出合并后的配置，密钥以***显示
+  db-set <文件>  把YAML文件保存为数据库中的配置，优先级高于配置文件
+  db-clear      清除数据库中的配置
+
+配置优先级: 默认值 < 配置文件 < 数据库 < XIAOZHI_*环境变量 < --set
+`
+
+// secretKeys 输出配置时隐藏的键
+var secretKeys = []string{"api_key", "access_token", "token", "tokens", "private_key", "personal_access_token", "password", "credential", "dsn", "secret"}
+
+// RunCommand 执行config子命令，args不包含"config"本身，dbi为nil时不使用数据库中的配置
+func RunCommand(dbi ConfigDBInterface, opts *LoadOptions, args []string) error {
+	if len(args) == 0 {
+		fmt.Print(commandUsage)
+		return fmt.Errorf("缺少子命令")
+	}
+
+	switch args[0] {
+	case "validate":
+		issues, err := ValidateConfig(dbi, opts)
+		if err != nil {
+			return err
+		}
+		errCount := 0
+		for _, issue := range issues {
+			fmt.Println(issue)
+			if issue.Level == IssueError {
+				errCount++
+			}
+		}
+		if errCount > 0 {
+			return fmt.Errorf("配置有%d个错误", errCount)
+		}
+		fmt.Printf("配置检查通过，%d个警告\n", len(issues))
+		return nil
+
+	case "show":
+		merged, path, err := loadLayers(dbi, opts)
+		if err != nil {
+			return err
+		}
+		if issues := resolveSecretFiles(merged); len(issues) > 0 {
+			return fmt.Errorf("%s", issues[0])
+		}
+		maskSecrets(merged)
+		data, err := yaml.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("# 配置文件: %s\n%s", path, data)
+		return nil
+
+	case "db-set":
+		if dbi == nil {
+			return fmt.Errorf("数据库未连接")
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("缺少YAML文件")
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		if _, err := parseLayer(data); err != nil {
+			return fmt.Errorf("解析%s失败: %w", args[1], err)
+		}
+		return saveDBConfig(dbi, string(data))
+
+	case "db-clear":
+		if dbi == nil {
+			return fmt.Errorf("数据库未连接")
+		}
+		return saveDBConfig(dbi, "")
+
+	default:
+		fmt.Print(commandUsage)
+		return fmt.Errorf("未知命令: %s", args[0])
+	}
+}
+
+// saveDBConfig 保存数据库中的配置，没有记录时先创建
+func saveDBConfig(dbi ConfigDBInterface, cfgStr string) error {
+	if err := dbi.InitServerConfig(cfgStr); err != nil {
+		return err
+	}
+	return dbi.UpdateServerConfig(cfgStr)
+}
+
+// maskSecrets 把密钥替换为***
+func maskSecrets(value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if isSecretKey(key) && item != nil {
+				if s, ok := stringValue(item); !ok || s != "" {
+					v[key] = "***"
+				}
+				continue
+			}
+			maskSecrets(item)
+		}
+	case []interface{}:
+		for _, item := range v {
+			maskSecrets(item)
+		}
+	}
+}
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, secret := range secretKeys {
+		if key == secret || strings.HasSuffix(key, "_"+secret) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,9 +1,6 @@
 package configs
 
 import (
-	"fmt"
-	"os"
-
 	"gopkg.in/yaml.v3"
 )
 
@@ -36,13 +33,15 @@ type Config struct {
 			IP      string `yaml:"ip" json:"ip"`
 			Port    int    `yaml:"port" json:"port"`
 		} `yaml:"websocket" json:"websocket"`
+		WebRTC WebRTCConfig `yaml:"webrtc" json:"webrtc"`
 	} `yaml:"transport" json:"transport"`
 
 	Log struct {
-		LogFormat string `yaml:"log_format" json:"log_format"`
-		LogLevel  string `yaml:"log_level" json:"log_level"`
-		LogDir    string `yaml:"log_dir" json:"log_dir"`
-		LogFile   string `yaml:"log_file" json:"log_file"`
+		LogFormat    string            `yaml:"log_format" json:"log_format"`
+		LogLevel     string            `yaml:"log_level" json:"log_level"`
+		LogDir       string            `yaml:"log_dir" json:"log_dir"`
+		LogFile      string            `yaml:"log_file" json:"log_file"`
+		ModuleLevels map[string]string `yaml:"module_levels" json:"module_levels"` // 按模块覆盖日志级别
 	} `yaml:"log" json:"log"`
 
 	Web struct {
@@ -59,6 +58,7 @@ type Config struct {
 	DeleteAudio      bool     `yaml:"delete_audio"       json:"delete_audio"`
 	QuickReply       bool     `yaml:"quick_reply"        json:"quick_reply"`
 	QuickReplyWords  []string `yaml:"quick_reply_words"  json:"quick_reply_words"`
+	BargeInChars     int      `yaml:"barge_in_chars"     json:"barge_in_chars"` // realtime模式下中间识别结果达到该字数时打断播报，0表示等待最终结果
 	UsePrivateConfig bool     `yaml:"use_private_config" json:"use_private_config"`
 	LocalMCPFun      []string `yaml:"local_mcp_fun"      json:"local_mcp_fun"` // 本地MCP函数映射
 
@@ -72,6 +72,10 @@ type Config struct {
 	LLM   map[string]LLMConfig  `yaml:"LLM"   json:"LLM"`
 	VLLLM map[string]VLLMConfig `yaml:"VLLLM" json:"VLLLM"`
 
+	Embedding map[string]EmbeddingConfig `yaml:"Embedding" json:"Embedding"`
+	ImageGen  map[string]ImageGenConfig  `yaml:"ImageGen"  json:"ImageGen"`
+	OCR       map[string]OCRConfig       `yaml:"OCR"       json:"OCR"`
+
 	CMDExit []string `yaml:"CMD_exit" json:"CMD_exit"`
 
 	// 连通性检查配置
@@ -79,6 +83,36 @@ type Config struct {
 
 	// 音乐服务
 	MusicService MusicService `yaml:"music_service" json:"music_service"`
+
+	// 文档知识库
+	KnowledgeBase KnowledgeBaseConfig `yaml:"knowledge_base" json:"knowledge_base"`
+
+	// 语音识别热词
+	ASRHotwords ASRHotwordsConfig `yaml:"asr_hotwords" json:"asr_hotwords"`
+
+	// 对外提供的MCP服务
+	MCPServer MCPServerConfig `yaml:"mcp_server" json:"mcp_server"`
+
+	// OpenAI兼容的对话和语音接口
+	OpenAIAPI OpenAIAPIConfig `yaml:"openai_api" json:"openai_api"`
+
+	// 链路追踪
+	Tracing TracingConfig `yaml:"tracing" json:"tracing"`
+
+	// 用量统计和配额
+	Usage UsageConfig `yaml:"usage" json:"usage"`
+
+	// 生成图片的保存和下发
+	Images ImagesConfig `yaml:"images" json:"images"`
+
+	// 对话中的图片上下文
+	VisionContext VisionContextConfig `yaml:"vision_context" json:"vision_context"`
+
+	// Vision接口的多模型路由
+	VisionRouting VisionRoutingConfig `yaml:"vision_routing" json:"vision_routing"`
+
+	// 配置、认证、角色等数据的存储
+	Database DatabaseConfig `yaml:"database" json:"database"`
 }
 
 type PoolConfig struct {
@@ -107,14 +141,21 @@ type VoiceInfo struct {
 
 // TTSConfig TTS配置结构
 type TTSConfig struct {
-	Type            string      `yaml:"type"             json:"type"`             // TTS类型
-	Voice           string      `yaml:"voice"            json:"voice"`            // 语音名称
-	Format          string      `yaml:"format"           json:"format"`           // 输出格式
-	OutputDir       string      `yaml:"output_dir"       json:"output_dir"`       // 输出目录
-	AppID           string      `yaml:"appid"            json:"appid"`            // 应用ID
-	Token           string      `yaml:"token"            json:"token"`            // API密钥
-	Cluster         string      `yaml:"cluster"          json:"cluster"`          // 集群信息
-	SupportedVoices []VoiceInfo `yaml:"supported_voices" json:"supported_voices"` // 支持的语音列表
+	Type            string                 `yaml:"type"             json:"type"`             // TTS类型
+	Voice           string                 `yaml:"voice"            json:"voice"`            // 语音名称
+	Format          string                 `yaml:"format"           json:"format"`           // 输出格式
+	OutputDir       string                 `yaml:"output_dir"       json:"output_dir"`       // 输出目录
+	AppID           string                 `yaml:"appid"            json:"appid"`            // 应用ID
+	Token           string                 `yaml:"token"            json:"token"`            // API密钥
+	Cluster         string                 `yaml:"cluster"          json:"cluster"`          // 集群信息
+	SupportedVoices []VoiceInfo            `yaml:"supported_voices" json:"supported_voices"` // 支持的语音列表
+	URL             string                 `yaml:"url"              json:"url"`              // http：合成接口地址
+	Method          string                 `yaml:"method"           json:"method"`           // http：POST(JSON)、FORM(POST表单)或GET，默认POST
+	TextField       string                 `yaml:"text_field"       json:"text_field"`       // http：文本的字段名，默认text
+	VoiceField      string                 `yaml:"voice_field"      json:"voice_field"`      // http：音色的字段名，默认voice
+	SampleRate      int                    `yaml:"sample_rate"      json:"sample_rate"`      // format为pcm时返回音频的采样率
+	Timeout         int                    `yaml:"timeout"          json:"timeout"`          // 超时(秒)，默认60
+	Extra           map[string]interface{} `yaml:",inline"          json:"extra"`            // http：额外参数，原样放入请求
 }
 
 // LLMConfig LLM配置结构
@@ -166,11 +207,173 @@ type VLLMConfig struct {
 	Extra       map[string]interface{} `yaml:",inline"     json:"extra"`       // 额外配置
 }
 
+// EmbeddingConfig 向量模型配置结构
+type EmbeddingConfig struct {
+	Type       string                 `yaml:"type"       json:"type"`       // 提供者类型：openai、ollama、local
+	ModelName  string                 `yaml:"model_name" json:"model_name"` // 模型名称
+	BaseURL    string                 `yaml:"url"        json:"url"`        // API地址
+	APIKey     string                 `yaml:"api_key"    json:"api_key"`    // API密钥
+	Dimensions int                    `yaml:"dimensions" json:"dimensions"` // 向量维度，0表示使用模型默认值
+	Extra      map[string]interface{} `yaml:",inline"    json:"extra"`      // 额外配置
+}
+
+// ImageGenConfig 图片生成配置结构
+type ImageGenConfig struct {
+	Type           string                 `yaml:"type"            json:"type"`            // 提供者类型：openai、sdwebui
+	ModelName      string                 `yaml:"model_name"      json:"model_name"`      // 模型名称
+	BaseURL        string                 `yaml:"url"             json:"url"`             // API地址
+	APIKey         string                 `yaml:"api_key"         json:"api_key"`         // API密钥，sdwebui为user:password时使用Basic认证
+	Sizes          []string               `yaml:"sizes"           json:"sizes"`           // 支持的尺寸，如1024x1024，为空时按模型选择
+	NegativePrompt string                 `yaml:"negative_prompt" json:"negative_prompt"` // 反向提示词
+	Steps          int                    `yaml:"steps"           json:"steps"`           // 采样步数
+	Timeout        int                    `yaml:"timeout"         json:"timeout"`         // 超时(秒)，默认120
+	Extra          map[string]interface{} `yaml:",inline"         json:"extra"`           // 额外参数，原样传给接口
+}
+
+// OCRConfig 文档模式的文字识别配置结构
+type OCRConfig struct {
+	Type       string                 `yaml:"type"        json:"type"`        // 提供者类型：openai、http
+	ModelName  string                 `yaml:"model_name"  json:"model_name"`  // 模型名称，如qwen-vl-ocr
+	BaseURL    string                 `yaml:"url"         json:"url"`         // API地址
+	APIKey     string                 `yaml:"api_key"     json:"api_key"`     // API密钥
+	Prompt     string                 `yaml:"prompt"      json:"prompt"`      // openai：识别文字的提示词
+	ImageField string                 `yaml:"image_field" json:"image_field"` // http：请求中base64图片的字段名，默认image
+	TextPath   string                 `yaml:"text_path"   json:"text_path"`   // http：响应中文字的路径，如data.text，默认text
+	Timeout    int                    `yaml:"timeout"     json:"timeout"`     // 超时(秒)，默认60
+	Security   SecurityConfig         `yaml:"security"    json:"security"`    // 图片安全配置，不填时使用默认限制
+	Extra      map[string]interface{} `yaml:",inline"     json:"extra"`       // 额外参数，http类型原样放入请求
+}
+
+// ImagesConfig 生成的图片保存在本地，由Web服务提供给设备下载
+type ImagesConfig struct {
+	Dir       string `yaml:"dir"        json:"dir"`        // 保存目录，默认tmp/generated
+	PublicURL string `yaml:"public_url" json:"public_url"` // 设备访问Web服务的地址，如http://192.168.1.10:8080，为空时由web.vision推导
+	KeepHours int    `yaml:"keep_hours" json:"keep_hours"` // 保留时长(小时)，默认24
+	Format    string `yaml:"format"     json:"format"`     // 设备未说明时的图片格式：jpeg或png，默认jpeg
+	MaxWidth  int    `yaml:"max_width"  json:"max_width"`  // 设备未说明屏幕尺寸时的最大宽度，0表示不缩放
+	MaxHeight int    `yaml:"max_height" json:"max_height"` // 设备未说明屏幕尺寸时的最大高度，0表示不缩放
+}
+
+// VisionContextConfig 设备发送的图片保留在对话中，后续追问由VLLLM结合最近的图片回答
+type VisionContextConfig struct {
+	MaxImages     int `yaml:"max_images"      json:"max_images"`      // 发给VLLLM的最近图片数，默认3
+	FollowUpTurns int `yaml:"follow_up_turns" json:"follow_up_turns"` // 发送图片后几轮内的文字消息仍由VLLLM回答，默认2，负数表示不追问
+}
+
+// VisionRoutingConfig /api/vision加载VLLLM下的所有模型，按请求、图片大小和策略选择，失败时换下一个
+type VisionRoutingConfig struct {
+	Policy        string            `yaml:"policy"         json:"policy"`         // selected：selected_module.VLLLM优先；local_first：本地模型优先，云端兜底
+	SizeRoutes    []VisionSizeRoute `yaml:"size_routes"    json:"size_routes"`    // 按图片大小选择模型，取第一个max_size不小于图片的
+	RetryInterval string            `yaml:"retry_interval" json:"retry_interval"` // 重新检查不可用模型的间隔，默认1m
+}
+
+// VisionSizeRoute 图片不超过MaxSize字节时使用Provider
+type VisionSizeRoute struct {
+	MaxSize  int    `yaml:"max_size" json:"max_size"`
+	Provider string `yaml:"provider" json:"provider"`
+}
+
 type MusicService struct {
 	EmbeddingModelName string `yaml:"embedding_model_name"`
 	MusicListNum       int    `yaml:"music_list_num"`
 }
 
+// KnowledgeBaseConfig 文档知识库配置，集合可以绑定到角色或设备
+type KnowledgeBaseConfig struct {
+	ChunkSize    int                 `yaml:"chunk_size"    json:"chunk_size"`    // 分块长度（字符数）
+	ChunkOverlap int                 `yaml:"chunk_overlap" json:"chunk_overlap"` // 相邻分块重叠的字符数
+	TopK         int                 `yaml:"top_k"         json:"top_k"`         // 默认返回的分块数
+	Collections  []string            `yaml:"collections"   json:"collections"`   // 所有设备都可检索的集合
+	Roles        map[string][]string `yaml:"roles"         json:"roles"`         // 角色名 -> 集合
+	Devices      map[string][]string `yaml:"devices"       json:"devices"`       // 设备ID -> 集合
+}
+
+// ASRHotwordsConfig 语音识别热词，与ASR类型无关，由各ASR映射到自己的参数
+// 热词可以写成"词:权重"，权重省略时使用服务默认值
+type ASRHotwordsConfig struct {
+	Words       []string            `yaml:"words"        json:"words"`        // 所有设备使用的热词，如唤醒名、产品名
+	Roles       map[string][]string `yaml:"roles"        json:"roles"`        // 角色名 -> 热词，数据库角色的hotwords也会合并
+	Devices     map[string][]string `yaml:"devices"      json:"devices"`      // 设备ID -> 热词
+	MusicTitles bool                `yaml:"music_titles" json:"music_titles"` // 合并音乐知识库中的歌名和歌手
+	MaxWords    int                 `yaml:"max_words"    json:"max_words"`    // 热词数量上限，超出时优先保留设备、角色和全局热词
+}
+
+// MCPServerConfig 对外的MCP服务，供外部智能体控制在线设备
+type MCPServerConfig struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Tokens  []string `yaml:"tokens"  json:"tokens"` // 访问令牌，为空时使用server.token
+}
+
+// WebRTCConfig WebRTC传输层，信令通过HTTP交换SDP，控制消息走DataChannel，音频走Opus轨道
+type WebRTCConfig struct {
+	Enabled    bool              `yaml:"enabled"      json:"enabled"`
+	IP         string            `yaml:"ip"           json:"ip"`
+	Port       int               `yaml:"port"         json:"port"`         // 信令HTTP端口
+	ICEServers []ICEServerConfig `yaml:"ice_servers"  json:"ice_servers"`  // STUN/TURN服务器
+	PublicIPs  []string          `yaml:"public_ips"   json:"public_ips"`   // 服务器在NAT后面时对外的IP
+	UDPPortMin uint16            `yaml:"udp_port_min" json:"udp_port_min"` // 媒体UDP端口范围，0表示随机
+	UDPPortMax uint16            `yaml:"udp_port_max" json:"udp_port_max"`
+}
+
+// ICEServerConfig STUN/TURN服务器
+type ICEServerConfig struct {
+	URLs       []string `yaml:"urls"       json:"urls"`
+	Username   string   `yaml:"username"   json:"username"`
+	Credential string   `yaml:"credential" json:"credential"`
+}
+
+// OpenAIAPIConfig OpenAI兼容接口，供网页和App直接使用对话、语音合成和识别
+type OpenAIAPIConfig struct {
+	Enabled       bool     `yaml:"enabled"         json:"enabled"`
+	Tokens        []string `yaml:"tokens"          json:"tokens"`          // 访问令牌，为空时使用server.token
+	DefaultRole   string   `yaml:"default_role"    json:"default_role"`    // model不是角色名时使用的角色，为空时使用default_prompt
+	MaxToolRounds int      `yaml:"max_tool_rounds" json:"max_tool_rounds"` // 单次请求最多连续调用工具的轮数
+}
+
+// TracingConfig OpenTelemetry链路追踪配置
+type TracingConfig struct {
+	Enabled     bool              `yaml:"enabled"      json:"enabled"`
+	Exporter    string            `yaml:"exporter"     json:"exporter"`     // otlp或stdout
+	Endpoint    string            `yaml:"endpoint"     json:"endpoint"`     // OTLP HTTP地址，如 localhost:4318
+	Insecure    bool              `yaml:"insecure"     json:"insecure"`     // OTLP不使用TLS
+	Headers     map[string]string `yaml:"headers"      json:"headers"`      // OTLP请求头，如鉴权
+	ServiceName string            `yaml:"service_name" json:"service_name"` // 为空时为xiaozhi-server-go
+	SampleRatio float64           `yaml:"sample_ratio" json:"sample_ratio"` // 采样比例，0或不填表示全部采样
+}
+
+// UsageConfig 按设备统计LLM token、TTS字数、ASR时长和识图次数，按用户级别限制每日和每月用量
+type UsageConfig struct {
+	Enabled          bool                        `yaml:"enabled"            json:"enabled"`
+	DefaultLevel     string                      `yaml:"default_level"      json:"default_level"`      // 未单独设置级别的设备，默认basic
+	Levels           map[string]UsageLevelConfig `yaml:"levels"             json:"levels"`             // basic/premium/business
+	OverQuotaMessage string                      `yaml:"over_quota_message" json:"over_quota_message"` // 超出配额时播报的内容
+	FlushInterval    int                         `yaml:"flush_interval"     json:"flush_interval"`     // 用量写入数据库的间隔(秒)
+}
+
+// UsageLevelConfig 一个用户级别的配额，计量项为llm_tokens、tts_chars、asr_seconds、vision_calls、image_calls，0或不填表示不限制
+type UsageLevelConfig struct {
+	Daily              map[string]float64 `yaml:"daily"                json:"daily"`
+	Monthly            map[string]float64 `yaml:"monthly"              json:"monthly"`
+	MaxTasks           int                `yaml:"max_tasks"            json:"max_tasks"`            // 每日异步任务数
+	MaxConcurrentTasks int                `yaml:"max_concurrent_tasks" json:"max_concurrent_tasks"` // 同时运行的异步任务数
+}
+
+// DatabaseConfig 数据库配置，多副本部署时使用mysql或postgres共享
+// 数据库在加载配置之前连接，因此只读取配置文件、环境变量和--set，不使用数据库中保存的配置
+type DatabaseConfig struct {
+	Type            string `yaml:"type"              json:"type"`              // sqlite/mysql/postgres，默认sqlite
+	DSN             string `yaml:"dsn"               json:"dsn"`               // sqlite为文件路径，默认./config.db
+	MaxOpenConns    int    `yaml:"max_open_conns"    json:"max_open_conns"`    // 0表示不限制
+	MaxIdleConns    int    `yaml:"max_idle_conns"    json:"max_idle_conns"`    // 0使用驱动默认值
+	ConnMaxLifetime int    `yaml:"conn_max_lifetime" json:"conn_max_lifetime"` // 连接最长复用时间(秒)，0表示不限制
+}
+
+// 数据库配置的环境变量，优先于配置文件
+const (
+	EnvDatabaseType = "XIAOZHI_DB_TYPE"
+	EnvDatabaseDSN  = "XIAOZHI_DB_DSN"
+)
+
 var (
 	Cfg *Config
 )
@@ -191,8 +394,6 @@ func (cfg *Config) setDefaults() {
 
 	cfg.Web.Port = 8080
 
-	cfg.Server.Token = "your_token"
-
 	cfg.Log.LogDir = "logs"
 	cfg.Log.LogLevel = "INFO"
 	cfg.Log.LogFormat = "{time:YYYY-MM-DD HH:mm:ss} - {level} - {message}"
@@ -203,51 +404,3 @@ func (cfg *Config) setDefaults() {
 	cfg.PoolConfig.PoolCheckInterval = 30
 
 }
-
-// LoadConfig 加载配置
-// 第一次从config.yaml加载，加载后存储到数据库加载
-// 如果数据库中已存在配置，则直接加载数据库中的配置
-func LoadConfig(dbi ConfigDBInterface) (*Config, string, error) {
-	bUseDatabaseCfg := false
-	// 尝试从数据库加载配置
-	cfgStr, err := dbi.LoadServerConfig()
-	if err != nil {
-		fmt.Println("加载服务器配置失败:", err)
-		return nil, "", err
-	}
-
-	config := &Config{}
-
-	path := "database:serverConfig"
-	if cfgStr != "" {
-		config.FromString(cfgStr)
-		Cfg = config
-		if bUseDatabaseCfg {
-			return Cfg, path, nil
-		}
-	}
-
-	// 尝试从文件读取
-	path = ".config.yaml"
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		path = "config.yaml"
-	}
-
-	data, err := os.ReadFile(path)
-	if err != nil {
-		// 读取配置文件失败，使用默认配置
-		config.setDefaults()
-		data, _ = yaml.Marshal(config)
-	} else {
-		if err := yaml.Unmarshal(data, config); err != nil {
-			return nil, path, err
-		}
-	}
-
-	err = dbi.InitServerConfig(string(data))
-	if err != nil {
-		fmt.Println("初始化服务器配置到数据库失败:", err)
-	}
-	Cfg = config
-	return config, path, nil
-}
@@ -6,8 +6,10 @@ import (
 	"strings"
 	"time"
 
-	"xiaozhi-server-go/src/models"
+	"xiaozhi-server-go/src/configs"
 
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
@@ -57,23 +59,24 @@ func (l *DBLogger) Trace(
 			// 忽略记录未找到的错误
 			return
 		}
-		l.logger.Error("SQL Trace Error", map[string]interface{}{
-			"sql":     sql,
-			"rows":    rows,
-			"elapsed": elapsed,
-			"err":     err,
-		})
+		l.logger.ErrorKV("SQL Trace Error",
+			"sql", sql,
+			"rows", rows,
+			"elapsed", elapsed,
+			xiaozhi_utils.FieldError, err,
+		)
 	} else {
-		l.logger.Debug("SQL Trace", map[string]interface{}{
-			"sql":     sql,
-			"rows":    rows,
-			"elapsed": elapsed,
-		})
+		l.logger.DebugKV("SQL Trace",
+			"sql", sql,
+			"rows", rows,
+			"elapsed", elapsed,
+		)
 	}
 }
 
 var (
 	DB       *gorm.DB
+	dbDriver string
 	dbLogger *xiaozhi_utils.Logger
 )
 
@@ -92,56 +95,104 @@ func GetTxDB() *gorm.DB {
 	return DB.Begin()
 }
 
-// InitDB 初始化数据库类型并连接
-func InitDB() (*gorm.DB, string, error) {
-	var (
-		db     *gorm.DB
-		err    error
-		dbType string
-	)
-
-	dbType = "sqlite"
-	path := "./config.db"
-	db, err = gorm.Open(sqlite.Open(path))
+// InitDB 按配置连接数据库并执行迁移，返回数据库类型
+func InitDB(config *configs.DatabaseConfig) (*gorm.DB, string, error) {
+	if config == nil {
+		config = &configs.DatabaseConfig{}
+	}
+	dialector, dbType, err := openDialector(config)
+	if err != nil {
+		return nil, "", err
+	}
 
+	db, err := gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
-		return nil, "", fmt.Errorf("连接数据库失败: %w", err)
+		return nil, dbType, fmt.Errorf("连接%s数据库失败: %w", dbType, err)
+	}
+	if err := configurePool(db, config); err != nil {
+		return nil, dbType, err
 	}
 
-	// 自动迁移所有表
+	// 按版本执行结构变更
 	if err := migrateTables(db); err != nil {
 		return nil, dbType, err
 	}
 
 	// 插入默认配置
 	if err := InsertDefaultConfigIfNeeded(db); err != nil {
-		fmt.Println("⚠️ 插入默认配置失败: %v", err)
+		fmt.Printf("⚠️ 插入默认配置失败: %v\n", err)
 	}
 
 	DB = db
+	dbDriver = dbType
 
 	NewServerConfigDB(db)
+	NewRoleDB(db)
+	NewUsageDB(db)
 
 	return db, dbType, nil
 }
 
+// openDialector 根据数据库类型创建gorm驱动
+func openDialector(config *configs.DatabaseConfig) (gorm.Dialector, string, error) {
+	dbType := strings.ToLower(config.Type)
+	switch dbType {
+	case "", "sqlite", "sqlite3":
+		path := config.DSN
+		if path == "" {
+			path = "./config.db"
+		}
+		return sqlite.Open(path), "sqlite", nil
+	case "mysql":
+		if config.DSN == "" {
+			return nil, dbType, fmt.Errorf("mysql数据库需要配置dsn")
+		}
+		return mysql.Open(config.DSN), dbType, nil
+	case "postgres", "postgresql":
+		if config.DSN == "" {
+			return nil, "postgres", fmt.Errorf("postgres数据库需要配置dsn")
+		}
+		return postgres.Open(config.DSN), "postgres", nil
+	default:
+		return nil, dbType, fmt.Errorf("不支持的数据库类型: %s", config.Type)
+	}
+}
+
+// configurePool 设置连接池参数
+func configurePool(db *gorm.DB, config *configs.DatabaseConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("获取数据库连接池失败: %w", err)
+	}
+	if config.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(time.Duration(config.ConnMaxLifetime) * time.Second)
+	}
+	return nil
+}
+
+// Driver 当前数据库类型：sqlite、mysql或postgres
+func Driver() string {
+	return dbDriver
+}
+
 func SetLogger(logger *xiaozhi_utils.Logger) {
 	dbLogger = logger
 	DB.Logger = &DBLogger{logger: logger}
 
+	versionSQL := "SELECT version()"
+	if dbDriver == "sqlite" {
+		versionSQL = "SELECT sqlite_version()"
+	}
 	var version string
-	DB.Raw("SELECT sqlite_version()").Scan(&version)
-	logger.Info("SQLite 数据库连接成功，版本: %s", version)
-}
-
-// migrateTables 自动迁移模型表结构
-func migrateTables(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.SystemConfig{},
-		&models.User{},
-		&models.UserSetting{},
-		&models.ModuleConfig{},
-	)
+	DB.Raw(versionSQL).Scan(&version)
+	schemaVersion, _ := SchemaVersion(DB)
+	logger.Info("%s 数据库连接成功，版本: %s，结构版本: %d", dbDriver, version, schemaVersion)
 }
 
 // InsertDefaultConfigIfNeeded 首次启动插入默认配置
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migration 一次数据库结构变更，版本号递增且发布后不再修改
+// 新增表或字段时追加新的版本，不要修改已有版本的内容
+type migration struct {
+	Version int
+	Name    string
+	Migrate func(tx *gorm.DB) error
+}
+
+// migrations 按版本排序的全部变更
+// 早期版本没有版本记录、直接AutoMigrate建表，这些版本也只用AutoMigrate，已有的表会原样保留
+var migrations = []migration{
+	{Version: 1, Name: "init", Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(
+			&models.SystemConfig{},
+			&models.User{},
+			&models.UserSetting{},
+			&models.ModuleConfig{},
+			&models.ServerConfig{},
+			&models.AuthClient{},
+		)
+	}},
+	{Version: 2, Name: "roles", Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.Role{}, &models.DeviceRole{})
+	}},
+	{Version: 3, Name: "usage", Migrate: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&models.UsageRecord{}, &models.DeviceLevel{})
+	}},
+	{Version: 4, Name: "server_config_overlay", Migrate: func(tx *gorm.DB) error {
+		// 旧版本启动时把整份配置文件复制到数据库但从未使用；现在数据库中的配置优先于配置文件，
+		// 清除旧副本，避免修改配置文件后被旧副本覆盖
+		return tx.Where("id = ?", ServerConfigID).Delete(&models.ServerConfig{}).Error
+	}},
+}
+
+// migrateTables 执行尚未应用的变更，每个版本在一个事务中执行并记录到schema_migrations
+func migrateTables(db *gorm.DB) error {
+	if err := db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return fmt.Errorf("创建版本记录表失败: %w", err)
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Migrate(tx); err != nil {
+				return err
+			}
+			// 多个副本同时启动时，只有一个能写入版本记录
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SchemaMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("数据库迁移%d(%s)失败: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func appliedVersions(db *gorm.DB) (map[int]bool, error) {
+	var rows []models.SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("读取版本记录失败: %w", err)
+	}
+	applied := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = true
+	}
+	return applied, nil
+}
+
+// SchemaVersion 数据库当前的结构版本，没有记录时为0
+func SchemaVersion(db *gorm.DB) (int, error) {
+	var row models.SchemaMigration
+	err := db.Order("version DESC").First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return row.Version, err
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateTables(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟没有版本记录的旧数据库：表已由AutoMigrate创建并有数据
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Role{Name: "英语老师", Prompt: "你是英语老师"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := migrateTables(db); err != nil {
+			t.Fatalf("第%d次迁移失败: %v", i+1, err)
+		}
+	}
+
+	t.Run("记录所有版本", func(t *testing.T) {
+		var count int64
+		db.Model(&models.SchemaMigration{}).Count(&count)
+		if int(count) != len(migrations) {
+			t.Fatalf("版本记录数 = %d, 期望 %d", count, len(migrations))
+		}
+		version, err := SchemaVersion(db)
+		if err != nil || version != migrations[len(migrations)-1].Version {
+			t.Fatalf("结构版本 = %d %v", version, err)
+		}
+	})
+
+	t.Run("包括认证和服务器配置表", func(t *testing.T) {
+		for _, model := range []interface{}{&models.AuthClient{}, &models.ServerConfig{}, &models.UsageRecord{}} {
+			if !db.Migrator().HasTable(model) {
+				t.Errorf("缺少表: %T", model)
+			}
+		}
+	})
+
+	t.Run("保留已有数据", func(t *testing.T) {
+		var role models.Role
+		if err := db.Where("name = ?", "英语老师").First(&role).Error; err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestOpenDialector(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   configs.DatabaseConfig
+		wantType string
+		wantErr  bool
+	}{
+		{name: "默认sqlite", config: configs.DatabaseConfig{}, wantType: "sqlite"},
+		{name: "mysql", config: configs.DatabaseConfig{Type: "MySQL", DSN: "user:pass@tcp(127.0.0.1:3306)/xiaozhi"}, wantType: "mysql"},
+		{name: "postgresql别名", config: configs.DatabaseConfig{Type: "postgresql", DSN: "host=127.0.0.1"}, wantType: "postgres"},
+		{name: "mysql缺少dsn", config: configs.DatabaseConfig{Type: "mysql"}, wantErr: true},
+		{name: "不支持的类型", config: configs.DatabaseConfig{Type: "oracle", DSN: "x"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, dbType, err := openDialector(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && dbType != tt.wantType {
+				t.Errorf("类型 = %s, 期望 %s", dbType, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrRoleNotFound 角色不存在
+var ErrRoleNotFound = errors.New("角色不存在")
+
+// legacyEdgeVoices 旧版本在切换角色时为edge TTS写死的音色，迁移时写入角色定义
+var legacyEdgeVoices = map[string]string{
+	"陕西女友":  "zh-CN-shaanxi-XiaoniNeural",
+	"英语老师":  "zh-CN-XiaoyiNeural",
+	"好奇小男孩": "zh-CN-YunxiNeural",
+}
+
+type RoleDB struct {
+	db *gorm.DB
+}
+
+var roleDB *RoleDB
+
+// GetRoleDB 获取角色存储，数据库未初始化时返回nil
+func GetRoleDB() *RoleDB {
+	return roleDB
+}
+
+func NewRoleDB(db *gorm.DB) *RoleDB {
+	roleDB = &RoleDB{db: db}
+	return roleDB
+}
+
+// SeedLegacyRoles 角色表为空时，把配置文件中"名称@提示词"格式的角色导入数据库
+func (d *RoleDB) SeedLegacyRoles(roles []string, ttsType string) (int, error) {
+	var count int64
+	if err := d.db.Model(&models.Role{}).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, nil
+	}
+
+	created := 0
+	for _, item := range roles {
+		parts := strings.SplitN(item, "@", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" || len(parts) < 2 {
+			continue
+		}
+		role := &models.Role{Name: name, Prompt: parts[1]}
+		if ttsType == "edge" {
+			role.Voice = legacyEdgeVoices[name]
+		}
+		if err := d.db.Create(role).Error; err != nil {
+			return created, fmt.Errorf("导入角色%s失败: %v", name, err)
+		}
+		created++
+	}
+	return created, nil
+}
+
+// ListRoles 按名称列出所有角色
+func (d *RoleDB) ListRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := d.db.Order("name").Find(&roles).Error
+	return roles, err
+}
+
+// GetRole 按名称获取角色
+func (d *RoleDB) GetRole(name string) (*models.Role, error) {
+	var role models.Role
+	if err := d.db.Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// CreateRole 新建角色
+func (d *RoleDB) CreateRole(role *models.Role) error {
+	role.ID = 0
+	return d.db.Create(role).Error
+}
+
+// UpdateRole 按名称整体更新角色，允许改名，改名时同步设备的当前角色
+func (d *RoleDB) UpdateRole(name string, role *models.Role) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Role
+		if err := tx.Where("name = ?", name).First(&existing).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRoleNotFound
+			}
+			return err
+		}
+
+		role.ID = existing.ID
+		role.CreatedAt = existing.CreatedAt
+		if err := tx.Save(role).Error; err != nil {
+			return err
+		}
+		if role.Name != name {
+			return tx.Model(&models.DeviceRole{}).Where("role_name = ?", name).Update("role_name", role.Name).Error
+		}
+		return nil
+	})
+}
+
+// DeleteRole 删除角色，使用该角色的设备恢复默认角色
+func (d *RoleDB) DeleteRole(name string) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("name = ?", name).Delete(&models.Role{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRoleNotFound
+		}
+		return tx.Where("role_name = ?", name).Delete(&models.DeviceRole{}).Error
+	})
+}
+
+// GetDeviceRole 获取设备当前角色名，没有记录时返回空字符串
+func (d *RoleDB) GetDeviceRole(deviceID string) (string, error) {
+	var dr models.DeviceRole
+	if err := d.db.Where("device_id = ?", deviceID).First(&dr).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return dr.RoleName, nil
+}
+
+// SetDeviceRole 记录设备当前角色，roleName为空时清除记录
+func (d *RoleDB) SetDeviceRole(deviceID, roleName string) error {
+	if roleName == "" {
+		return d.db.Where("device_id = ?", deviceID).Delete(&models.DeviceRole{}).Error
+	}
+	return d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role_name", "updated_at"}),
+	}).Create(&models.DeviceRole{DeviceID: deviceID, RoleName: roleName}).Error
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestRoleDB(t *testing.T) *RoleDB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	return &RoleDB{db: db}
+}
+
+func TestRoleDB(t *testing.T) {
+	d := newTestRoleDB(t)
+
+	n, err := d.SeedLegacyRoles([]string{"英语老师@你是英语老师", "无效角色", "陕西女友@你是陕西女友"}, "edge")
+	if err != nil || n != 2 {
+		t.Fatalf("导入角色错误: %d %v", n, err)
+	}
+	if n, _ := d.SeedLegacyRoles([]string{"新角色@提示词"}, "edge"); n != 0 {
+		t.Errorf("已有角色时不应重复导入: %d", n)
+	}
+
+	t.Run("导入旧版音色", func(t *testing.T) {
+		role, err := d.GetRole("英语老师")
+		if err != nil || role.Voice != "zh-CN-XiaoyiNeural" || role.Prompt != "你是英语老师" {
+			t.Fatalf("角色错误: %+v %v", role, err)
+		}
+	})
+
+	t.Run("设备角色记录与改名同步", func(t *testing.T) {
+		if err := d.SetDeviceRole("aa:bb", "陕西女友"); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetDeviceRole("aa:bb", "英语老师"); err != nil {
+			t.Fatal(err)
+		}
+		temperature := 0.3
+		role := &models.Role{Name: "英文老师", Prompt: "你是英文老师", Temperature: &temperature,
+			AllowedTools: models.StringsJSON([]string{"get_time"})}
+		if err := d.UpdateRole("英语老师", role); err != nil {
+			t.Fatal(err)
+		}
+		name, err := d.GetDeviceRole("aa:bb")
+		if err != nil || name != "英文老师" {
+			t.Fatalf("设备角色错误: %s %v", name, err)
+		}
+		got, err := d.GetRole("英文老师")
+		if err != nil || *got.Temperature != 0.3 || len(got.Tools()) != 1 {
+			t.Fatalf("更新角色错误: %+v %v", got, err)
+		}
+	})
+
+	t.Run("删除角色后设备恢复默认", func(t *testing.T) {
+		if err := d.DeleteRole("英文老师"); err != nil {
+			t.Fatal(err)
+		}
+		if name, _ := d.GetDeviceRole("aa:bb"); name != "" {
+			t.Errorf("删除角色后设备角色应为空: %s", name)
+		}
+		if err := d.DeleteRole("英文老师"); err != ErrRoleNotFound {
+			t.Errorf("期望ErrRoleNotFound, 实际: %v", err)
+		}
+	})
+}
@@ -80,15 +80,17 @@ func (d *ServerConfigDB) LoadServerConfig() (string, error) {
 		return "", fmt.Errorf("创建服务器配置表失败: %v", err)
 	}
 
-	if err := d.db.First(&config, ServerConfigID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return "", nil
-		}
+	// 没有数据库中的配置是常见情况，用Find避免记录不存在的日志
+	result := d.db.Where("id = ?", ServerConfigID).Limit(1).Find(&config)
+	if err := result.Error; err != nil {
 		if strings.Contains(err.Error(), "no such table") {
 			return "", nil
 		}
 		return "", fmt.Errorf("查询服务器配置失败: %v", err)
 	}
+	if result.RowsAffected == 0 {
+		return "", nil
+	}
 
 	return config.CfgStr, nil
 }
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"xiaozhi-server-go/src/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageSummary 一个设备在一段时间内某计量项的合计
+type UsageSummary struct {
+	DeviceID string  `json:"device_id"`
+	Metric   string  `json:"metric"`
+	Amount   float64 `json:"amount"`
+}
+
+type UsageDB struct {
+	db *gorm.DB
+}
+
+var usageDB *UsageDB
+
+// GetUsageDB 获取用量存储，数据库未初始化时返回nil
+func GetUsageDB() *UsageDB {
+	return usageDB
+}
+
+func NewUsageDB(db *gorm.DB) *UsageDB {
+	usageDB = &UsageDB{db: db}
+	return usageDB
+}
+
+// AddUsage 累加设备某天某计量项的用量
+func (d *UsageDB) AddUsage(deviceID, day, metric string, amount float64) error {
+	return d.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "device_id"}, {Name: "day"}, {Name: "metric"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"amount":     gorm.Expr("usage_records.amount + ?", amount),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&models.UsageRecord{DeviceID: deviceID, Day: day, Metric: metric, Amount: amount}).Error
+}
+
+// SumUsage 设备在[fromDay, toDay]内各计量项的合计
+func (d *UsageDB) SumUsage(deviceID, fromDay, toDay string) (map[string]float64, error) {
+	var rows []UsageSummary
+	err := d.db.Model(&models.UsageRecord{}).
+		Select("device_id, metric, SUM(amount) AS amount").
+		Where("device_id = ? AND day >= ? AND day <= ?", deviceID, fromDay, toDay).
+		Group("device_id, metric").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		totals[row.Metric] = row.Amount
+	}
+	return totals, nil
+}
+
+// Report 按设备和计量项汇总[fromDay, toDay]内的用量，deviceID为空时包括所有设备
+func (d *UsageDB) Report(fromDay, toDay, deviceID string) ([]UsageSummary, error) {
+	query := d.db.Model(&models.UsageRecord{}).
+		Select("device_id, metric, SUM(amount) AS amount").
+		Where("day >= ? AND day <= ?", fromDay, toDay)
+	if deviceID != "" {
+		query = query.Where("device_id = ?", deviceID)
+	}
+	var rows []UsageSummary
+	err := query.Group("device_id, metric").Order("device_id, metric").Scan(&rows).Error
+	return rows, err
+}
+
+// GetDeviceLevel 获取设备的用户级别，没有记录时返回空字符串
+func (d *UsageDB) GetDeviceLevel(deviceID string) (string, error) {
+	var dl models.DeviceLevel
+	if err := d.db.Where("device_id = ?", deviceID).First(&dl).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return dl.Level, nil
+}
+
+// SetDeviceLevel 设置设备的用户级别，level为空时清除记录
+func (d *UsageDB) SetDeviceLevel(deviceID, level string) error {
+	if level == "" {
+		return d.db.Where("device_id = ?", deviceID).Delete(&models.DeviceLevel{}).Error
+	}
+	return d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "device_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"level", "updated_at"}),
+	}).Create(&models.DeviceLevel{DeviceID: deviceID, Level: level}).Error
+}
+
+// ListDeviceLevels 列出单独设置了级别的设备
+func (d *UsageDB) ListDeviceLevels() ([]models.DeviceLevel, error) {
+	var levels []models.DeviceLevel
+	err := d.db.Order("device_id").Find(&levels).Error
+	return levels, err
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUsageDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateTables(db); err != nil {
+		t.Fatal(err)
+	}
+	d := &UsageDB{db: db}
+
+	for _, r := range []struct {
+		device, day, metric string
+		amount              float64
+	}{
+		{"aa:bb", "2025-06-01", "llm_tokens", 10},
+		{"aa:bb", "2025-06-01", "llm_tokens", 5},
+		{"aa:bb", "2025-06-02", "llm_tokens", 20},
+		{"aa:bb", "2025-06-02", "tts_chars", 8},
+		{"cc:dd", "2025-06-02", "llm_tokens", 1},
+	} {
+		if err := d.AddUsage(r.device, r.day, r.metric, r.amount); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("同一天累加", func(t *testing.T) {
+		totals, err := d.SumUsage("aa:bb", "2025-06-01", "2025-06-01")
+		if err != nil || totals["llm_tokens"] != 15 {
+			t.Fatalf("合计错误: %v %v", totals, err)
+		}
+	})
+
+	t.Run("按日期范围汇总", func(t *testing.T) {
+		totals, err := d.SumUsage("aa:bb", "2025-06-01", "2025-06-30")
+		if err != nil || totals["llm_tokens"] != 35 || totals["tts_chars"] != 8 {
+			t.Fatalf("合计错误: %v %v", totals, err)
+		}
+	})
+
+	t.Run("报表包括所有设备", func(t *testing.T) {
+		rows, err := d.Report("2025-06-02", "2025-06-02", "")
+		if err != nil || len(rows) != 3 || rows[0].DeviceID != "aa:bb" || rows[2].DeviceID != "cc:dd" {
+			t.Fatalf("报表错误: %+v %v", rows, err)
+		}
+	})
+
+	t.Run("设置和清除级别", func(t *testing.T) {
+		if err := d.SetDeviceLevel("aa:bb", "premium"); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetDeviceLevel("aa:bb", "business"); err != nil {
+			t.Fatal(err)
+		}
+		if level, err := d.GetDeviceLevel("aa:bb"); err != nil || level != "business" {
+			t.Fatalf("级别错误: %s %v", level, err)
+		}
+		if err := d.SetDeviceLevel("aa:bb", ""); err != nil {
+			t.Fatal(err)
+		}
+		if level, err := d.GetDeviceLevel("aa:bb"); err != nil || level != "" {
+			t.Fatalf("清除后级别应为空: %s %v", level, err)
+		}
+	})
+}
@@ -0,0 +1,361 @@
+package configs
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置按以下顺序合并，后面的覆盖前面的:
+//   默认值 < 配置文件 < 数据库(server_configs) < XIAOZHI_*环境变量 < --set参数
+// 配置文件和数据库中的内容支持${ENV}和${ENV:-默认值}引用环境变量；
+// 模块配置(ASR/TTS/LLM/VLLLM/Embedding/ImageGen)和database中的xxx_file表示从文件读取xxx，用于挂载的密钥文件
+
+// EnvPrefix 覆盖配置的环境变量前缀，层级之间用双下划线分隔，如 XIAOZHI_LLM__ChatGLMLLM__API_KEY
+const EnvPrefix = "XIAOZHI_"
+
+// envAliases 常用配置的简写环境变量
+var envAliases = map[string][]string{
+	EnvDatabaseType: {"database", "type"},
+	EnvDatabaseDSN:  {"database", "dsn"},
+}
+
+// providerSections 支持xxx_file密钥引用的模块配置
+var providerSections = []string{"ASR", "TTS", "LLM", "VLLLM", "Embedding", "ImageGen", "OCR"}
+
+// secretFileSuffix 密钥文件引用的后缀
+const secretFileSuffix = "_file"
+
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// LoadOptions 命令行中的配置选项
+type LoadOptions struct {
+	File      string   // --config 配置文件路径
+	Overrides []string // --set key.path=value，可重复
+}
+
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// ParseFlags 解析子命令之前的全局参数，返回配置选项和剩余参数
+func ParseFlags(args []string) (*LoadOptions, []string, error) {
+	opts := &LoadOptions{}
+	fs := flag.NewFlagSet("xiaozhi-server", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", "", "配置文件路径，默认依次查找.config.yaml和config.yaml")
+	fs.Var((*stringList)(&opts.Overrides), "set", "覆盖配置项，如 --set LLM.ChatGLMLLM.api_key=xxx，可重复")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	return opts, fs.Args(), nil
+}
+
+// configFilePath 配置文件路径，未指定时优先使用.config.yaml
+func configFilePath(opts *LoadOptions) string {
+	if opts != nil && opts.File != "" {
+		return opts.File
+	}
+	path := ".config.yaml"
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		path = "config.yaml"
+	}
+	return path
+}
+
+// rawScalar 环境变量和--set的值，按目标字段的类型解析
+type rawScalar string
+
+func (s rawScalar) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: string(s)}, nil
+}
+
+// overrideValue 把环境变量或--set的值转换为配置值，[...]和{...}按YAML解析
+func overrideValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(trimmed), &parsed); err == nil {
+			return parsed
+		}
+	}
+	return rawScalar(value)
+}
+
+// stringValue 配置值为字符串时返回其内容
+func stringValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case rawScalar:
+		return string(v), true
+	}
+	return "", false
+}
+
+// interpolate 替换${ENV}和${ENV:-默认值}
+func interpolate(data []byte) []byte {
+	return envRefPattern.ReplaceAllFunc(data, func(ref []byte) []byte {
+		m := envRefPattern.FindSubmatch(ref)
+		if value, ok := os.LookupEnv(string(m[1])); ok && value != "" {
+			return []byte(value)
+		}
+		return m[3]
+	})
+}
+
+// parseLayer 解析一层YAML配置
+func parseLayer(data []byte) (map[string]interface{}, error) {
+	layer := make(map[string]interface{})
+	if err := yaml.Unmarshal(interpolate(data), &layer); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// mergeMaps 把src深度合并到dst，映射逐项合并，其他值（包括列表）整体替换
+func mergeMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, ok := value.(map[string]interface{})
+		if dstMap, isMap := dst[key].(map[string]interface{}); ok && isMap {
+			mergeMaps(dstMap, srcMap)
+			continue
+		}
+		setValue(dst, key, value)
+	}
+}
+
+// setValue 设置一个值，同时去掉较低优先级中同名的xxx_file引用，避免其覆盖直接填写的值
+func setValue(m map[string]interface{}, key string, value interface{}) {
+	m[key] = value
+	if !strings.HasSuffix(key, secretFileSuffix) {
+		delete(m, key+secretFileSuffix)
+	}
+}
+
+// canonicalPath 按Config结构体的YAML键修正key.path的大小写，映射中的名称（如模块名）保持不变
+func canonicalPath(path []string) []string {
+	result := make([]string, len(path))
+	t := reflect.TypeOf(Config{})
+	for i, segment := range path {
+		result[i] = segment
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch {
+		case t == nil:
+		case t.Kind() == reflect.Struct:
+			fields, _ := yamlFields(t)
+			var next reflect.Type
+			for name, ft := range fields {
+				if strings.EqualFold(name, segment) {
+					result[i], next = name, ft
+					break
+				}
+			}
+			t = next
+		case t.Kind() == reflect.Map:
+			t = t.Elem()
+		default:
+			t = nil
+		}
+	}
+	return result
+}
+
+// setPath 设置key.path的值，已有的键不区分大小写匹配
+func setPath(root map[string]interface{}, path []string, value interface{}) error {
+	path = canonicalPath(path)
+	current := root
+	for i, segment := range path {
+		key := segment
+		for existing := range current {
+			if strings.EqualFold(existing, segment) {
+				key = existing
+				break
+			}
+		}
+		if i == len(path)-1 {
+			setValue(current, key, value)
+			return nil
+		}
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			if current[key] != nil {
+				return fmt.Errorf("%s不是映射，无法设置%s", strings.Join(path[:i+1], "."), strings.Join(path, "."))
+			}
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	return nil
+}
+
+// envOverrides 从XIAOZHI_*环境变量得到覆盖项，按变量名排序
+func envOverrides(environ []string) [][2]string {
+	var overrides [][2]string
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		if path, ok := envAliases[name]; ok {
+			overrides = append(overrides, [2]string{strings.Join(path, "."), value})
+			continue
+		}
+		rest := strings.TrimPrefix(name, EnvPrefix)
+		if !strings.Contains(rest, "__") {
+			continue
+		}
+		overrides = append(overrides, [2]string{strings.ReplaceAll(rest, "__", "."), value})
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i][0] < overrides[j][0] })
+	return overrides
+}
+
+// loadLayers 按优先级合并各层配置，返回合并结果和使用的配置文件路径
+func loadLayers(dbi ConfigDBInterface, opts *LoadOptions) (map[string]interface{}, string, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	merged := make(map[string]interface{})
+
+	path := configFilePath(opts)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		layer, err := parseLayer(data)
+		if err != nil {
+			return nil, path, fmt.Errorf("解析%s失败: %w", path, err)
+		}
+		mergeMaps(merged, layer)
+	case opts.File != "":
+		return nil, path, fmt.Errorf("读取配置文件失败: %w", err)
+	default:
+		path = ""
+	}
+
+	if dbi != nil {
+		cfgStr, err := dbi.LoadServerConfig()
+		if err != nil {
+			return nil, path, fmt.Errorf("加载数据库中的配置失败: %w", err)
+		}
+		if strings.TrimSpace(cfgStr) != "" {
+			layer, err := parseLayer([]byte(cfgStr))
+			if err != nil {
+				return nil, path, fmt.Errorf("解析数据库中的配置失败: %w", err)
+			}
+			mergeMaps(merged, layer)
+		}
+	}
+
+	for _, kv := range envOverrides(os.Environ()) {
+		if err := setPath(merged, strings.Split(kv[0], "."), overrideValue(kv[1])); err != nil {
+			return nil, path, fmt.Errorf("环境变量: %w", err)
+		}
+	}
+	for _, override := range opts.Overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return nil, path, fmt.Errorf("--set格式应为key.path=value: %s", override)
+		}
+		if err := setPath(merged, strings.Split(key, "."), overrideValue(value)); err != nil {
+			return nil, path, fmt.Errorf("--set: %w", err)
+		}
+	}
+	return merged, path, nil
+}
+
+// resolveSecretFiles 把模块配置和数据库配置中的xxx_file替换为文件内容
+func resolveSecretFiles(merged map[string]interface{}) []Issue {
+	var issues []Issue
+	for _, section := range providerSections {
+		providers, _ := merged[section].(map[string]interface{})
+		for name, value := range providers {
+			if provider, ok := value.(map[string]interface{}); ok {
+				issues = append(issues, resolveBlockSecrets(section+"."+name, provider)...)
+			}
+		}
+	}
+	if database, ok := merged["database"].(map[string]interface{}); ok {
+		issues = append(issues, resolveBlockSecrets("database", database)...)
+	}
+	sortIssues(issues)
+	return issues
+}
+
+func resolveBlockSecrets(prefix string, block map[string]interface{}) []Issue {
+	var issues []Issue
+	for key, ref := range block {
+		file, ok := stringValue(ref)
+		if !ok || !strings.HasSuffix(key, secretFileSuffix) || file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			issues = append(issues, Issue{Level: IssueError, Path: prefix + "." + key, Message: "读取密钥文件失败: " + err.Error()})
+			continue
+		}
+		block[strings.TrimSuffix(key, secretFileSuffix)] = strings.TrimSpace(string(data))
+		delete(block, key)
+	}
+	return issues
+}
+
+// decodeConfig 把合并后的配置解析到结构体，结构体中已有的默认值在配置缺省时保留
+func decodeConfig(merged map[string]interface{}, config *Config) error {
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(data, config)
+}
+
+// LoadDatabaseConfig 读取数据库配置，只使用配置文件、环境变量和--set，不读取数据库中的配置
+func LoadDatabaseConfig(opts *LoadOptions) (*DatabaseConfig, error) {
+	merged, _, err := loadLayers(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	if issues := resolveSecretFiles(merged); len(issues) > 0 {
+		return nil, fmt.Errorf("%s", issues[0])
+	}
+	config := &Config{}
+	if err := decodeConfig(merged, config); err != nil {
+		return nil, err
+	}
+	return &config.Database, nil
+}
+
+// LoadConfig 按默认值、配置文件、数据库、环境变量、--set的顺序加载配置，返回使用的配置文件路径
+func LoadConfig(dbi ConfigDBInterface, opts *LoadOptions) (*Config, string, error) {
+	merged, path, err := loadLayers(dbi, opts)
+	if err != nil {
+		return nil, path, err
+	}
+	if issues := resolveSecretFiles(merged); len(issues) > 0 {
+		return nil, path, fmt.Errorf("%s", issues[0])
+	}
+
+	config := &Config{}
+	config.setDefaults()
+	if err := decodeConfig(merged, config); err != nil {
+		return nil, path, fmt.Errorf("解析配置失败: %w", err)
+	}
+	if path == "" {
+		path = "默认配置"
+	}
+	Cfg = config
+	return config, path, nil
+}
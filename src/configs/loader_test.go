@@ -0,0 +1,161 @@
+package configs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type memoryConfigDB struct {
+	cfg string
+}
+
+func (m *memoryConfigDB) GetDB() *gorm.DB                     { return nil }
+func (m *memoryConfigDB) LoadServerConfig() (string, error)   { return m.cfg, nil }
+func (m *memoryConfigDB) InitServerConfig(cfg string) error   { return nil }
+func (m *memoryConfigDB) UpdateServerConfig(cfg string) error { m.cfg = cfg; return nil }
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := writeFile(t, dir, "api_key", "sk-from-file\n")
+	file := writeFile(t, dir, "config.yaml", `
+server:
+  port: 8000
+  token: ${TEST_XIAOZHI_TOKEN:-file-token}
+log:
+  log_level: info
+LLM:
+  OpenAILLM:
+    type: openai
+    model_name: ${TEST_XIAOZHI_MODEL}
+    api_key_file: `+keyFile+`
+`)
+
+	tests := []struct {
+		name      string
+		env       map[string]string
+		db        string
+		overrides []string
+		check     func(t *testing.T, c *Config)
+	}{
+		{
+			name: "只有配置文件",
+			check: func(t *testing.T, c *Config) {
+				if c.Server.Port != 8000 || c.Server.Token != "file-token" {
+					t.Errorf("server = %+v", c.Server)
+				}
+				if got := c.LLM["OpenAILLM"].APIKey; got != "sk-from-file" {
+					t.Errorf("api_key = %q", got)
+				}
+			},
+		},
+		{
+			name: "环境变量插值",
+			env:  map[string]string{"TEST_XIAOZHI_TOKEN": "env-token", "TEST_XIAOZHI_MODEL": "gpt-4o"},
+			check: func(t *testing.T, c *Config) {
+				if c.Server.Token != "env-token" || c.LLM["OpenAILLM"].ModelName != "gpt-4o" {
+					t.Errorf("token = %q, model = %q", c.Server.Token, c.LLM["OpenAILLM"].ModelName)
+				}
+			},
+		},
+		{
+			name: "数据库覆盖配置文件",
+			db:   "server:\n  port: 9000\n",
+			check: func(t *testing.T, c *Config) {
+				if c.Server.Port != 9000 || c.Server.Token != "file-token" {
+					t.Errorf("server = %+v", c.Server)
+				}
+			},
+		},
+		{
+			name: "XIAOZHI环境变量覆盖数据库",
+			env:  map[string]string{"XIAOZHI_SERVER__PORT": "9100", "XIAOZHI_LLM__OpenAILLM__API_KEY": "0123"},
+			db:   "server:\n  port: 9000\n",
+			check: func(t *testing.T, c *Config) {
+				if c.Server.Port != 9100 {
+					t.Errorf("port = %d", c.Server.Port)
+				}
+				if got := c.LLM["OpenAILLM"].APIKey; got != "0123" {
+					t.Errorf("api_key = %q", got)
+				}
+			},
+		},
+		{
+			name:      "--set优先级最高",
+			env:       map[string]string{"XIAOZHI_SERVER__PORT": "9100"},
+			overrides: []string{"server.port=9200", "log.log_level=debug"},
+			check: func(t *testing.T, c *Config) {
+				if c.Server.Port != 9200 || c.Log.LogLevel != "debug" {
+					t.Errorf("port = %d, level = %q", c.Server.Port, c.Log.LogLevel)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			config, path, err := LoadConfig(&memoryConfigDB{cfg: tt.db}, &LoadOptions{File: file, Overrides: tt.overrides})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != file {
+				t.Errorf("path = %q", path)
+			}
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yaml", `
+server:
+  port: 8000
+  unknown_option: true
+selected_module:
+  LLM: CozeLLM
+  TTS: MissingTTS
+LLM:
+  CozeLLM:
+    type: coze
+    bot_id: "123"
+    personal_access_token: 你的coze个人令牌
+    extra_option: 1
+`)
+
+	issues, err := ValidateConfig(nil, &LoadOptions{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"server.unknown_option": IssueWarning,
+		"LLM.CozeLLM":           IssueError,
+		"selected_module.TTS":   IssueError,
+	}
+	got := make(map[string]string)
+	for _, issue := range issues {
+		got[issue.Path] = issue.Level
+	}
+	for path, level := range want {
+		if got[path] != level {
+			t.Errorf("%s: got %q, want %q (issues: %v)", path, got[path], level, issues)
+		}
+	}
+	if _, ok := got["LLM.CozeLLM.extra_option"]; ok {
+		t.Errorf("模块配置的额外参数不应报告为未知: %v", issues)
+	}
+}
@@ -0,0 +1,259 @@
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 问题级别
+const (
+	IssueError   = "error"
+	IssueWarning = "warning"
+)
+
+// Issue 配置检查发现的问题
+type Issue struct {
+	Level   string
+	Path    string
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("[%s] %s", i.Level, i.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", i.Level, i.Path, i.Message)
+}
+
+func sortIssues(issues []Issue) {
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+}
+
+// credentialRule 一种模块类型需要的凭证
+type credentialRule struct {
+	Required []string   // 都要填写
+	AnyOf    [][]string // 至少完整填写其中一组
+}
+
+// credentialRules 模块 -> 类型 -> 凭证，未列出的类型不需要凭证
+var credentialRules = map[string]map[string]credentialRule{
+	"ASR": {
+		"doubao":   {Required: []string{"appid", "access_token"}},
+		"deepgram": {Required: []string{"api_key"}},
+	},
+	"TTS": {
+		"doubao":   {Required: []string{"appid", "token", "cluster"}},
+		"deepgram": {Required: []string{"token"}},
+	},
+	"LLM": {
+		"openai":    {Required: []string{"api_key"}},
+		"anthropic": {Required: []string{"api_key"}},
+		"gemini":    {Required: []string{"api_key"}},
+		"coze": {
+			Required: []string{"bot_id"},
+			AnyOf:    [][]string{{"personal_access_token"}, {"client_id", "public_key", "private_key"}},
+		},
+	},
+	"VLLLM": {
+		"openai": {Required: []string{"api_key"}},
+	},
+	"Embedding": {
+		"openai": {Required: []string{"api_key"}},
+	},
+	"ImageGen": {
+		"openai": {Required: []string{"api_key"}},
+	},
+	"OCR": {
+		"openai": {Required: []string{"api_key"}},
+	},
+}
+
+// placeholderPrefixes 示例配置中的占位值，视为未填写
+var placeholderPrefixes = []string{"你的", "your_", "your-"}
+
+// ValidateConfig 按与LoadConfig相同的顺序合并配置，检查未知配置项、密钥文件和所选模块的凭证
+func ValidateConfig(dbi ConfigDBInterface, opts *LoadOptions) ([]Issue, error) {
+	merged, _, err := loadLayers(dbi, opts)
+	if err != nil {
+		return nil, err
+	}
+	issues := resolveSecretFiles(merged)
+
+	unknown := unknownKeys(merged, reflect.TypeOf(Config{}), "")
+	sortIssues(unknown)
+	issues = append(issues, unknown...)
+
+	config := &Config{}
+	config.setDefaults()
+	if err := decodeConfig(merged, config); err != nil {
+		return append(issues, Issue{Level: IssueError, Message: "解析配置失败: " + err.Error()}), nil
+	}
+	return append(issues, checkSelectedModules(merged)...), nil
+}
+
+// unknownKeys 检查配置中结构体没有的键，映射和内联的额外配置接受任意键
+func unknownKeys(value interface{}, t reflect.Type, path string) []Issue {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var issues []Issue
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		fields, open := yamlFields(t)
+		for _, key := range sortedKeys(m) {
+			ft, ok := fields[key]
+			if !ok {
+				if !open {
+					issues = append(issues, Issue{Level: IssueWarning, Path: joinPath(path, key), Message: "未知的配置项"})
+				}
+				continue
+			}
+			issues = append(issues, unknownKeys(m[key], ft, joinPath(path, key))...)
+		}
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, key := range sortedKeys(m) {
+			issues = append(issues, unknownKeys(m[key], t.Elem(), joinPath(path, key))...)
+		}
+	case reflect.Slice:
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range list {
+			issues = append(issues, unknownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	return issues
+}
+
+// yamlFields 结构体的YAML键及类型，有内联映射时open为true
+func yamlFields(t reflect.Type) (map[string]reflect.Type, bool) {
+	fields := make(map[string]reflect.Type)
+	open := false
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if strings.Contains(options, "inline") {
+			if field.Type.Kind() == reflect.Map {
+				open = true
+				continue
+			}
+			inner, innerOpen := yamlFields(field.Type)
+			for k, v := range inner {
+				fields[k] = v
+			}
+			open = open || innerOpen
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields, open
+}
+
+// checkSelectedModules 检查selected_module选中的模块是否存在以及凭证是否填写
+func checkSelectedModules(merged map[string]interface{}) []Issue {
+	selected, _ := merged["selected_module"].(map[string]interface{})
+	var issues []Issue
+	for _, module := range providerSections {
+		name, _ := stringValue(selected[module])
+		if name == "" {
+			continue
+		}
+		providers, _ := merged[module].(map[string]interface{})
+		provider, ok := providers[name].(map[string]interface{})
+		if !ok {
+			issues = append(issues, Issue{Level: IssueError, Path: "selected_module." + module, Message: fmt.Sprintf("未找到%s.%s的配置", module, name)})
+			continue
+		}
+		providerType, _ := stringValue(provider["type"])
+		rule, ok := credentialRules[module][providerType]
+		if !ok {
+			continue
+		}
+		path := module + "." + name
+		for _, key := range rule.Required {
+			if !hasCredential(provider, key) {
+				issues = append(issues, Issue{Level: IssueError, Path: path + "." + key, Message: "缺少凭证"})
+			}
+		}
+		if len(rule.AnyOf) > 0 && !anyGroupFilled(provider, rule.AnyOf) {
+			groups := make([]string, 0, len(rule.AnyOf))
+			for _, group := range rule.AnyOf {
+				groups = append(groups, strings.Join(group, "+"))
+			}
+			issues = append(issues, Issue{Level: IssueError, Path: path, Message: "缺少凭证，需要填写 " + strings.Join(groups, " 或 ")})
+		}
+	}
+	return issues
+}
+
+func anyGroupFilled(provider map[string]interface{}, groups [][]string) bool {
+	for _, group := range groups {
+		filled := true
+		for _, key := range group {
+			filled = filled && hasCredential(provider, key)
+		}
+		if filled {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCredential 凭证已填写且不是示例中的占位值
+func hasCredential(provider map[string]interface{}, key string) bool {
+	raw, ok := provider[key]
+	if !ok || raw == nil {
+		return false
+	}
+	value, ok := stringValue(raw)
+	if !ok {
+		// 数字等非字符串值
+		return true
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	for _, prefix := range placeholderPrefixes {
+		if strings.HasPrefix(strings.ToLower(value), prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
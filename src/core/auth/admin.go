@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorResponse 管理接口的错误返回结构
+type ErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Message string `json:"message" example:"无效的管理token"`
+}
+
+// TokenEqual 以固定时间比较token，避免通过响应时间逐位猜测
+func TokenEqual(token, expected string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// AdminAuth 管理接口的鉴权中间件，Bearer token须与server.token一致，未配置token时拒绝所有请求
+// OPTIONS预检请求直接返回，methods为允许跨域的请求方法
+func AdminAuth(config *configs.Config, methods string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Origin", "*")
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		bearer := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !TokenEqual(bearer, config.Server.Token) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Success: false, Message: "无效的管理token"})
+			return
+		}
+		c.Next()
+	}
+}
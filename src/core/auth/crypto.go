@@ -96,7 +96,7 @@ func (cm *MemoryCryptoManager) GenerateSessionKeys(sessionID string) (*SessionKe
 	cm.keys[sessionID] = sessionKeys
 	cm.mutex.Unlock()
 
-	cm.logger.Debug("生成会话密钥", map[string]interface{}{
+	cm.logger.DebugKV("生成会话密钥", map[string]interface{}{
 		"session_id": sessionID,
 		"expires_at": sessionKeys.ExpiresAt,
 	})
@@ -137,7 +137,7 @@ func (cm *MemoryCryptoManager) RevokeSessionKeys(sessionID string) error {
 	}
 
 	delete(cm.keys, sessionID)
-	cm.logger.Info("撤销会话密钥", map[string]interface{}{
+	cm.logger.InfoKV("撤销会话密钥", map[string]interface{}{
 		"session_id": sessionID,
 	})
 
@@ -160,7 +160,7 @@ func (cm *MemoryCryptoManager) CleanupExpiredKeys() error {
 	}
 
 	if expiredCount > 0 {
-		cm.logger.Info("清理过期密钥", map[string]interface{}{
+		cm.logger.InfoKV("清理过期密钥", map[string]interface{}{
 			"expired_count": expiredCount,
 		})
 	}
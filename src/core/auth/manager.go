@@ -42,7 +42,7 @@ func NewAuthManager(storeConfig *store.StoreConfig, logger *utils.Logger) (*Auth
 		logger:        logger,
 	}
 
-	manager.logger.Info("认证管理器初始化成功", map[string]interface{}{
+	manager.logger.InfoKV("认证管理器初始化成功", map[string]interface{}{
 		"store_type": storeConfig.Type,
 		"expiry_hr":  storeConfig.ExpiryHr,
 	})
@@ -65,7 +65,7 @@ func (am *AuthManager) RegisterClient(
 	// 存储认证信息
 	err := am.store.StoreAuth(clientID, username, password, metadata)
 	if err != nil {
-		am.logger.Error("注册客户端认证信息失败", map[string]interface{}{
+		am.logger.ErrorKV("注册客户端认证信息失败", map[string]interface{}{
 			"client_id": clientID,
 			"error":     err.Error(),
 		})
@@ -83,7 +83,7 @@ func (am *AuthManager) AuthenticateClient(
 
 	valid, clientInfo, err := am.store.ValidateAuth(clientID, username, password)
 	if err != nil {
-		am.logger.Error("客户端认证验证失败", map[string]interface{}{
+		am.logger.ErrorKV("客户端认证验证失败", map[string]interface{}{
 			"client_id": clientID,
 			"error":     err.Error(),
 		})
@@ -91,14 +91,14 @@ func (am *AuthManager) AuthenticateClient(
 	}
 
 	if !valid {
-		am.logger.Debug("客户端认证失败", map[string]interface{}{
+		am.logger.DebugKV("客户端认证失败", map[string]interface{}{
 			"client_id": clientID,
 			"username":  username,
 		})
 		return false, nil, nil
 	}
 
-	am.logger.Debug("客户端认证成功", map[string]interface{}{
+	am.logger.DebugKV("客户端认证成功", map[string]interface{}{
 		"client_id": clientID,
 		"username":  username,
 		"ip":        clientInfo.IP,
@@ -123,14 +123,14 @@ func (am *AuthManager) RemoveClient(clientID string) error {
 
 	err := am.store.RemoveAuth(clientID)
 	if err != nil {
-		am.logger.Error("移除客户端认证信息失败", map[string]interface{}{
+		am.logger.ErrorKV("移除客户端认证信息失败", map[string]interface{}{
 			"client_id": clientID,
 			"error":     err.Error(),
 		})
 		return err
 	}
 
-	am.logger.Info("客户端认证信息已移除", map[string]interface{}{
+	am.logger.InfoKV("客户端认证信息已移除", map[string]interface{}{
 		"client_id": clientID,
 	})
 
@@ -152,7 +152,7 @@ func (am *AuthManager) CleanupExpired() error {
 
 	err := am.store.CleanupExpired()
 	if err != nil {
-		am.logger.Error("清理过期认证信息失败", map[string]interface{}{
+		am.logger.ErrorKV("清理过期认证信息失败", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return err
@@ -188,7 +188,7 @@ func (am *AuthManager) Close() error {
 	if am.store != nil {
 		err := am.store.Close()
 		if err != nil {
-			am.logger.Error("关闭认证存储失败", map[string]interface{}{
+			am.logger.ErrorKV("关闭认证存储失败", map[string]interface{}{
 				"error": err.Error(),
 			})
 			return err
@@ -90,6 +90,62 @@ func (dm *DialogueManager) GetLLMDialogue() []Message {
 	return dm.dialogue
 }
 
+// GetVisionDialogue 获取供VLLLM使用的对话，只保留最近maxImages张图片，工具调用过程不发送
+func (dm *DialogueManager) GetVisionDialogue(maxImages int) []Message {
+	dialogue := make([]Message, 0, len(dm.dialogue))
+	remaining := maxImages
+	for i := len(dm.dialogue) - 1; i >= 0; i-- {
+		msg := dm.dialogue[i]
+		if msg.Role == "tool" || (msg.Content == "" && len(msg.Images) == 0) {
+			continue
+		}
+		images := make([]types.ImageRef, 0, len(msg.Images))
+		for j := len(msg.Images) - 1; j >= 0 && remaining > 0; j-- {
+			if msg.Images[j].Data == "" {
+				continue
+			}
+			images = append([]types.ImageRef{msg.Images[j]}, images...)
+			remaining--
+		}
+		if len(images) == 0 {
+			images = nil
+		}
+		dialogue = append(dialogue, Message{Role: msg.Role, Content: msg.Content, Images: images})
+	}
+	for i, j := 0, len(dialogue)-1; i < j; i, j = i+1, j-1 {
+		dialogue[i], dialogue[j] = dialogue[j], dialogue[i]
+	}
+	return dialogue
+}
+
+// AttachImage 把图片附加到最近一条用户消息，没有用户消息时返回false
+func (dm *DialogueManager) AttachImage(image types.ImageRef) bool {
+	for i := len(dm.dialogue) - 1; i >= 0; i-- {
+		if dm.dialogue[i].Role == "user" {
+			dm.dialogue[i].Images = append(dm.dialogue[i].Images, image)
+			return true
+		}
+	}
+	return false
+}
+
+// TurnsSinceImage 最近一张图片之后的用户消息数，没有图片时返回-1，从记录恢复的图片没有数据不计入
+func (dm *DialogueManager) TurnsSinceImage() int {
+	turns := 0
+	for i := len(dm.dialogue) - 1; i >= 0; i-- {
+		msg := dm.dialogue[i]
+		for _, image := range msg.Images {
+			if image.Data != "" {
+				return turns
+			}
+		}
+		if msg.Role == "user" {
+			turns++
+		}
+	}
+	return -1
+}
+
 // GetLLMDialogueWithMemory 获取带记忆的对话
 func (dm *DialogueManager) GetLLMDialogueWithMemory(memoryStr string) []Message {
 	if memoryStr == "" {
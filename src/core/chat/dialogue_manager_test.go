@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"testing"
+
+	"xiaozhi-server-go/src/core/types"
+)
+
+func TestVisionDialogue(t *testing.T) {
+	img := func(data string) types.ImageRef {
+		return types.ImageRef{Format: "jpeg", Data: data}
+	}
+	dm := NewDialogueManager(nil, nil)
+	dm.SetSystemMessage("你是小智")
+	if got := dm.TurnsSinceImage(); got != -1 {
+		t.Errorf("没有图片时 TurnsSinceImage() = %d, want -1", got)
+	}
+
+	dm.Put(Message{Role: "user", Content: "这是什么", Images: []types.ImageRef{img("a")}})
+	dm.Put(Message{Role: "assistant", Content: "一只猫"})
+	dm.Put(Message{Role: "user", Content: "看看前面"})
+	dm.Put(Message{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "1", Type: "function"}}})
+	if !dm.AttachImage(img("b")) {
+		t.Fatal("AttachImage() = false")
+	}
+	dm.Put(Message{Role: "tool", Content: "一个红色的杯子", ToolCallID: "1"})
+	dm.Put(Message{Role: "assistant", Content: "前面有一个红色的杯子"})
+	dm.Put(Message{Role: "user", Content: "那它是什么材质的"})
+
+	if got := dm.TurnsSinceImage(); got != 1 {
+		t.Errorf("TurnsSinceImage() = %d, want 1", got)
+	}
+
+	tests := []struct {
+		name       string
+		maxImages  int
+		wantImages []string
+	}{
+		{"保留全部图片", 3, []string{"a", "b"}},
+		{"只保留最近的图片", 1, []string{"b"}},
+		{"不带图片", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialogue := dm.GetVisionDialogue(tt.maxImages)
+			if len(dialogue) != 6 {
+				t.Fatalf("len(dialogue) = %d, want 6（不含工具调用）", len(dialogue))
+			}
+			var images []string
+			for _, msg := range dialogue {
+				if msg.Role == "tool" || len(msg.ToolCalls) > 0 {
+					t.Errorf("工具调用消息不应发给VLLLM: %+v", msg)
+				}
+				for _, image := range msg.Images {
+					images = append(images, image.Data)
+				}
+			}
+			if len(images) != len(tt.wantImages) {
+				t.Fatalf("images = %v, want %v", images, tt.wantImages)
+			}
+			for i := range images {
+				if images[i] != tt.wantImages[i] {
+					t.Errorf("images = %v, want %v", images, tt.wantImages)
+				}
+			}
+		})
+	}
+
+	// 从记录恢复的对话没有图片数据，不再触发追问
+	saved, err := dm.ToJSON(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewDialogueManager(nil, nil)
+	if err := restored.LoadFromJSON(saved); err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.TurnsSinceImage(); got != -1 {
+		t.Errorf("恢复后 TurnsSinceImage() = %d, want -1", got)
+	}
+}
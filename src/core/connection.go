@@ -11,22 +11,28 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/chat"
 	"xiaozhi-server-go/src/core/function"
-	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/kb"
 	"xiaozhi-server-go/src/core/mcp"
 	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/imagegen"
 	"xiaozhi-server-go/src/core/providers/tts"
 	"xiaozhi-server-go/src/core/providers/vlllm"
+	"xiaozhi-server-go/src/core/tracing"
 	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/usage"
 	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
 	"xiaozhi-server-go/src/task"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Connection 统一连接接口
@@ -73,6 +79,10 @@ type ConnectionHandler struct {
 
 	initailVoice string // 初始语音名称
 
+	// 当前角色，nil表示默认设置
+	role      *models.Role
+	roleMutex sync.RWMutex
+
 	// 会话相关
 	sessionID     string            // 设备与服务端会话ID
 	deviceID      string            // 设备ID
@@ -85,11 +95,14 @@ type ConnectionHandler struct {
 	clientAudioSampleRate    int
 	clientAudioChannels      int
 	clientAudioFrameDuration int
+	clientDisplay            imagegen.Display // 设备屏幕，决定下发图片的尺寸和格式
 
 	serverAudioFormat        string // 服务端音频格式
 	serverAudioSampleRate    int
 	serverAudioChannels      int
 	serverAudioFrameDuration int
+	playout                  *utils.PlayoutScheduler // 下行音频播放时钟
+	connectedAt              int64                   // 连接完成绑定的时间(unix纳秒)，外部查询时原子读取
 
 	clientListenMode string
 	isDeviceVerified bool
@@ -103,14 +116,18 @@ type ConnectionHandler struct {
 
 	// 对话相关
 	dialogueManager     *chat.DialogueManager
-	tts_last_text_index int
+	tts_last_text_index int32  // 本轮最后一句的文本索引，TTS、发送和ASR回调协程共用，原子读写
 	client_asr_text     string // 客户端ASR文本
+	asrPartialText      string // 上一次中间识别结果，ASR回调协程与连接协程共用
+	asrPartialMutex     sync.Mutex
 	quickReplyCache     *utils.QuickReplyCache
 
 	// 并发控制
 	stopChan         chan struct{}
 	clientAudioQueue chan []byte
 	clientTextQueue  chan string
+	speakQueue       chan speakTask // 外部触发的播报，在文本消息协程中执行
+	bargeInQueue     chan string    // 中间识别结果触发的打断，在文本消息协程中执行
 
 	// TTS任务队列
 	ttsQueue chan struct {
@@ -134,6 +151,8 @@ type ConnectionHandler struct {
 
 	mcpResultHandlers map[string]func(interface{}) // MCP处理器映射
 	ctx               context.Context
+
+	tracer turnTracer // 对话轮次的链路追踪
 }
 
 // NewConnectionHandler 创建新的连接处理器
@@ -151,6 +170,8 @@ func NewConnectionHandler(
 		stopChan:         make(chan struct{}),
 		clientAudioQueue: make(chan []byte, 100),
 		clientTextQueue:  make(chan string, 100),
+		speakQueue:       make(chan speakTask),
+		bargeInQueue:     make(chan string, 1),
 		ttsQueue: make(chan struct {
 			text      string
 			round     int // 轮次
@@ -171,6 +192,7 @@ func NewConnectionHandler(
 		serverAudioSampleRate:    24000,
 		serverAudioChannels:      1,
 		serverAudioFrameDuration: 60,
+		playout:                  utils.NewPlayoutScheduler(60 * time.Millisecond),
 
 		ctx: ctx,
 
@@ -193,7 +215,7 @@ func NewConnectionHandler(
 		if key == "Transport-Type" {
 			handler.transportType = values[0] // 传输类型
 		}
-		logger.Info("HTTP头部信息: %s: %s", key, values[0])
+		logger.DebugKV("HTTP头部信息", "header", key, "value", values[0])
 	}
 
 	if handler.sessionID == "" {
@@ -204,6 +226,14 @@ func NewConnectionHandler(
 		}
 	}
 
+	// 会话级日志：附带设备、会话和客户端ID，以及当前轮次的trace_id
+	handler.logger = logger.Module("connection").With(
+		utils.FieldDeviceID, handler.deviceID,
+		utils.FieldSessionID, handler.sessionID,
+		utils.FieldClientID, handler.clientId,
+	).WithContextFunc(handler.traceContext)
+	logger = handler.logger
+
 	// 正确设置providers
 	if providerSet != nil {
 		handler.providers.asr = providerSet.ASR
@@ -228,6 +258,8 @@ func NewConnectionHandler(
 	handler.dialogueManager.SetSystemMessage(config.DefaultPrompt)
 	handler.functionRegister = function.NewFunctionRegistry()
 	handler.initMCPResultHandlers()
+	handler.updateASRHotwords()
+	handler.restoreDeviceRole()
 
 	return handler
 }
@@ -236,9 +268,9 @@ func (h *ConnectionHandler) SetTaskCallback(callback func(func(*ConnectionHandle
 	h.safeCallbackFunc = callback
 }
 
-func (h *ConnectionHandler) SubmitTask(taskType string, params map[string]interface{}) {
-	_task, id := task.NewTask(h.ctx, "", params)
-	h.LogInfo(fmt.Sprintf("提交任务: %s, ID: %s, 参数: %v", _task.Type, id, params))
+func (h *ConnectionHandler) SubmitTask(taskType string, params map[string]interface{}) error {
+	_task, id := task.NewTask(h.ctx, task.TaskType(taskType), params)
+	h.LogInfo("提交任务", "task_type", _task.Type, "task_id", id, "params", params)
 	// 创建安全回调用于任务完成时调用
 	var taskCallback func(result interface{})
 	if h.safeCallbackFunc != nil {
@@ -256,25 +288,29 @@ func (h *ConnectionHandler) SubmitTask(taskType string, params map[string]interf
 	}
 	cb := task.NewCallBack(taskCallback)
 	_task.Callback = cb
-	h.taskMgr.SubmitTask(h.sessionID, _task)
+	h.syncTaskLevel()
+	return h.taskMgr.SubmitTask(h.sessionID, _task)
 }
 
 func (h *ConnectionHandler) handleTaskComplete(task *task.Task, id string, result interface{}) {
-	h.LogInfo(fmt.Sprintf("任务 %s 完成，ID: %s, %v", task.Type, id, result))
+	h.LogInfo("任务完成", "task_type", task.Type, "task_id", id, "result", result)
+	switch task.Type {
+	case taskTypeGenPic:
+		h.handleGenPicComplete(result)
+	}
 }
 
-func (h *ConnectionHandler) LogInfo(msg string) {
+// LogInfo 记录信息日志，设备和会话字段由会话级logger附带
+func (h *ConnectionHandler) LogInfo(msg string, fields ...interface{}) {
 	if h.logger != nil {
-		h.logger.Info(msg, map[string]interface{}{
-			"device": h.deviceID,
-		})
+		h.logger.InfoKV(msg, fields...)
 	}
 }
-func (h *ConnectionHandler) LogError(msg string) {
+
+// LogError 记录错误日志，设备和会话字段由会话级logger附带
+func (h *ConnectionHandler) LogError(msg string, fields ...interface{}) {
 	if h.logger != nil {
-		h.logger.Error(msg, map[string]interface{}{
-			"device": h.deviceID,
-		})
+		h.logger.ErrorKV(msg, fields...)
 	}
 }
 
@@ -283,6 +319,7 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 	defer conn.Close()
 
 	h.conn = conn
+	h.logger = h.logger.With(utils.FieldTransport, conn.GetType())
 
 	// 启动消息处理协程
 	go h.processClientAudioMessagesCoroutine() // 添加客户端音频消息处理协程
@@ -306,12 +343,13 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 			"token":      h.config.Server.Token,
 		}
 		if err := h.mcpManager.BindConnection(conn, h.functionRegister, params); err != nil {
-			h.LogError(fmt.Sprintf("绑定MCP管理器连接失败: %v", err))
+			h.LogError("绑定MCP管理器连接失败", utils.FieldError, err)
 			return
 		}
 		// 不需要重新初始化服务器，只需要确保连接相关的服务正常
 		h.LogInfo("MCP管理器连接绑定完成，跳过重复初始化")
 	}
+	h.registerConnection()
 
 	// 主消息循环
 	for {
@@ -321,12 +359,12 @@ func (h *ConnectionHandler) Handle(conn Connection) {
 		default:
 			messageType, message, err := conn.ReadMessage(h.stopChan)
 			if err != nil {
-				h.LogError(fmt.Sprintf("读取消息失败: %v, 退出主消息循环", err))
+				h.LogError("读取消息失败，退出主消息循环", utils.FieldError, err)
 				return
 			}
 
 			if err := h.handleMessage(messageType, message); err != nil {
-				h.LogError(fmt.Sprintf("处理消息失败: %v", err))
+				h.LogError("处理消息失败", utils.FieldError, err)
 			}
 		}
 	}
@@ -340,8 +378,13 @@ func (h *ConnectionHandler) processClientTextMessagesCoroutine() {
 			return
 		case text := <-h.clientTextQueue:
 			if err := h.processClientTextMessage(context.Background(), text); err != nil {
-				h.LogError(fmt.Sprintf("处理文本数据失败: %v", err))
+				h.LogError("处理文本数据失败", utils.FieldError, err)
 			}
+		case task := <-h.speakQueue:
+			// 与设备消息在同一协程修改轮次和对话历史
+			task.done <- h.speak(task.text)
+		case text := <-h.bargeInQueue:
+			h.bargeIn(text)
 		}
 	}
 }
@@ -356,9 +399,11 @@ func (h *ConnectionHandler) processClientAudioMessagesCoroutine() {
 			if h.closeAfterChat {
 				continue
 			}
+			h.traceASRStart()
 			if err := h.providers.asr.AddAudio(audioData); err != nil {
-				h.LogError(fmt.Sprintf("处理音频数据失败: %v", err))
+				h.LogError("处理音频数据失败", utils.FieldError, err)
 			}
+			h.recordASRAudio(len(audioData))
 		}
 	}
 }
@@ -377,7 +422,8 @@ func (h *ConnectionHandler) sendAudioMessageCoroutine() {
 // OnAsrResult 实现 AsrEventListener 接口
 // 返回true则停止语音识别，返回false会继续语音识别
 func (h *ConnectionHandler) OnAsrResult(result string) bool {
-	//h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+	//h.LogInfo("ASR识别结果", "mode", h.clientListenMode, "text", result)
+	h.resetPartialText()
 	if h.providers.asr.GetSilenceCount() >= 2 {
 		h.LogInfo("检测到连续两次静音，结束对话")
 		h.closeAfterChat = true // 如果连续两次静音，则结束对话
@@ -387,13 +433,13 @@ func (h *ConnectionHandler) OnAsrResult(result string) bool {
 		if result == "" {
 			return false
 		}
-		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+		h.LogInfo("ASR识别结果", "mode", h.clientListenMode, "text", result)
 		h.handleChatMessage(context.Background(), result)
 		return true
 	} else if h.clientListenMode == "manual" {
 		h.client_asr_text += result
 		if result != "" {
-			h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, h.client_asr_text))
+			h.LogInfo("ASR识别结果", "mode", h.clientListenMode, "text", h.client_asr_text)
 		}
 		if h.clientVoiceStop {
 			h.handleChatMessage(context.Background(), h.client_asr_text)
@@ -406,13 +452,83 @@ func (h *ConnectionHandler) OnAsrResult(result string) bool {
 		}
 		h.stopServerSpeak()
 		h.providers.asr.Reset() // 重置ASR状态，准备下一次识别
-		h.LogInfo(fmt.Sprintf("[%s] ASR识别结果: %s", h.clientListenMode, result))
+		h.LogInfo("ASR识别结果", "mode", h.clientListenMode, "text", result)
 		h.handleChatMessage(context.Background(), result)
 		return true
 	}
 	return false
 }
 
+// OnAsrPartialResult 实现 AsrEventListener 接口
+// 推送实时字幕；中间结果稳定后提前识别退出指令，realtime模式下说话达到一定字数时提前打断播报
+func (h *ConnectionHandler) OnAsrPartialResult(result string) {
+	if h.closeAfterChat {
+		return
+	}
+	stable := h.updatePartialText(result)
+	if !stable {
+		if err := h.sendInterimSTTMessage(h.client_asr_text + result); err != nil {
+			h.logger.Debug("发送中间识别结果失败: %v", err)
+		}
+		h.logger.Debug("[%s] ASR中间结果: %s", h.clientListenMode, result)
+	}
+
+	// 连续两次相同的中间结果视为稳定，避免"退出"后面还有话时误退出
+	if stable && h.QuitIntent(result) {
+		return
+	}
+
+	if h.clientListenMode == "realtime" && h.config.BargeInChars > 0 && h.isServerSpeaking() &&
+		utf8.RuneCountInString(utils.RemoveAllPunctuation(result)) >= h.config.BargeInChars {
+		// 在ASR回调协程中只投递打断请求，已有未处理的请求时丢弃
+		select {
+		case h.bargeInQueue <- result:
+		default:
+		}
+	}
+}
+
+// bargeIn 在文本消息协程中打断播报，投递后播报可能已经结束
+func (h *ConnectionHandler) bargeIn(text string) {
+	if !h.isServerSpeaking() {
+		return
+	}
+	h.LogInfo("检测到用户说话，提前打断播报", "text", text)
+	h.stopServerSpeak()
+	h.sendTTSMessage("stop", "", 0)
+}
+
+// updatePartialText 记录中间识别结果，返回是否与上一次相同
+func (h *ConnectionHandler) updatePartialText(result string) bool {
+	h.asrPartialMutex.Lock()
+	defer h.asrPartialMutex.Unlock()
+	stable := result == h.asrPartialText
+	h.asrPartialText = result
+	return stable
+}
+
+// resetPartialText 一句话识别结束后清空中间结果
+func (h *ConnectionHandler) resetPartialText() {
+	h.asrPartialMutex.Lock()
+	h.asrPartialText = ""
+	h.asrPartialMutex.Unlock()
+}
+
+// lastTextIndex 本轮最后一句的文本索引
+func (h *ConnectionHandler) lastTextIndex() int {
+	return int(atomic.LoadInt32(&h.tts_last_text_index))
+}
+
+// setLastTextIndex 设置本轮最后一句的文本索引
+func (h *ConnectionHandler) setLastTextIndex(index int) {
+	atomic.StoreInt32(&h.tts_last_text_index, int32(index))
+}
+
+// isServerSpeaking 服务端是否正在生成或播放回复
+func (h *ConnectionHandler) isServerSpeaking() bool {
+	return atomic.LoadInt32(&h.serverVoiceStop) == 0 && h.lastTextIndex() > 0
+}
+
 // clientAbortChat 处理中止消息
 func (h *ConnectionHandler) clientAbortChat() error {
 	h.LogInfo("收到客户端中止消息，停止语音识别")
@@ -431,7 +547,7 @@ func (h *ConnectionHandler) QuitIntent(text string) bool {
 	cleand_text := utils.RemoveAllPunctuation(text) // 移除标点符号，确保匹配准确
 	// 检查是否包含退出命令
 	for _, cmd := range exitCommands {
-		h.logger.Debug(fmt.Sprintf("检查退出命令: %s,%s", cmd, cleand_text))
+		h.logger.DebugKV("检查退出命令", "command", cmd, "text", cleand_text)
 		//判断相等
 		if cleand_text == cmd {
 			h.LogInfo("收到客户端退出意图，准备结束对话")
@@ -451,9 +567,9 @@ func (h *ConnectionHandler) quickReplyWakeUpWords(text string) bool {
 		return false
 	}
 
-	repalyWords := h.config.QuickReplyWords
+	repalyWords := h.quickReplyWords()
 	reply_text := utils.RandomSelectFromArray(repalyWords)
-	h.tts_last_text_index = 1 // 重置文本索引
+	h.setLastTextIndex(1) // 重置文本索引
 	h.SpeakAndPlay(reply_text, 1, h.talkRound)
 
 	return true
@@ -475,25 +591,26 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 	h.talkRound++
 	h.roundStartTime = time.Now()
 	currentRound := h.talkRound
-	h.LogInfo(fmt.Sprintf("开始新的对话轮次: %d", currentRound))
+	ctx = h.beginTurn(ctx, currentRound, text)
+	h.LogInfo("开始新的对话轮次", utils.FieldRound, currentRound)
 
 	// 普通文本消息处理流程
 	// 立即发送 stt 消息
 	err := h.sendSTTMessage(text)
 	if err != nil {
-		h.LogError(fmt.Sprintf("发送STT消息失败: %v", err))
+		h.LogError("发送STT消息失败", utils.FieldError, err)
 		return fmt.Errorf("发送STT消息失败: %v", err)
 	}
 
 	// 发送tts start状态
 	if err := h.sendTTSMessage("start", "", 0); err != nil {
-		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+		h.LogError("发送TTS开始状态失败", utils.FieldError, err)
 		return fmt.Errorf("发送TTS开始状态失败: %v", err)
 	}
 
 	// 发送思考状态的情绪
 	if err := h.sendEmotionMessage("thinking"); err != nil {
-		h.LogError(fmt.Sprintf("发送思考状态情绪消息失败: %v", err))
+		h.LogError("发送思考状态情绪消息失败", utils.FieldError, err)
 		return fmt.Errorf("发送情绪消息失败: %v", err)
 	}
 
@@ -503,21 +620,33 @@ func (h *ConnectionHandler) handleChatMessage(ctx context.Context, text string)
 		return nil
 	}
 
+	// 超出用量配额时不再调用LLM
+	if !h.checkQuota(currentRound) {
+		return nil
+	}
+
 	// 添加用户消息到对话历史
 	h.dialogueManager.Put(chat.Message{
 		Role:    "user",
 		Content: text,
 	})
 
+	// 刚发送过图片时，追问由VLLLM结合最近的图片回答
+	if h.followUpWithVision() {
+		return h.genResponseByVLLM(ctx, h.visionDialogue(), text, currentRound)
+	}
+
 	return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), currentRound)
 }
 
-func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []providers.Message, round int) error {
+func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []providers.Message, round int) (err error) {
+	ctx, span := tracing.Start(ctx, "llm", tracing.AttrRound.Int(round), tracing.AttrProvider.String(h.config.SelectedModule["LLM"]))
+	defer func() { tracing.End(span, err) }()
 	defer func() {
 		if r := recover(); r != nil {
-			h.LogError(fmt.Sprintf("genResponseByLLM发生panic: %v", r))
+			h.LogError("genResponseByLLM发生panic", "panic", fmt.Sprint(r), utils.FieldRound, round)
 			errorMsg := "抱歉，处理您的请求时发生了错误"
-			h.tts_last_text_index = 1 // 重置文本索引
+			h.setLastTextIndex(1) // 重置文本索引
 			h.SpeakAndPlay(errorMsg, 1, round)
 		}
 	}()
@@ -529,8 +658,9 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		//msg.Print()
 	}
 	// 使用LLM生成回复
-	tools := h.functionRegister.GetAllFunctions()
-	responses, err := h.providers.llm.ResponseWithFunctions(ctx, h.sessionID, messages, tools)
+	tools := h.filterTools(h.functionRegister.GetAllFunctions())
+	span.SetAttributes(attribute.Int("xiaozhi.messages", len(messages)), attribute.Int("xiaozhi.tools", len(tools)))
+	responses, err := h.providers.llm.ResponseWithFunctions(h.roleContext(ctx), h.sessionID, messages, tools)
 	if err != nil {
 		return fmt.Errorf("LLM生成回复失败: %v", err)
 	}
@@ -548,15 +678,16 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 	functionID := ""
 	functionArguments := ""
 	contentArguments := ""
+	defer func() { h.recordLLMUsage(messages, contentArguments+functionArguments) }()
 
 	for response := range responses {
 		content := response.Content
 		toolCall := response.ToolCalls
 
 		if response.Error != "" {
-			h.LogError(fmt.Sprintf("LLM响应错误: %s", response.Error))
+			h.LogError("LLM响应错误", utils.FieldError, response.Error, utils.FieldRound, round)
 			errorMsg := "抱歉，服务暂时不可用，请稍后再试"
-			h.tts_last_text_index = 1 // 重置文本索引
+			h.setLastTextIndex(1) // 重置文本索引
 			h.SpeakAndPlay(errorMsg, 1, round)
 			return fmt.Errorf("LLM响应错误: %s", response.Error)
 		}
@@ -585,9 +716,9 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 
 		if content != "" {
 			if strings.Contains(content, "服务响应异常") {
-				h.LogError(fmt.Sprintf("检测到LLM服务异常: %s", content))
+				h.LogError("检测到LLM服务异常", "content", content, utils.FieldRound, round)
 				errorMsg := "抱歉，服务暂时不可用，请稍后再试"
-				h.tts_last_text_index = 1 // 重置文本索引
+				h.setLastTextIndex(1) // 重置文本索引
 				h.SpeakAndPlay(errorMsg, 1, round)
 				return fmt.Errorf("LLM服务异常")
 			}
@@ -600,7 +731,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 			// 处理分段
 			fullText := utils.JoinStrings(responseMessage)
 			if len(fullText) <= processedChars {
-				h.logger.Warn(fmt.Sprintf("文本处理异常: fullText长度=%d, processedChars=%d", len(fullText), processedChars))
+				h.logger.WarnKV("文本处理异常", "full_text_length", len(fullText), "processed_chars", processedChars)
 				continue
 			}
 			currentText := fullText[processedChars:]
@@ -611,14 +742,15 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 				if textIndex == 1 {
 					now := time.Now()
 					llmSpentTime := now.Sub(llmStartTime)
-					h.LogInfo(fmt.Sprintf("LLM回复耗时 %s 生成第一句话【%s】, round: %d", llmSpentTime, segment, round))
+					span.AddEvent("first_segment")
+					h.LogInfo("LLM生成第一句话", "elapsed_ms", llmSpentTime.Milliseconds(), "text", segment, utils.FieldRound, round)
 				} else {
-					h.LogInfo(fmt.Sprintf("LLM回复分段: %s, index: %d, round:%d", segment, textIndex, round))
+					h.LogInfo("LLM回复分段", "text", segment, utils.FieldTextIndex, textIndex, utils.FieldRound, round)
 				}
-				h.tts_last_text_index = textIndex
+				h.setLastTextIndex(textIndex)
 				err := h.SpeakAndPlay(segment, textIndex, round)
 				if err != nil {
-					h.LogError(fmt.Sprintf("播放LLM回复分段失败: %v", err))
+					h.LogError("播放LLM回复分段失败", utils.FieldError, err, utils.FieldTextIndex, textIndex)
 				}
 				processedChars += chars
 			}
@@ -633,7 +765,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 				functionName = a["name"].(string)
 				argumentsJson, err := json.Marshal(a["arguments"])
 				if err != nil {
-					h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
+					h.logger.ErrorKV("函数调用参数解析失败", utils.FieldError, err)
 				}
 				functionArguments = string(argumentsJson)
 				functionID = uuid.New().String()
@@ -641,7 +773,7 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 				bHasError = true
 			}
 			if bHasError {
-				h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
+				h.logger.ErrorKV("函数调用参数解析失败", utils.FieldError, err)
 			}
 		}
 		if !bHasError {
@@ -649,28 +781,38 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 			responseMessage = []string{}
 			arguments := make(map[string]interface{})
 			if err := json.Unmarshal([]byte(functionArguments), &arguments); err != nil {
-				h.LogError(fmt.Sprintf("函数调用参数解析失败: %v", err))
+				h.logger.ErrorKV("函数调用参数解析失败", utils.FieldError, err)
 			}
 			functionCallData := map[string]interface{}{
 				"id":        functionID,
 				"name":      functionName,
 				"arguments": functionArguments,
 			}
-			h.LogInfo(fmt.Sprintf("函数调用: %v", arguments))
-			if h.mcpManager.IsMCPTool(functionName) {
-				// 处理MCP函数调用
-				result, err := h.mcpManager.ExecuteTool(ctx, functionName, arguments)
+			h.LogInfo("函数调用", "tool", functionName, "arguments", arguments)
+			if !h.isToolAllowed(functionName) {
+				// 当前角色不允许调用该工具，告知LLM后重新生成回复
+				h.LogError("当前角色不允许调用工具", "tool", functionName)
+				h.handleFunctionResult(types.ActionResponse{
+					Action: types.ActionTypeReqLLM,
+					Result: "当前角色不能使用该工具",
+				}, functionCallData, textIndex)
+			} else if h.mcpManager.IsMCPTool(functionName) {
+				// 处理MCP函数调用，附带当前设备和角色可检索的知识库集合
+				toolCtx, toolSpan := tracing.Start(ctx, "tool", tracing.AttrTool.String(functionName), tracing.AttrRound.Int(round))
+				toolCtx = kb.WithCollections(toolCtx, h.knowledgeCollections())
+				result, err := h.mcpManager.ExecuteTool(toolCtx, functionName, arguments)
+				tracing.End(toolSpan, err)
 				if err != nil {
-					h.LogError(fmt.Sprintf("MCP函数调用失败: %v", err))
+					h.LogError("MCP函数调用失败", "tool", functionName, utils.FieldError, err)
 					if result == nil {
 						result = "MCP工具调用失败"
 					}
 				}
 				// 判断result 是否是types.ActionResponse类型
 				if actionResult, ok := result.(types.ActionResponse); ok {
-					h.handleFunctionResult(actionResult, functionCallData, textIndex)
+					h.handleFunctionResult(routeVisionResult(actionResult), functionCallData, textIndex)
 				} else {
-					h.LogInfo(fmt.Sprintf("MCP函数调用结果: %v", result))
+					h.LogInfo("MCP函数调用结果", "tool", functionName, "result", result)
 					actionResult := types.ActionResponse{
 						Action: types.ActionTypeReqLLM, // 动作类型
 						Result: result,                 // 动作产生的结果
@@ -691,8 +833,8 @@ func (h *ConnectionHandler) genResponseByLLM(ctx context.Context, messages []pro
 		remainingText := fullResponse[processedChars:]
 		if remainingText != "" {
 			textIndex++
-			h.LogInfo(fmt.Sprintf("LLM回复分段[剩余文本]: %s, index: %d, round:%d", remainingText, textIndex, round))
-			h.tts_last_text_index = textIndex
+			h.LogInfo("LLM回复分段[剩余文本]", "text", remainingText, utils.FieldTextIndex, textIndex, utils.FieldRound, round)
+			h.setLastTextIndex(textIndex)
 			h.SpeakAndPlay(remainingText, textIndex, round)
 		}
 	} else {
@@ -718,10 +860,11 @@ func (h *ConnectionHandler) addToolCallMessage(toolResultText string, functionCa
 	functionID := functionCallData["id"].(string)
 	functionName := functionCallData["name"].(string)
 	functionArguments := functionCallData["arguments"].(string)
-	h.LogInfo(fmt.Sprintf("函数调用结果: %s", toolResultText))
-	h.LogInfo(fmt.Sprintf("函数调用参数: %s", functionArguments))
-	h.LogInfo(fmt.Sprintf("函数调用名称: %s", functionName))
-	h.LogInfo(fmt.Sprintf("函数调用ID: %s", functionID))
+	h.LogInfo("函数调用结果",
+		"tool", functionName,
+		"tool_call_id", functionID,
+		"arguments", functionArguments,
+		"result", toolResultText)
 
 	// 添加 assistant 消息，包含 tool_calls
 	h.dialogueManager.Put(chat.Message{
@@ -752,26 +895,26 @@ func (h *ConnectionHandler) addToolCallMessage(toolResultText string, functionCa
 func (h *ConnectionHandler) handleFunctionResult(result types.ActionResponse, functionCallData map[string]interface{}, textIndex int) {
 	switch result.Action {
 	case types.ActionTypeError:
-		h.LogError(fmt.Sprintf("函数调用错误: %v", result.Result))
+		h.LogError("函数调用错误", "result", result.Result)
 	case types.ActionTypeNotFound:
-		h.LogError(fmt.Sprintf("函数未找到: %v", result.Result))
+		h.LogError("函数未找到", "result", result.Result)
 	case types.ActionTypeNone:
-		h.LogInfo(fmt.Sprintf("函数调用无操作: %v", result.Result))
+		h.LogInfo("函数调用无操作", "result", result.Result)
 	case types.ActionTypeResponse:
-		h.LogInfo(fmt.Sprintf("函数调用直接回复: %v", result.Response))
+		h.LogInfo("函数调用直接回复", "response", result.Response)
 		h.SystemSpeak(result.Response.(string))
 	case types.ActionTypeCallHandler:
 		resultStr := h.handleMCPResultCall(result)
 		h.addToolCallMessage(resultStr, functionCallData)
 	case types.ActionTypeReqLLM:
-		h.LogInfo(fmt.Sprintf("函数调用后请求LLM: %v", result.Result))
+		h.LogInfo("函数调用后请求LLM", "result", result.Result)
 		text, ok := result.Result.(string)
 		if ok && len(text) > 0 {
 			h.addToolCallMessage(text, functionCallData)
-			h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogue(), h.talkRound)
+			h.genResponseByLLM(h.turnContext(h.talkRound), h.dialogueManager.GetLLMDialogue(), h.talkRound)
 
 		} else {
-			h.LogError(fmt.Sprintf("函数调用结果解析失败: %v", result.Result))
+			h.LogError("函数调用结果解析失败", "result", result.Result)
 			// 发送错误消息
 			errorMessage := fmt.Sprintf("函数调用结果解析失败 %v", result.Result)
 			h.SystemSpeak(errorMessage)
@@ -788,7 +931,7 @@ func (h *ConnectionHandler) SystemSpeak(text string) error {
 	index := 0
 	for _, item := range texts {
 		index++
-		h.tts_last_text_index = index // 重置文本索引
+		h.setLastTextIndex(index) // 重置文本索引
 		h.SpeakAndPlay(item, index, h.talkRound)
 	}
 	return nil
@@ -818,7 +961,9 @@ func (h *ConnectionHandler) processTTSQueueCoroutine() {
 func (h *ConnectionHandler) stopServerSpeak() {
 	h.LogInfo("服务端停止说话")
 	atomic.StoreInt32(&h.serverVoiceStop, 1)
+	h.endTurn(h.talkRound, "interrupted")
 	h.cleanTTSAndAudioQueue(false)
+	h.playout.Reset() // 设备会丢弃未播放的音频，下一轮重新计时
 }
 
 func (h *ConnectionHandler) deleteAudioFileIfNeeded(filepath string, reason string) {
@@ -828,28 +973,33 @@ func (h *ConnectionHandler) deleteAudioFileIfNeeded(filepath string, reason stri
 
 	// 检查是否为快速回复缓存文件，如果是则不删除
 	if h.quickReplyCache != nil && h.quickReplyCache.IsCachedFile(filepath) {
-		h.LogInfo(fmt.Sprintf(reason+" 跳过删除缓存音频文件: %s", filepath))
+		h.LogInfo(reason+" 跳过删除缓存音频文件", "file", filepath)
 		return
 	}
 
 	// 检查是否是音乐文件，如果是则不删除
 	if utils.IsMusicFile(filepath) {
-		h.LogInfo(fmt.Sprintf(reason+" 跳过删除音乐文件: %s", filepath))
+		h.LogInfo(reason+" 跳过删除音乐文件", "file", filepath)
 		return
 	}
 
 	// 删除非缓存音频文件
 	if err := os.Remove(filepath); err != nil {
-		h.LogError(fmt.Sprintf(reason+" 删除音频文件失败: %v", err))
+		h.LogError(reason+" 删除音频文件失败", "file", filepath, utils.FieldError, err)
 	} else {
-		h.logger.Debug(fmt.Sprintf(reason+" 已删除音频文件: %s", filepath))
+		h.logger.DebugKV(reason+" 已删除音频文件", "file", filepath)
 	}
 }
 
 // processTTSTask 处理单个TTS任务
 func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int) {
 	filepath := ""
+	_, span := tracing.Start(h.turnContext(round), "tts",
+		tracing.AttrRound.Int(round), tracing.AttrTextIndex.Int(textIndex), tracing.AttrText.String(text),
+		tracing.AttrProvider.String(h.config.SelectedModule["TTS"]))
+	var ttsErr error
 	defer func() {
+		tracing.End(span, ttsErr)
 		h.audioMessagesQueue <- struct {
 			filepath  string
 			text      string
@@ -858,10 +1008,11 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 		}{filepath, text, round, textIndex}
 	}()
 
-	if utils.IsQuickReplyHit(text, h.config.QuickReplyWords) {
+	if h.isCachedReply(text) {
 		// 尝试从缓存查找音频文件
 		if cachedFile := h.quickReplyCache.FindCachedAudio(text); cachedFile != "" {
-			h.LogInfo(fmt.Sprintf("使用缓存的快速回复音频: %s", cachedFile))
+			span.SetAttributes(tracing.AttrCached.Bool(true))
+			h.LogInfo("使用缓存的快速回复音频", "file", cachedFile, utils.FieldTextIndex, textIndex)
 			filepath = cachedFile
 			return
 		}
@@ -871,28 +1022,30 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 	text = utils.RemoveAllEmoji(text)
 
 	if text == "" {
-		h.logger.Warn(fmt.Sprintf("收到空文本，无法合成语音, 索引: %d", textIndex))
+		h.logger.WarnKV("收到空文本，无法合成语音", utils.FieldTextIndex, textIndex)
 		return
 	}
 
 	// 生成语音文件
 	filepath, err := h.providers.tts.ToTTS(text)
 	if err != nil {
-		h.LogError(fmt.Sprintf("TTS转换失败:text(%s) %v", text, err))
+		ttsErr = err
+		h.LogError("TTS转换失败", "text", text, utils.FieldTextIndex, textIndex, utils.FieldError, err)
 		return
 	} else {
-		h.logger.Debug(fmt.Sprintf("TTS转换成功: text(%s), index(%d) %s", text, textIndex, filepath))
-		// 如果是快速回复词，保存到缓存
-		if utils.IsQuickReplyHit(text, h.config.QuickReplyWords) {
+		h.logger.DebugKV("TTS转换成功", "text", text, utils.FieldTextIndex, textIndex, "file", filepath)
+		h.recordTTSUsage(text)
+		// 如果是快速回复词或问候语，保存到缓存
+		if h.isCachedReply(text) {
 			if err := h.quickReplyCache.SaveCachedAudio(text, filepath); err != nil {
-				h.LogError(fmt.Sprintf("保存快速回复音频失败: %v", err))
+				h.LogError("保存快速回复音频失败", utils.FieldError, err)
 			} else {
-				h.LogInfo(fmt.Sprintf("成功缓存快速回复音频: %s", text))
+				h.LogInfo("成功缓存快速回复音频", "text", text)
 			}
 		}
 	}
 	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
-		h.LogInfo(fmt.Sprintf("processTTSTask 服务端语音停止, 不再发送音频数据：%s", text))
+		h.LogInfo("processTTSTask 服务端语音停止, 不再发送音频数据", "text", text)
 		// 服务端语音停止时，根据配置删除已生成的音频文件
 		h.deleteAudioFileIfNeeded(filepath, "服务端语音停止时")
 		return
@@ -901,7 +1054,7 @@ func (h *ConnectionHandler) processTTSTask(text string, textIndex int, round int
 	if textIndex == 1 {
 		now := time.Now()
 		ttsSpentTime := now.Sub(ttsStartTime)
-		h.logger.Debug(fmt.Sprintf("TTS转换耗时: %s, 文本: %s, 索引: %d", ttsSpentTime, text, textIndex))
+		h.logger.DebugKV("TTS转换耗时", "elapsed_ms", ttsSpentTime.Milliseconds(), "text", text, utils.FieldTextIndex, textIndex)
 	}
 
 }
@@ -926,13 +1079,13 @@ func (h *ConnectionHandler) SpeakAndPlay(text string, textIndex int, round int)
 	}
 
 	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
-		h.LogInfo(fmt.Sprintf("speakAndPlay 服务端语音停止, 不再发送音频数据：%s", text))
+		h.LogInfo("speakAndPlay 服务端语音停止, 不再发送音频数据", "text", text)
 		text = ""
 		return errors.New("服务端语音已停止，无法合成语音")
 	}
 
 	if len(text) > 255 {
-		h.logger.Warn(fmt.Sprintf("文本过长，超过255字符限制，截断合成语音: %s", text))
+		h.logger.WarnKV("文本过长，超过255字符限制，截断合成语音", "text", text)
 		text = text[:255] // 截断文本
 	}
 
@@ -941,14 +1094,14 @@ func (h *ConnectionHandler) SpeakAndPlay(text string, textIndex int, round int)
 
 func (h *ConnectionHandler) clearSpeakStatus() {
 	h.LogInfo("清除服务端讲话状态 ")
-	h.tts_last_text_index = -1
+	h.setLastTextIndex(-1)
 	h.providers.asr.Reset() // 重置ASR状态
 }
 
 func (h *ConnectionHandler) closeOpusDecoder() {
 	if h.opusDecoder != nil {
 		if err := h.opusDecoder.Close(); err != nil {
-			h.LogError(fmt.Sprintf("关闭Opus解码器失败: %v", err))
+			h.LogError("关闭Opus解码器失败", utils.FieldError, err)
 		}
 		h.opusDecoder = nil
 	}
@@ -963,7 +1116,7 @@ func (h *ConnectionHandler) cleanTTSAndAudioQueue(bClose bool) error {
 	for {
 		select {
 		case task := <-h.ttsQueue:
-			h.LogInfo(fmt.Sprintf(msgPrefix+"丢弃一个TTS任务: %s", task.text))
+			h.LogInfo(msgPrefix+"丢弃一个TTS任务", "text", task.text, utils.FieldRound, task.round)
 		default:
 			// 队列已清空，退出循环
 			h.LogInfo(msgPrefix + "ttsQueue队列已清空，停止处理TTS任务,准备清空音频队列")
@@ -976,7 +1129,7 @@ clearAudioQueue:
 	for {
 		select {
 		case task := <-h.audioMessagesQueue:
-			h.LogInfo(fmt.Sprintf(msgPrefix+"丢弃一个音频任务: %s", task.text))
+			h.LogInfo(msgPrefix+"丢弃一个音频任务", "text", task.text, utils.FieldRound, task.round)
 			// 根据配置删除被丢弃的音频文件
 			h.deleteAudioFileIfNeeded(task.filepath, msgPrefix+"丢弃音频任务时")
 		default:
@@ -991,6 +1144,8 @@ clearAudioQueue:
 func (h *ConnectionHandler) Close() {
 	h.closeOnce.Do(func() {
 		close(h.stopChan)
+		h.unregisterConnection()
+		h.closeTrace()
 
 		h.closeOpusDecoder()
 		if h.providers.tts != nil {
@@ -998,27 +1153,32 @@ func (h *ConnectionHandler) Close() {
 		}
 		if h.providers.asr != nil {
 			if err := h.providers.asr.Reset(); err != nil {
-				h.LogError(fmt.Sprintf("重置ASR状态失败: %v", err))
+				h.LogError("重置ASR状态失败", utils.FieldError, err)
 			}
 		}
 		h.cleanTTSAndAudioQueue(true)
 	})
 }
 
-// genResponseByVLLM 使用VLLLM处理包含图片的消息
-func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []providers.Message, imageData image.ImageData, text string, round int) error {
-	h.logger.Info("开始生成VLLLM回复 %v", map[string]interface{}{
-		"text":          text,
-		"has_url":       imageData.URL != "",
-		"has_data":      imageData.Data != "",
-		"format":        imageData.Format,
-		"message_count": len(messages),
-	})
+// genResponseByVLLM 使用VLLLM处理包含图片的对话，图片在messages的Images中
+func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []providers.Message, text string, round int) (err error) {
+	ctx, span := tracing.Start(ctx, "vlllm", tracing.AttrRound.Int(round), tracing.AttrProvider.String(h.config.SelectedModule["VLLLM"]))
+	defer func() { tracing.End(span, err) }()
+	imageCount := 0
+	for _, msg := range messages {
+		imageCount += len(msg.Images)
+	}
+	h.logger.InfoKV("开始生成VLLLM回复",
+		"text", text,
+		"image_count", imageCount,
+		"message_count", len(messages),
+		utils.FieldRound, round)
 
 	// 使用VLLLM处理图片和文本
-	responses, err := h.providers.vlllm.ResponseWithImage(ctx, h.sessionID, messages, imageData, text)
+	responses, err := h.providers.vlllm.ResponseWithHistory(ctx, h.sessionID, messages)
 	if err != nil {
-		h.LogError(fmt.Sprintf("VLLLM生成回复失败，尝试降级到普通LLM: %v", err))
+		span.RecordError(err)
+		h.LogError("VLLLM生成回复失败，尝试降级到普通LLM", utils.FieldError, err)
 		// 降级策略：只使用文本部分调用普通LLM
 		fallbackText := fmt.Sprintf("用户发送了一张图片并询问：%s（注：当前无法处理图片，只能根据文字回答）", text)
 		fallbackMessages := append(messages, providers.Message{
@@ -1027,6 +1187,7 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 		})
 		return h.genResponseByLLM(ctx, fallbackMessages, round)
 	}
+	usage.Default().Record(h.deviceID, usage.MetricVisionCalls, 1)
 
 	// 处理VLLLM流式回复
 	var responseMessage []string
@@ -1048,7 +1209,7 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 		// 按标点符号分割
 		if segment, chars := utils.SplitAtLastPunctuation(currentText); chars > 0 {
 			textIndex++
-			h.tts_last_text_index = textIndex
+			h.setLastTextIndex(textIndex)
 			h.SpeakAndPlay(segment, textIndex, round)
 			processedChars += chars
 		}
@@ -1058,23 +1219,22 @@ func (h *ConnectionHandler) genResponseByVLLM(ctx context.Context, messages []pr
 	remainingText := utils.JoinStrings(responseMessage)[processedChars:]
 	if remainingText != "" {
 		textIndex++
-		h.tts_last_text_index = textIndex
+		h.setLastTextIndex(textIndex)
 		h.SpeakAndPlay(remainingText, textIndex, round)
 	}
 
 	// 获取完整回复内容
 	content := utils.JoinStrings(responseMessage)
 
+	h.recordLLMUsage(messages, text+content)
+
 	// 添加VLLLM回复到对话历史
 	h.dialogueManager.Put(chat.Message{
 		Role:    "assistant",
 		Content: content,
 	})
 
-	h.LogInfo(fmt.Sprintf("VLLLM回复处理完成 …%v", map[string]interface{}{
-		"content_length": len(content),
-		"text_segments":  textIndex,
-	}))
+	h.LogInfo("VLLLM回复处理完成", "content_length", len(content), "text_segments", textIndex, utils.FieldRound, round)
 
 	return nil
 }
@@ -2,11 +2,21 @@ package core
 
 import (
 	"context"
-	"encoding/json"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/kb"
+	"xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
-	"xiaozhi-server-go/src/vision"
-	"xiaozhi-server-go/src/core/kb"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/google/uuid"
 )
 
 func (h *ConnectionHandler) initMCPResultHandlers() {
@@ -14,10 +24,12 @@ func (h *ConnectionHandler) initMCPResultHandlers() {
 	// 这里可以添加更多的处理器初始化逻辑
 	h.mcpResultHandlers = map[string]func(args interface{}){
 		"mcp_handler_exit":         h.mcp_handler_exit,
-		"mcp_handler_take_photo":   h.mcp_handler_take_photo,
+		mcp.ToolContentHandler:     h.mcp_handler_tool_content,
+		visionResultHandler:        h.mcp_handler_vision_result,
 		"mcp_handler_change_voice": h.mcp_handler_change_voice,
 		"mcp_handler_change_role":  h.mcp_handler_change_role,
 		"mcp_handler_play_music":   h.mcp_handler_play_music,
+		"mcp_handler_gen_pic":      h.mcp_handler_gen_pic,
 	}
 }
 
@@ -38,6 +50,10 @@ func (h *ConnectionHandler) handleMCPResultCall(result types.ActionResponse) str
 		if handler, exists := h.mcpResultHandlers[Caller.FuncName]; exists {
 			// 调用对应的处理函数
 			handler(Caller.Args)
+			// 多模态结果中的文本作为工具结果写入对话历史
+			if toolResult, ok := Caller.Args.(mcp.ToolResult); ok && toolResult.Text() != "" {
+				return toolResult.Text()
+			}
 			return "调用工具成功: " + Caller.FuncName
 		} else {
 			h.logger.Error("handleMCPResultCall: no handler found for function %s", Caller.FuncName)
@@ -63,8 +79,9 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) {
 		var err error
 		songs, err = kb.Search(songName, 1)
 		if err != nil || len(songs) == 0 {
-			h.logger.Error("mcp_handler_play_music: SearchSingle failed: %v", err)
-			h.SystemSpeak("搜索歌曲" + songName + "失败")
+			// 知识库不可用或没有结果时，退回文件名模糊匹配
+			h.logger.Warn("mcp_handler_play_music: SearchSingle failed: %v", err)
+			h.playMusicFuzzy(songName)
 			return
 		}
 		songName = songs[0].Title
@@ -80,9 +97,11 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) {
 
 	s, err := kb.Search(songRequirement, h.config.MusicService.MusicListNum)
 	if err != nil || len(s) == 0 {
-		h.logger.Error("mcp_handler_search_music: Search failed: %v", err)
-		h.SystemSpeak("搜索音乐失败")
-		return
+		h.logger.Warn("mcp_handler_search_music: Search failed: %v", err)
+		if len(songs) == 0 {
+			h.playMusicFuzzy(songRequirement)
+			return
+		}
 	}
 
 	for _, song := range s {
@@ -103,6 +122,15 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) {
 		h.logger.Info("准备播放的音乐: %s", song.Title)
 		songName := song.Title
 
+		// 导入时记录了文件路径的歌曲直接播放
+		if song.File != "" {
+			if _, err := os.Stat(song.File); err == nil {
+				musicPaths = append(musicPaths, song.File)
+				musicNames = append(musicNames, songName)
+				continue
+			}
+		}
+
 		if path, name, err := utils.GetMusicFilePathFuzzy(songName); err != nil {
 			h.logger.Error("mcp_handler_play_music: Get path failed for %s: %v", songName, err)
 		} else {
@@ -115,13 +143,27 @@ func (h *ConnectionHandler) mcp_handler_play_music(args interface{}) {
 	// 如果找到了至少一首歌曲的路径，则播放
 	if len(musicPaths) > 0 {
 		//h.SystemSpeak("这就为您播放找到的音乐")
-		h.sendMusic(musicPaths, musicNames, h.tts_last_text_index, h.talkRound)
+		h.sendMusic(musicPaths, musicNames, h.lastTextIndex(), h.talkRound)
 	} else {
 		h.logger.Error("mcp_handler_play_music: No music paths found")
 		h.SystemSpeak("没有找到任何歌曲的播放路径")
 	}
 }
 
+// playMusicFuzzy 按文件名模糊匹配播放音乐，知识库不可用时使用
+func (h *ConnectionHandler) playMusicFuzzy(songName string) {
+	if songName == "" {
+		songName = "random"
+	}
+	path, name, err := utils.GetMusicFilePathFuzzy(songName)
+	if err != nil {
+		h.logger.Error("playMusicFuzzy: Get path failed for %s: %v", songName, err)
+		h.SystemSpeak("没有找到歌曲" + songName)
+		return
+	}
+	h.sendMusic([]string{path}, []string{name}, h.lastTextIndex(), h.talkRound)
+}
+
 func (h *ConnectionHandler) mcp_handler_change_voice(args interface{}) {
 	if voice, ok := args.(string); ok {
 		h.logger.Info("mcp_handler_change_voice: %s", voice)
@@ -129,6 +171,7 @@ func (h *ConnectionHandler) mcp_handler_change_voice(args interface{}) {
 			h.logger.Error("mcp_handler_change_voice: SetVoice failed: %v", err)
 			h.SystemSpeak("切换语音失败，没有叫" + voice + "的音色")
 		} else {
+			h.resetQuickReplyCache()
 			h.SystemSpeak("已切换到音色" + voice)
 		}
 	} else {
@@ -137,28 +180,45 @@ func (h *ConnectionHandler) mcp_handler_change_voice(args interface{}) {
 }
 
 func (h *ConnectionHandler) mcp_handler_change_role(args interface{}) {
-	if params, ok := args.(map[string]string); ok {
-		role := params["role"]
-		prompt := params["prompt"]
-
-		h.logger.Info("mcp_handler_change_role: %s", role)
-		h.dialogueManager.SetSystemMessage(prompt)
-		h.dialogueManager.KeepRecentMessages(5) // 保留最近5条消息
-		if getter, ok := h.providers.tts.(configGetter); ok {
-			ttsProvider := getter.Config().Type
-			if ttsProvider == "edge" {
-				if role == "陕西女友" {
-					h.providers.tts.SetVoice("zh-CN-shaanxi-XiaoniNeural") // 陕西女友音色
-				} else if role == "英语老师" {
-					h.providers.tts.SetVoice("zh-CN-XiaoyiNeural") // 英语老师音色
-				} else if role == "好奇小男孩" {
-					h.providers.tts.SetVoice("zh-CN-YunxiNeural") // 好奇小男孩音色
-				}
-			}
+	params, ok := args.(map[string]string)
+	if !ok {
+		h.logger.Error("mcp_handler_change_role: args is not a map[string]string")
+		return
+	}
+	name := params["role"]
+	h.logger.Info("mcp_handler_change_role: %s", name)
+
+	var role *models.Role
+	if roleDB := database.GetRoleDB(); roleDB != nil {
+		r, err := roleDB.GetRole(name)
+		if err != nil {
+			h.logger.Error("mcp_handler_change_role: GetRole failed: %v", err)
+			h.SystemSpeak("没有找到角色" + name)
+			return
+		}
+		role = r
+	} else {
+		// 没有数据库时使用配置文件中的提示词
+		role = &models.Role{Name: name, Prompt: params["prompt"]}
+	}
+
+	if err := h.applyRole(role); err != nil {
+		h.logger.Error("mcp_handler_change_role: %v", err)
+		h.SystemSpeak("切换角色失败")
+		return
+	}
+	h.dialogueManager.KeepRecentMessages(5) // 保留最近5条消息
+
+	if roleDB := database.GetRoleDB(); roleDB != nil && h.deviceID != "" {
+		if err := roleDB.SetDeviceRole(h.deviceID, role.Name); err != nil {
+			h.logger.Warn("mcp_handler_change_role: 保存设备角色失败: %v", err)
 		}
-		h.SystemSpeak("已切换到新角色 " + role)
+	}
+
+	if role.Greeting != "" {
+		h.SystemSpeak(role.Greeting)
 	} else {
-		h.logger.Error("mcp_handler_change_role: args is not a string")
+		h.SystemSpeak("已切换到新角色 " + role.Name)
 	}
 }
 
@@ -171,19 +231,136 @@ func (h *ConnectionHandler) mcp_handler_exit(args interface{}) {
 	}
 }
 
-func (h *ConnectionHandler) mcp_handler_take_photo(args interface{}) {
-	// 特殊处理拍照函数，解析为VisionResponse
-	resultStr, _ := args.(string)
-	var visionResponse vision.VisionResponse
-	if err := json.Unmarshal([]byte(resultStr), &visionResponse); err != nil {
-		h.logger.Error("解析VisionResponse失败: %v", err)
+// mcp_handler_tool_content 处理包含图片或音频的MCP工具结果，音频直接播放，图片交给VLLLM生成回复
+func (h *ConnectionHandler) mcp_handler_tool_content(args interface{}) {
+	result, ok := args.(mcp.ToolResult)
+	if !ok {
+		h.logger.Error("mcp_handler_tool_content: args is not a ToolResult")
+		return
+	}
+	images := result.ByType(mcp.ContentTypeImage)
+	audios := result.ByType(mcp.ContentTypeAudio)
+	h.logger.Info("mcp_handler_tool_content: %s 返回图片%d张，音频%d段", result.ToolName, len(images), len(audios))
+
+	if len(audios) > 0 {
+		// 有图片时由VLLLM的回复结束本轮播放
+		h.playToolAudio(audios, len(images) == 0)
+	}
+	if len(images) > 0 {
+		h.answerWithToolImage(result, images[0])
+	}
+}
+
+// playToolAudio 将工具返回的音频写入临时文件后按顺序播放
+func (h *ConnectionHandler) playToolAudio(audios []mcp.ToolContent, finishRound bool) {
+	dir := filepath.Join("tmp", "mcp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		h.logger.Error("playToolAudio: 创建临时目录失败: %v", err)
+		return
+	}
+
+	var files []string
+	for _, audio := range audios {
+		ext := toolAudioExt(audio.MIMEType)
+		if ext == "" {
+			h.logger.Warn("playToolAudio: 不支持的音频格式 %s", audio.MIMEType)
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(audio.Data)
+		if err != nil {
+			h.logger.Error("playToolAudio: 音频base64解码失败: %v", err)
+			continue
+		}
+		file := filepath.Join(dir, uuid.New().String()+ext)
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			h.logger.Error("playToolAudio: 写入音频文件失败: %v", err)
+			continue
+		}
+		files = append(files, file)
+	}
+
+	base := 0
+	if finishRound && len(files) > 0 {
+		// 接在本轮已排队的分段之后编号，最后一段音频结束本轮
+		base = max(h.lastTextIndex(), 0)
+		h.setLastTextIndex(base + len(files))
+	}
+	for i, file := range files {
+		textIndex := 0
+		if finishRound {
+			textIndex = base + i + 1
+		}
+		h.audioMessagesQueue <- struct {
+			filepath  string
+			text      string
+			round     int
+			textIndex int
+		}{file, "", h.talkRound, textIndex}
+	}
+}
+
+// answerWithToolImage 将工具返回的图片经VLLLM识别后回答用户，未配置VLLLM时退回普通LLM
+func (h *ConnectionHandler) answerWithToolImage(result mcp.ToolResult, img mcp.ToolContent) {
+	question := ""
+	messages := make([]providers.Message, 0)
+	for _, msg := range h.dialogueManager.GetLLMDialogue() {
+		if msg.Content == "" || (msg.Role != "user" && msg.Role != "assistant" && msg.Role != "system") {
+			continue
+		}
+		if msg.Role == "user" {
+			question = msg.Content
+		}
+		messages = append(messages, providers.Message{Role: msg.Role, Content: msg.Content})
+	}
+
+	prompt := fmt.Sprintf("工具%s返回了一张图片", result.ToolName)
+	if text := result.Text(); text != "" {
+		prompt += "，附带说明：" + text
 	}
+	prompt += "。请结合图片回答用户的问题：" + question
 
-	if !visionResponse.Success {
-		h.logger.Error("拍照失败: %s", visionResponse.Message)
-		h.genResponseByLLM(context.Background(), h.dialogueManager.GetLLMDialogue(), h.talkRound)
+	if h.providers.vlllm == nil {
+		h.logger.Warn("answerWithToolImage: 未配置VLLLM服务，无法识别工具返回的图片")
+		messages = append(messages, providers.Message{
+			Role:    "user",
+			Content: prompt + "（注：当前无法识别图片，只能根据文字回答）",
+		})
+		h.genResponseByLLM(context.Background(), messages, h.talkRound)
+		return
+	}
 
+	ctx := context.Background()
+	ref, err := h.providers.vlllm.ProcessImage(ctx, image.ImageData{
+		Data:   img.Data,
+		Format: strings.TrimPrefix(img.MIMEType, "image/"),
+	})
+	if err != nil {
+		h.logger.Warn("answerWithToolImage: %v", err)
+		messages = append(messages, providers.Message{
+			Role:    "user",
+			Content: prompt + "（注：当前无法识别图片，只能根据文字回答）",
+		})
+		h.genResponseByLLM(ctx, messages, h.talkRound)
+		return
+	}
+	ref.Source = "tool"
+	messages = append(messages, providers.Message{
+		Role:    "user",
+		Content: prompt,
+		Images:  []providers.ImageRef{ref},
+	})
+	if err := h.genResponseByVLLM(ctx, messages, prompt, h.talkRound); err != nil {
+		h.logger.Error("answerWithToolImage: %v", err)
 	}
+}
 
-	h.SystemSpeak(visionResponse.Result)
+// toolAudioExt 工具音频的MIME类型对应的文件扩展名，仅支持可转码的mp3和wav
+func toolAudioExt(mimeType string) string {
+	switch strings.ToLower(mimeType) {
+	case "audio/mpeg", "audio/mp3":
+		return ".mp3"
+	case "audio/wav", "audio/x-wav", "audio/wave", "audio/vnd.wave":
+		return ".wav"
+	}
+	return ""
 }
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
+	"time"
 	"xiaozhi-server-go/src/core/chat"
 	"xiaozhi-server-go/src/core/image"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/imagegen"
+	"xiaozhi-server-go/src/core/providers/ocr"
 	"xiaozhi-server-go/src/core/utils"
 )
 
@@ -27,12 +29,12 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 				// 解码opus数据为PCM
 				decodedData, err := h.opusDecoder.Decode(message)
 				if err != nil {
-					h.logger.Error(fmt.Sprintf("解码Opus音频失败: %v", err))
+					h.logger.Error("解码Opus音频失败: %v", err)
 					// 即使解码失败，也尝试将原始数据传递给ASR处理
 					h.clientAudioQueue <- message
 				} else {
 					// 解码成功，将PCM数据放入队列
-					h.logger.Debug(fmt.Sprintf("Opus解码成功: %d bytes -> %d bytes", len(message), len(decodedData)))
+					h.logger.Debug("Opus解码成功: %d bytes -> %d bytes", len(message), len(decodedData))
 					if len(decodedData) > 0 {
 						h.clientAudioQueue <- decodedData
 					}
@@ -44,7 +46,7 @@ func (h *ConnectionHandler) handleMessage(messageType int, message []byte) error
 		}
 		return nil
 	default:
-		h.logger.Error(fmt.Sprintf("未知的消息类型: %d", messageType))
+		h.logger.Error("未知的消息类型: %d", messageType)
 		return fmt.Errorf("未知的消息类型: %d", messageType)
 	}
 }
@@ -86,13 +88,13 @@ func (h *ConnectionHandler) processClientTextMessage(ctx context.Context, text s
 	case "chat":
 		return h.handleChatMessage(ctx, text)
 	case "vision":
-		return h.handleVisionMessage(msgMap)
+		return h.handleVisionMessage(ctx, msgMap)
 	case "image":
 		return h.handleImageMessage(ctx, msgMap)
 	case "mcp":
 		return h.mcpManager.HandleXiaoZhiMCPMessage(msgMap)
 	default:
-		h.logger.Warn("=== 未知消息类型 ===", map[string]interface{}{
+		h.logger.WarnKV("=== 未知消息类型 ===", map[string]interface{}{
 			"unknown_type": msgType,
 			"full_message": msgMap,
 		})
@@ -100,12 +102,24 @@ func (h *ConnectionHandler) processClientTextMessage(ctx context.Context, text s
 	}
 }
 
-func (h *ConnectionHandler) handleVisionMessage(msgMap map[string]interface{}) error {
+func (h *ConnectionHandler) handleVisionMessage(ctx context.Context, msgMap map[string]interface{}) error {
 	// 处理视觉消息
-	cmd := msgMap["cmd"].(string)
+	cmd, _ := msgMap["cmd"].(string)
 	if cmd == "gen_pic" {
+		// 提示词在text中，消息中的width、height、format覆盖hello上报的屏幕信息
+		prompt, _ := msgMap["text"].(string)
+		display := h.clientDisplay.Merge(imagegen.ParseDisplay(msgMap))
+		if err := h.genPic(prompt, display); err != nil {
+			h.logger.Warn("生成图片失败: %v", err)
+			return h.sendVisionMessage(cmd, "error", map[string]interface{}{"message": err.Error()})
+		}
 	} else if cmd == "gen_video" {
+		return h.sendVisionMessage(cmd, "error", map[string]interface{}{"message": "暂不支持生成视频"})
 	} else if cmd == "read_img" {
+		// 设备上传的图片和问题，与image消息一样在当前对话中识别
+		return h.handleImageMessage(ctx, msgMap)
+	} else {
+		return fmt.Errorf("未知的vision命令: %s", cmd)
 	}
 	return nil
 }
@@ -113,15 +127,11 @@ func (h *ConnectionHandler) handleVisionMessage(msgMap map[string]interface{}) e
 // handleHelloMessage 处理欢迎消息
 // 客户端会上传语音格式和采样率等信息
 func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) error {
-	h.LogInfo("收到客户端欢迎消息: " + fmt.Sprintf("%v", msgMap))
+	h.logger.InfoKV("收到客户端欢迎消息", "hello", msgMap)
 	// 获取客户端编码格式
 	if audioParams, ok := msgMap["audio_params"].(map[string]interface{}); ok {
 		if format, ok := audioParams["format"].(string); ok {
 			h.clientAudioFormat = format
-			if format == "pcm" {
-				// 客户端使用PCM格式，服务端也使用PCM格式
-				h.serverAudioFormat = "pcm"
-			}
 		}
 		if sampleRate, ok := audioParams["sample_rate"].(float64); ok {
 			h.clientAudioSampleRate = int(sampleRate)
@@ -132,8 +142,26 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 		if frameDuration, ok := audioParams["frame_duration"].(float64); ok {
 			h.clientAudioFrameDuration = int(frameDuration)
 		}
-		h.LogInfo(fmt.Sprintf("客户端音频参数: format=%s, sample_rate=%d, channels=%d, frame_duration=%d",
-			h.clientAudioFormat, h.clientAudioSampleRate, h.clientAudioChannels, h.clientAudioFrameDuration))
+		// 设备播放缓冲大小，下行预缓冲不会超过它
+		if bufferMs, ok := audioParams["buffer_ms"].(float64); ok && bufferMs > 0 {
+			h.playout.SetDeviceBuffer(time.Duration(bufferMs) * time.Millisecond)
+			h.logger.InfoKV("设备播放缓冲", "buffer_ms", int(bufferMs))
+		}
+		h.logger.InfoKV("客户端音频参数",
+			"format", h.clientAudioFormat,
+			"sample_rate", h.clientAudioSampleRate,
+			"channels", h.clientAudioChannels,
+			"frame_duration", h.clientAudioFrameDuration,
+		)
+
+		// 协商下行音频格式、采样率和帧长
+		h.setOutputAudioParams(utils.NegotiateAudioParams(audioParams))
+		h.logger.InfoKV("下行音频参数", "params", h.outputAudioParams().String())
+	}
+	// 有屏幕的设备上报屏幕尺寸和支持的图片格式，如 "display": {"width":240,"height":240,"format":"jpeg"}
+	if display, ok := msgMap["display"].(map[string]interface{}); ok {
+		h.clientDisplay = imagegen.ParseDisplay(display)
+		h.logger.InfoKV("设备屏幕", "width", h.clientDisplay.Width, "height", h.clientDisplay.Height, "format", h.clientDisplay.Format)
 	}
 	h.sendHelloMessage()
 	h.closeOpusDecoder()
@@ -143,7 +171,7 @@ func (h *ConnectionHandler) handleHelloMessage(msgMap map[string]interface{}) er
 		MaxChannels: h.clientAudioChannels,   // 单声道音频
 	})
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("初始化Opus解码器失败: %v", err))
+		h.logger.Error("初始化Opus解码器失败: %v", err)
 	} else {
 		h.opusDecoder = opusDecoder
 		h.LogInfo("Opus解码器初始化成功")
@@ -164,7 +192,7 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 	// 处理mode参数
 	if mode, ok := msgMap["mode"].(string); ok {
 		h.clientListenMode = mode
-		h.LogInfo(fmt.Sprintf("客户端拾音模式：%s， %s", h.clientListenMode, state))
+		h.logger.InfoKV("客户端拾音模式", "mode", h.clientListenMode, "state", state)
 		h.providers.asr.SetListener(h)
 	}
 
@@ -183,9 +211,7 @@ func (h *ConnectionHandler) handleListenMessage(msgMap map[string]interface{}) e
 
 		if hasText && text != "" {
 			// 只有文本，使用普通LLM处理
-			h.LogInfo(fmt.Sprintf("检测到纯文本消息，使用LLM处理 %v", map[string]interface{}{
-				"text": text,
-			}))
+			h.logger.InfoKV("检测到纯文本消息，使用LLM处理", "text", text)
 			return h.handleChatMessage(context.Background(), text)
 		} else {
 			// 既没有图片也没有文本
@@ -201,12 +227,12 @@ func (h *ConnectionHandler) handleIotMessage(msgMap map[string]interface{}) erro
 	if descriptors, ok := msgMap["descriptors"].([]interface{}); ok {
 		// 处理设备描述符
 		// 这里需要实现具体的IOT设备描述符处理逻辑
-		h.LogInfo(fmt.Sprintf("收到IOT设备描述符：%v", descriptors))
+		h.logger.InfoKV("收到IOT设备描述符", "descriptors", descriptors)
 	}
 	if states, ok := msgMap["states"].([]interface{}); ok {
 		// 处理设备状态
 		// 这里需要实现具体的IOT设备状态处理逻辑
-		h.LogInfo(fmt.Sprintf("收到IOT设备状态：%v", states))
+		h.logger.InfoKV("收到IOT设备状态", "states", states)
 	}
 	return nil
 }
@@ -216,10 +242,11 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 	// 增加对话轮次
 	h.talkRound++
 	currentRound := h.talkRound
-	h.LogInfo(fmt.Sprintf("开始新的图片对话轮次: %d", currentRound))
+	ctx = h.beginTurn(ctx, currentRound, "")
+	h.logger.InfoKV("开始新的图片对话轮次", utils.FieldRound, currentRound)
 
-	// 检查是否有VLLLM Provider
-	if h.providers.vlllm == nil {
+	// 检查是否有VLLLM Provider，只配置了OCR时仍可按文档模式识别
+	if h.providers.vlllm == nil && ocr.Default() == nil {
 		h.logger.Warn("未配置VLLLM服务，图片消息将被忽略")
 		return h.conn.WriteMessage(1, []byte("系统暂不支持图片处理功能"))
 	}
@@ -252,52 +279,67 @@ func (h *ConnectionHandler) handleImageMessage(ctx context.Context, msgMap map[s
 		return fmt.Errorf("图片数据为空")
 	}
 
-	h.LogInfo(fmt.Sprintf("收到图片消息 %v", map[string]interface{}{
-		"text":        text,
-		"has_url":     imageData.URL != "",
-		"has_data":    imageData.Data != "",
-		"format":      imageData.Format,
-		"data_length": len(imageData.Data),
-	}))
+	h.logger.InfoKV("收到图片消息",
+		"text", text,
+		"has_url", imageData.URL != "",
+		"has_data", imageData.Data != "",
+		"format", imageData.Format,
+		"data_length", len(imageData.Data),
+	)
 
 	// 立即发送STT消息
 	err := h.sendSTTMessage(text)
 	if err != nil {
-		h.logger.Error(fmt.Sprintf("发送STT消息失败: %v", err))
+		h.logger.Error("发送STT消息失败: %v", err)
 		return fmt.Errorf("发送STT消息失败: %v", err)
 	}
 
 	// 发送TTS开始状态
 	if err := h.sendTTSMessage("start", "", 0); err != nil {
-		h.logger.Error(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+		h.logger.Error("发送TTS开始状态失败: %v", err)
 		return fmt.Errorf("发送TTS开始状态失败: %v", err)
 	}
 
 	// 发送思考状态的情绪
 	if err := h.sendEmotionMessage("thinking"); err != nil {
-		h.logger.Error(fmt.Sprintf("发送思考状态情绪消息失败: %v", err))
+		h.logger.Error("发送思考状态情绪消息失败: %v", err)
 		return fmt.Errorf("发送情绪消息失败: %v", err)
 	}
 
-	// 添加用户消息到对话历史（包含图片信息的描述）
-	userMessage := fmt.Sprintf("%s [用户发送了一张%s格式的图片]", text, imageData.Format)
-	h.dialogueManager.Put(chat.Message{
-		Role:    "user",
-		Content: userMessage,
-	})
+	// 超出用量配额时不再识图
+	if !h.checkQuota(currentRound) {
+		return nil
+	}
 
-	// 获取对话历史
-	messages := make([]providers.Message, 0)
-	for _, msg := range h.dialogueManager.GetLLMDialogue() {
-		// 排除包含图片信息的最后一条消息，因为我们要用VLLLM处理
-		if msg.Role == "user" && strings.Contains(msg.Content, "[用户发送了一张") {
-			continue
-		}
-		messages = append(messages, providers.Message{
-			Role:    msg.Role,
-			Content: msg.Content,
+	// 菜单、药品说明、作业等文字图片先识别文字，再交给LLM朗读、翻译或讲解
+	mode, _ := msgMap["mode"].(string)
+	if handled, err := h.answerDocument(ctx, mode, imageData, text, currentRound); handled {
+		return err
+	}
+	if h.providers.vlllm == nil {
+		h.dialogueManager.Put(chat.Message{
+			Role:    "user",
+			Content: fmt.Sprintf("用户发送了一张图片并询问：%s（注：当前无法处理图片，只能根据文字回答）", text),
 		})
+		return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), currentRound)
 	}
 
-	return h.genResponseByVLLM(ctx, messages, imageData, text, currentRound)
+	// 图片随用户消息保存在对话历史中，后续追问可以继续引用
+	ref, err := h.providers.vlllm.ProcessImage(ctx, imageData)
+	if err != nil {
+		h.LogError("图片处理失败，降级到普通LLM", utils.FieldError, err)
+		h.dialogueManager.Put(chat.Message{
+			Role:    "user",
+			Content: fmt.Sprintf("用户发送了一张图片并询问：%s（注：当前无法处理图片，只能根据文字回答）", text),
+		})
+		return h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), currentRound)
+	}
+	ref.Source = "device"
+	h.dialogueManager.Put(chat.Message{
+		Role:    "user",
+		Content: text,
+		Images:  []providers.ImageRef{ref},
+	})
+
+	return h.genResponseByVLLM(ctx, h.visionDialogue(), text, currentRound)
 }
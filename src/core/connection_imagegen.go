@@ -0,0 +1,111 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"xiaozhi-server-go/src/core/providers/imagegen"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/task"
+)
+
+// taskTypeGenPic 生成图片的异步任务，占用设备用户级别的任务配额
+const taskTypeGenPic task.TaskType = "gen_pic"
+
+func init() {
+	task.RegisterTaskExecutor(taskTypeGenPic, executeGenPic)
+}
+
+// executeGenPic 在任务工作池中生成图片，结果为*imagegen.Image
+func executeGenPic(t *task.Task) error {
+	generator := imagegen.Default()
+	if generator == nil {
+		return fmt.Errorf("未配置图片生成")
+	}
+	params, _ := t.Params.(map[string]interface{})
+	prompt, _ := params["prompt"].(string)
+	display, _ := params["display"].(imagegen.Display)
+	img, err := generator.Generate(t.Context, prompt, display)
+	if err != nil {
+		return err
+	}
+	t.Result = img
+	return nil
+}
+
+// genPic 检查配额后提交生成图片的任务，完成后通过vision消息把图片地址发给设备
+func (h *ConnectionHandler) genPic(prompt string, display imagegen.Display) error {
+	if imagegen.Default() == nil {
+		return fmt.Errorf("未配置图片生成")
+	}
+	if prompt == "" {
+		return fmt.Errorf("缺少画面描述")
+	}
+	if err := usage.Default().Check(h.deviceID); err != nil {
+		return err
+	}
+	h.LogInfo("提交生成图片任务", "prompt", prompt, "width", display.Width, "height", display.Height)
+	h.sendVisionMessage("gen_pic", "start", map[string]interface{}{"prompt": prompt})
+	if err := h.SubmitTask(string(taskTypeGenPic), map[string]interface{}{
+		"prompt":  prompt,
+		"display": display,
+	}); err != nil {
+		return fmt.Errorf("提交任务失败: %w", err)
+	}
+	return nil
+}
+
+// handleGenPicComplete 把生成结果发给设备，失败时result为包含error的map
+func (h *ConnectionHandler) handleGenPicComplete(result interface{}) {
+	img, ok := result.(*imagegen.Image)
+	if !ok {
+		message := "生成图片失败"
+		if m, ok := result.(map[string]interface{}); ok {
+			if errMsg, ok := m["error"].(string); ok {
+				message = errMsg
+			}
+		}
+		h.logger.Warn("生成图片失败: %s", message)
+		h.sendVisionMessage("gen_pic", "error", map[string]interface{}{"message": message})
+		return
+	}
+
+	usage.Default().Record(h.deviceID, usage.MetricImageCalls, 1)
+	h.sendVisionMessage("gen_pic", "done", map[string]interface{}{
+		"url":    img.URL,
+		"width":  img.Width,
+		"height": img.Height,
+		"format": img.Format,
+		"prompt": img.Prompt,
+	})
+}
+
+// mcp_handler_gen_pic 处理画图工具调用
+func (h *ConnectionHandler) mcp_handler_gen_pic(args interface{}) {
+	prompt, _ := args.(string)
+	if err := h.genPic(prompt, h.clientDisplay); err != nil {
+		h.logger.Warn("mcp_handler_gen_pic: %v", err)
+		h.sendVisionMessage("gen_pic", "error", map[string]interface{}{"message": err.Error()})
+		h.SystemSpeak("画图失败了，请稍后再试")
+		return
+	}
+	h.SystemSpeak("好的，正在画，画好后会显示在屏幕上")
+}
+
+// sendVisionMessage 发送vision消息，state为start、done或error
+func (h *ConnectionHandler) sendVisionMessage(cmd, state string, fields map[string]interface{}) error {
+	msg := map[string]interface{}{
+		"type":       "vision",
+		"cmd":        cmd,
+		"state":      state,
+		"session_id": h.sessionID,
+	}
+	for k, v := range fields {
+		msg[k] = v
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("序列化vision消息失败: %v", err)
+	}
+	return h.conn.WriteMessage(1, data)
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// DeviceInfo 在线设备信息
+type DeviceInfo struct {
+	DeviceID    string    `json:"device_id"`
+	ClientID    string    `json:"client_id"`
+	SessionID   string    `json:"session_id"`
+	Role        string    `json:"role,omitempty"`
+	Speaking    bool      `json:"speaking"`
+	ConnectedAt time.Time `json:"connected_at"`
+
+	Playout utils.PlayoutStats `json:"playout"` // 下行音频播放统计
+}
+
+// connections 在线连接，key为设备ID，没有设备ID时为会话ID
+var connections sync.Map
+
+// registerConnection 连接完成MCP绑定后登记，同一设备重连时覆盖旧连接
+func (h *ConnectionHandler) registerConnection() {
+	atomic.StoreInt64(&h.connectedAt, time.Now().UnixNano())
+	connections.Store(h.connectionKey(), h)
+}
+
+// unregisterConnection 连接关闭时注销，只删除自己登记的连接
+func (h *ConnectionHandler) unregisterConnection() {
+	connections.CompareAndDelete(h.connectionKey(), h)
+}
+
+func (h *ConnectionHandler) connectionKey() string {
+	if h.deviceID != "" {
+		return h.deviceID
+	}
+	return h.sessionID
+}
+
+// ListDevices 列出所有在线设备
+func ListDevices() []DeviceInfo {
+	devices := make([]DeviceInfo, 0)
+	connections.Range(func(key, value interface{}) bool {
+		devices = append(devices, value.(*ConnectionHandler).Info())
+		return true
+	})
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ConnectedAt.Before(devices[j].ConnectedAt)
+	})
+	return devices
+}
+
+// GetConnection 按设备ID或会话ID查找在线连接
+func GetConnection(deviceID string) (*ConnectionHandler, bool) {
+	if value, ok := connections.Load(deviceID); ok {
+		return value.(*ConnectionHandler), true
+	}
+	return nil, false
+}
+
+// Info 连接的设备信息
+func (h *ConnectionHandler) Info() DeviceInfo {
+	info := DeviceInfo{
+		DeviceID:    h.deviceID,
+		ClientID:    h.clientId,
+		SessionID:   h.sessionID,
+		Speaking:    h.isServerSpeaking(),
+		ConnectedAt: time.Unix(0, atomic.LoadInt64(&h.connectedAt)),
+		Playout:     h.playout.Stats(),
+	}
+	if role := h.activeRole(); role != nil {
+		info.Role = role.Name
+	}
+	return info
+}
+
+// speakTask 外部触发的播报请求，done返回播报是否开始
+type speakTask struct {
+	text string
+	done chan error
+}
+
+// Speak 由外部触发设备播报一段文本，会打断当前播报，播报内容记入对话历史
+// 播报交给连接的文本消息协程执行，避免与设备消息同时修改轮次和对话历史；连接协程阻塞时在ctx结束后返回
+func (h *ConnectionHandler) Speak(ctx context.Context, text string) error {
+	if text == "" {
+		return fmt.Errorf("播报文本为空")
+	}
+	task := speakTask{text: text, done: make(chan error, 1)}
+	select {
+	case h.speakQueue <- task:
+	case <-h.stopChan:
+		return fmt.Errorf("设备未连接")
+	case <-ctx.Done():
+		return fmt.Errorf("等待连接处理播报超时: %v", ctx.Err())
+	}
+	select {
+	case err := <-task.done:
+		return err
+	case <-h.stopChan:
+		return fmt.Errorf("设备未连接")
+	case <-ctx.Done():
+		return fmt.Errorf("等待播报开始超时: %v", ctx.Err())
+	}
+}
+
+// speak 打断当前播报并开始新的一轮播报
+func (h *ConnectionHandler) speak(text string) error {
+	if h.conn == nil {
+		return fmt.Errorf("设备未连接")
+	}
+	if h.isServerSpeaking() {
+		h.stopServerSpeak()
+	}
+
+	h.talkRound++
+	h.roundStartTime = time.Now()
+	h.beginTurn(context.Background(), h.talkRound, text)
+	atomic.StoreInt32(&h.serverVoiceStop, 0)
+	h.logger.InfoKV("外部触发播报", utils.FieldRound, h.talkRound, "text", text)
+	if err := h.sendTTSMessage("start", "", 0); err != nil {
+		return fmt.Errorf("发送TTS开始状态失败: %v", err)
+	}
+	h.dialogueManager.Put(chat.Message{
+		Role:    "assistant",
+		Content: text,
+	})
+	return h.SystemSpeak(text)
+}
+
+// DeviceTools 设备端上报的MCP工具
+func (h *ConnectionHandler) DeviceTools() ([]openai.Tool, error) {
+	if h.mcpManager == nil || h.mcpManager.XiaoZhiMCPClient == nil || !h.mcpManager.XiaoZhiMCPClient.IsReady() {
+		return nil, fmt.Errorf("设备端MCP尚未就绪")
+	}
+	return h.mcpManager.XiaoZhiMCPClient.GetAvailableTools(), nil
+}
+
+// CallDeviceTool 通过设备端MCP调用工具
+func (h *ConnectionHandler) CallDeviceTool(ctx context.Context, name string, args map[string]interface{}) (interface{}, error) {
+	if _, err := h.DeviceTools(); err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	h.logger.InfoKV("外部调用设备工具", "tool", name, "arguments", args)
+	return h.mcpManager.XiaoZhiMCPClient.CallTool(ctx, name, args)
+}
+
+// Conversation 最近的用户和助手对话，limit<=0时返回全部
+func (h *ConnectionHandler) Conversation(limit int) []chat.Message {
+	messages := make([]chat.Message, 0)
+	for _, msg := range h.dialogueManager.GetLLMDialogue() {
+		if (msg.Role == "user" || msg.Role == "assistant") && msg.Content != "" {
+			messages = append(messages, chat.Message{Role: msg.Role, Content: msg.Content})
+		}
+	}
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	return messages
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/kb"
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/quickreply"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// alwaysAllowedTools 角色限制工具时仍然可用的工具，保证可以切回其他角色或退出
+var alwaysAllowedTools = []string{"change_role", "exit"}
+
+// applyRole 切换到指定角色，nil表示恢复默认设置
+// 先设置音色，失败时不做任何修改；成功后再一起替换提示词、快速回复、温度、工具和知识库
+func (h *ConnectionHandler) applyRole(role *models.Role) error {
+	voice := h.initailVoice
+	prompt := h.config.DefaultPrompt
+	if role != nil {
+		if role.Voice != "" {
+			voice = role.Voice
+		}
+		if role.Prompt != "" {
+			prompt = role.Prompt
+		}
+	}
+
+	if h.providers.tts != nil && voice != "" {
+		if err := h.providers.tts.SetVoice(voice); err != nil {
+			return fmt.Errorf("设置音色%s失败: %v", voice, err)
+		}
+	}
+
+	h.roleMutex.Lock()
+	h.role = role
+	h.roleMutex.Unlock()
+
+	h.dialogueManager.SetSystemMessage(prompt)
+	h.resetQuickReplyCache()
+	h.updateASRHotwords()
+	return nil
+}
+
+// updateASRHotwords 合并设备、角色、全局热词和音乐知识库歌名，设置到ASR
+func (h *ConnectionHandler) updateASRHotwords() {
+	if h.providers.asr == nil {
+		return
+	}
+	cfg := &h.config.ASRHotwords
+	var roleWords []string
+	if role := h.activeRole(); role != nil {
+		roleWords = append(append([]string{}, cfg.Roles[role.Name]...), role.HotwordList()...)
+	}
+	var musicWords []string
+	if cfg.MusicTitles && kb.Available() {
+		for _, song := range kb.List() {
+			musicWords = append(musicWords, song.Title, song.Artist)
+		}
+	}
+
+	limit := cfg.MaxWords
+	if limit <= 0 {
+		limit = 100
+	}
+	hotwords := asr.MergeHotwords(limit, cfg.Devices[h.deviceID], roleWords, cfg.Words, musicWords)
+	h.providers.asr.SetHotwords(hotwords)
+	h.logger.Debug("设置识别热词%d个", len(hotwords))
+}
+
+// resetQuickReplyCache 音色变化后切换快速回复缓存，避免播放旧音色的缓存
+func (h *ConnectionHandler) resetQuickReplyCache() {
+	getter, ok := h.providers.tts.(configGetter)
+	if !ok {
+		return
+	}
+	// SetVoice会把显示名转换为音色名，缓存以转换后的名称为准
+	voice := getter.Config().Voice
+	h.quickReplyCache = utils.NewQuickReplyCache(getter.Config().Type, voice)
+	quickreply.AddVoice(voice)
+}
+
+// isCachedReply 快速回复词和角色问候语的音频可以缓存复用
+func (h *ConnectionHandler) isCachedReply(text string) bool {
+	if utils.IsQuickReplyHit(text, h.quickReplyWords()) {
+		return true
+	}
+	if role := h.activeRole(); role != nil && role.Greeting != "" {
+		return utils.IsInArray(text, utils.SpeechSegments(role.Greeting))
+	}
+	return false
+}
+
+// activeRole 当前角色，没有切换过角色时返回nil
+func (h *ConnectionHandler) activeRole() *models.Role {
+	h.roleMutex.RLock()
+	defer h.roleMutex.RUnlock()
+	return h.role
+}
+
+// restoreDeviceRole 连接建立时恢复设备上次使用的角色
+func (h *ConnectionHandler) restoreDeviceRole() {
+	roleDB := database.GetRoleDB()
+	if roleDB == nil || h.deviceID == "" {
+		return
+	}
+
+	name, err := roleDB.GetDeviceRole(h.deviceID)
+	if err != nil || name == "" {
+		if err != nil {
+			h.logger.Warn("读取设备角色失败: %v", err)
+		}
+		return
+	}
+	role, err := roleDB.GetRole(name)
+	if err != nil {
+		h.logger.Warn("恢复设备角色%s失败: %v", name, err)
+		return
+	}
+	if err := h.applyRole(role); err != nil {
+		h.logger.Warn("恢复设备角色%s失败: %v", name, err)
+		return
+	}
+	h.logger.Info("恢复设备角色: %s", name)
+}
+
+// roleContext 附带角色指定的LLM温度
+func (h *ConnectionHandler) roleContext(ctx context.Context) context.Context {
+	if role := h.activeRole(); role != nil && role.Temperature != nil {
+		return llm.WithTemperature(ctx, *role.Temperature)
+	}
+	return ctx
+}
+
+// knowledgeCollections 当前设备和角色可检索的知识库集合
+func (h *ConnectionHandler) knowledgeCollections() []string {
+	roleName := ""
+	var roleCollections []string
+	if role := h.activeRole(); role != nil {
+		roleName = role.Name
+		roleCollections = role.Collections()
+	}
+	return kb.BoundCollections(&h.config.KnowledgeBase, h.deviceID, roleName, roleCollections)
+}
+
+// quickReplyWords 唤醒词快速回复，角色没有配置时使用全局配置
+func (h *ConnectionHandler) quickReplyWords() []string {
+	if role := h.activeRole(); role != nil {
+		if words := role.QuickReplies(); len(words) > 0 {
+			return words
+		}
+	}
+	return h.config.QuickReplyWords
+}
+
+// isToolAllowed 判断当前角色是否允许调用工具，本地工具可以省略local_前缀
+func (h *ConnectionHandler) isToolAllowed(name string) bool {
+	role := h.activeRole()
+	return role == nil || role.AllowsTool(name, alwaysAllowedTools...)
+}
+
+// filterTools 按当前角色过滤提供给LLM的工具
+func (h *ConnectionHandler) filterTools(tools []openai.Tool) []openai.Tool {
+	if role := h.activeRole(); role == nil || len(role.Tools()) == 0 {
+		return tools
+	}
+
+	filtered := make([]openai.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function != nil && h.isToolAllowed(tool.Function.Name) {
+			filtered = append(filtered, tool)
+		}
+	}
+	return filtered
+}
@@ -3,14 +3,13 @@ package core
 import (
 	"math/rand"
 	"time"
-	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
 	"sync/atomic"
+	"xiaozhi-server-go/src/core/tracing"
 	"xiaozhi-server-go/src/core/utils"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // sendHelloMessage 发送欢迎消息
@@ -30,7 +29,7 @@ func (h *ConnectionHandler) sendHelloMessage() error {
 	hello := make(map[string]interface{})
 	hello["type"] = "hello"
 	hello["version"] = 1
-	hello["transport"] = "websocket"
+	hello["transport"] = h.conn.GetType()
 	hello["session_id"] = h.sessionID
 	hello["audio_params"] = map[string]interface{}{
 		"format":         h.serverAudioFormat,
@@ -72,6 +71,21 @@ func (h *ConnectionHandler) sendSTTMessage(text string) error {
 		"text":       text,
 		"session_id": h.sessionID,
 	}
+	return h.writeSTTMessage(sttMsg)
+}
+
+// sendInterimSTTMessage 发送中间识别结果，设备用于显示实时字幕，最终结果仍由sendSTTMessage发送
+func (h *ConnectionHandler) sendInterimSTTMessage(text string) error {
+	sttMsg := map[string]interface{}{
+		"type":       "stt",
+		"text":       text,
+		"interim":    true,
+		"session_id": h.sessionID,
+	}
+	return h.writeSTTMessage(sttMsg)
+}
+
+func (h *ConnectionHandler) writeSTTMessage(sttMsg map[string]interface{}) error {
 	jsonData, err := json.Marshal(sttMsg)
 	if err != nil {
 		return fmt.Errorf("序列化 STT 消息失败: %v", err)
@@ -100,14 +114,21 @@ func (h *ConnectionHandler) sendEmotionMessage(emotion string) error {
 
 func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textIndex int, round int) {
 	bFinishSuccess := false
+	_, span := tracing.Start(h.turnContext(round), "send",
+		tracing.AttrRound.Int(round), tracing.AttrTextIndex.Int(textIndex), tracing.AttrText.String(text))
 	defer func() {
+		span.SetAttributes(attribute.Bool("xiaozhi.completed", bFinishSuccess))
+		span.End()
 		// 音频发送完成后，根据配置决定是否删除文件
 		h.deleteAudioFileIfNeeded(filepath, "音频发送完成")
 
-		h.LogInfo(fmt.Sprintf("TTS音频发送任务结束(%t): %s, 索引: %d/%d", bFinishSuccess, text, textIndex, h.tts_last_text_index))
+		h.LogInfo("TTS音频发送任务结束", "completed", bFinishSuccess, "text", text,
+			utils.FieldTextIndex, textIndex, "last_text_index", h.lastTextIndex(), utils.FieldRound, round)
 		h.providers.asr.ResetStartListenTime()
-		if textIndex == h.tts_last_text_index {
+		if textIndex == h.lastTextIndex() {
+			h.finishPlayout(round)
 			h.sendTTSMessage("stop", "", textIndex)
+			h.endTurn(round, "")
 			if h.closeAfterChat {
 				h.Close()
 			} else {
@@ -121,15 +142,14 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 	}
 	// 检查轮次
 	if round != h.talkRound {
-		h.LogInfo(fmt.Sprintf("sendAudioMessage: 跳过过期轮次的音频: 任务轮次=%d, 当前轮次=%d, 文本=%s",
-			round, h.talkRound, text))
+		h.LogInfo("sendAudioMessage: 跳过过期轮次的音频", utils.FieldRound, round, "current_round", h.talkRound, "text", text)
 		// 即使跳过，也要根据配置删除音频文件
 		h.deleteAudioFileIfNeeded(filepath, "跳过过期轮次")
 		return
 	}
 
 	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
-		h.LogInfo(fmt.Sprintf("sendAudioMessage 服务端语音停止, 不再发送音频数据：%s", text))
+		h.LogInfo("sendAudioMessage 服务端语音停止, 不再发送音频数据", "text", text)
 		// 服务端语音停止时也要根据配置删除音频文件
 		h.deleteAudioFileIfNeeded(filepath, "服务端语音停止")
 		return
@@ -139,44 +159,60 @@ func (h *ConnectionHandler) sendAudioMessage(filepath string, text string, textI
 	var duration float64
 	var err error
 
-	// 使用TTS提供者的方法将音频转为Opus格式
-	if h.serverAudioFormat == "pcm" {
-		h.LogInfo("服务端音频格式为PCM，直接发送")
-		audioData, duration, err = utils.AudioToPCMData(filepath)
+	// 按协商的下行参数转码，默认参数下快速回复直接使用预合成的opus帧
+	params := h.outputAudioParams()
+	if !params.IsDefault() {
+		audioData, duration, err = utils.AudioToFrames(filepath, params)
 		if err != nil {
-			h.LogError(fmt.Sprintf("音频转PCM失败: %v", err))
+			h.LogError("音频转码失败", "params", params.String(), utils.FieldError, err)
 			return
 		}
-	} else if h.serverAudioFormat == "opus" {
-		audioData, duration, err = utils.AudioToOpusData(filepath)
-		if err != nil {
-			h.LogError(fmt.Sprintf("音频转Opus失败: %v", err))
-			return
+	} else {
+		cache := h.quickReplyCache
+		cachedReply := cache != nil && cache.IsCachedFile(filepath)
+		cachedOpus := false
+		if cachedReply {
+			// 预合成的opus帧直接发送，省去转码
+			audioData, duration, cachedOpus = cache.FindCachedOpus(text)
+		}
+		if !cachedOpus {
+			audioData, duration, err = utils.AudioToOpusData(filepath)
+			if err != nil {
+				h.logger.ErrorKV("音频转Opus失败", utils.FieldError, err)
+				return
+			}
+			if cachedReply {
+				if err := cache.SaveCachedOpus(text, audioData, duration); err != nil {
+					h.logger.ErrorKV("保存快速回复opus缓存失败", utils.FieldError, err)
+				}
+			}
 		}
 	}
 
 	// 发送TTS状态开始通知
 	if err := h.sendTTSMessage("sentence_start", text, textIndex); err != nil {
-		h.LogError(fmt.Sprintf("发送TTS开始状态失败: %v", err))
+		h.logger.ErrorKV("发送TTS开始状态失败", utils.FieldError, err)
 		return
 	}
 
 	if textIndex == 1 {
 		now := time.Now()
 		spentTime := now.Sub(h.roundStartTime)
-		h.logger.Debug("回复首句耗时 %s 第一句话【%s】, round: %d", spentTime, text, round)
+		h.logger.DebugKV("回复首句耗时", "elapsed_ms", spentTime.Milliseconds(), "text", text, utils.FieldRound, round)
 	}
-	h.logger.Debug("TTS发送(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, h.tts_last_text_index, duration, len(audioData))
+	h.logger.DebugKV("TTS发送", "format", h.serverAudioFormat, "text", text, utils.FieldTextIndex, textIndex,
+		"last_text_index", h.lastTextIndex(), "duration", duration, "frames", len(audioData))
+	span.SetAttributes(tracing.AttrFrames.Int(len(audioData)))
 
 	// 分时发送音频数据
 	if err := h.sendAudioFrames(audioData, text, round); err != nil {
-		h.LogError(fmt.Sprintf("分时发送音频数据失败: %v", err))
+		h.LogError("分时发送音频数据失败", utils.FieldError, err, utils.FieldTextIndex, textIndex)
 		return
 	}
 
 	// 发送TTS状态结束通知
 	if err := h.sendTTSMessage("sentence_end", text, textIndex); err != nil {
-		h.LogError(fmt.Sprintf("发送TTS结束状态失败: %v", err))
+		h.logger.ErrorKV("发送TTS结束状态失败", utils.FieldError, err)
 		return
 	}
 
@@ -187,10 +223,12 @@ func (h *ConnectionHandler) sendMusic(songFilepaths []string, texts []string, te
 	// 初始化随机数生成器
 	rand.Seed(time.Now().UnixNano())
 	defer func() {
-		h.LogInfo(fmt.Sprintf("music音频发送任务结束: 索引: %d/%d", textIndex, h.tts_last_text_index))
+		h.LogInfo("music音频发送任务结束", utils.FieldTextIndex, textIndex, "last_text_index", h.lastTextIndex())
 		h.providers.asr.ResetStartListenTime()
-		if textIndex == h.tts_last_text_index {
+		if textIndex == h.lastTextIndex() {
+			h.finishPlayout(round)
 			h.sendTTSMessage("stop", "", textIndex)
+			h.endTurn(round, "")
 			if h.closeAfterChat {
 				h.Close()
 			} else {
@@ -201,13 +239,12 @@ func (h *ConnectionHandler) sendMusic(songFilepaths []string, texts []string, te
 
 	// 检查轮次
 	if round != h.talkRound {
-		h.LogInfo(fmt.Sprintf("sendMusic: 跳过过期轮次的音频: 任务轮次=%d, 当前轮次=%d",
-			round, h.talkRound))
+		h.LogInfo("sendMusic: 跳过过期轮次的音频", utils.FieldRound, round, "current_round", h.talkRound)
 		return
 	}
 
 	if atomic.LoadInt32(&h.serverVoiceStop) == 1 { // 服务端语音停止
-		h.LogInfo(fmt.Sprintf("sendMusic 服务端语音停止, 不再发送音频数据"))
+		h.LogInfo("sendMusic 服务端语音停止, 不再发送音频数据")
 		return
 	}
 
@@ -236,7 +273,7 @@ func (h *ConnectionHandler) sendMusic(songFilepaths []string, texts []string, te
 
 		// 检查轮次是否已变更
 		if round != h.talkRound {
-			h.LogInfo(fmt.Sprintf("sendMusic: 跳过过期轮次的音频: 任务轮次=%d, 当前轮次=%d", round, h.talkRound))
+			h.LogInfo("sendMusic: 跳过过期轮次的音频", utils.FieldRound, round, "current_round", h.talkRound)
 			return
 		}
 
@@ -270,221 +307,154 @@ func (h *ConnectionHandler) sendMusic(songFilepaths []string, texts []string, te
 		// 使用TTS提供者的方法将音频转为Opus格式
 		audioData, duration, err = getAudioData(songFilepath, h)
 		if err != nil {
-			h.LogError(fmt.Sprintf("sendMusic: 获取音频数据失败: %v", err))
+			h.logger.ErrorKV("sendMusic: 获取音频数据失败", utils.FieldError, err)
 			continue // 出错时跳过当前歌曲，继续播放下一首
 		}
 
 		// 发送TTS状态开始通知
 		if err := h.sendTTSMessage("sentence_start", text, textIndex); err != nil {
-			h.LogError(fmt.Sprintf("sendMusic: 发送TTS开始状态失败: %v", err))
+			h.logger.ErrorKV("sendMusic: 发送TTS开始状态失败", utils.FieldError, err)
 			break
 		}
 
 		if textIndex == 1 {
 			now := time.Now()
 			spentTime := now.Sub(h.roundStartTime)
-			h.logger.Debug("回复首句耗时 %s 第一句话【%s】, round: %d", spentTime, text, round)
+			h.logger.DebugKV("回复首句耗时", "elapsed_ms", spentTime.Milliseconds(), "text", text, utils.FieldRound, round)
 		}
-		h.logger.Debug("音乐播放(%s): \"%s\" (索引:%d/%d，时长:%f，帧数:%d)", h.serverAudioFormat, text, textIndex, h.tts_last_text_index, duration, len(audioData))
+		h.logger.DebugKV("音乐播放", "format", h.serverAudioFormat, "text", text, utils.FieldTextIndex, textIndex,
+			"last_text_index", h.lastTextIndex(), "duration", duration, "frames", len(audioData))
 
 		// 分时发送音频数据
 		if err := h.sendAudioFrames(audioData, text, round); err != nil {
-			h.LogError(fmt.Sprintf("sendMusic: 分时发送音频数据失败: %v", err))
+			h.logger.ErrorKV("sendMusic: 分时发送音频数据失败", utils.FieldError, err)
 			continue
 		}
 
 		// 发送TTS状态结束通知
 		if err := h.sendTTSMessage("sentence_end", text, textIndex); err != nil {
-			h.LogError(fmt.Sprintf("sendMusic:发送TTS结束状态失败: %v", err))
+			h.logger.ErrorKV("sendMusic:发送TTS结束状态失败", utils.FieldError, err)
 			break
 		}
 	}
 }
 
 func getAudioData(songFilepath string, h *ConnectionHandler) (audioData [][]byte, duration float64, err error) {
-	// 提取文件名（不含扩展名）
-	filename := filepath.Base(songFilepath)
-	filenameWithoutExt := strings.TrimSuffix(filename, filepath.Ext(filename))
-
-	// 构造opus文件路径
-	opusDir := filepath.Join("", "music-opus")
-	opusFilePath := filepath.Join(opusDir, filenameWithoutExt+"_.opus")
-	durationFilePath := filepath.Join(opusDir, filenameWithoutExt+"_.duration")
-
-	// 检查opus文件是否存在
-	if _, err := os.Stat(opusFilePath); os.IsNotExist(err) {
-		// 文件不存在，调用转换函数
-		audioData, duration, err = utils.AudioToOpusData(songFilepath)
-		if err != nil {
-			h.LogError(fmt.Sprintf("音频转Opus失败: %v", err))
-			return nil, 0, err
-		}
-
-		// 确保music-opus目录存在
-		if err := os.MkdirAll(opusDir, 0755); err != nil {
-			h.LogError(fmt.Sprintf("创建opus目录失败: %v", err))
-		} else {
-			// 保存全部opus数据到文件（带长度信息）
-			for i, data := range audioData {
-				// 准备包含长度信息的数据
-				lengthBytes := make([]byte, 4)
-				binary.LittleEndian.PutUint32(lengthBytes, uint32(len(data)))
-				dataWithLength := append(lengthBytes, data...)
-
-				if i == 0 {
-					// 第一次写入，创建或覆盖文件
-					if err := utils.SaveAudioFile(dataWithLength, opusFilePath); err != nil {
-						h.LogError(fmt.Sprintf("保存Opus文件失败: %v", err))
-					}
-				} else {
-					// 后续写入，追加到文件
-					if err := utils.AppendAudioFile(dataWithLength, opusFilePath); err != nil {
-						h.LogError(fmt.Sprintf("追加Opus文件失败: %v", err))
-					}
-				}
-			}
-
-			// 保存duration到文件
-			durationFile, err := os.Create(durationFilePath)
-			if err != nil {
-				h.LogError(fmt.Sprintf("创建duration文件失败: %v", err))
-			} else {
-				fmt.Fprintf(durationFile, "%f", duration)
-				durationFile.Close()
-			}
-		}
-	} else {
-		// 文件存在，直接读取
-		opusData, err := os.ReadFile(opusFilePath)
-		if err != nil {
-			h.LogError(fmt.Sprintf("读取Opus文件失败: %v", err))
-			return nil, 0, err
-		}
-
-		// 从文件中读取带长度信息的opus数据
-		audioData = [][]byte{}
-		offset := 0
-		dataLen := len(opusData)
-
-		for offset < dataLen {
-			// 读取长度信息（4字节）
-			if offset+4 > dataLen {
-				h.LogError("Opus文件格式错误：缺少足够的长度信息")
-				break
-			}
-
-			length := int(binary.LittleEndian.Uint32(opusData[offset:offset+4]))
-			offset += 4
-
-			// 读取数据
-			if offset+length > dataLen {
-				h.LogError("Opus文件格式错误：数据长度不足")
-				break
-			}
+	// 预转码缓存只适用于默认参数，其他参数实时转码
+	if params := h.outputAudioParams(); !params.IsDefault() {
+		return utils.AudioToFrames(songFilepath, params)
+	}
 
-			data := opusData[offset:offset+length]
-			audioData = append(audioData, data)
-			offset += length
+	// 优先读取预转码的opus缓存
+	if utils.IsMusicOpusCached(songFilepath) {
+		audioData, duration, err = utils.LoadMusicOpusCache(songFilepath)
+		if err == nil {
+			return audioData, duration, nil
 		}
+		h.logger.ErrorKV("读取Opus缓存失败，重新转码", utils.FieldError, err)
+	}
 
-		// 如果解析后的帧数量为0，则使用原始数据作为备选
+	// 缓存不存在或已损坏，转码并写入缓存
+	audioData, duration, err = utils.TranscodeMusicToOpus(songFilepath)
+	if err != nil {
 		if len(audioData) == 0 {
-			audioData = [][]byte{opusData}
-		}
-
-		// 读取duration
-		durationData, err := os.ReadFile(durationFilePath)
-		if err != nil {
-			h.LogError(fmt.Sprintf("读取duration文件失败: %v", err))
+			h.logger.ErrorKV("音频转Opus失败", utils.FieldError, err)
 			return nil, 0, err
 		}
-		fmt.Sscanf(string(durationData), "%f", &duration)
+		h.logger.ErrorKV("保存Opus缓存失败", utils.FieldError, err)
 	}
 
 	return audioData, duration, nil
 }
 
-// sendAudioFrames 分时发送音频帧，避免撑爆客户端缓冲区
+// sendAudioFrames 按连接的播放时钟发送音频帧，避免撑爆客户端缓冲区
+// 同一轮的多句音频连续排队，句子之间不重新预缓冲，也不额外等待
 func (h *ConnectionHandler) sendAudioFrames(audioData [][]byte, text string, round int) error {
 	if len(audioData) == 0 {
 		return nil
 	}
 
 	startTime := time.Now()
-	playPosition := 0 // 播放位置（毫秒）
-
-	// 预缓冲：发送前几帧，提升播放流畅度
-	preBufferFrames := 3
-	if len(audioData) < preBufferFrames {
-		preBufferFrames = len(audioData)
-	}
-	preBufferTime := time.Duration(h.serverAudioFrameDuration*preBufferFrames) * time.Millisecond // 预缓冲时间（毫秒）
-
-	// 发送预缓冲帧
-	for i := 0; i < preBufferFrames; i++ {
-		// 检查是否被打断
+	for i, chunk := range audioData {
+		// 检查是否被打断或轮次变化
 		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
-			h.LogInfo(fmt.Sprintf("音频发送被中断(预缓冲阶段): 帧=%d/%d, 文本=%s", i+1, preBufferFrames, text))
+			h.LogInfo("音频发送被中断", "frame", i+1, "frames", len(audioData), "text", text)
 			return nil
 		}
 
-		if err := h.conn.WriteMessage(2, audioData[i]); err != nil {
-			return fmt.Errorf("发送预缓冲音频帧失败: %v", err)
+		// 设备端缓冲超过目标值时等待
+		if delay := h.playout.Delay(time.Now()); delay > 0 {
+			if !h.waitPlayout(delay, round) {
+				h.LogInfo("音频发送在延迟中被中断", "frame", i+1, "frames", len(audioData), "text", text)
+				return nil
+			}
 		}
-		playPosition += h.serverAudioFrameDuration
-	}
 
-	// 发送剩余音频帧
-	remainingFrames := audioData[preBufferFrames:]
-	for i, chunk := range remainingFrames {
-		// 检查是否被打断或轮次变化
-		if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
-			h.LogInfo(fmt.Sprintf("音频发送被中断: 帧=%d/%d, 文本=%s", i+preBufferFrames+1, len(audioData), text))
-			return nil
+		writeStart := time.Now()
+		if err := h.conn.WriteMessage(2, chunk); err != nil {
+			return fmt.Errorf("发送音频帧失败: %v", err)
 		}
+		h.playout.OnSent(time.Now(), time.Since(writeStart))
+	}
+	// 等待下一句期间设备播完缓冲是正常停顿，不计为欠载
+	h.playout.Idle()
+
+	stats := h.playout.Stats()
+	h.LogInfo("音频帧发送完成",
+		"frames", len(audioData),
+		"duration_ms", len(audioData)*h.serverAudioFrameDuration,
+		"elapsed_ms", time.Since(startTime).Milliseconds(),
+		"buffer_ms", stats.BufferMs,
+		"write_latency_ms", stats.WriteLatencyMs,
+		"underruns", stats.Underruns,
+		"text", text)
+	return nil
+}
 
-		// 检查连接是否关闭
-		select {
-		case <-h.stopChan:
-			return nil
-		default:
-		}
+// waitPlayout 可中断的等待，被打断、轮次变化或连接关闭时返回false
+func (h *ConnectionHandler) waitPlayout(delay time.Duration, round int) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
 
-		// 计算预期发送时间
-		expectedTime := startTime.Add(time.Duration(playPosition)*time.Millisecond - preBufferTime)
-		currentTime := time.Now()
-		delay := expectedTime.Sub(currentTime)
-
-		// 流控延迟处理
-		if delay > 0 {
-			// 使用简单的可中断睡眠
-			ticker := time.NewTicker(10 * time.Millisecond) // 固定10ms检查间隔
-			defer ticker.Stop()
-
-			endTime := time.Now().Add(delay)
-			for time.Now().Before(endTime) {
-				select {
-				case <-ticker.C:
-					// 检查中断条件
-					if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
-						h.LogInfo(fmt.Sprintf("音频发送在延迟中被中断: 帧=%d/%d, 文本=%s", i+preBufferFrames+1, len(audioData), text))
-						return nil
-					}
-				case <-h.stopChan:
-					return nil
-				}
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case <-ticker.C:
+			if atomic.LoadInt32(&h.serverVoiceStop) == 1 || round != h.talkRound {
+				return false
 			}
+		case <-h.stopChan:
+			return false
 		}
+	}
+}
 
-		// 发送音频帧
-		if err := h.conn.WriteMessage(2, chunk); err != nil {
-			return fmt.Errorf("发送音频帧失败: %v", err)
-		}
+// finishPlayout 一轮播放结束，等设备播完缓冲后再通知stop，然后重置播放时钟
+func (h *ConnectionHandler) finishPlayout(round int) {
+	if remaining := h.playout.Remaining(time.Now()); remaining > 0 {
+		h.waitPlayout(remaining, round)
+	}
+	h.playout.Reset()
+}
 
-		playPosition += h.serverAudioFrameDuration
+// outputAudioParams 当前连接协商后的下行音频参数
+func (h *ConnectionHandler) outputAudioParams() utils.AudioParams {
+	return utils.AudioParams{
+		Format:        h.serverAudioFormat,
+		SampleRate:    h.serverAudioSampleRate,
+		Channels:      h.serverAudioChannels,
+		FrameDuration: h.serverAudioFrameDuration,
 	}
-	time.Sleep(preBufferTime) // 确保预缓冲时间已过
-	spentTime := time.Since(startTime).Milliseconds()
-	h.LogInfo(fmt.Sprintf("音频帧发送完成: 总帧数=%d, 总时长=%dms, 总耗时:%dms 文本=%s", len(audioData), playPosition, spentTime, text))
-	return nil
+}
+
+// setOutputAudioParams 设置下行音频参数，hello回复和播放时钟随之更新
+func (h *ConnectionHandler) setOutputAudioParams(params utils.AudioParams) {
+	h.serverAudioFormat = params.Format
+	h.serverAudioSampleRate = params.SampleRate
+	h.serverAudioChannels = params.Channels
+	h.serverAudioFrameDuration = params.FrameDuration
+	h.playout.SetFrameDuration(time.Duration(params.FrameDuration) * time.Millisecond)
 }
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// fakeConn 记录下发的文本消息
+type fakeConn struct {
+	mu       sync.Mutex
+	messages []map[string]interface{}
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, msg)
+	return nil
+}
+
+func (c *fakeConn) ReadMessage(stopChan <-chan struct{}) (int, []byte, error) {
+	<-stopChan
+	return 0, nil, errors.New("closed")
+}
+
+func (c *fakeConn) Close() error    { return nil }
+func (c *fakeConn) GetID() string   { return "test" }
+func (c *fakeConn) GetType() string { return "websocket" }
+func (c *fakeConn) IsClosed() bool  { return false }
+
+func (c *fakeConn) GetLastActiveTime() time.Time { return time.Now() }
+
+func (c *fakeConn) IsStale(timeout time.Duration) bool { return false }
+
+// count 统计指定类型和状态的消息数
+func (c *fakeConn) count(msgType, state string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, msg := range c.messages {
+		if msg["type"] == msgType && msg["state"] == state {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBargeIn(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	tests := []struct {
+		name     string
+		finished bool // 投递打断请求后播报已经结束
+		wantStop bool
+	}{
+		{name: "播报中打断", wantStop: true},
+		{name: "播报已结束时忽略", finished: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &fakeConn{}
+			h := &ConnectionHandler{
+				config:              &configs.Config{BargeInChars: 2},
+				logger:              logger,
+				conn:                conn,
+				clientListenMode:    "realtime",
+				stopChan:            make(chan struct{}),
+				bargeInQueue:        make(chan string, 1),
+				playout:             utils.NewPlayoutScheduler(60 * time.Millisecond),
+				tts_last_text_index: 3,
+				talkRound:           1,
+			}
+
+			// ASR回调协程只投递打断请求，测试协程作为连接协程同时修改轮次
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				h.OnAsrPartialResult("等一下")
+			}()
+			h.talkRound++
+			<-done
+
+			if tt.finished {
+				h.setLastTextIndex(-1)
+			}
+			select {
+			case text := <-h.bargeInQueue:
+				h.bargeIn(text)
+			default:
+				t.Fatal("没有投递打断请求")
+			}
+
+			if stopped := conn.count("tts", "stop") == 1; stopped != tt.wantStop {
+				t.Errorf("发送tts stop = %v, 期望 %v", stopped, tt.wantStop)
+			}
+		})
+	}
+}
+
+func TestSpeakTimeout(t *testing.T) {
+	// 连接协程没有处理播报请求时，Speak在ctx结束后返回
+	h := &ConnectionHandler{stopChan: make(chan struct{}), speakQueue: make(chan speakTask)}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := h.Speak(ctx, "你好"); err == nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Errorf("Speak() = %v, 期望超时", err)
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"xiaozhi-server-go/src/core/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// turnTracer 连接的对话轮次追踪状态
+// 用户开始说话时创建待用的轮次span和asr子span，进入对话后成为当前轮次，播放结束、被打断或下一轮开始时结束
+type turnTracer struct {
+	mu sync.Mutex
+
+	pendingCtx  context.Context // 识别中的下一轮
+	pendingSpan trace.Span
+	asrSpan     trace.Span
+
+	ctx   context.Context // 当前轮次
+	span  trace.Span
+	round int
+}
+
+// traceAttrs 会话级的span属性
+func (h *ConnectionHandler) traceAttrs() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		tracing.AttrSessionID.String(h.sessionID),
+		tracing.AttrDeviceID.String(h.deviceID),
+		tracing.AttrClientID.String(h.clientId),
+	}
+	if h.conn != nil {
+		attrs = append(attrs, tracing.AttrTransport.String(h.conn.GetType()))
+	}
+	return attrs
+}
+
+// traceASRStart 收到一段语音的第一帧音频时开始asr span
+func (h *ConnectionHandler) traceASRStart() {
+	t := &h.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.asrSpan != nil {
+		return
+	}
+	if t.pendingSpan == nil {
+		t.pendingCtx, t.pendingSpan = tracing.Start(context.Background(), "turn", h.traceAttrs()...)
+	}
+	_, t.asrSpan = tracing.Start(t.pendingCtx, "asr", tracing.AttrMode.String(h.clientListenMode))
+}
+
+// beginTurn 开始新的对话轮次，结束上一轮和识别中的asr span，返回带轮次span的ctx
+func (h *ConnectionHandler) beginTurn(ctx context.Context, round int, text string) context.Context {
+	t := &h.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.span != nil {
+		t.span.End()
+	}
+	if t.asrSpan != nil {
+		t.asrSpan.SetAttributes(tracing.AttrText.String(text))
+		t.asrSpan.End()
+		t.asrSpan = nil
+	}
+	if t.pendingSpan != nil {
+		t.ctx, t.span = t.pendingCtx, t.pendingSpan
+		t.pendingCtx, t.pendingSpan = nil, nil
+	} else {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		t.ctx, t.span = tracing.Start(ctx, "turn", h.traceAttrs()...)
+	}
+	t.round = round
+	t.span.SetAttributes(
+		tracing.AttrRound.Int(round),
+		tracing.AttrMode.String(h.clientListenMode),
+		tracing.AttrText.String(text),
+	)
+	return t.ctx
+}
+
+// turnContext 指定轮次的span上下文，轮次已结束时返回空上下文
+func (h *ConnectionHandler) turnContext(round int) context.Context {
+	t := &h.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.span == nil || t.round != round {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// traceContext 当前轮次的span上下文，用于日志自动附带trace_id
+func (h *ConnectionHandler) traceContext() context.Context {
+	t := &h.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.span == nil {
+		return nil
+	}
+	return t.ctx
+}
+
+// endTurn 结束指定轮次，event不为空时先记录事件（如被打断）
+func (h *ConnectionHandler) endTurn(round int, event string) {
+	t := &h.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.span == nil || (round > 0 && t.round != round) {
+		return
+	}
+	if event != "" {
+		t.span.AddEvent(event)
+	}
+	t.span.End()
+	t.ctx, t.span = nil, nil
+}
+
+// closeTrace 连接关闭时结束所有未完成的span
+func (h *ConnectionHandler) closeTrace() {
+	h.endTurn(0, "closed")
+	t := &h.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.asrSpan != nil {
+		t.asrSpan.End()
+		t.asrSpan = nil
+	}
+	if t.pendingSpan != nil {
+		t.pendingSpan.End()
+		t.pendingCtx, t.pendingSpan = nil, nil
+	}
+}
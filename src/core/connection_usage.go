@@ -0,0 +1,67 @@
+package core
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/task"
+)
+
+// recordASRAudio 记录送入ASR的PCM音频时长，音频为16位单声道或多声道
+func (h *ConnectionHandler) recordASRAudio(pcmBytes int) {
+	sampleRate, channels := h.clientAudioSampleRate, h.clientAudioChannels
+	if sampleRate <= 0 {
+		sampleRate = 16000
+	}
+	if channels <= 0 {
+		channels = 1
+	}
+	seconds := float64(pcmBytes) / float64(2*sampleRate*channels)
+	usage.Default().Record(h.deviceID, usage.MetricASRSeconds, seconds)
+}
+
+// recordLLMUsage 按输入消息和输出文本估算并记录LLM token
+func (h *ConnectionHandler) recordLLMUsage(messages []providers.Message, output string) {
+	tokens := usage.EstimateTokens(output)
+	for _, msg := range messages {
+		tokens += usage.EstimateTokens(msg.Content)
+	}
+	usage.Default().Record(h.deviceID, usage.MetricLLMTokens, float64(tokens))
+}
+
+// recordTTSUsage 记录TTS合成字数
+func (h *ConnectionHandler) recordTTSUsage(text string) {
+	usage.Default().Record(h.deviceID, usage.MetricTTSChars, float64(utf8.RuneCountInString(text)))
+}
+
+// checkQuota 检查设备配额，超出时播报提示并返回false
+func (h *ConnectionHandler) checkQuota(round int) bool {
+	meter := usage.Default()
+	err := meter.Check(h.deviceID)
+	if err == nil {
+		return true
+	}
+	var exceeded *usage.ExceededError
+	if errors.As(err, &exceeded) {
+		h.logger.WarnKV("设备超出用量配额",
+			"metric", exceeded.Metric, "period", exceeded.Period,
+			"used", exceeded.Used, "limit", exceeded.Limit, utils.FieldRound, round)
+	}
+	h.setLastTextIndex(1)
+	h.SpeakAndPlay(meter.OverQuotaMessage(), 1, round)
+	return false
+}
+
+// syncTaskLevel 按设备的用户级别设置任务配额
+func (h *ConnectionHandler) syncTaskLevel() {
+	if usage.Default() == nil {
+		return
+	}
+	level := task.UserLevel(usage.Default().Level(h.deviceID))
+	if err := h.taskMgr.SetClientLevel(h.sessionID, level); err != nil {
+		h.logger.WarnKV("设置任务用户级别失败", utils.FieldError, err)
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"xiaozhi-server-go/src/core/chat"
+	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/ocr"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	defaultVisionMaxImages     = 3
+	defaultVisionFollowUpTurns = 2
+
+	// visionResultHandler 播报视觉识别结果的handler名称
+	visionResultHandler = "mcp_handler_vision_result"
+)
+
+// routeVisionResult 按工具结果的内容路由：文本是/api/vision的识别结果（如设备拍照）时，
+// 成功直接播报识别结果，失败交给LLM说明原因；其他结果原样返回，图片和音频已由ToolResult交给mcp_handler_tool_content
+func routeVisionResult(result types.ActionResponse) types.ActionResponse {
+	text, ok := result.Result.(string)
+	if result.Action != types.ActionTypeReqLLM || !ok {
+		return result
+	}
+	var response struct {
+		Success *bool   `json:"success"`
+		Result  *string `json:"result"`
+		Message *string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(text), &response); err != nil || response.Success == nil ||
+		(response.Result == nil && response.Message == nil) {
+		return result
+	}
+	if !*response.Success || response.Result == nil || *response.Result == "" {
+		message := ""
+		if response.Message != nil {
+			message = *response.Message
+		}
+		result.Result = "识别失败: " + message
+		return result
+	}
+	return types.ActionResponse{
+		Action: types.ActionTypeCallHandler,
+		Result: types.ActionResponseCall{
+			FuncName: visionResultHandler,
+			Args:     mcp.ToolResult{Contents: []mcp.ToolContent{{Type: mcp.ContentTypeText, Text: *response.Result}}},
+		},
+	}
+}
+
+// mcp_handler_vision_result 播报视觉识别结果，识别结果作为工具结果写入对话历史
+func (h *ConnectionHandler) mcp_handler_vision_result(args interface{}) {
+	result, ok := args.(mcp.ToolResult)
+	if !ok {
+		h.logger.Error("mcp_handler_vision_result: args is not a ToolResult")
+		return
+	}
+	h.SystemSpeak(result.Text())
+}
+
+// visionDialogue 供VLLLM使用的对话历史，只带最近vision_context.max_images张图片
+func (h *ConnectionHandler) visionDialogue() []providers.Message {
+	maxImages := h.config.VisionContext.MaxImages
+	if maxImages <= 0 {
+		maxImages = defaultVisionMaxImages
+	}
+	return h.dialogueManager.GetVisionDialogue(maxImages)
+}
+
+// followUpWithVision 最近几轮发送过图片时，文字追问也交给VLLLM结合图片回答
+func (h *ConnectionHandler) followUpWithVision() bool {
+	if h.providers.vlllm == nil {
+		return false
+	}
+	turns := h.config.VisionContext.FollowUpTurns
+	if turns < 0 {
+		return false
+	}
+	if turns == 0 {
+		turns = defaultVisionFollowUpTurns
+	}
+	since := h.dialogueManager.TurnsSinceImage()
+	return since > 0 && since <= turns
+}
+
+// answerDocument 文档模式：识别图片中的文字，连同用户原来的问题交给LLM
+// 未配置OCR、不是文字图片或识别失败时返回false，由VLLLM按通用识图处理
+func (h *ConnectionHandler) answerDocument(ctx context.Context, mode string, imageData image.ImageData, question string, round int) (bool, error) {
+	recognizer := ocr.Default()
+	if recognizer == nil {
+		return false, nil
+	}
+	prepared, err := recognizer.Prepare(ctx, imageData)
+	if err != nil {
+		h.LogError("文档模式图片处理失败", utils.FieldError, err)
+		return false, nil
+	}
+	if recognizer.DetectMode(mode, question, prepared) != image.ModeDocument {
+		return false, nil
+	}
+
+	text, err := recognizer.Recognize(ctx, prepared)
+	if err != nil {
+		if h.providers.vlllm != nil {
+			h.LogError("识别图片文字失败，改用VLLLM识图", utils.FieldError, err)
+			return false, nil
+		}
+		h.LogError("识别图片文字失败", utils.FieldError, err)
+		text = "（没有识别到文字）"
+	} else {
+		usage.Default().Record(h.deviceID, usage.MetricVisionCalls, 1)
+	}
+	h.LogInfo("文档模式识别完成", "ocr", recognizer.Name(), "chars", len([]rune(text)), utils.FieldRound, round)
+
+	h.dialogueManager.Put(chat.Message{
+		Role:    "user",
+		Content: ocr.DocumentPrompt(question, text),
+		Images: []providers.ImageRef{{
+			Format:      prepared.Format,
+			Source:      "document",
+			Description: text,
+			Data:        prepared.Data,
+		}},
+	})
+	return true, h.genResponseByLLM(ctx, h.dialogueManager.GetLLMDialogue(), round)
+}
+
+// AddVisionResult 把/api/vision识别的图片和结果加入当前对话，后续追问可以继续引用这张图片
+func (h *ConnectionHandler) AddVisionResult(ctx context.Context, question string, imageData image.ImageData, result string) error {
+	if h.providers.vlllm == nil {
+		return fmt.Errorf("未配置VLLLM服务")
+	}
+	ref, err := h.providers.vlllm.ProcessImage(ctx, imageData)
+	if err != nil {
+		return err
+	}
+	ref.Source = "vision"
+	ref.Description = result
+
+	// 通常由设备的拍照工具触发，图片附加到发起工具调用的用户消息，不打断工具调用的消息顺序
+	if h.dialogueManager.AttachImage(ref) {
+		h.LogInfo("识图结果已加入对话", "question", question)
+		return nil
+	}
+	h.dialogueManager.Put(chat.Message{
+		Role:    "user",
+		Content: question,
+		Images:  []providers.ImageRef{ref},
+	})
+	h.dialogueManager.Put(chat.Message{
+		Role:    "assistant",
+		Content: result,
+	})
+	h.LogInfo("识图结果已加入对话", "question", question)
+	return nil
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+	"xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/types"
+)
+
+func TestRouteVisionResult(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     types.ActionResponse
+		wantAction types.Action
+		wantText   string
+	}{
+		{
+			name:       "识别成功直接播报",
+			result:     types.ActionResponse{Action: types.ActionTypeReqLLM, Result: `{"success":true,"result":"桌上有一只猫"}`},
+			wantAction: types.ActionTypeCallHandler,
+			wantText:   "桌上有一只猫",
+		},
+		{
+			name:       "识别失败交给LLM",
+			result:     types.ActionResponse{Action: types.ActionTypeReqLLM, Result: `{"success":false,"message":"摄像头不可用"}`},
+			wantAction: types.ActionTypeReqLLM,
+			wantText:   "识别失败: 摄像头不可用",
+		},
+		{
+			name:       "其他JSON文本不处理",
+			result:     types.ActionResponse{Action: types.ActionTypeReqLLM, Result: `{"success":true}`},
+			wantAction: types.ActionTypeReqLLM,
+			wantText:   `{"success":true}`,
+		},
+		{
+			name:       "普通文本不处理",
+			result:     types.ActionResponse{Action: types.ActionTypeReqLLM, Result: "北京晴"},
+			wantAction: types.ActionTypeReqLLM,
+			wantText:   "北京晴",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := routeVisionResult(tt.result)
+			if got.Action != tt.wantAction {
+				t.Fatalf("action = %v, 期望 %v", got.Action, tt.wantAction)
+			}
+			text, _ := got.Result.(string)
+			if call, ok := got.Result.(types.ActionResponseCall); ok {
+				text = call.Args.(mcp.ToolResult).Text()
+			}
+			if text != tt.wantText {
+				t.Errorf("结果 = %q, 期望 %q", text, tt.wantText)
+			}
+		})
+	}
+}
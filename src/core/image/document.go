@@ -0,0 +1,123 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"strings"
+)
+
+// 图片识别模式
+const (
+	ModeAuto     = "auto"     // 按问题和图片内容判断
+	ModeGeneral  = "general"  // 通用识图，交给VLLLM
+	ModeDocument = "document" // 文档模式，识别文字后交给LLM朗读、翻译或讲解
+)
+
+// documentKeywords 问题中出现这些词时按文档识别，如菜单、药品说明、作业
+var documentKeywords = []string{
+	"读一下", "读给我", "念", "朗读", "文字", "写的什么", "写了什么", "写的是什么", "上面写",
+	"翻译", "菜单", "说明书", "用法用量", "作业", "题目", "这道题", "单词", "识字",
+}
+
+const (
+	// 检测时缩小到的最大宽度
+	detectWidth = 320
+	// 相邻像素灰度差超过该值视为笔画边缘
+	edgeThreshold = 48
+	// 文字图片的边缘密度和背景占比
+	minEdgeDensity     = 0.05
+	minBackgroundRatio = 0.45
+)
+
+// DetectMode 判断按通用识图还是文档识别：指定了模式时直接使用，否则问题要求读文字或图片文字密集时为文档模式
+func (p *ImageProcessor) DetectMode(mode string, question string, imageData ImageData) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case ModeDocument:
+		return ModeDocument
+	case ModeGeneral:
+		return ModeGeneral
+	}
+	if IsDocumentQuestion(question) {
+		return ModeDocument
+	}
+	data, err := base64.StdEncoding.DecodeString(imageData.Data)
+	if err != nil {
+		return ModeGeneral
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ModeGeneral
+	}
+	if IsTextHeavy(img) {
+		p.logger.Debug("图片文字密集，使用文档模式")
+		return ModeDocument
+	}
+	return ModeGeneral
+}
+
+// IsDocumentQuestion 问题是否要求读出、翻译或讲解图片中的文字
+func IsDocumentQuestion(question string) bool {
+	for _, keyword := range documentKeywords {
+		if strings.Contains(question, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTextHeavy 粗略判断图片是否以文字为主：浅色或深色背景占多数，且横向笔画边缘密集
+// 只用于自动选择模式，判断不准时可以在请求中指定mode
+func IsTextHeavy(img image.Image) bool {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w < 16 || h < 16 {
+		return false
+	}
+	step := 1
+	if w > detectWidth {
+		step = (w + detectWidth - 1) / detectWidth
+	}
+
+	var histogram [32]int
+	edges, total := 0, 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		prev := -1
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, _ := img.At(x, y).RGBA()
+			// 16位分量转为0-255的灰度
+			gray := int((299*r + 587*g + 114*b) / 1000 >> 8)
+			histogram[gray/8]++
+			if prev >= 0 && abs(gray-prev) > edgeThreshold {
+				edges++
+			}
+			prev = gray
+			total++
+		}
+	}
+	if total == 0 {
+		return false
+	}
+
+	// 背景取最多的灰度及其相邻区间
+	background := 0
+	for i := range histogram {
+		sum := histogram[i]
+		if i > 0 {
+			sum += histogram[i-1]
+		}
+		if i < len(histogram)-1 {
+			sum += histogram[i+1]
+		}
+		background = max(background, sum)
+	}
+	return float64(edges)/float64(total) >= minEdgeDensity &&
+		float64(background)/float64(total) >= minBackgroundRatio
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
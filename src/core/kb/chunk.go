@@ -0,0 +1,158 @@
+package kb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DefaultChunkSize    = 500
+	DefaultChunkOverlap = 80
+)
+
+// ChunkOptions 文档分块参数，长度按字符计算
+type ChunkOptions struct {
+	Size    int `json:"chunk_size"`
+	Overlap int `json:"chunk_overlap"`
+}
+
+func (o ChunkOptions) normalize() ChunkOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultChunkSize
+	}
+	if o.Overlap < 0 || o.Overlap >= o.Size/2 {
+		o.Overlap = o.Size / 5
+	}
+	return o
+}
+
+// SplitText 将文本切分为带重叠的分块
+// 优先按段落合并，过长的段落按句子切分，分块会带上所在的markdown标题
+func SplitText(text string, opts ChunkOptions) []string {
+	opts = opts.normalize()
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	var chunks []string
+	var current strings.Builder
+	heading := ""
+	chunkHeading := ""
+
+	flush := func() {
+		content := strings.TrimSpace(current.String())
+		current.Reset()
+		if content == "" {
+			return
+		}
+		if chunkHeading != "" && !strings.HasPrefix(content, chunkHeading) {
+			content = chunkHeading + "\n" + content
+		}
+		chunks = append(chunks, content)
+	}
+
+	appendPiece := func(piece string) {
+		if current.Len() > 0 && runeLen(current.String())+runeLen(piece) > opts.Size {
+			tail := overlapTail(current.String(), opts.Overlap)
+			flush()
+			current.WriteString(tail)
+		}
+		if current.Len() == 0 || strings.TrimSpace(current.String()) == "" {
+			chunkHeading = heading
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(piece)
+	}
+
+	for _, para := range splitParagraphs(text) {
+		if strings.HasPrefix(para, "#") {
+			// 新的章节不与上一章节混在同一分块
+			flush()
+			heading = strings.TrimSpace(strings.SplitN(para, "\n", 2)[0])
+			chunkHeading = heading
+		}
+
+		if runeLen(para) <= opts.Size {
+			appendPiece(para)
+			continue
+		}
+		for _, sentence := range splitSentences(para, opts.Size) {
+			appendPiece(sentence)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitParagraphs 按空行和markdown标题切分段落
+func splitParagraphs(text string) []string {
+	var paras []string
+	var current []string
+	push := func() {
+		if p := strings.TrimSpace(strings.Join(current, "\n")); p != "" {
+			paras = append(paras, p)
+		}
+		current = current[:0]
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			push()
+		case strings.HasPrefix(trimmed, "#"):
+			push()
+			current = append(current, trimmed)
+		default:
+			current = append(current, strings.TrimRight(line, " \t"))
+		}
+	}
+	push()
+	return paras
+}
+
+// splitSentences 按句末标点切分长段落，单句仍超长时按长度硬切
+func splitSentences(para string, size int) []string {
+	var sentences []string
+	var current []rune
+	for _, r := range para {
+		current = append(current, r)
+		if strings.ContainsRune("。！？；!?;\n", r) || (r == '.' && len(current) > 1) {
+			sentences = append(sentences, string(current))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		sentences = append(sentences, string(current))
+	}
+
+	var result []string
+	for _, s := range sentences {
+		s = strings.TrimSpace(s)
+		runes := []rune(s)
+		for len(runes) > size {
+			result = append(result, string(runes[:size]))
+			runes = runes[size:]
+		}
+		if len(runes) > 0 {
+			result = append(result, string(runes))
+		}
+	}
+	return result
+}
+
+// overlapTail 取分块末尾的若干字符作为下一分块的开头
+func overlapTail(text string, overlap int) string {
+	if overlap <= 0 {
+		return ""
+	}
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= overlap {
+		return string(runes)
+	}
+	return string(runes[len(runes)-overlap:])
+}
+
+func runeLen(s string) int {
+	return utf8.RuneCountInString(s)
+}
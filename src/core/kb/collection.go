@@ -0,0 +1,442 @@
+package kb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/philippgille/chromem-go"
+	"xiaozhi-server-go/src/configs"
+)
+
+const (
+	// CollectionFilePrefix 文档集合索引文件前缀，与歌曲索引一样放在KBPath下
+	CollectionFilePrefix = "collection_"
+	// docCollectionPrefix chromem中文档集合名的前缀，避免与歌曲集合重名
+	docCollectionPrefix = "doc_"
+	// addConcurrency 写入分块时并发计算向量的数量
+	addConcurrency = 4
+)
+
+var collectionNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Document 集合中的一篇文档，保存分块原文用于更换向量模型后重建
+type Document struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Chunks    []string  `json:"chunks"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DocumentInfo 文档概要
+type DocumentInfo struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Chunks    int       `json:"chunks"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CollectionInfo 集合概要
+type CollectionInfo struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Chunks    int    `json:"chunks"`
+}
+
+// Chunk 检索到的文档分块
+type Chunk struct {
+	Collection string  `json:"collection"`
+	DocID      string  `json:"doc_id"`
+	Source     string  `json:"source"`
+	Index      int     `json:"index"`
+	Content    string  `json:"content"`
+	Similarity float32 `json:"similarity"`
+}
+
+// Citation 分块的来源标注，例如 manual.pdf#3
+func (c Chunk) Citation() string {
+	return fmt.Sprintf("%s#%d", filepath.Base(c.Source), c.Index+1)
+}
+
+type docCollection struct {
+	name       string
+	collection *chromem.Collection
+	docs       map[string]Document
+}
+
+var gCollections = map[string]*docCollection{}
+var gCollectionsMutex sync.RWMutex
+var gEmbeddingFunc chromem.EmbeddingFunc
+
+// ValidCollectionName 集合名只允许字母、数字、下划线和中划线
+func ValidCollectionName(name string) bool {
+	return collectionNameRe.MatchString(name)
+}
+
+// DocumentID 根据来源生成文档的稳定ID，重复导入同一来源会覆盖
+func DocumentID(source string) string {
+	sum := sha1.Sum([]byte(filepath.ToSlash(filepath.Clean(source))))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// loadCollections 加载所有文档集合，rebuild为true时用当前向量模型重建
+func loadCollections(rebuild bool) error {
+	files, err := filepath.Glob(filepath.Join(gKBPath, CollectionFilePrefix+"*.json"))
+	if err != nil {
+		return err
+	}
+
+	collections := map[string]*docCollection{}
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), CollectionFilePrefix), ".json")
+		if !ValidCollectionName(name) {
+			continue
+		}
+		dc, err := openCollection(name, rebuild)
+		if err != nil {
+			return fmt.Errorf("加载文档集合%s失败: %v", name, err)
+		}
+		collections[name] = dc
+	}
+
+	gCollectionsMutex.Lock()
+	gCollections = collections
+	gCollectionsMutex.Unlock()
+	return nil
+}
+
+// openCollection 读取集合索引并打开向量集合
+func openCollection(name string, rebuild bool) (*docCollection, error) {
+	dc := &docCollection{name: name, docs: map[string]Document{}}
+	data, err := os.ReadFile(collectionIndexPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &dc.docs); err != nil {
+			return nil, err
+		}
+	}
+
+	collection := gDB.GetCollection(docCollectionPrefix+name, gEmbeddingFunc)
+	if collection != nil && rebuild {
+		if err := gDB.DeleteCollection(docCollectionPrefix + name); err != nil {
+			return nil, err
+		}
+		collection = nil
+	}
+	if collection == nil {
+		collection, err = gDB.CreateCollection(docCollectionPrefix+name, nil, gEmbeddingFunc)
+		if err != nil {
+			return nil, err
+		}
+		rebuild = true
+	}
+	dc.collection = collection
+
+	if rebuild {
+		for _, doc := range dc.docs {
+			if err := addChunks(gCtx, collection, doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return dc, nil
+}
+
+// getCollection 获取集合，create为true时不存在则创建
+func getCollection(name string, create bool) (*docCollection, error) {
+	if gDB == nil {
+		return nil, ErrUnavailable
+	}
+	if !ValidCollectionName(name) {
+		return nil, fmt.Errorf("无效的集合名: %s", name)
+	}
+
+	gCollectionsMutex.Lock()
+	defer gCollectionsMutex.Unlock()
+	if dc, ok := gCollections[name]; ok {
+		return dc, nil
+	}
+	if !create {
+		return nil, fmt.Errorf("集合不存在: %s", name)
+	}
+
+	collection, err := gDB.GetOrCreateCollection(docCollectionPrefix+name, nil, gEmbeddingFunc)
+	if err != nil {
+		return nil, err
+	}
+	dc := &docCollection{name: name, collection: collection, docs: map[string]Document{}}
+	gCollections[name] = dc
+	return dc, nil
+}
+
+// ListCollections 列出所有文档集合
+func ListCollections() []CollectionInfo {
+	gCollectionsMutex.RLock()
+	infos := make([]CollectionInfo, 0, len(gCollections))
+	for name, dc := range gCollections {
+		info := CollectionInfo{Name: name, Documents: len(dc.docs)}
+		for _, doc := range dc.docs {
+			info.Chunks += len(doc.Chunks)
+		}
+		infos = append(infos, info)
+	}
+	gCollectionsMutex.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// ListDocuments 列出集合中的文档，按来源排序
+func ListDocuments(collection string) ([]DocumentInfo, error) {
+	dc, err := getCollection(collection, false)
+	if err != nil {
+		return nil, err
+	}
+
+	gCollectionsMutex.RLock()
+	infos := make([]DocumentInfo, 0, len(dc.docs))
+	for _, doc := range dc.docs {
+		infos = append(infos, DocumentInfo{ID: doc.ID, Source: doc.Source, Chunks: len(doc.Chunks), UpdatedAt: doc.UpdatedAt})
+	}
+	gCollectionsMutex.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Source < infos[j].Source
+	})
+	return infos, nil
+}
+
+// AddDocument 切分文本并写入集合，集合不存在时自动创建，同一来源的旧分块会被替换
+func AddDocument(ctx context.Context, collection, source, text string, opts ChunkOptions) (*DocumentInfo, error) {
+	chunks := SplitText(text, opts)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("文档内容为空: %s", source)
+	}
+	dc, err := getCollection(collection, true)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := Document{ID: DocumentID(source), Source: source, Chunks: chunks, UpdatedAt: time.Now()}
+	// 计算向量耗时较长，不持有锁
+	if err := addChunks(ctx, dc.collection, doc); err != nil {
+		return nil, err
+	}
+
+	gCollectionsMutex.Lock()
+	old, exists := dc.docs[doc.ID]
+	dc.docs[doc.ID] = doc
+	gCollectionsMutex.Unlock()
+
+	// 新文档分块更少时删除多出的旧分块
+	if exists && len(old.Chunks) > len(chunks) {
+		var stale []string
+		for i := len(chunks); i < len(old.Chunks); i++ {
+			stale = append(stale, chunkID(doc.ID, i))
+		}
+		if err := dc.collection.Delete(ctx, nil, nil, stale...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := saveCollection(dc); err != nil {
+		return nil, err
+	}
+	return &DocumentInfo{ID: doc.ID, Source: source, Chunks: len(chunks), UpdatedAt: doc.UpdatedAt}, nil
+}
+
+// DeleteDocument 从集合删除文档
+func DeleteDocument(collection, id string) error {
+	dc, err := getCollection(collection, false)
+	if err != nil {
+		return err
+	}
+
+	gCollectionsMutex.Lock()
+	doc, ok := dc.docs[id]
+	delete(dc.docs, id)
+	gCollectionsMutex.Unlock()
+	if !ok {
+		return fmt.Errorf("文档不存在: %s", id)
+	}
+
+	ids := make([]string, 0, len(doc.Chunks))
+	for i := range doc.Chunks {
+		ids = append(ids, chunkID(id, i))
+	}
+	if err := dc.collection.Delete(gCtx, nil, nil, ids...); err != nil {
+		return err
+	}
+	return saveCollection(dc)
+}
+
+// DeleteCollection 删除整个集合
+func DeleteCollection(name string) error {
+	if _, err := getCollection(name, false); err != nil {
+		return err
+	}
+
+	gCollectionsMutex.Lock()
+	delete(gCollections, name)
+	gCollectionsMutex.Unlock()
+
+	if err := gDB.DeleteCollection(docCollectionPrefix + name); err != nil {
+		return err
+	}
+	if err := os.Remove(collectionIndexPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SearchChunks 在多个集合中检索，按相似度合并后返回前topK个分块
+func SearchChunks(ctx context.Context, collections []string, query string, topK int) ([]Chunk, error) {
+	if gDB == nil {
+		return nil, ErrUnavailable
+	}
+	if topK <= 0 {
+		topK = 4
+	}
+
+	var targets []*docCollection
+	gCollectionsMutex.RLock()
+	for _, name := range collections {
+		if dc, ok := gCollections[name]; ok && dc.collection.Count() > 0 {
+			targets = append(targets, dc)
+		}
+	}
+	gCollectionsMutex.RUnlock()
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	// 所有集合使用同一个向量模型，查询向量只计算一次
+	embedding, err := gEmbeddingFunc(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for _, dc := range targets {
+		n := topK
+		if count := dc.collection.Count(); n > count {
+			n = count
+		}
+		res, err := dc.collection.QueryEmbedding(ctx, embedding, n, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range res {
+			index, _ := strconv.Atoi(r.Metadata["index"])
+			chunks = append(chunks, Chunk{
+				Collection: dc.name,
+				DocID:      r.Metadata["doc_id"],
+				Source:     r.Metadata["source"],
+				Index:      index,
+				Content:    r.Content,
+				Similarity: r.Similarity,
+			})
+		}
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Similarity > chunks[j].Similarity
+	})
+	if len(chunks) > topK {
+		chunks = chunks[:topK]
+	}
+	return chunks, nil
+}
+
+// BoundCollections 计算设备当前可检索的集合：公共集合、配置中角色绑定的集合、
+// 角色定义中的集合和设备绑定的集合
+func BoundCollections(cfg *configs.KnowledgeBaseConfig, deviceID, role string, roleCollections []string) []string {
+	seen := map[string]bool{}
+	var names []string
+	add := func(list []string) {
+		for _, name := range list {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if cfg != nil {
+		add(cfg.Collections)
+		if role != "" {
+			add(cfg.Roles[role])
+		}
+	}
+	add(roleCollections)
+	if cfg != nil && deviceID != "" {
+		add(cfg.Devices[deviceID])
+	}
+	return names
+}
+
+type collectionsKey struct{}
+
+// WithCollections 将当前连接可检索的集合放入context，供search_knowledge工具使用
+func WithCollections(ctx context.Context, collections []string) context.Context {
+	return context.WithValue(ctx, collectionsKey{}, collections)
+}
+
+// CollectionsFromContext 取出context中的可检索集合
+func CollectionsFromContext(ctx context.Context) []string {
+	collections, _ := ctx.Value(collectionsKey{}).([]string)
+	return collections
+}
+
+func addChunks(ctx context.Context, collection *chromem.Collection, doc Document) error {
+	docs := make([]chromem.Document, 0, len(doc.Chunks))
+	for i, content := range doc.Chunks {
+		docs = append(docs, chromem.Document{
+			ID:      chunkID(doc.ID, i),
+			Content: content,
+			Metadata: map[string]string{
+				"doc_id": doc.ID,
+				"source": doc.Source,
+				"index":  strconv.Itoa(i),
+			},
+		})
+	}
+	return collection.AddDocuments(ctx, docs, addConcurrency)
+}
+
+func chunkID(docID string, index int) string {
+	return docID + "-" + strconv.Itoa(index)
+}
+
+func collectionIndexPath(name string) string {
+	return filepath.Join(gKBPath, CollectionFilePrefix+name+".json")
+}
+
+func saveCollection(dc *docCollection) error {
+	gCollectionsMutex.RLock()
+	data, err := json.MarshalIndent(dc.docs, "", "  ")
+	gCollectionsMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	path := collectionIndexPath(dc.name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,169 @@
+package kb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		opts      ChunkOptions
+		minChunks int
+		check     func(t *testing.T, chunks []string)
+	}{
+		{
+			name:      "短文本一个分块",
+			text:      "设备开机后长按电源键三秒即可重置。",
+			opts:      ChunkOptions{Size: 100, Overlap: 10},
+			minChunks: 1,
+		},
+		{
+			name:      "长段落按句子切分且不超长",
+			text:      strings.Repeat("这是一句用于测试分块的话。", 40),
+			opts:      ChunkOptions{Size: 60, Overlap: 10},
+			minChunks: 5,
+			check: func(t *testing.T, chunks []string) {
+				for _, c := range chunks {
+					if runeLen(c) > 60+10+1 {
+						t.Errorf("分块过长: %d", runeLen(c))
+					}
+				}
+			},
+		},
+		{
+			name:      "markdown分块带上章节标题",
+			text:      "# 安装\n\n" + strings.Repeat("安装步骤说明。", 20) + "\n\n# 重置\n\n长按电源键三秒。",
+			opts:      ChunkOptions{Size: 50, Overlap: 5},
+			minChunks: 3,
+			check: func(t *testing.T, chunks []string) {
+				last := chunks[len(chunks)-1]
+				if !strings.HasPrefix(last, "# 重置") || strings.Contains(last, "安装步骤") {
+					t.Errorf("章节切分错误: %q", last)
+				}
+				for _, c := range chunks[:len(chunks)-1] {
+					if !strings.HasPrefix(c, "# 安装") {
+						t.Errorf("分块缺少标题: %q", c)
+					}
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitText(tt.text, tt.opts)
+			if len(chunks) < tt.minChunks {
+				t.Fatalf("分块数量 %d 少于 %d", len(chunks), tt.minChunks)
+			}
+			if tt.check != nil {
+				tt.check(t, chunks)
+			}
+		})
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	pdf := "%PDF-1.4\n1 0 obj\n<< /Length 60 >>\nstream\nBT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj T* [(Wor) -20 (ld)] TJ ET\nendstream\nendobj\n"
+	text := extractPDFText([]byte(pdf))
+	if !strings.Contains(text, "Hello (PDF)") || !strings.Contains(text, "World") {
+		t.Errorf("PDF文本提取错误: %q", text)
+	}
+}
+
+func TestDocumentCollections(t *testing.T) {
+	dir := t.TempDir()
+	loadLocalKB(t, dir, 256)
+	ctx := context.Background()
+
+	manual := filepath.Join(t.TempDir(), "manual.md")
+	content := "# 重置\n\n长按电源键十秒恢复出厂设置。\n\n# 充电\n\n使用五伏二安的充电器，充满约需两小时。"
+	if err := os.WriteFile(manual, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := IngestPaths(ctx, "manual", []string{manual}, ChunkOptions{Size: 30, Overlap: 5})
+	if err != nil || len(result.Imported) != 1 {
+		t.Fatalf("导入失败: %v %+v", err, result)
+	}
+	if _, err := AddDocument(ctx, "english", "words.txt", "apple 苹果 banana 香蕉", ChunkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("检索结果带来源", func(t *testing.T) {
+		chunks, err := SearchChunks(ctx, []string{"manual"}, "怎么恢复出厂设置", 1)
+		if err != nil || len(chunks) != 1 {
+			t.Fatalf("检索失败: %v %+v", err, chunks)
+		}
+		if !strings.Contains(chunks[0].Content, "出厂设置") || chunks[0].Citation() != "manual.md#1" {
+			t.Errorf("检索结果错误: %+v", chunks[0])
+		}
+	})
+
+	t.Run("未绑定的集合不参与检索", func(t *testing.T) {
+		chunks, err := SearchChunks(ctx, []string{"english"}, "恢复出厂设置", 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range chunks {
+			if c.Collection != "english" {
+				t.Errorf("检索到其他集合: %+v", c)
+			}
+		}
+	})
+
+	t.Run("重新加载后集合仍在", func(t *testing.T) {
+		loadLocalKB(t, dir, 256)
+		infos := ListCollections()
+		if len(infos) != 2 || infos[0].Name != "english" || infos[1].Documents != 1 {
+			t.Fatalf("集合列表错误: %+v", infos)
+		}
+	})
+
+	t.Run("更换向量模型后重建", func(t *testing.T) {
+		loadLocalKB(t, dir, 64)
+		chunks, err := SearchChunks(ctx, []string{"manual"}, "充电器", 1)
+		if err != nil || len(chunks) != 1 || !strings.Contains(chunks[0].Content, "充电") {
+			t.Fatalf("重建后检索错误: %v %+v", err, chunks)
+		}
+	})
+
+	t.Run("删除文档和集合", func(t *testing.T) {
+		docs, err := ListDocuments("manual")
+		if err != nil || len(docs) != 1 {
+			t.Fatalf("文档列表错误: %v %+v", err, docs)
+		}
+		if err := DeleteDocument("manual", docs[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		if chunks, _ := SearchChunks(ctx, []string{"manual"}, "充电器", 4); len(chunks) != 0 {
+			t.Errorf("删除后仍能检索到: %+v", chunks)
+		}
+		if err := DeleteCollection("english"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ListDocuments("english"); err == nil {
+			t.Error("删除后集合仍存在")
+		}
+	})
+}
+
+func TestBoundCollections(t *testing.T) {
+	cfg := &configs.KnowledgeBaseConfig{
+		Collections: []string{"common"},
+		Roles:       map[string][]string{"英语老师": {"english", "common"}},
+		Devices:     map[string][]string{"aa:bb": {"manual"}},
+	}
+	got := strings.Join(BoundCollections(cfg, "aa:bb", "英语老师", []string{"words", "english"}), ",")
+	if got != "common,english,words,manual" {
+		t.Errorf("绑定集合错误: %s", got)
+	}
+	if got := strings.Join(BoundCollections(cfg, "cc:dd", "", nil), ","); got != "common" {
+		t.Errorf("未绑定设备的集合错误: %s", got)
+	}
+}
@@ -0,0 +1,121 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// supportedDocumentExts 支持导入的文档格式
+var supportedDocumentExts = map[string]bool{
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".pdf":      true,
+}
+
+var (
+	mdImageRe = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkRe  = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdFenceRe = regexp.MustCompile("(?m)^\\s*```.*$")
+)
+
+// DocumentIngestResult 文档导入结果
+type DocumentIngestResult struct {
+	Collection string            `json:"collection"`
+	Imported   []DocumentInfo    `json:"imported"`
+	Failed     map[string]string `json:"failed"`
+}
+
+// IsSupportedDocument 判断文件扩展名是否支持导入
+func IsSupportedDocument(path string) bool {
+	return supportedDocumentExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// ReadDocument 读取txt、markdown或PDF文件的文本
+func ReadDocument(path string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if !supportedDocumentExts[ext] {
+		return "", fmt.Errorf("不支持的文档格式: %s", ext)
+	}
+	if ext == ".pdf" {
+		return ReadPDFText(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("文档不是UTF-8编码: %s", path)
+	}
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	if ext != ".txt" {
+		text = cleanMarkdown(text)
+	}
+	return text, nil
+}
+
+// cleanMarkdown 去掉图片、链接地址和代码块标记，保留标题用于分块
+func cleanMarkdown(text string) string {
+	text = mdImageRe.ReplaceAllString(text, "$1")
+	text = mdLinkRe.ReplaceAllString(text, "$1")
+	return mdFenceRe.ReplaceAllString(text, "")
+}
+
+// IngestFile 导入单个文档，来源记录为文件名
+func IngestFile(ctx context.Context, collection, path string, opts ChunkOptions) (*DocumentInfo, error) {
+	text, err := ReadDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	return AddDocument(ctx, collection, filepath.Base(path), text, opts)
+}
+
+// IngestPaths 导入文件或目录，目录只扫描一层中支持的文档
+func IngestPaths(ctx context.Context, collection string, paths []string, opts ChunkOptions) (*DocumentIngestResult, error) {
+	if !ValidCollectionName(collection) {
+		return nil, fmt.Errorf("无效的集合名: %s", collection)
+	}
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && IsSupportedDocument(entry.Name()) {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+
+	result := &DocumentIngestResult{Collection: collection, Failed: map[string]string{}}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		info, err := IngestFile(ctx, collection, file, opts)
+		if err != nil {
+			result.Failed[file] = err.Error()
+			continue
+		}
+		result.Imported = append(result.Imported, *info)
+	}
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+)
+
+// SongEnricher 补全歌曲标签（情绪、场景、流派等）
+type SongEnricher interface {
+	Enrich(ctx context.Context, song *Song) error
+}
+
+const enrichPrompt = `你是一名音乐编辑。请根据歌曲的基本信息补全它的标签，只输出一个JSON对象，不要输出其他内容。
+JSON字段如下（不确定的字段留空）：
+{"album":"","release_year":0,"language":"","theme":"","genre":"","sub_genre":"","vocal_type":"","mood_tags":[],"scene_tags":[],"location_tags":[],"cultural_tags":[],"performance_form":""}
+歌曲信息：
+%s`
+
+// LLMEnricher 使用大语言模型补全歌曲标签
+type LLMEnricher struct {
+	provider types.LLMProvider
+}
+
+// NewLLMEnricher 创建基于LLM的标签补全器
+func NewLLMEnricher(provider types.LLMProvider) *LLMEnricher {
+	return &LLMEnricher{provider: provider}
+}
+
+// NewLLMEnricherFromConfig 使用配置中选中的LLM创建标签补全器
+func NewLLMEnricherFromConfig(config *configs.Config) (*LLMEnricher, error) {
+	llmName := config.SelectedModule["LLM"]
+	llmCfg, ok := config.LLM[llmName]
+	if !ok {
+		return nil, fmt.Errorf("未找到LLM配置: %s", llmName)
+	}
+
+	provider, err := llm.Create(llmCfg.Type, &llm.Config{
+		Name:        llmName,
+		Type:        llmCfg.Type,
+		ModelName:   llmCfg.ModelName,
+		BaseURL:     llmCfg.BaseURL,
+		APIKey:      llmCfg.APIKey,
+		Temperature: llmCfg.Temperature,
+		MaxTokens:   llmCfg.MaxTokens,
+		TopP:        llmCfg.TopP,
+		Extra:       llmCfg.Extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewLLMEnricher(provider), nil
+}
+
+// Enrich 请求LLM生成标签，只填充歌曲中为空的字段
+func (e *LLMEnricher) Enrich(ctx context.Context, song *Song) error {
+	info := fmt.Sprintf("标题: %s\n歌手: %s\n专辑: %s\n流派: %s", song.Title, song.Artist, song.Album, song.Genre)
+	messages := []types.Message{
+		{Role: "user", Content: fmt.Sprintf(enrichPrompt, info)},
+	}
+
+	respChan, err := e.provider.Response(ctx, "music-enrich", messages)
+	if err != nil {
+		return fmt.Errorf("请求LLM失败: %v", err)
+	}
+
+	var sb strings.Builder
+	for chunk := range respChan {
+		sb.WriteString(chunk)
+	}
+
+	text := sb.String()
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return fmt.Errorf("LLM返回内容不是JSON: %s", text)
+	}
+
+	var tags Song
+	if err := json.Unmarshal([]byte(text[start:end+1]), &tags); err != nil {
+		return fmt.Errorf("解析LLM标签失败: %v", err)
+	}
+	mergeSongTags(song, &tags)
+	return nil
+}
+
+// mergeSongTags 用src中的标签补全dst中为空的字段
+func mergeSongTags(dst, src *Song) {
+	fillString := func(d *string, s string) {
+		if *d == "" {
+			*d = strings.TrimSpace(s)
+		}
+	}
+	fillTags := func(d *[]string, s []string) {
+		if len(*d) == 0 {
+			*d = s
+		}
+	}
+
+	fillString(&dst.Album, src.Album)
+	fillString(&dst.Language, src.Language)
+	fillString(&dst.Theme, src.Theme)
+	fillString(&dst.Genre, src.Genre)
+	fillString(&dst.SubGenre, src.SubGenre)
+	fillString(&dst.VocalType, src.VocalType)
+	fillString(&dst.PerformanceForm, src.PerformanceForm)
+	fillTags(&dst.MoodTags, src.MoodTags)
+	fillTags(&dst.SceneTags, src.SceneTags)
+	fillTags(&dst.LocationTags, src.LocationTags)
+	fillTags(&dst.CulturalTags, src.CulturalTags)
+	if dst.ReleaseYear == 0 {
+		dst.ReleaseYear = src.ReleaseYear
+	}
+}
@@ -0,0 +1,265 @@
+package kb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// AudioTags 音频文件中的元数据
+type AudioTags struct {
+	Title    string
+	Artist   string
+	Album    string
+	Genre    string
+	Year     int
+	Duration int // 秒，来自TLEN帧，可能为0
+}
+
+// ReadAudioTags 读取音频文件的ID3v2/ID3v1标签，没有标签时返回空结构
+func ReadAudioTags(path string) (*AudioTags, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开音频文件失败: %v", err)
+	}
+	defer f.Close()
+
+	tags := &AudioTags{}
+	if err := readID3v2(f, tags); err != nil {
+		return nil, err
+	}
+	// v2标签不完整时用v1补充
+	if tags.Title == "" || tags.Artist == "" {
+		if err := readID3v1(f, tags); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func readID3v2(r io.ReadSeeker, tags *AudioTags) error {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil // 文件太短，视为无标签
+	}
+	if string(header[:3]) != "ID3" {
+		return nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	size := syncsafeInt(header[6:10])
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return fmt.Errorf("读取ID3v2标签失败: %v", err)
+	}
+	// v2.3及以下的非同步处理作用于整个标签
+	if flags&0x80 != 0 && version < 4 {
+		body = removeUnsync(body)
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+
+	pos := 0
+	// 跳过扩展头
+	if flags&0x40 != 0 && version >= 3 && len(body) >= 4 {
+		extSize := int(binary.BigEndian.Uint32(body[:4]))
+		if version == 4 {
+			extSize = syncsafeInt(body[:4])
+		} else {
+			extSize += 4
+		}
+		pos = extSize
+	}
+
+	for pos+headerLen <= len(body) {
+		id := string(body[pos : pos+idLen])
+		if id[0] == 0 {
+			break // 填充区
+		}
+
+		var frameSize int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			frameSize = int(body[pos+3])<<16 | int(body[pos+4])<<8 | int(body[pos+5])
+		case 4:
+			frameSize = syncsafeInt(body[pos+4 : pos+8])
+			frameFlags = binary.BigEndian.Uint16(body[pos+8 : pos+10])
+		default:
+			frameSize = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		}
+		pos += headerLen
+		if frameSize <= 0 || pos+frameSize > len(body) {
+			break
+		}
+		data := body[pos : pos+frameSize]
+		pos += frameSize
+
+		// 压缩或加密的帧不处理
+		if version == 4 && frameFlags&0x000C != 0 {
+			continue
+		}
+		if version == 4 && frameFlags&0x0002 != 0 {
+			data = removeUnsync(data)
+		}
+
+		switch id {
+		case "TIT2", "TT2":
+			tags.Title = decodeTextFrame(data)
+		case "TPE1", "TP1":
+			tags.Artist = decodeTextFrame(data)
+		case "TALB", "TAL":
+			tags.Album = decodeTextFrame(data)
+		case "TCON", "TCO":
+			tags.Genre = cleanGenre(decodeTextFrame(data))
+		case "TYER", "TYE", "TDRC", "TDOR":
+			if tags.Year == 0 {
+				tags.Year = parseYear(decodeTextFrame(data))
+			}
+		case "TLEN", "TLE":
+			if ms, err := strconv.Atoi(decodeTextFrame(data)); err == nil {
+				tags.Duration = ms / 1000
+			}
+		}
+	}
+	return nil
+}
+
+func readID3v1(r io.ReadSeeker, tags *AudioTags) error {
+	if _, err := r.Seek(-128, io.SeekEnd); err != nil {
+		return nil
+	}
+	buf := make([]byte, 128)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil
+	}
+	if string(buf[:3]) != "TAG" {
+		return nil
+	}
+
+	if tags.Title == "" {
+		tags.Title = decodeLatin1(trimNull(buf[3:33]))
+	}
+	if tags.Artist == "" {
+		tags.Artist = decodeLatin1(trimNull(buf[33:63]))
+	}
+	if tags.Album == "" {
+		tags.Album = decodeLatin1(trimNull(buf[63:93]))
+	}
+	if tags.Year == 0 {
+		tags.Year = parseYear(string(trimNull(buf[93:97])))
+	}
+	return nil
+}
+
+// decodeTextFrame 按ID3文本帧的编码字节解码
+func decodeTextFrame(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	enc, text := data[0], data[1:]
+	var s string
+	switch enc {
+	case 0:
+		s = decodeLatin1(text)
+	case 1:
+		s = decodeUTF16(text, true)
+	case 2:
+		s = decodeUTF16(text, false)
+	default:
+		s = string(text)
+	}
+	// 多值文本以\x00分隔，只取第一个
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// decodeLatin1 解码ISO-8859-1文本；很多中文文件实际写入的是UTF-8，这里优先按UTF-8识别
+func decodeLatin1(b []byte) string {
+	b = trimNull(b)
+	if utf8.Valid(b) {
+		return strings.TrimSpace(string(b))
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+func decodeUTF16(b []byte, withBOM bool) string {
+	bigEndian := true
+	if withBOM && len(b) >= 2 {
+		if b[0] == 0xFF && b[1] == 0xFE {
+			bigEndian = false
+			b = b[2:]
+		} else if b[0] == 0xFE && b[1] == 0xFF {
+			b = b[2:]
+		}
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		var v uint16
+		if bigEndian {
+			v = uint16(b[i])<<8 | uint16(b[i+1])
+		} else {
+			v = uint16(b[i+1])<<8 | uint16(b[i])
+		}
+		if v == 0 {
+			break
+		}
+		u = append(u, v)
+	}
+	return string(utf16.Decode(u))
+}
+
+// cleanGenre 处理"(17)"这类数字流派，只保留文本部分
+func cleanGenre(s string) string {
+	if strings.HasPrefix(s, "(") {
+		if i := strings.Index(s, ")"); i > 0 {
+			if rest := strings.TrimSpace(s[i+1:]); rest != "" {
+				return rest
+			}
+			return ""
+		}
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		return ""
+	}
+	return s
+}
+
+func parseYear(s string) int {
+	if len(s) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(s[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+func syncsafeInt(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func removeUnsync(b []byte) []byte {
+	return bytes.ReplaceAll(b, []byte{0xFF, 0x00}, []byte{0xFF})
+}
+
+func trimNull(b []byte) []byte {
+	return bytes.TrimRight(b, "\x00 ")
+}
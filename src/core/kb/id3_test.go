@@ -0,0 +1,149 @@
+package kb
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// syncsafe 编码为ID3v2的syncsafe整数
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// id3Frame 生成v2.3/v2.4的帧，v2.4的帧长度为syncsafe整数
+func id3Frame(version byte, id string, data []byte) []byte {
+	frame := []byte(id)
+	if version == 4 {
+		frame = append(frame, syncsafe(len(data))...)
+	} else {
+		frame = binary.BigEndian.AppendUint32(frame, uint32(len(data)))
+	}
+	frame = append(frame, 0, 0)
+	return append(frame, data...)
+}
+
+// id3Tag 生成带填充区的ID3v2标签
+func id3Tag(version byte, frames ...[]byte) []byte {
+	var body []byte
+	for _, frame := range frames {
+		body = append(body, frame...)
+	}
+	body = append(body, make([]byte, 16)...)
+	tag := append([]byte{'I', 'D', '3', version, 0, 0}, syncsafe(len(body))...)
+	return append(tag, body...)
+}
+
+// id3v1Tag 生成文件末尾的128字节ID3v1标签
+func id3v1Tag(title, artist, album, year string) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	copy(tag[93:97], year)
+	return tag
+}
+
+// utf16Text 编码为带BOM的UTF-16文本帧
+func utf16Text(s string, littleEndian bool) []byte {
+	data := []byte{1, 0xFE, 0xFF}
+	if littleEndian {
+		data = []byte{1, 0xFF, 0xFE}
+	}
+	for _, r := range s {
+		if littleEndian {
+			data = binary.LittleEndian.AppendUint16(data, uint16(r))
+		} else {
+			data = binary.BigEndian.AppendUint16(data, uint16(r))
+		}
+	}
+	return append(data, 0, 0)
+}
+
+func latin1Text(s string) []byte {
+	return append([]byte{0}, s...)
+}
+
+func TestSyncsafeInt(t *testing.T) {
+	for _, n := range []int{0, 127, 128, 255, 1 << 14, 1<<28 - 1} {
+		if got := syncsafeInt(syncsafe(n)); got != n {
+			t.Errorf("syncsafeInt(%d) = %d", n, got)
+		}
+	}
+}
+
+func TestReadAudioTags(t *testing.T) {
+	longAlbum := strings.Repeat("专辑", 50) // 帧长度超过127，验证v2.4的syncsafe帧长度
+	audio := make([]byte, 64)
+
+	tests := []struct {
+		name string
+		data []byte
+		want AudioTags
+	}{
+		{
+			name: "v2.3文本帧",
+			data: id3Tag(3,
+				id3Frame(3, "TIT2", latin1Text("青花瓷")),
+				id3Frame(3, "TPE1", latin1Text("周杰伦")),
+				id3Frame(3, "TALB", latin1Text("我很忙")),
+				id3Frame(3, "TCON", latin1Text("(13)Pop")),
+				id3Frame(3, "TYER", latin1Text("2007")),
+				id3Frame(3, "TLEN", latin1Text("239000")),
+			),
+			want: AudioTags{Title: "青花瓷", Artist: "周杰伦", Album: "我很忙", Genre: "Pop", Year: 2007, Duration: 239},
+		},
+		{
+			name: "v2.4 UTF-16小端BOM和syncsafe帧长度",
+			data: id3Tag(4,
+				id3Frame(4, "TIT2", utf16Text("十年", true)),
+				id3Frame(4, "TPE1", utf16Text("陈奕迅", false)),
+				id3Frame(4, "TALB", append([]byte{3}, longAlbum...)),
+				id3Frame(4, "TDRC", latin1Text("2003-04-15")),
+			),
+			want: AudioTags{Title: "十年", Artist: "陈奕迅", Album: longAlbum, Year: 2003},
+		},
+		{
+			name: "纯数字流派忽略",
+			data: id3Tag(3,
+				id3Frame(3, "TIT2", latin1Text("Hotel California")),
+				id3Frame(3, "TPE1", latin1Text("Eagles")),
+				id3Frame(3, "TCON", latin1Text("17")),
+			),
+			want: AudioTags{Title: "Hotel California", Artist: "Eagles"},
+		},
+		{
+			name: "v2缺少歌手时用v1补充",
+			data: append(id3Tag(3, id3Frame(3, "TIT2", latin1Text("稻香"))), append(audio, id3v1Tag("Dao Xiang", "Jay Chou", "Mojito", "2008")...)...),
+			want: AudioTags{Title: "稻香", Artist: "Jay Chou", Album: "Mojito", Year: 2008},
+		},
+		{
+			name: "只有v1标签",
+			data: append(audio, id3v1Tag("Yesterday", "The Beatles", "Help!", "1965")...),
+			want: AudioTags{Title: "Yesterday", Artist: "The Beatles", Album: "Help!", Year: 1965},
+		},
+		{
+			name: "没有标签",
+			data: audio,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "song.mp3")
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			tags, err := ReadAudioTags(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *tags != tt.want {
+				t.Errorf("标签错误: %+v, 期望: %+v", *tags, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// IngestOptions 音乐导入选项
+type IngestOptions struct {
+	MusicDir  string `json:"music_dir"` // 音乐目录，默认./music
+	Enrich    bool   `json:"enrich"`    // 是否使用LLM补全标签
+	Transcode bool   `json:"transcode"` // 是否预转码到music-opus
+	Force     bool   `json:"force"`     // 已入库的歌曲也重新处理
+	Prune     bool   `json:"prune"`     // 删除文件已不存在的歌曲
+}
+
+// IngestResult 音乐导入结果
+type IngestResult struct {
+	Added   []string          `json:"added"`
+	Updated []string          `json:"updated"`
+	Skipped []string          `json:"skipped"`
+	Pruned  []string          `json:"pruned"`
+	Failed  map[string]string `json:"failed"`
+}
+
+// supportedMusicExts 支持导入的音频格式，与AudioToOpusData保持一致
+var supportedMusicExts = map[string]bool{
+	".mp3": true,
+	".wav": true,
+}
+
+// ScanMusicDir 扫描目录下的音频文件
+func ScanMusicDir(musicDir string) ([]string, error) {
+	entries, err := os.ReadDir(musicDir)
+	if err != nil {
+		return nil, fmt.Errorf("读取音乐目录失败: %v", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if supportedMusicExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+			files = append(files, filepath.Join(musicDir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ImportMusicDir 扫描音乐目录并导入知识库，enricher为nil时不补全标签
+func ImportMusicDir(ctx context.Context, opts IngestOptions, enricher SongEnricher) (*IngestResult, error) {
+	if opts.MusicDir == "" {
+		opts.MusicDir = utils.DefaultMusicDir
+	}
+	files, err := ScanMusicDir(opts.MusicDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IngestResult{Failed: map[string]string{}}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		name := filepath.Base(file)
+		added, skipped, err := ImportMusicFile(ctx, file, opts, enricher)
+		switch {
+		case err != nil:
+			result.Failed[name] = err.Error()
+		case skipped:
+			result.Skipped = append(result.Skipped, name)
+		case added:
+			result.Added = append(result.Added, name)
+		default:
+			result.Updated = append(result.Updated, name)
+		}
+	}
+
+	if opts.Prune {
+		result.Pruned, err = PruneMissingSongs()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	utils.ResetMusicNamesCache()
+	return result, nil
+}
+
+// ImportMusicFile 导入单个音乐文件，返回是否为新增、是否跳过
+func ImportMusicFile(ctx context.Context, file string, opts IngestOptions, enricher SongEnricher) (bool, bool, error) {
+	song, err := songFromFile(file)
+	if err != nil {
+		return false, false, err
+	}
+
+	id := SongID(song)
+	existing, exists := Get(id)
+	cached := !opts.Transcode || utils.IsMusicOpusCached(file)
+	enriched := enricher == nil || (exists && len(existing.MoodTags) > 0)
+	if exists && !opts.Force && cached && enriched {
+		return false, true, nil
+	}
+
+	// 重新导入时保留已有的标签，避免重复调用LLM
+	if exists && !opts.Force {
+		mergeSongTags(song, existing)
+	}
+
+	if opts.Transcode && (opts.Force || !utils.IsMusicOpusCached(file)) {
+		_, duration, err := utils.TranscodeMusicToOpus(file)
+		if err != nil {
+			return false, false, err
+		}
+		if duration > 0 {
+			song.Duration = int(duration + 0.5)
+		}
+	}
+
+	if enricher != nil && (opts.Force || len(song.MoodTags) == 0) {
+		if err := enricher.Enrich(ctx, song); err != nil {
+			// 标签补全失败不影响入库
+			if utils.DefaultLogger != nil {
+				utils.DefaultLogger.Warn("补全歌曲标签失败 %s: %v", song.Title, err)
+			}
+		}
+	}
+
+	if _, err := Upsert(song); err != nil {
+		return false, false, err
+	}
+	return !exists, false, nil
+}
+
+// DeleteSong 删除歌曲，removeFiles为true时同时删除音乐文件和opus缓存
+func DeleteSong(id string, removeFiles bool) error {
+	song, ok := Get(id)
+	if !ok {
+		return fmt.Errorf("歌曲不存在: %s", id)
+	}
+	if err := Delete(id); err != nil {
+		return err
+	}
+
+	if song.File != "" {
+		if err := utils.RemoveMusicOpusCache(song.File); err != nil {
+			return err
+		}
+		if removeFiles {
+			if err := os.Remove(song.File); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			utils.ResetMusicNamesCache()
+		}
+	}
+	return nil
+}
+
+// PruneMissingSongs 删除音乐文件已不存在的歌曲，返回被删除的ID
+func PruneMissingSongs() ([]string, error) {
+	var pruned []string
+	for _, entry := range List() {
+		if entry.File == "" {
+			continue
+		}
+		if _, err := os.Stat(entry.File); !os.IsNotExist(err) {
+			continue
+		}
+		if err := DeleteSong(entry.ID, false); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, entry.ID)
+	}
+	return pruned, nil
+}
+
+// songFromFile 根据文件名和ID3标签生成歌曲信息
+func songFromFile(file string) (*Song, error) {
+	tags, err := ReadAudioTags(file)
+	if err != nil {
+		return nil, err
+	}
+
+	song := &Song{
+		Title:       tags.Title,
+		Artist:      tags.Artist,
+		Album:       tags.Album,
+		Genre:       tags.Genre,
+		ReleaseYear: tags.Year,
+		Duration:    tags.Duration,
+		File:        file,
+	}
+
+	// 没有标签时，按"歌名-歌手"格式解析文件名
+	if song.Title == "" {
+		name := utils.GetFileNameFromPath(file)
+		if parts := strings.SplitN(name, "-", 2); len(parts) == 2 && song.Artist == "" {
+			song.Title = strings.TrimSpace(parts[0])
+			song.Artist = strings.TrimSpace(parts[1])
+		} else {
+			song.Title = name
+		}
+	}
+
+	if song.Duration == 0 && strings.EqualFold(filepath.Ext(file), ".mp3") {
+		song.Duration = mp3Duration(file)
+	}
+	return song, nil
+}
+
+// mp3Duration 通过解码器计算mp3时长（秒），失败返回0
+func mp3Duration(file string) int {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	decoder, err := mp3.NewDecoder(f)
+	if err != nil || decoder.SampleRate() == 0 {
+		return 0
+	}
+	// 解码输出为16位双声道，每个采样4字节
+	return int(decoder.Length() / 4 / int64(decoder.SampleRate()))
+}
@@ -0,0 +1,70 @@
+package kb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportMusicDir(t *testing.T) {
+	loadLocalKB(t, t.TempDir(), 64)
+	musicDir := t.TempDir()
+	files := map[string][]byte{
+		"qinghuaci.mp3":  id3Tag(3, id3Frame(3, "TIT2", latin1Text("青花瓷")), id3Frame(3, "TPE1", latin1Text("周杰伦")), id3Frame(3, "TLEN", latin1Text("239000"))),
+		"十年-陈奕迅.mp3":     make([]byte, 64),
+		"readme.txt":     []byte("不是音频"),
+		"notes/note.mp3": nil,
+	}
+	for name, data := range files {
+		path := filepath.Join(musicDir, name)
+		if data == nil {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	result, err := ImportMusicDir(ctx, IngestOptions{MusicDir: musicDir}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Added) != 2 || len(result.Failed) != 0 {
+		t.Fatalf("导入结果错误: %+v", result)
+	}
+
+	t.Run("按标签和文件名生成歌曲信息", func(t *testing.T) {
+		byTitle := map[string]Song{}
+		for _, entry := range List() {
+			byTitle[entry.Title] = entry.Song
+		}
+		if song := byTitle["青花瓷"]; song.Artist != "周杰伦" || song.Duration != 239 {
+			t.Errorf("ID3标签解析错误: %+v", song)
+		}
+		if song := byTitle["十年"]; song.Artist != "陈奕迅" {
+			t.Errorf("文件名解析错误: %+v", song)
+		}
+	})
+
+	t.Run("重复导入跳过", func(t *testing.T) {
+		result, err := ImportMusicDir(ctx, IngestOptions{MusicDir: musicDir}, nil)
+		if err != nil || len(result.Skipped) != 2 || len(result.Added) != 0 {
+			t.Errorf("重复导入结果错误: %v %+v", err, result)
+		}
+	})
+
+	t.Run("删除文件后清理", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(musicDir, "qinghuaci.mp3")); err != nil {
+			t.Fatal(err)
+		}
+		result, err := ImportMusicDir(ctx, IngestOptions{MusicDir: musicDir, Prune: true}, nil)
+		if err != nil || len(result.Pruned) != 1 || len(List()) != 1 {
+			t.Errorf("清理结果错误: %v %+v", err, result)
+		}
+	})
+}
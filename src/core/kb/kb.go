@@ -2,69 +2,317 @@ package kb
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"runtime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 
-	"github.com/google/uuid"
 	"github.com/philippgille/chromem-go"
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/providers/embedding"
+	"xiaozhi-server-go/src/core/utils"
 )
 
 const (
 	// KBPath = "../../../music-kb"
-	KBPath              = "music-kb"
-	CollectionName      = "song"
+	KBPath                      = "music-kb"
+	CollectionName              = "song"
 	SongNameSimilarityThreshold = 0.38
+	// IndexFileName 歌曲索引文件，放在KBPath下，chromem会跳过目录下的普通文件
+	IndexFileName = "songs_index.json"
+	// EmbeddingFileName 记录生成向量所用的模型
+	EmbeddingFileName = "embedding_model"
 )
 
 var gCtx context.Context
 var gDB *chromem.DB
 var gCollection *chromem.Collection
+var gKBPath = KBPath
 
-func Load(config *configs.Config) {
-	load(config.LLM[config.SelectedModule["LLM"]].BaseURL, config.LLM[config.SelectedModule["LLM"]].APIKey, config.MusicService.EmbeddingModelName)
+// 歌曲索引，chromem不支持遍历文档，列表和删除依赖该索引
+var gIndex = map[string]Song{}
+var gIndexMutex sync.RWMutex
+
+// ErrUnavailable 知识库未加载或加载失败，调用方应退回文件名模糊匹配
+var ErrUnavailable = errors.New("知识库未加载")
+
+// Load 加载音乐知识库，失败时知识库不可用但不影响服务启动
+func Load(config *configs.Config) error {
+	embedCfg := embeddingConfig(config)
+	provider, err := embedding.Create(embedCfg.Type, embedCfg)
+	if err != nil {
+		return err
+	}
+	legacy := embedding.Fingerprint(legacyEmbeddingConfig(config))
+	return loadWithEmbedding(KBPath, provider.Embed, embedding.Fingerprint(embedCfg), legacy)
+}
+
+// embeddingConfig 获取选中的向量模型配置；未配置embedding模块时沿用LLM地址和music_service中的模型名
+func embeddingConfig(config *configs.Config) *embedding.Config {
+	if name, ok := config.SelectedModule["Embedding"]; ok && name != "" {
+		if cfg, ok := config.Embedding[name]; ok {
+			return &embedding.Config{
+				Name:       name,
+				Type:       cfg.Type,
+				ModelName:  cfg.ModelName,
+				BaseURL:    cfg.BaseURL,
+				APIKey:     cfg.APIKey,
+				Dimensions: cfg.Dimensions,
+				Extra:      cfg.Extra,
+			}
+		}
+	}
+
+	return legacyEmbeddingConfig(config)
+}
+
+// legacyEmbeddingConfig 旧版本使用的远程向量模型，即LLM地址加music_service中的模型名
+func legacyEmbeddingConfig(config *configs.Config) *embedding.Config {
+	llmCfg := config.LLM[config.SelectedModule["LLM"]]
+	return &embedding.Config{
+		Name:      "legacy",
+		Type:      "openai",
+		ModelName: config.MusicService.EmbeddingModelName,
+		BaseURL:   llmCfg.BaseURL,
+		APIKey:    llmCfg.APIKey,
+	}
+}
+
+func load(path, baseUrl, apiKey, modelName string) error {
+	embeddingFunc := chromem.NewEmbeddingFuncOpenAICompat(baseUrl, apiKey, modelName, nil)
+	fingerprint := "openai/" + modelName + "/0"
+	return loadWithEmbedding(path, embeddingFunc, fingerprint, fingerprint)
 }
 
-func load(baseUrl, apiKey, modelName string) {
+// loadWithEmbedding 打开知识库目录，向量模型变化时用索引中的歌曲和文档重建向量
+// legacyFingerprint 为旧版本（未记录模型）使用的向量模型，没有记录时按它判断是否需要重建
+func loadWithEmbedding(path string, embeddingFunc chromem.EmbeddingFunc, fingerprint, legacyFingerprint string) error {
 	gCtx = context.Background()
+	gDB = nil
+	gCollection = nil
+	gKBPath = path
+	gEmbeddingFunc = embeddingFunc
 
-	var err error
-	gDB, err = chromem.NewPersistentDB(KBPath, false)
-	// gDB = chromem.NewDB()
+	db, err := chromem.NewPersistentDB(path, false)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("打开知识库失败: %v", err)
 	}
 
-	embeddingFunc := chromem.NewEmbeddingFuncOpenAICompat(baseUrl, apiKey, modelName, nil)
+	if err := loadIndex(); err != nil {
+		return fmt.Errorf("加载歌曲索引失败: %v", err)
+	}
 
-	// 创建集合
-	gCollection = gDB.GetCollection(CollectionName, embeddingFunc)
-	if gCollection == nil {
-		gCollection, err = gDB.CreateCollection(CollectionName, nil, embeddingFunc)
+	fingerprintPath := filepath.Join(path, EmbeddingFileName)
+	recorded, _ := os.ReadFile(fingerprintPath)
+	oldFingerprint := strings.TrimSpace(string(recorded))
+	if oldFingerprint == "" {
+		// 旧版本没有记录模型，向量来自旧的远程模型
+		oldFingerprint = legacyFingerprint
+	}
+	rebuild := oldFingerprint != fingerprint
+
+	collection := db.GetCollection(CollectionName, embeddingFunc)
+	if collection != nil && rebuild && collection.Count() > 0 {
+		// 不同模型的向量不能混用，删除旧集合后重建
+		if err := db.DeleteCollection(CollectionName); err != nil {
+			return fmt.Errorf("删除旧向量集合失败: %v", err)
+		}
+		collection = nil
+	}
+	if collection == nil {
+		collection, err = db.CreateCollection(CollectionName, nil, embeddingFunc)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("创建向量集合失败: %v", err)
 		}
 	}
+
+	gDB = db
+	gCollection = collection
+
+	if rebuild {
+		if err := reindex(); err != nil {
+			return fmt.Errorf("重建知识库向量失败: %v", err)
+		}
+	}
+	if err := loadCollections(rebuild); err != nil {
+		return err
+	}
+	if rebuild || len(recorded) == 0 {
+		if err := os.WriteFile(fingerprintPath, []byte(fingerprint), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reindex 用当前向量模型重新写入索引中的所有歌曲
+func reindex() error {
+	entries := List()
+	for _, entry := range entries {
+		song := entry.Song
+		if _, err := Upsert(&song); err != nil {
+			gCollection = nil
+			return err
+		}
+	}
+	return nil
 }
 
-// Add 向知识库添加文档
+// Available 知识库是否可用
+func Available() bool {
+	return gCollection != nil
+}
+
+// SongID 生成歌曲的稳定ID，有文件名时按文件名，否则按标题和歌手
+func SongID(song *Song) string {
+	key := strings.ToLower(strings.TrimSpace(song.Title)) + "|" + strings.ToLower(strings.TrimSpace(song.Artist))
+	if song.File != "" {
+		key = strings.ToLower(filepath.Base(song.File))
+	}
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Add 向知识库添加文档，相同歌曲会覆盖原有文档
 func Add(jsonStr string) error {
-	// 生成UUID作为文档ID
-	id := uuid.New().String()
-
-	// 添加文档
-	err := gCollection.AddDocuments(gCtx, []chromem.Document{
-		{
-			ID:      id,
-			Content: jsonStr,
+	song, err := FromJSON(jsonStr)
+	if err != nil {
+		return err
+	}
+	_, err = Upsert(song)
+	return err
+}
+
+// Upsert 插入或更新歌曲，返回歌曲ID
+func Upsert(song *Song) (string, error) {
+	if gCollection == nil {
+		return "", ErrUnavailable
+	}
+
+	id := SongID(song)
+	content, err := song.ToJSON()
+	if err != nil {
+		return "", err
+	}
+
+	err = gCollection.AddDocument(gCtx, chromem.Document{
+		ID:      id,
+		Content: content,
+		Metadata: map[string]string{
+			"title":  song.Title,
+			"artist": song.Artist,
+			"file":   song.File,
 		},
-	}, runtime.NumCPU())
+	})
+	if err != nil {
+		return "", err
+	}
 
-	return err
+	gIndexMutex.Lock()
+	gIndex[id] = *song
+	gIndexMutex.Unlock()
+	return id, saveIndex()
+}
+
+// Get 根据ID获取歌曲
+func Get(id string) (*Song, bool) {
+	gIndexMutex.RLock()
+	defer gIndexMutex.RUnlock()
+	song, ok := gIndex[id]
+	if !ok {
+		return nil, false
+	}
+	return &song, true
+}
+
+// List 列出知识库中的所有歌曲，按标题排序
+func List() []SongEntry {
+	gIndexMutex.RLock()
+	entries := make([]SongEntry, 0, len(gIndex))
+	for id, song := range gIndex {
+		entries = append(entries, SongEntry{ID: id, Song: song})
+	}
+	gIndexMutex.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Title < entries[j].Title
+	})
+	return entries
+}
+
+// Delete 从知识库删除歌曲
+func Delete(id string) error {
+	if gCollection == nil {
+		return ErrUnavailable
+	}
+	if err := gCollection.Delete(gCtx, nil, nil, id); err != nil {
+		return err
+	}
+
+	gIndexMutex.Lock()
+	delete(gIndex, id)
+	gIndexMutex.Unlock()
+	return saveIndex()
+}
+
+func loadIndex() error {
+	data, err := os.ReadFile(filepath.Join(gKBPath, IndexFileName))
+	index := map[string]Song{}
+	if err != nil {
+		if os.IsNotExist(err) {
+			gIndexMutex.Lock()
+			gIndex = index
+			gIndexMutex.Unlock()
+			return nil
+		}
+		return err
+	}
+
+	if err := json.Unmarshal(data, &index); err != nil {
+		return err
+	}
+
+	gIndexMutex.Lock()
+	gIndex = index
+	gIndexMutex.Unlock()
+	return nil
+}
+
+func saveIndex() error {
+	gIndexMutex.RLock()
+	data, err := json.MarshalIndent(gIndex, "", "  ")
+	gIndexMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再替换，避免写一半时索引损坏
+	path := filepath.Join(gKBPath, IndexFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
 
 // Search 搜索知识库
 func Search(query string, nResults int) ([]Song, error) {
+	if gCollection == nil {
+		return nil, ErrUnavailable
+	}
+	// chromem要求结果数不超过文档数
+	if count := gCollection.Count(); nResults > count {
+		nResults = count
+	}
+	if nResults <= 0 {
+		return nil, nil
+	}
 	res, err := gCollection.Query(gCtx, query, nResults, nil, nil)
 	if err != nil {
 		return nil, err
@@ -86,10 +334,15 @@ func Search(query string, nResults int) ([]Song, error) {
 }
 
 func IsSongExist(songName string) bool {
+	if gCollection == nil || gCollection.Count() == 0 {
+		return false
+	}
 	res, err := gCollection.Query(gCtx, songName, 1, nil, nil)
-	if err != nil {
+	if err != nil || len(res) == 0 {
 		return false
 	}
-	fmt.Println("相似度:", res[0].Similarity)
+	if utils.DefaultLogger != nil {
+		utils.DefaultLogger.DebugKV("歌曲名相似度", "song", songName, "similarity", res[0].Similarity)
+	}
 	return res[0].Similarity > SongNameSimilarityThreshold
 }
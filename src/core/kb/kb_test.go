@@ -2,7 +2,12 @@ package kb
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"xiaozhi-server-go/src/core/providers/embedding"
+	_ "xiaozhi-server-go/src/core/providers/embedding/local"
 )
 
 func TestCase1(t *testing.T) {
@@ -101,7 +106,16 @@ func TestCase2(t *testing.T) {
 }
 
 func TestCase3(t *testing.T) {
-	load("https://dashscope.aliyuncs.com/compatible-mode/v1", "sk-e8690fae27c4479a8718f71ebe20177d", "text-embedding-v4")
+	apiKey := os.Getenv("DASHSCOPE_API_KEY")
+	if apiKey == "" {
+		t.Skip("未设置DASHSCOPE_API_KEY，跳过远程向量模型测试")
+	}
+	if err := load(t.TempDir(), "https://dashscope.aliyuncs.com/compatible-mode/v1", apiKey, "text-embedding-v4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(`{"title": "青花瓷", "artist": "周杰伦", "genre": "流行", "mood_tags": ["中国风"]}`); err != nil {
+		t.Fatal(err)
+	}
 	docs, err := Search("周杰伦的青花瓷", 10)
 	if err != nil {
 		t.Fatal(err)
@@ -110,3 +124,107 @@ func TestCase3(t *testing.T) {
 		fmt.Println(v)
 	}
 }
+
+// legacyTestFingerprint 模拟旧版本使用的远程向量模型
+const legacyTestFingerprint = "openai/text-embedding-v4/0"
+
+func loadLocalKB(t *testing.T, dir string, dimensions int) {
+	t.Helper()
+	cfg := &embedding.Config{Type: "local", Dimensions: dimensions}
+	provider, err := embedding.Create("local", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadWithEmbedding(dir, provider.Embed, embedding.Fingerprint(cfg), legacyTestFingerprint); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalEmbedding(t *testing.T) {
+	dir := t.TempDir()
+	loadLocalKB(t, dir, 256)
+
+	songs := []Song{
+		{Title: "青花瓷", Artist: "周杰伦", Genre: "流行", MoodTags: []string{"中国风", "优雅"}},
+		{Title: "十年", Artist: "陈奕迅", Genre: "流行", MoodTags: []string{"怀旧", "伤感"}},
+		{Title: "Hotel California", Artist: "Eagles", Genre: "rock"},
+	}
+	for i := range songs {
+		if _, err := Upsert(&songs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("相同歌曲重复写入不产生重复文档", func(t *testing.T) {
+		if _, err := Upsert(&songs[0]); err != nil {
+			t.Fatal(err)
+		}
+		if n := gCollection.Count(); n != len(songs) {
+			t.Errorf("文档数量错误: %d", n)
+		}
+		if n := len(List()); n != len(songs) {
+			t.Errorf("索引数量错误: %d", n)
+		}
+	})
+
+	t.Run("检索结果", func(t *testing.T) {
+		res, err := Search("周杰伦的青花瓷", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != len(songs) || res[0].Title != "青花瓷" {
+			t.Errorf("检索结果错误: %+v", res)
+		}
+	})
+
+	t.Run("删除歌曲", func(t *testing.T) {
+		if err := Delete(SongID(&songs[2])); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := Get(SongID(&songs[2])); ok {
+			t.Error("歌曲仍在索引中")
+		}
+		if n := gCollection.Count(); n != 2 {
+			t.Errorf("文档数量错误: %d", n)
+		}
+	})
+
+	t.Run("切换向量模型后重建", func(t *testing.T) {
+		loadLocalKB(t, dir, 64)
+		if n := gCollection.Count(); n != 2 {
+			t.Fatalf("重建后文档数量错误: %d", n)
+		}
+		res, err := Search("青花瓷", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0].Title != "青花瓷" {
+			t.Errorf("重建后检索结果错误: %+v", res)
+		}
+	})
+
+	t.Run("旧版本没有记录模型时按远程模型重建", func(t *testing.T) {
+		fingerprintPath := filepath.Join(dir, EmbeddingFileName)
+		if err := os.Remove(fingerprintPath); err != nil {
+			t.Fatal(err)
+		}
+		loadLocalKB(t, dir, 128)
+		res, err := Search("十年", 1)
+		if err != nil || len(res) != 1 || res[0].Title != "十年" {
+			t.Fatalf("重建后检索结果错误: %v %+v", err, res)
+		}
+		if data, _ := os.ReadFile(fingerprintPath); string(data) != "local//128" {
+			t.Errorf("未记录当前模型: %q", data)
+		}
+	})
+}
+
+func TestUnavailable(t *testing.T) {
+	gCollection = nil
+	if _, err := Search("青花瓷", 1); err != ErrUnavailable {
+		t.Errorf("期望ErrUnavailable, 实际: %v", err)
+	}
+	if IsSongExist("青花瓷") {
+		t.Error("知识库不可用时不应判断歌曲存在")
+	}
+}
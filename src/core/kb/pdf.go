@@ -0,0 +1,236 @@
+package kb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+var (
+	pdfStreamRe = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	pdfTextOpRe = regexp.MustCompile(`^(Tj|TJ|'|"|T\*|Td|TD|Tm|ET)$`)
+)
+
+// ReadPDFText 提取PDF中的文本
+// 优先使用poppler的pdftotext，没有安装时使用内置解析器，
+// 内置解析器只支持文字未经自定义编码的PDF，中文PDF建议安装pdftotext
+func ReadPDFText(path string) (string, error) {
+	if bin, err := exec.LookPath("pdftotext"); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, bin, "-layout", "-enc", "UTF-8", path, "-").Output()
+		if err == nil && strings.TrimSpace(string(out)) != "" {
+			return string(out), nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	text := extractPDFText(data)
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("未能从PDF中提取文本，请安装pdftotext或先转换为txt: %s", path)
+	}
+	return text, nil
+}
+
+// extractPDFText 解压内容流并读取文本绘制操作中的字符串
+func extractPDFText(data []byte) string {
+	var out strings.Builder
+	for _, loc := range pdfStreamRe.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[loc[2]:loc[3]])
+		start := loc[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+
+		// 跳过图片、字体等非内容流
+		if strings.Contains(dict, "/Image") || strings.Contains(dict, "/FontFile") || strings.Contains(dict, "/Length1") {
+			continue
+		}
+		if strings.Contains(dict, "/FlateDecode") {
+			r, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			decoded, err := io.ReadAll(r)
+			r.Close()
+			if err != nil && len(decoded) == 0 {
+				continue
+			}
+			stream = decoded
+		} else if strings.Contains(dict, "/Filter") {
+			continue
+		}
+
+		if !bytes.Contains(stream, []byte("BT")) {
+			continue
+		}
+		out.WriteString(parseContentStream(stream))
+	}
+	return out.String()
+}
+
+// parseContentStream 解析内容流，收集操作数中的字符串，遇到换行类操作时换行
+func parseContentStream(stream []byte) string {
+	var out strings.Builder
+	var operands []string
+	line := false
+
+	for i := 0; i < len(stream); {
+		c := stream[i]
+		switch {
+		case c == '(':
+			s, n := readPDFLiteral(stream[i:])
+			operands = append(operands, s)
+			i += n
+		case c == '<' && i+1 < len(stream) && stream[i+1] != '<':
+			end := bytes.IndexByte(stream[i:], '>')
+			if end < 0 {
+				return out.String()
+			}
+			operands = append(operands, decodePDFHex(string(stream[i+1:i+end])))
+			i += end + 1
+		case c == '%':
+			for i < len(stream) && stream[i] != '\n' && stream[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			j := i
+			for j < len(stream) && isPDFRegular(stream[j]) {
+				j++
+			}
+			token := string(stream[i:j])
+			i = j
+			if !pdfTextOpRe.MatchString(token) {
+				// 数字是操作数，其他操作符丢弃之前收集的字符串
+				if _, err := strconv.ParseFloat(token, 64); err != nil {
+					operands = operands[:0]
+				}
+				continue
+			}
+			switch token {
+			case "Tj", "TJ", "'", "\"":
+				if token != "Tj" && token != "TJ" && line {
+					out.WriteString("\n")
+				}
+				for _, s := range operands {
+					out.WriteString(s)
+				}
+				line = true
+			default:
+				if line {
+					out.WriteString("\n")
+					line = false
+				}
+			}
+			operands = operands[:0]
+		default:
+			i++
+		}
+	}
+	if line {
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// readPDFLiteral 读取括号字符串，处理转义和嵌套括号，返回内容和消耗的字节数
+func readPDFLiteral(data []byte) (string, int) {
+	var buf []byte
+	depth := 0
+	i := 0
+	for ; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\\' && i+1 < len(data):
+			i++
+			switch e := data[i]; e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r':
+				buf = append(buf, '\r')
+			case 't':
+				buf = append(buf, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// 续行
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					k := 0
+					for ; k < 3 && i+k < len(data) && data[i+k] >= '0' && data[i+k] <= '7'; k++ {
+						v = v*8 + int(data[i+k]-'0')
+					}
+					i += k - 1
+					buf = append(buf, byte(v))
+				} else {
+					buf = append(buf, e)
+				}
+			}
+		case c == '(':
+			if depth > 0 {
+				buf = append(buf, c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return decodePDFString(buf), i + 1
+			}
+			buf = append(buf, c)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return decodePDFString(buf), i
+}
+
+func decodePDFHex(s string) string {
+	s = strings.Join(strings.Fields(s), "")
+	if len(s)%2 == 1 {
+		s += "0"
+	}
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return ""
+	}
+	return decodePDFString(buf)
+}
+
+// decodePDFString 带BOM的按UTF-16BE解码，否则按Latin-1处理
+func decodePDFString(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+func isPDFRegular(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return false
+	}
+	return true
+}
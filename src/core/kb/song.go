@@ -25,6 +25,13 @@ type Song struct {
 	LocationTags    []string `json:"location_tags"`
 	CulturalTags    []string `json:"cultural_tags"`
 	PerformanceForm string   `json:"performance_form"`
+	File            string   `json:"file,omitempty"` // 音乐文件路径，导入时填写
+}
+
+// SongEntry 带ID的歌曲信息
+type SongEntry struct {
+	ID string `json:"id"`
+	Song
 }
 
 // ToJSON 将 Song 结构体转换为 JSON 字符串
@@ -44,4 +51,4 @@ func FromJSON(jsonStr string) (*Song, error) {
 		return nil, fmt.Errorf("failed to unmarshal JSON to song: %w", err)
 	}
 	return &song, nil
-}
\ No newline at end of file
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"sync"
 	"time"
-	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
 
 	mcpclient "github.com/mark3labs/mcp-go/client"
@@ -250,33 +249,9 @@ func (c *Client) CallTool(
 			return nil, nil
 		}
 
-		// 返回第一个内容项，或整个内容列表
-		if len(result.Content) == 1 {
-			// 如果是文本内容，直接返回文本
-			if textContent, ok := result.Content[0].(mcp.TextContent); ok {
-				return textContent.Text, nil
-			}
-			ret := types.ActionResponse{
-				Action: types.ActionTypeReqLLM,
-				Result: result.Content[0],
-			}
-			return ret, nil
-		}
-
-		// 处理多个内容项的情况
-		processedContent := make([]interface{}, 0, len(result.Content))
-		for _, content := range result.Content {
-			if textContent, ok := content.(mcp.TextContent); ok {
-				processedContent = append(processedContent, textContent.Text)
-			} else {
-				processedContent = append(processedContent, content)
-			}
-		}
-		ret := types.ActionResponse{
-			Action: types.ActionTypeReqLLM,
-			Result: processedContent,
-		}
-		return ret, nil
+		// 保留所有内容项，文本交给LLM，图片和音频交给连接处理
+		toolResult := ToolResult{ToolName: name, Contents: FromMCPContents(result.Content)}
+		return toolResult.ToActionResponse(), nil
 	}
 
 	// 原始网络客户端不支持直接调用工具
@@ -0,0 +1,150 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	ContentTypeText  = "text"
+	ContentTypeImage = "image"
+	ContentTypeAudio = "audio"
+
+	// ToolContentHandler 处理包含图片或音频的工具结果的handler名称
+	ToolContentHandler = "mcp_handler_tool_content"
+)
+
+// ToolContent MCP工具返回的单个内容项
+type ToolContent struct {
+	Type     string // text, image, audio
+	Text     string // 文本内容
+	Data     string // base64编码的图片或音频
+	MIMEType string // 图片或音频的MIME类型
+	URI      string // 嵌入资源的URI
+}
+
+// ToolResult MCP工具返回的全部内容项
+type ToolResult struct {
+	ToolName string
+	Contents []ToolContent
+}
+
+// Text 拼接所有文本内容项
+func (r ToolResult) Text() string {
+	texts := make([]string, 0, len(r.Contents))
+	for _, content := range r.Contents {
+		if content.Type == ContentTypeText && content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ByType 返回指定类型的内容项
+func (r ToolResult) ByType(contentType string) []ToolContent {
+	var result []ToolContent
+	for _, content := range r.Contents {
+		if content.Type == contentType {
+			result = append(result, content)
+		}
+	}
+	return result
+}
+
+// IsMultimodal 是否包含图片或音频
+func (r ToolResult) IsMultimodal() bool {
+	return len(r.ByType(ContentTypeImage)) > 0 || len(r.ByType(ContentTypeAudio)) > 0
+}
+
+// ToActionResponse 按内容类型转换为动作：纯文本交给LLM，包含图片或音频时交给连接的handler处理
+func (r ToolResult) ToActionResponse() types.ActionResponse {
+	if r.IsMultimodal() {
+		return types.ActionResponse{
+			Action: types.ActionTypeCallHandler,
+			Result: types.ActionResponseCall{
+				FuncName: ToolContentHandler,
+				Args:     r,
+			},
+		}
+	}
+	return types.ActionResponse{
+		Action: types.ActionTypeReqLLM,
+		Result: r.Text(),
+	}
+}
+
+// ParseToolContents 解析JSON-RPC返回的content数组
+func ParseToolContents(raw []interface{}) []ToolContent {
+	contents := make([]ToolContent, 0, len(raw))
+	for _, item := range raw {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		contentType, _ := itemMap["type"].(string)
+		switch contentType {
+		case ContentTypeText:
+			text, _ := itemMap["text"].(string)
+			contents = append(contents, textContent(text))
+		case ContentTypeImage, ContentTypeAudio:
+			data, _ := itemMap["data"].(string)
+			mimeType, _ := itemMap["mimeType"].(string)
+			contents = append(contents, ToolContent{Type: contentType, Data: data, MIMEType: mimeType})
+		case "resource":
+			resource, _ := itemMap["resource"].(map[string]interface{})
+			uri, _ := resource["uri"].(string)
+			mimeType, _ := resource["mimeType"].(string)
+			text, _ := resource["text"].(string)
+			blob, _ := resource["blob"].(string)
+			contents = append(contents, resourceContent(uri, mimeType, text, blob))
+		}
+	}
+	return contents
+}
+
+// FromMCPContents 转换mcp-go客户端返回的内容项
+func FromMCPContents(raw []mcp.Content) []ToolContent {
+	contents := make([]ToolContent, 0, len(raw))
+	for _, item := range raw {
+		switch content := item.(type) {
+		case mcp.TextContent:
+			contents = append(contents, textContent(content.Text))
+		case mcp.ImageContent:
+			contents = append(contents, ToolContent{Type: ContentTypeImage, Data: content.Data, MIMEType: content.MIMEType})
+		case mcp.AudioContent:
+			contents = append(contents, ToolContent{Type: ContentTypeAudio, Data: content.Data, MIMEType: content.MIMEType})
+		case mcp.EmbeddedResource:
+			switch resource := content.Resource.(type) {
+			case mcp.TextResourceContents:
+				contents = append(contents, resourceContent(resource.URI, resource.MIMEType, resource.Text, ""))
+			case mcp.BlobResourceContents:
+				contents = append(contents, resourceContent(resource.URI, resource.MIMEType, "", resource.Blob))
+			}
+		}
+	}
+	return contents
+}
+
+// resourceContent 嵌入资源按MIME类型归类，无法识别的二进制资源只保留URI
+func resourceContent(uri, mimeType, text, blob string) ToolContent {
+	if blob != "" {
+		if strings.HasPrefix(mimeType, "image/") {
+			return ToolContent{Type: ContentTypeImage, Data: blob, MIMEType: mimeType, URI: uri}
+		}
+		if strings.HasPrefix(mimeType, "audio/") {
+			return ToolContent{Type: ContentTypeAudio, Data: blob, MIMEType: mimeType, URI: uri}
+		}
+		return ToolContent{Type: ContentTypeText, Text: fmt.Sprintf("[资源 %s (%s)]", uri, mimeType), URI: uri}
+	}
+	content := textContent(text)
+	content.URI = uri
+	return content
+}
+
+// textContent 文本内容项
+func textContent(text string) ToolContent {
+	return ToolContent{Type: ContentTypeText, Text: text}
+}
@@ -65,6 +65,12 @@ func (c *LocalClient) RegisterTools() {
 		} else if funcName == "play_music" {
 			c.AddToolPlayMusic()
 			c.logger.Info("RegisterTools: play_music tool registered")
+		} else if funcName == "search_knowledge" {
+			c.AddToolSearchKnowledge()
+			c.logger.Info("RegisterTools: search_knowledge tool registered")
+		} else if funcName == "gen_pic" {
+			c.AddToolGenPic()
+			c.logger.Info("RegisterTools: gen_pic tool registered")
 		} else {
 			c.logger.Warn("RegisterTools: unknown function name %s", funcName)
 		}
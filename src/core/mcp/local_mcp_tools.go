@@ -2,11 +2,15 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"time"
 	"xiaozhi-server-go/src/core/kb"
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/providers/imagegen"
 	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
 	"fmt"
 )
 
@@ -66,20 +70,34 @@ func (c *LocalClient) AddToolTime() error {
 }
 
 func (c *LocalClient) AddToolChangeRole() error {
-	roles := c.cfg.Roles
 	prompts := map[string]string{}
 	roleNames := ""
-	if roles == nil {
+	// 优先使用数据库中的角色定义，切换时由连接按名称重新加载
+	if roleDB := database.GetRoleDB(); roleDB != nil {
+		if roles, err := roleDB.ListRoles(); err == nil {
+			for _, role := range roles {
+				prompts[role.Name] = role.Prompt
+				roleNames += role.Name + ", "
+			}
+		} else {
+			c.logger.Warn("AddToolChangeRole: ListRoles failed: %v", err)
+		}
+	}
+	if roleNames == "" {
+		for _, role := range c.cfg.Roles {
+			items := strings.SplitN(role, "@", 2)
+			if len(items) < 2 {
+				continue
+			}
+			prompts[items[0]] = items[1]
+			roleNames += items[0] + ", "
+		}
+	}
+	if roleNames == "" {
 		c.logger.Warn(
 			"AddToolChangeRole: roles settings is nil or empty, Skipping tool registration",
 		)
 		return nil
-	} else {
-		for _, role := range roles {
-			items := strings.Split(role, "@")
-			prompts[items[0]] = items[1]
-			roleNames += items[0] + ", "
-		}
 	}
 
 	InputSchema := ToolInputSchema{
@@ -216,7 +234,18 @@ func (c *LocalClient) AddToolPlayMusic() error {
 
 			responseResult := ""
 			songs, err := kb.Search(song_requirement, song_num)
-			if err != nil || len(songs) == 0 {
+			if errors.Is(err, kb.ErrUnavailable) {
+				// 知识库不可用时列出音乐目录中的文件
+				if files, err := utils.GetAllMusicNames(utils.DefaultMusicDir); err == nil && len(files) > 0 {
+					names := make([]string, 0, len(files))
+					for _, file := range files {
+						names = append(names, utils.GetFileNameFromPath(file))
+					}
+					responseResult = "音乐库检索不可用，可播放的歌曲有：" + strings.Join(names, "、")
+				} else {
+					responseResult = "搜索音乐失败"
+				}
+			} else if err != nil || len(songs) == 0 {
 				c.logger.Error("search_music: Search failed: %v", err)
 				responseResult = "搜索音乐失败"
 			} else {
@@ -243,3 +272,96 @@ func (c *LocalClient) AddToolPlayMusic() error {
 
 	return nil
 }
+
+func (c *LocalClient) AddToolSearchKnowledge() error {
+	InputSchema := ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "检索内容，使用完整的问题或关键词",
+			},
+			"top_k": map[string]any{
+				"type":        "number",
+				"description": "返回的资料片段数量，默认使用配置值",
+			},
+		},
+		Required: []string{"query"},
+	}
+
+	c.AddTool("search_knowledge",
+		"知识库检索工具。用户询问设备说明书、课程资料等文档中的内容时调用，返回带来源编号的资料片段，回答时应基于资料并注明来源。",
+		InputSchema,
+		func(ctx context.Context, args map[string]any) (interface{}, error) {
+			query, _ := args["query"].(string)
+			topK := c.cfg.KnowledgeBase.TopK
+			if n, ok := args["top_k"].(float64); ok && n > 0 {
+				topK = int(n)
+			}
+			// 可检索的集合由连接根据设备和当前角色放入context
+			collections := kb.CollectionsFromContext(ctx)
+			c.logger.Info("search_knowledge: %s, top_k: %d, collections: %v", query, topK, collections)
+
+			responseResult := ""
+			if query == "" {
+				responseResult = "检索内容为空"
+			} else if len(collections) == 0 {
+				responseResult = "当前设备没有可用的知识库"
+			} else if chunks, err := kb.SearchChunks(ctx, collections, query, topK); err != nil {
+				c.logger.Error("search_knowledge: Search failed: %v", err)
+				responseResult = "检索知识库失败"
+			} else if len(chunks) == 0 {
+				responseResult = "知识库中没有找到相关资料"
+			} else {
+				var sb strings.Builder
+				sb.WriteString("以下是知识库中检索到的资料片段，请基于资料回答，并在引用处用[编号]注明来源：")
+				for i, chunk := range chunks {
+					sb.WriteString(fmt.Sprintf("\n\n[%d] 来源: %s\n%s", i+1, chunk.Citation(), chunk.Content))
+				}
+				responseResult = sb.String()
+			}
+
+			res := types.ActionResponse{
+				Action: types.ActionTypeReqLLM, // 动作类型
+				Result: responseResult,         // 函数参数
+			}
+			return res, nil
+		})
+
+	return nil
+}
+
+func (c *LocalClient) AddToolGenPic() error {
+	if imagegen.Default() == nil {
+		c.logger.Warn("AddToolGenPic: 未配置ImageGen，Skipping tool registration")
+		return nil
+	}
+
+	InputSchema := ToolInputSchema{
+		Type: "object",
+		Properties: map[string]any{
+			"prompt": map[string]any{
+				"type":        "string",
+				"description": "画面描述，包含主体、场景、风格等细节，如'一只在草地上奔跑的橘猫，水彩风格'",
+			},
+		},
+		Required: []string{"prompt"},
+	}
+
+	c.AddTool("gen_pic",
+		"画图工具。用户要求画一幅画、生成图片或壁纸时调用，图片生成后显示在设备屏幕上。",
+		InputSchema,
+		func(ctx context.Context, args map[string]any) (interface{}, error) {
+			prompt, _ := args["prompt"].(string)
+			res := types.ActionResponse{
+				Action: types.ActionTypeCallHandler, // 动作类型
+				Result: types.ActionResponseCall{
+					FuncName: "mcp_handler_gen_pic", // 函数名
+					Args:     prompt,                // 函数参数
+				},
+			}
+			return res, nil
+		})
+
+	return nil
+}
@@ -241,7 +241,7 @@ func (m *Manager) LoadConfig() map[string]interface{} {
 
 	data, err := os.ReadFile(m.configPath)
 	if err != nil {
-		m.logger.Error(fmt.Sprintf("Error loading MCP config from %s: %v", m.configPath, err))
+		m.logger.Error("Error loading MCP config from %s: %v", m.configPath, err)
 		return nil
 	}
 
@@ -250,7 +250,7 @@ func (m *Manager) LoadConfig() map[string]interface{} {
 	}
 
 	if err := json.Unmarshal(data, &config); err != nil {
-		m.logger.Error(fmt.Sprintf("Error parsing MCP config: %v", err))
+		m.logger.Error("Error parsing MCP config: %v", err)
 		return nil
 	}
 
@@ -346,7 +346,7 @@ func (m *Manager) registerTools(tools []go_openai.Tool) {
 		m.tools = append(m.tools, toolName)
 		if m.funcHandler != nil {
 			if err := m.funcHandler.RegisterFunction(toolName, tool); err != nil {
-				m.logger.Error(fmt.Sprintf("注册工具失败: %s, 错误: %v", toolName, err))
+				m.logger.Error("注册工具失败: %s, 错误: %v", toolName, err)
 				continue
 			}
 			// m.logger.Info("Registered tool: [%s] %s", toolName, tool.Function.Description)
@@ -374,7 +374,7 @@ func (m *Manager) ExecuteTool(
 	toolName string,
 	arguments map[string]interface{},
 ) (interface{}, error) {
-	m.logger.Info(fmt.Sprintf("Executing tool %s with arguments: %v", toolName, arguments))
+	m.logger.Info("Executing tool %s with arguments: %v", toolName, arguments)
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -388,6 +388,48 @@ func (m *Manager) ExecuteTool(
 	return nil, fmt.Errorf("Tool %s not found in any MCP server", toolName)
 }
 
+// ServerTools 本地和外部MCP服务器的工具，不包含设备端工具，供没有设备连接的调用方使用
+func (m *Manager) ServerTools() []go_openai.Tool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tools []go_openai.Tool
+	seen := make(map[string]bool)
+	for name, client := range m.clients {
+		if name == "xiaozhi" || !client.IsReady() {
+			continue
+		}
+		for _, tool := range client.GetAvailableTools() {
+			if tool.Function == nil || seen[tool.Function.Name] {
+				continue
+			}
+			seen[tool.Function.Name] = true
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// ExecuteServerTool 执行本地或外部MCP服务器的工具，不会调用设备端工具
+func (m *Manager) ExecuteServerTool(
+	ctx context.Context,
+	toolName string,
+	arguments map[string]interface{},
+) (interface{}, error) {
+	m.logger.Info("Executing server tool %s with arguments: %v", toolName, arguments)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, client := range m.clients {
+		if name != "xiaozhi" && client.HasTool(toolName) {
+			return client.CallTool(ctx, toolName, arguments)
+		}
+	}
+
+	return nil, fmt.Errorf("Tool %s not found in any MCP server", toolName)
+}
+
 // CleanupAll 依次关闭所有MCPClient
 func (m *Manager) CleanupAll(ctx context.Context) {
 	m.mu.Lock()
@@ -411,9 +453,9 @@ func (m *Manager) CleanupAll(ctx context.Context) {
 
 			select {
 			case <-done:
-				m.logger.Info(fmt.Sprintf("MCP client closed: %s", name))
+				m.logger.Info("MCP client closed: %s", name)
 			case <-ctx.Done():
-				m.logger.Error(fmt.Sprintf("Timeout closing MCP client %s", name))
+				m.logger.Error("Timeout closing MCP client %s", name)
 			}
 		}()
 
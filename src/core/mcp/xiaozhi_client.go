@@ -8,7 +8,6 @@ import (
 	"sync"
 	"time"
 	"xiaozhi-server-go/src/core/auth"
-	"xiaozhi-server-go/src/core/types"
 	"xiaozhi-server-go/src/core/utils"
 
 	"github.com/sashabaranov/go-openai"
@@ -78,7 +77,7 @@ func (c *XiaoZhiMCPClient) SetToken(token string) {
 	auth := auth.NewAuthToken(token)
 	visionToken, err := auth.GenerateToken(c.deviceID)
 	if err != nil {
-		c.logger.Error(fmt.Sprintf("生成Vision Token失败: %v", err))
+		c.logger.Error("生成Vision Token失败: %v", err)
 		return
 	}
 
@@ -239,7 +238,7 @@ func (c *XiaoZhiMCPClient) CallTool(
 		return nil, fmt.Errorf("序列化MCP工具调用请求失败: %v", err)
 	}
 
-	c.logger.Info(fmt.Sprintf("发送客户端mcp工具调用请求: %s，参数: %s", originalName, string(data)))
+	c.logger.Info("发送客户端mcp工具调用请求: %s，参数: %s", originalName, string(data))
 	err = c.conn.WriteMessage(msgTypeText, data)
 	if err != nil {
 		// 清理资源
@@ -255,7 +254,7 @@ func (c *XiaoZhiMCPClient) CallTool(
 		if err, ok := result.(error); ok {
 			return nil, err
 		}
-		c.logger.Info(fmt.Sprintf("客户端mcp工具调用 %s 成功，结果: %v", originalName, result))
+		c.logger.Info("客户端mcp工具调用 %s 成功，结果: %v", originalName, result)
 		//  map[content:[map[text:{"audio_speaker":{"volume":10},"screen":{},"network":{"type":"wifi","ssid":"zgcinnotown","signal":"weak"}} type:text]] isError:false]
 		// 将里面的text提取出来
 		if resultMap, ok := result.(map[string]interface{}); ok {
@@ -266,28 +265,11 @@ func (c *XiaoZhiMCPClient) CallTool(
 				}
 				return nil, fmt.Errorf("工具调用返回错误，但未提供具体错误信息")
 			}
-			// 检查content字段是否存在且为非空数组
+			// 保留所有内容项，文本交给LLM，图片和音频交给连接处理
 			if content, ok := resultMap["content"].([]interface{}); ok && len(content) > 0 {
-				if textMap, ok := content[0].(map[string]interface{}); ok {
-					if text, ok := textMap["text"].(string); ok {
-						if strings.Contains(originalName, "self.camera.take_photo") {
-							ret := types.ActionResponse{
-								Action: types.ActionTypeCallHandler,
-								Result: types.ActionResponseCall{
-									FuncName: "mcp_handler_take_photo",
-									Args:     text,
-								},
-							}
-							return ret, nil
-						}
-						c.logger.Info(fmt.Sprintf("工具调用返回文本: %s", text))
-						ret := types.ActionResponse{
-							Action: types.ActionTypeReqLLM,
-							Result: text,
-						}
-						return ret, nil
-					}
-				}
+				toolResult := ToolResult{ToolName: originalName, Contents: ParseToolContents(content)}
+				c.logger.Info("工具调用返回 %d 个内容项，文本: %s", len(toolResult.Contents), toolResult.Text())
+				return toolResult.ToActionResponse(), nil
 			}
 		}
 		return result, nil
@@ -395,7 +377,7 @@ func (c *XiaoZhiMCPClient) SendMCPToolsListContinueRequest(cursor string) error
 		return fmt.Errorf("序列化MCP工具列表请求失败: %v", err)
 	}
 
-	c.logger.Info(fmt.Sprintf("发送带cursor的MCP工具列表请求: %s", cursor))
+	c.logger.Info("发送带cursor的MCP工具列表请求: %s", cursor)
 	return c.conn.WriteMessage(msgTypeText, data)
 }
 
@@ -432,7 +414,7 @@ func (c *XiaoZhiMCPClient) HandleMCPMessage(msgMap map[string]interface{}) error
 			if serverInfo, ok := result.(map[string]interface{})["serverInfo"].(map[string]interface{}); ok {
 				name := serverInfo["name"]
 				version := serverInfo["version"]
-				c.logger.Info(fmt.Sprintf("客户端MCP服务器信息: name=%v, version=%v", name, version))
+				c.logger.Info("客户端MCP服务器信息: name=%v, version=%v", name, version)
 			}
 
 			// 初始化完成后，请求工具列表
@@ -448,7 +430,7 @@ func (c *XiaoZhiMCPClient) HandleMCPMessage(msgMap map[string]interface{}) error
 					return fmt.Errorf("工具列表格式错误")
 				}
 
-				c.logger.Debug(fmt.Sprintf("客户端设备支持的工具数量: %d", len(tools)))
+				c.logger.Debug("客户端设备支持的工具数量: %d", len(tools))
 
 				// 解析工具并添加到列表中
 				c.mu.Lock()
@@ -497,15 +479,15 @@ func (c *XiaoZhiMCPClient) HandleMCPMessage(msgMap map[string]interface{}) error
 					// 建立名称映射关系
 					sanitizedName := sanitizeToolName(name)
 					c.toolNameMap[sanitizedName] = name
-					c.logger.Debug(fmt.Sprintf("客户端工具 #%d: %v", i+1, name))
+					c.logger.Debug("客户端工具 #%d: %v", i+1, name)
 					toolNames += fmt.Sprintf("%s ", name)
 				}
-				c.logger.Info(fmt.Sprintf("客户端工具列表: %s", toolNames))
+				c.logger.Info("客户端工具列表: %s", toolNames)
 
 				// 检查是否需要继续获取下一页工具
 				if nextCursor, ok := toolsData["nextCursor"].(string); ok && nextCursor != "" {
 					// 如果有下一页，发送带cursor的请求
-					c.logger.Info(fmt.Sprintf("有更多工具，nextCursor: %s", nextCursor))
+					c.logger.Info("有更多工具，nextCursor: %s", nextCursor)
 					c.mu.Unlock()
 					return c.SendMCPToolsListContinueRequest(nextCursor)
 				} else {
@@ -517,12 +499,12 @@ func (c *XiaoZhiMCPClient) HandleMCPMessage(msgMap map[string]interface{}) error
 		}
 	} else if method, hasMethod := payload["method"].(string); hasMethod {
 		// 处理客户端发起的请求
-		c.logger.Info(fmt.Sprintf("收到MCP客户端请求: %s", method))
+		c.logger.Info("收到MCP客户端请求: %s", method)
 		// TODO: 实现处理客户端请求的逻辑
 	} else if errorData, hasError := payload["error"].(map[string]interface{}); hasError {
 		// 处理错误响应
 		errorMsg, _ := errorData["message"].(string)
-		c.logger.Error(fmt.Sprintf("收到MCP错误响应: %v", errorMsg))
+		c.logger.Error("收到MCP错误响应: %v", errorMsg)
 
 		// 检查是否是工具调用响应
 		if id, ok := payload["id"].(float64); ok {
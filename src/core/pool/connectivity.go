@@ -485,6 +485,11 @@ func (hc *HealthChecker) checkTTSProvider(
 	return nil
 }
 
+// CheckVLLLM 检查指定名称的VLLLM配置，供Vision服务重试不可用的模型
+func (hc *HealthChecker) CheckVLLLM(ctx context.Context, vlllmType string, mode CheckMode) error {
+	return hc.checkVLLLMProvider(ctx, vlllmType, mode)
+}
+
 // checkVLLLMProvider 检查VLLLM提供者
 func (hc *HealthChecker) checkVLLLMProvider(
 	ctx context.Context,
@@ -84,7 +84,7 @@ func NewASRFactory(asrType string, config *configs.Config, logger *utils.Logger)
 				Type: asrType,
 				Data: asrCfg,
 			},
-			logger: logger,
+			logger: logger.Module("asr"),
 			params: map[string]interface{}{
 				"type":         asrCfg["type"],
 				"delete_audio": config.DeleteAudio,
@@ -109,7 +109,7 @@ func NewLLMFactory(llmType string, config *configs.Config, logger *utils.Logger)
 				TopP:        llmCfg.TopP,
 				Extra:       llmCfg.Extra,
 			},
-			logger: logger,
+			logger: logger.Module("llm"),
 		}
 	}
 	return nil
@@ -129,8 +129,15 @@ func NewTTSFactory(ttsType string, config *configs.Config, logger *utils.Logger)
 				Token:           ttsCfg.Token,
 				Cluster:         ttsCfg.Cluster,
 				SupportedVoices: ttsCfg.SupportedVoices,
+				URL:             ttsCfg.URL,
+				Method:          ttsCfg.Method,
+				TextField:       ttsCfg.TextField,
+				VoiceField:      ttsCfg.VoiceField,
+				SampleRate:      ttsCfg.SampleRate,
+				Timeout:         ttsCfg.Timeout,
+				Extra:           ttsCfg.Extra,
 			},
-			logger: logger,
+			logger: logger.Module("tts"),
 			params: map[string]interface{}{
 				"type":         ttsCfg.Type,
 				"delete_audio": config.DeleteAudio,
@@ -150,7 +157,7 @@ func NewVLLLMFactory(
 			Name:         vlllmType,
 			providerType: "vlllm",
 			config:       &vlllmCfg,
-			logger:       logger,
+			logger:       logger.Module("vlllm"),
 		}
 	}
 	return nil
@@ -160,7 +167,7 @@ func NewMCPFactory(config *configs.Config, logger *utils.Logger) ResourceFactory
 	return &ProviderFactory{
 		providerType: "mcp",
 		config:       config,
-		logger:       logger,
+		logger:       logger.Module("mcp"),
 		params:       map[string]interface{}{},
 	}
 }
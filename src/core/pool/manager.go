@@ -3,6 +3,7 @@ package pool
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/core/mcp"
@@ -30,6 +31,25 @@ type ProviderSet struct {
 	MCP   *mcp.Manager
 }
 
+var (
+	gPoolManager      *PoolManager
+	gPoolManagerMutex sync.RWMutex
+)
+
+// SetDefault 设置全局资源池管理器，供HTTP接口等非设备连接使用
+func SetDefault(pm *PoolManager) {
+	gPoolManagerMutex.Lock()
+	defer gPoolManagerMutex.Unlock()
+	gPoolManager = pm
+}
+
+// Default 获取全局资源池管理器，未初始化时返回nil
+func Default() *PoolManager {
+	gPoolManagerMutex.RLock()
+	defer gPoolManagerMutex.RUnlock()
+	return gPoolManager
+}
+
 // NewPoolManager 创建资源池管理器
 func NewPoolManager(config *configs.Config, logger *utils.Logger) (*PoolManager, error) {
 	pm := &PoolManager{
@@ -193,6 +213,54 @@ func (pm *PoolManager) GetProviderSet() (*ProviderSet, error) {
 	return set, nil
 }
 
+// GetLLM 单独获取LLM提供者，用完后通过ReturnProviderSet归还
+func (pm *PoolManager) GetLLM() (providers.LLMProvider, error) {
+	if pm.llmPool == nil {
+		return nil, fmt.Errorf("未配置LLM")
+	}
+	llm, err := pm.llmPool.Get()
+	if err != nil {
+		return nil, fmt.Errorf("获取LLM提供者失败: %v", err)
+	}
+	return llm.(providers.LLMProvider), nil
+}
+
+// GetTTS 单独获取TTS提供者，用完后通过ReturnProviderSet归还
+func (pm *PoolManager) GetTTS() (providers.TTSProvider, error) {
+	if pm.ttsPool == nil {
+		return nil, fmt.Errorf("未配置TTS")
+	}
+	tts, err := pm.ttsPool.Get()
+	if err != nil {
+		return nil, fmt.Errorf("获取TTS提供者失败: %v", err)
+	}
+	return tts.(providers.TTSProvider), nil
+}
+
+// GetASR 单独获取ASR提供者，用完后通过ReturnProviderSet归还
+func (pm *PoolManager) GetASR() (providers.ASRProvider, error) {
+	if pm.asrPool == nil {
+		return nil, fmt.Errorf("未配置ASR")
+	}
+	asr, err := pm.asrPool.Get()
+	if err != nil {
+		return nil, fmt.Errorf("获取ASR提供者失败: %v", err)
+	}
+	return asr.(providers.ASRProvider), nil
+}
+
+// GetMCP 单独获取MCP管理器，用完后通过ReturnProviderSet归还
+func (pm *PoolManager) GetMCP() (*mcp.Manager, error) {
+	if pm.mcpPool == nil {
+		return nil, fmt.Errorf("MCP功能不可用")
+	}
+	mcpManager, err := pm.mcpPool.Get()
+	if err != nil {
+		return nil, fmt.Errorf("获取MCP管理器失败: %v", err)
+	}
+	return mcpManager.(*mcp.Manager), nil
+}
+
 // Close 关闭所有资源池
 func (pm *PoolManager) Close() {
 	if pm.asrPool != nil {
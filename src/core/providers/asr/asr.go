@@ -3,7 +3,11 @@ package asr
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 	"xiaozhi-server-go/src/core/providers"
 	"xiaozhi-server-go/src/core/utils"
 )
@@ -38,6 +42,38 @@ type BaseProvider struct {
 	SilenceCount            int       // 连续静音计数
 
 	listener providers.AsrEventListener
+
+	hotwords      []providers.Hotword
+	hotwordsMutex sync.RWMutex
+}
+
+// GetString 读取字符串配置，没有配置时返回默认值
+func (c *Config) GetString(key, def string) string {
+	if v, ok := c.Data[key].(string); ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// GetInt 读取整数配置，兼容yaml的int和json的float64
+func (c *Config) GetInt(key string, def int) int {
+	switch v := c.Data[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return def
+}
+
+// GetBool 读取布尔配置，没有配置时返回默认值
+func (c *Config) GetBool(key string, def bool) bool {
+	if v, ok := c.Data[key].(bool); ok {
+		return v
+	}
+	return def
 }
 
 func (p *BaseProvider) ResetStartListenTime() {
@@ -71,6 +107,72 @@ func (p *BaseProvider) SetListener(listener providers.AsrEventListener) {
 	p.listener = listener
 }
 
+// InterimResults 是否开启中间识别结果，对应配置interim_results
+func (p *BaseProvider) InterimResults() bool {
+	if p.config == nil {
+		return false
+	}
+	enabled, _ := p.config.Data["interim_results"].(bool)
+	return enabled
+}
+
+// NotifyPartial 通知监听器中间识别结果，空文本忽略
+func (p *BaseProvider) NotifyPartial(text string) {
+	if text == "" || p.listener == nil {
+		return
+	}
+	p.listener.OnAsrPartialResult(text)
+}
+
+// SetHotwords 设置识别热词，下一次开始识别时生效
+func (p *BaseProvider) SetHotwords(hotwords []providers.Hotword) {
+	p.hotwordsMutex.Lock()
+	defer p.hotwordsMutex.Unlock()
+	p.hotwords = hotwords
+}
+
+// Hotwords 当前识别热词
+func (p *BaseProvider) Hotwords() []providers.Hotword {
+	p.hotwordsMutex.RLock()
+	defer p.hotwordsMutex.RUnlock()
+	return p.hotwords
+}
+
+// ParseHotword 解析"词:权重"格式的热词，权重省略或无效时为0
+func ParseHotword(item string) providers.Hotword {
+	item = strings.TrimSpace(item)
+	if i := strings.LastIndexAny(item, ":："); i > 0 {
+		sep := item[i:]
+		_, size := utf8.DecodeRuneInString(sep)
+		if boost, err := strconv.ParseFloat(strings.TrimSpace(sep[size:]), 64); err == nil {
+			return providers.Hotword{Word: strings.TrimSpace(item[:i]), Boost: boost}
+		}
+	}
+	return providers.Hotword{Word: item}
+}
+
+// MergeHotwords 按顺序合并多组热词，去重后最多保留limit个，limit<=0表示不限制
+// 排在前面的组优先保留，重复的热词保留第一次出现时的权重
+func MergeHotwords(limit int, groups ...[]string) []providers.Hotword {
+	seen := make(map[string]bool)
+	hotwords := []providers.Hotword{}
+	for _, group := range groups {
+		for _, item := range group {
+			hotword := ParseHotword(item)
+			key := strings.ToLower(hotword.Word)
+			if hotword.Word == "" || seen[key] {
+				continue
+			}
+			if limit > 0 && len(hotwords) >= limit {
+				return hotwords
+			}
+			seen[key] = true
+			hotwords = append(hotwords, hotword)
+		}
+	}
+	return hotwords
+}
+
 // GetListener 获取事件监听器
 func (p *BaseProvider) GetListener() providers.AsrEventListener {
 	return p.listener
@@ -0,0 +1,48 @@
+package asr
+
+import (
+	"testing"
+)
+
+func TestMergeHotwords(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		groups [][]string
+		want   []string
+		boost  map[string]float64
+	}{
+		{
+			name:   "解析权重",
+			groups: [][]string{{"小智:2", "ESP32：1.5", "时间:早上"}},
+			want:   []string{"小智", "ESP32", "时间:早上"},
+			boost:  map[string]float64{"小智": 2, "ESP32": 1.5},
+		},
+		{
+			name:   "去重保留先出现的权重",
+			groups: [][]string{{"Lily:3"}, {"lily", "小智", " "}},
+			want:   []string{"Lily", "小智"},
+			boost:  map[string]float64{"Lily": 3},
+		},
+		{
+			name:   "超出上限时优先保留前面的组",
+			limit:  2,
+			groups: [][]string{{"设备名"}, {"角色名"}, {"稻香", "晴天"}},
+			want:   []string{"设备名", "角色名"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeHotwords(tt.limit, tt.groups...)
+			if len(got) != len(tt.want) {
+				t.Fatalf("热词数量错误: %+v", got)
+			}
+			for i, hotword := range got {
+				if hotword.Word != tt.want[i] || hotword.Boost != tt.boost[hotword.Word] {
+					t.Errorf("热词错误: %+v, 期望 %s", hotword, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +31,11 @@ type Provider struct {
 	wsURL     string
 	logger    *utils.Logger
 
+	// Recognition options, empty or zero uses Deepgram defaults
+	model       string
+	punctuate   bool
+	endpointing int // silence in ms before a final result
+
 	// Streaming related fields
 	conn        *websocket.Conn
 	isStreaming bool
@@ -64,21 +71,16 @@ func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Pr
 		return nil, fmt.Errorf("failed to create output directory: %v", err)
 	}
 
-	// Get model from config, default to nova
-	// model, _ := config.Data["model"].(string)
-	// if model == "" {
-	// 	model = "nova"
-	// }
-
 	provider := &Provider{
 		BaseProvider: base,
 		apiKey:       apiKey,
 		language:     language,
 		outputDir:    outputDir,
 		wsURL:        "wss://api.deepgram.com/v1/listen",
-		// model:        model,
-		// punctuate: false, // Default to true for punctuation
-		logger: logger,
+		model:        config.GetString("model", ""),
+		punctuate:    config.GetBool("punctuate", false),
+		endpointing:  config.GetInt("endpointing", 0),
+		logger:       logger,
 	}
 
 	// Initialize audio processing
@@ -175,8 +177,7 @@ func (p *Provider) StartStreaming(ctx context.Context) error {
 	}
 
 	// Add query parameters
-	queryParams := fmt.Sprintf("?language=%s&sample_rate=%v&encoding=%v",
-		p.language, 16000, "linear16")
+	queryParams := "?" + p.queryParams().Encode()
 
 	headers := http.Header{
 		"Authorization": []string{"token " + p.apiKey},
@@ -219,6 +220,34 @@ func (p *Provider) StartStreaming(ctx context.Context) error {
 	return nil
 }
 
+// queryParams builds the listen options, hotwords are sent as keywords with optional boost
+func (p *Provider) queryParams() url.Values {
+	params := url.Values{}
+	params.Set("language", p.language)
+	params.Set("sample_rate", "16000")
+	params.Set("encoding", "linear16")
+	if p.punctuate {
+		params.Set("punctuate", "true")
+	}
+	if p.model != "" {
+		params.Set("model", p.model)
+	}
+	if p.endpointing > 0 {
+		params.Set("endpointing", strconv.Itoa(p.endpointing))
+	}
+	if p.InterimResults() {
+		params.Set("interim_results", "true")
+	}
+	for _, hotword := range p.Hotwords() {
+		keyword := hotword.Word
+		if hotword.Boost != 0 {
+			keyword += ":" + strconv.FormatFloat(hotword.Boost, 'f', -1, 64)
+		}
+		params.Add("keywords", keyword)
+	}
+	return params
+}
+
 // ReadMessage reads messages from the WebSocket connection
 func (p *Provider) ReadMessage() {
 	p.logger.Info("Deepgram streaming thread started")
@@ -297,11 +326,9 @@ func (p *Provider) ReadMessage() {
 										return
 									}
 								}
-							// } else if p.interim {
-							// 	// For interim results, notify listener but don't update final result
-							// 	if listener := p.BaseProvider.GetListener(); listener != nil {
-							// 		listener.OnAsrInterimResult(transcript)
-							// 	}
+							} else {
+								// For interim results, notify listener but don't update final result
+								p.NotifyPartial(transcript)
 							}
 						}
 					}
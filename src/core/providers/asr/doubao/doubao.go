@@ -68,6 +68,8 @@ type Provider struct {
 	enablePunc    bool
 	enableITN     bool
 	enableDDC     bool
+	// 控制台创建的热词表ID，会与直传热词一起生效
+	boostingTableID string
 
 	// 流式识别相关字段
 	conn        *websocket.Conn
@@ -118,12 +120,18 @@ func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Pr
 		connectID:     connectID,
 		logger:        logger, // 使用简单的logger
 
-		// 默认配置
-		modelName:     "bigmodel",
-		endWindowSize: 800,
-		enablePunc:    true,
-		enableITN:     true,
-		enableDDC:     false,
+		// 识别配置，未配置时使用默认值
+		modelName:       config.GetString("model_name", "bigmodel"),
+		endWindowSize:   config.GetInt("end_window_size", 800),
+		enablePunc:      config.GetBool("enable_punc", true),
+		enableITN:       config.GetBool("enable_itn", true),
+		enableDDC:       config.GetBool("enable_ddc", false),
+		boostingTableID: config.GetString("boosting_table_id", ""),
+	}
+
+	// 中间结果需要使用流式输出接口
+	if provider.InterimResults() {
+		provider.wsURL = "wss://openspeech.bytedance.com/api/v3/sauc/bigmodel"
 	}
 
 	// 初始化音频处理
@@ -204,7 +212,7 @@ func (p *Provider) generateHeader(messageType uint8, flags uint8, serializationM
 
 // constructRequest 构造请求数据
 func (p *Provider) constructRequest() map[string]interface{} {
-	return map[string]interface{}{
+	request := map[string]interface{}{
 		"user": map[string]interface{}{
 			"uid": p.reqID,
 		},
@@ -223,9 +231,33 @@ func (p *Provider) constructRequest() map[string]interface{} {
 			"enable_itn":      p.enableITN,
 			"enable_ddc":      p.enableDDC,
 			"result_type":     "single",
-			"show_utterances": false, // Added show_utterances, default to false
+			"show_utterances": p.InterimResults(), // 中间结果通过分句的definite判断是否结束
 		},
 	}
+	if corpus := p.corpus(); corpus != nil {
+		request["request"].(map[string]interface{})["corpus"] = corpus
+	}
+	return request
+}
+
+// corpus 热词表和直传热词，豆包直传热词不支持权重
+func (p *Provider) corpus() map[string]interface{} {
+	corpus := map[string]interface{}{}
+	if p.boostingTableID != "" {
+		corpus["boosting_table_id"] = p.boostingTableID
+	}
+	if hotwords := p.Hotwords(); len(hotwords) > 0 {
+		words := make([]map[string]string, 0, len(hotwords))
+		for _, hotword := range hotwords {
+			words = append(words, map[string]string{"word": hotword.Word})
+		}
+		context, _ := json.Marshal(map[string]interface{}{"hotwords": words})
+		corpus["context"] = string(context)
+	}
+	if len(corpus) == 0 {
+		return nil
+	}
+	return corpus
 }
 
 // GetAudioBuffer 获取基类的audioBuffer
@@ -243,7 +275,7 @@ func (p *Provider) parseResponse(data []byte) (map[string]interface{}, error) {
 	_ = data[0] >> 4 // protocol version
 	headerSize := data[0] & 0x0f
 	messageType := data[1] >> 4
-	_ = data[1] & 0x0f // flags
+	flags := data[1] & 0x0f
 	serializationMethod := data[2] >> 4
 	compressionMethod := data[2] & 0x0f
 
@@ -320,6 +352,7 @@ func (p *Provider) parseResponse(data []byte) (map[string]interface{}, error) {
 	}
 
 	result["payload_size"] = payloadSize
+	result["last"] = flags&negSequence != 0 // 最后一包响应
 	return result, nil
 }
 
@@ -539,6 +572,13 @@ func (p *Provider) ReadMessage() {
 					text = textData
 				}
 
+				// 开启中间结果时，分句未确定前只推送中间结果
+				last, _ := result["last"].(bool)
+				if text != "" && p.InterimResults() && !last && !isDefinite(resultData) {
+					p.NotifyPartial(text)
+					continue
+				}
+
 				p.logger.Debug("[DEBUG] 流式识别: 识别成功, 文本='%s'", text)
 
 				p.connMutex.Lock()
@@ -565,6 +605,20 @@ func (p *Provider) ReadMessage() {
 
 	}
 }
+
+// isDefinite 判断识别结果中是否有已确定的分句
+func isDefinite(resultData map[string]interface{}) bool {
+	utterances, _ := resultData["utterances"].([]interface{})
+	for _, item := range utterances {
+		if utterance, ok := item.(map[string]interface{}); ok {
+			if definite, _ := utterance["definite"].(bool); definite {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p *Provider) setErrorAndStop(err error) {
 	p.connMutex.Lock()
 	defer p.connMutex.Unlock()
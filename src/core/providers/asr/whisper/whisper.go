@@ -0,0 +1,319 @@
+package whisper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	sampleRate = 16000
+	bytesPerMs = sampleRate * 2 / 1000
+
+	defaultModel        = "whisper-1"
+	defaultThreshold    = 0.01  // 语音能量阈值(RMS)
+	defaultSilenceMs    = 800   // 句尾静音时长
+	defaultMinSpeechMs  = 300   // 语音少于该时长的分段不识别，过滤咳嗽、按键等噪声
+	defaultMaxSegmentMs = 20000 // 单个分段的最长时长
+	defaultTimeout      = 30 * time.Second
+	preRollMs           = 300              // 保留语音开始前的音频，避免吞掉第一个字
+	idleTimeout         = 30 * time.Second // 长时间没有说话计为一次静音
+)
+
+var _ asr.Provider = (*Provider)(nil)
+
+// Provider OpenAI兼容的/v1/audio/transcriptions识别提供者，适用于whisper.cpp server、faster-whisper、vLLM等
+// 接口不支持流式识别，收到的音频按能量VAD切分成句子，每句话结束后整段识别
+type Provider struct {
+	*asr.BaseProvider
+	logger     *utils.Logger
+	httpClient *http.Client
+	endpoint   string
+	apiKey     string
+	model      string
+	language   string
+	prompt     string
+
+	threshold    float64
+	silenceMs    int
+	minSpeechMs  int
+	maxSegmentMs int
+
+	mu         sync.Mutex
+	segment    []byte // 当前分段的音频，未开始说话时只保留preRollMs
+	speaking   bool
+	speechMs   int // 当前分段中有声音的时长
+	silentMs   int // 最后一次有声音之后的静音时长
+	flushTimer *time.Timer
+	generation int           // Reset时递增，丢弃之前分段的识别结果
+	lastDone   chan struct{} // 上一个分段识别完成，保证结果按顺序回调
+}
+
+// NewProvider 创建Whisper ASR提供者
+func NewProvider(config *asr.Config, deleteFile bool, logger *utils.Logger) (*Provider, error) {
+	baseURL := config.GetString("url", "")
+	if baseURL == "" {
+		return nil, fmt.Errorf("missing url configuration")
+	}
+	threshold := defaultThreshold
+	if v, ok := config.Data["vad_threshold"].(float64); ok && v > 0 {
+		threshold = v
+	}
+	timeout := defaultTimeout
+	if seconds := config.GetInt("timeout", 0); seconds > 0 {
+		timeout = time.Duration(seconds) * time.Second
+	}
+
+	provider := &Provider{
+		BaseProvider: asr.NewBaseProvider(config, deleteFile),
+		logger:       logger,
+		httpClient:   &http.Client{Timeout: timeout},
+		endpoint:     strings.TrimSuffix(baseURL, "/") + "/audio/transcriptions",
+		apiKey:       config.GetString("api_key", ""),
+		model:        config.GetString("model", defaultModel),
+		language:     config.GetString("lang", ""),
+		prompt:       config.GetString("prompt", ""),
+		threshold:    threshold,
+		silenceMs:    config.GetInt("silence_ms", defaultSilenceMs),
+		minSpeechMs:  config.GetInt("min_speech_ms", defaultMinSpeechMs),
+		maxSegmentMs: config.GetInt("max_segment_ms", defaultMaxSegmentMs),
+	}
+	provider.InitAudioProcessing()
+	return provider, nil
+}
+
+// Transcribe 整段识别16k 16位单声道PCM
+func (p *Provider) Transcribe(ctx context.Context, audioData []byte) (string, error) {
+	return p.transcribe(ctx, audioData)
+}
+
+// AddAudio 添加音频数据，检测到一句话结束时在后台识别并回调监听器
+func (p *Provider) AddAudio(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	p.mu.Lock()
+	ms := len(data) / bytesPerMs
+	voiced := rms(data) >= p.threshold
+	p.segment = append(p.segment, data...)
+
+	if !p.speaking {
+		if !voiced {
+			if keep := preRollMs * bytesPerMs; len(p.segment) > keep {
+				p.segment = append(p.segment[:0], p.segment[len(p.segment)-keep:]...)
+			}
+			if p.SilenceTime() > idleTimeout {
+				p.ResetStartListenTime()
+				go p.notifyIdle()
+			}
+			p.mu.Unlock()
+			return nil
+		}
+		p.speaking = true
+		p.speechMs, p.silentMs = 0, 0
+	}
+	if voiced {
+		p.speechMs += ms
+		p.silentMs = 0
+	} else {
+		p.silentMs += ms
+	}
+
+	if p.silentMs >= p.silenceMs || len(p.segment) >= p.maxSegmentMs*bytesPerMs {
+		p.flushLocked()
+	} else {
+		// 设备停止发送音频（如手动模式松开按键）时也要结束这一句
+		p.resetFlushTimer()
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// resetFlushTimer 一段时间没有新的音频时结束当前分段，调用前需持有锁
+func (p *Provider) resetFlushTimer() {
+	if p.flushTimer != nil {
+		p.flushTimer.Stop()
+	}
+	generation := p.generation
+	p.flushTimer = time.AfterFunc(time.Duration(p.silenceMs)*time.Millisecond, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.speaking && p.generation == generation {
+			p.flushLocked()
+		}
+	})
+}
+
+// flushLocked 结束当前分段，语音足够长时在后台识别，调用前需持有锁
+func (p *Provider) flushLocked() {
+	if p.flushTimer != nil {
+		p.flushTimer.Stop()
+		p.flushTimer = nil
+	}
+	audio, speechMs := p.segment, p.speechMs
+	p.segment = nil
+	p.speaking = false
+	p.speechMs, p.silentMs = 0, 0
+	if speechMs < p.minSpeechMs {
+		return
+	}
+
+	generation := p.generation
+	prev := p.lastDone
+	done := make(chan struct{})
+	p.lastDone = done
+	go func() {
+		defer close(done)
+		text, err := p.transcribe(context.Background(), audio)
+		if prev != nil {
+			<-prev
+		}
+		if err != nil {
+			p.logger.Error("Whisper识别失败: %v", err)
+			return
+		}
+		p.deliver(generation, text)
+	}()
+}
+
+// deliver 回调识别结果，Reset之前的分段和空结果忽略
+func (p *Provider) deliver(generation int, text string) {
+	p.mu.Lock()
+	listener := p.GetListener()
+	if generation != p.generation || listener == nil || text == "" {
+		p.mu.Unlock()
+		return
+	}
+	p.SilenceCount = 0
+	p.mu.Unlock()
+
+	// 每句话独立识别，返回true时也继续接收下一句
+	p.logger.Debug("Whisper识别结果: %s", text)
+	listener.OnAsrResult(text)
+}
+
+// notifyIdle 长时间没有说话时增加静音计数并通知监听器
+func (p *Provider) notifyIdle() {
+	listener := p.GetListener()
+	if listener == nil {
+		return
+	}
+	p.SilenceCount++
+	listener.OnAsrResult("")
+}
+
+// transcribe 把PCM封装为wav，以multipart请求识别接口
+func (p *Provider) transcribe(ctx context.Context, pcmData []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(utils.WavBytes(pcmData, sampleRate)); err != nil {
+		return "", err
+	}
+	fields := map[string]string{
+		"model":           p.model,
+		"response_format": "json",
+		"language":        p.language,
+		"prompt":          p.promptText(),
+	}
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求识别服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("读取识别响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("识别服务返回错误(HTTP %d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		// 部分服务忽略response_format，直接返回文本
+		return strings.TrimSpace(string(respBody)), nil
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// promptText 识别提示词，热词附加在配置的提示词之后，引导模型识别专有名词
+func (p *Provider) promptText() string {
+	words := make([]string, 0, len(p.Hotwords()))
+	for _, hotword := range p.Hotwords() {
+		words = append(words, hotword.Word)
+	}
+	return strings.TrimSpace(p.prompt + " " + strings.Join(words, "，"))
+}
+
+// rms 计算16位PCM的归一化均方根能量
+func rms(data []byte) float64 {
+	samples := utils.PCMBytesToInt16(data)
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, sample := range samples {
+		v := float64(sample) / 32768
+		sum += v * v
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// Reset 复位识别状态，丢弃未完成的分段和正在识别的结果
+func (p *Provider) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.flushTimer != nil {
+		p.flushTimer.Stop()
+		p.flushTimer = nil
+	}
+	p.generation++
+	p.segment = nil
+	p.speaking = false
+	p.speechMs, p.silentMs = 0, 0
+	p.InitAudioProcessing()
+	return nil
+}
+
+func init() {
+	asr.Register("whisper", func(config *asr.Config, deleteFile bool, logger *utils.Logger) (asr.Provider, error) {
+		return NewProvider(config, deleteFile, logger)
+	})
+}
@@ -0,0 +1,217 @@
+package whisper
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/asr"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// fakeWhisper 模拟/v1/audio/transcriptions，answer按音频时长返回识别结果
+type fakeWhisper struct {
+	mu       sync.Mutex
+	answer   func(ms int) string
+	requests []map[string]string
+}
+
+// reply 所有请求返回同一个结果
+func reply(text string) func(int) string {
+	return func(int) string { return text }
+}
+
+func (f *fakeWhisper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer test-key" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields := map[string]string{}
+	for key, values := range r.MultipartForm.Value {
+		fields[key] = values[0]
+	}
+	ms := 0
+	if file, header, err := r.FormFile("file"); err == nil {
+		wav := make([]byte, 12)
+		io.ReadFull(file, wav)
+		fields["file"] = string(wav[0:4]) + string(wav[8:12])
+		ms = int(header.Size-44) / bytesPerMs
+		file.Close()
+	}
+
+	f.mu.Lock()
+	f.requests = append(f.requests, fields)
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"text":%q}`, f.answer(ms))
+}
+
+func (f *fakeWhisper) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+type resultListener struct {
+	mu      sync.Mutex
+	results []string
+}
+
+func (l *resultListener) OnAsrResult(result string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.results = append(l.results, result)
+	return true
+}
+
+func (l *resultListener) OnAsrPartialResult(result string) {}
+
+// wait 等待收到n个结果
+func (l *resultListener) wait(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		results := append([]string{}, l.results...)
+		l.mu.Unlock()
+		if len(results) >= n {
+			return results
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("只收到 %q，需要%d个结果", l.results, n)
+	return nil
+}
+
+// pcm 生成指定时长的16k PCM，amplitude为0时为静音
+func pcm(ms int, amplitude float64) []byte {
+	data := make([]byte, ms*bytesPerMs)
+	for i := 0; i < len(data)/2; i++ {
+		sample := int16(amplitude * 32767 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(sample))
+	}
+	return data
+}
+
+func newTestProvider(t *testing.T, fake *fakeWhisper) *Provider {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := asr.Create("whisper", &asr.Config{
+		Name: "WhisperASR",
+		Type: "whisper",
+		Data: map[string]interface{}{
+			"url":        server.URL + "/v1",
+			"api_key":    "test-key",
+			"model":      "large-v3",
+			"lang":       "zh",
+			"prompt":     "以下是普通话的句子。",
+			"silence_ms": 300,
+		},
+	}, true, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider.(*Provider)
+}
+
+func TestTranscribe(t *testing.T) {
+	fake := &fakeWhisper{answer: reply("小智你好")}
+	provider := newTestProvider(t, fake)
+	provider.SetHotwords([]providers.Hotword{{Word: "小智"}, {Word: "晴天", Boost: 2}})
+
+	text, err := provider.Transcribe(context.Background(), pcm(500, 0.3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "小智你好" {
+		t.Errorf("text = %q", text)
+	}
+	request := fake.requests[0]
+	if request["file"] != "RIFFWAVE" || request["model"] != "large-v3" || request["language"] != "zh" || request["response_format"] != "json" {
+		t.Errorf("request = %v", request)
+	}
+	if request["prompt"] != "以下是普通话的句子。 小智，晴天" {
+		t.Errorf("prompt = %q", request["prompt"])
+	}
+}
+
+func TestAddAudio(t *testing.T) {
+	// feed 按60ms一块送入音频，与设备上传的帧长一致
+	feed := func(provider *Provider, audio []byte) {
+		for start := 0; start < len(audio); start += 60 * bytesPerMs {
+			provider.AddAudio(audio[start:min(start+60*bytesPerMs, len(audio))])
+		}
+	}
+	join := func(parts ...[]byte) []byte {
+		var audio []byte
+		for _, part := range parts {
+			audio = append(audio, part...)
+		}
+		return audio
+	}
+
+	t.Run("按静音切分并按顺序回调", func(t *testing.T) {
+		// 第一句较长，识别得比第二句慢
+		fake := &fakeWhisper{answer: func(ms int) string {
+			if ms > 1200 {
+				time.Sleep(200 * time.Millisecond)
+				return "第一句"
+			}
+			return "第二句"
+		}}
+		provider := newTestProvider(t, fake)
+		listener := &resultListener{}
+		provider.SetListener(listener)
+
+		feed(provider, join(pcm(600, 0), pcm(120, 0.3), pcm(600, 0), // 短促的噪声不识别
+			pcm(1200, 0.3), pcm(420, 0), pcm(600, 0.3), pcm(420, 0)))
+		results := listener.wait(t, 2)
+		if strings.Join(results, "|") != "第一句|第二句" || fake.count() != 2 {
+			t.Errorf("results = %q, requests = %d", results, fake.count())
+		}
+	})
+
+	t.Run("停止发送音频后结束这一句", func(t *testing.T) {
+		fake := &fakeWhisper{answer: reply("放首歌")}
+		provider := newTestProvider(t, fake)
+		listener := &resultListener{}
+		provider.SetListener(listener)
+
+		feed(provider, pcm(600, 0.3))
+		if results := listener.wait(t, 1); results[0] != "放首歌" {
+			t.Errorf("results = %q", results)
+		}
+	})
+
+	t.Run("复位后丢弃未完成的分段", func(t *testing.T) {
+		fake := &fakeWhisper{answer: reply("新的一句")}
+		provider := newTestProvider(t, fake)
+		listener := &resultListener{}
+		provider.SetListener(listener)
+
+		feed(provider, pcm(600, 0.3))
+		provider.Reset()
+		feed(provider, join(pcm(600, 0.3), pcm(420, 0)))
+		if results := listener.wait(t, 1); results[0] != "新的一句" || fake.count() != 1 {
+			t.Errorf("results = %q, requests = %d", results, fake.count())
+		}
+	})
+}
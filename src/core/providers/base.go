@@ -11,8 +11,18 @@ type Provider interface {
 	Cleanup() error
 }
 
+// AsrEventListener 语音识别事件监听
 type AsrEventListener interface {
+	// OnAsrResult 最终识别结果，返回true则停止语音识别
 	OnAsrResult(result string) bool
+	// OnAsrPartialResult 识别过程中的中间结果，同一句话会多次回调，可能与最终结果不同
+	OnAsrPartialResult(result string)
+}
+
+// Hotword 语音识别热词，Boost为加权强度，0表示使用服务默认值
+type Hotword struct {
+	Word  string
+	Boost float64
 }
 
 // ASRProvider 语音识别提供者接口
@@ -31,6 +41,9 @@ type ASRProvider interface {
 	GetSilenceCount() int
 
 	ResetStartListenTime()
+
+	// 设置识别热词，下一次开始识别时生效
+	SetHotwords(hotwords []Hotword)
 }
 
 // TTSProvider 语音合成提供者接口
@@ -50,3 +63,6 @@ type LLMProvider interface {
 
 // Message 对话消息
 type Message = types.Message
+
+// ImageRef 对话中的图片
+type ImageRef = types.ImageRef
@@ -0,0 +1,86 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+)
+
+// Config 向量模型配置结构
+type Config struct {
+	Name       string                 `yaml:"name"` // 提供者名称
+	Type       string                 `yaml:"type"`
+	ModelName  string                 `yaml:"model_name"`
+	BaseURL    string                 `yaml:"url,omitempty"`
+	APIKey     string                 `yaml:"api_key,omitempty"`
+	Dimensions int                    `yaml:"dimensions,omitempty"`
+	Extra      map[string]interface{} `yaml:",inline"`
+}
+
+// Provider 向量模型提供者接口
+type Provider interface {
+	Initialize() error
+	Cleanup() error
+	// Embed 将文本转换为向量
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// BaseProvider 向量模型基础实现
+type BaseProvider struct {
+	config *Config
+}
+
+// Config 获取配置
+func (p *BaseProvider) Config() *Config {
+	return p.config
+}
+
+// NewBaseProvider 创建向量模型基础提供者
+func NewBaseProvider(config *Config) *BaseProvider {
+	return &BaseProvider{
+		config: config,
+	}
+}
+
+// Initialize 初始化提供者
+func (p *BaseProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *BaseProvider) Cleanup() error {
+	return nil
+}
+
+// Fingerprint 向量模型标识，模型或维度变化后需要重建知识库向量
+func Fingerprint(config *Config) string {
+	return fmt.Sprintf("%s/%s/%d", config.Type, config.ModelName, config.Dimensions)
+}
+
+// Factory 向量模型工厂函数类型
+type Factory func(config *Config) (Provider, error)
+
+var factories = make(map[string]Factory)
+
+// Register 注册向量模型提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建向量模型提供者实例
+func Create(name string, config *Config) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的向量模型提供者: %s", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建向量模型提供者失败: %v", err)
+	}
+
+	if err := provider.Initialize(); err != nil {
+		return nil, fmt.Errorf("初始化向量模型提供者失败: %v", err)
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,122 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	"xiaozhi-server-go/src/core/providers/embedding"
+)
+
+// DefaultDimensions 默认向量维度
+const DefaultDimensions = 512
+
+// Provider 本地哈希向量模型，无需网络，相同输入总是得到相同向量
+// 中文按单字和相邻双字切分，其他文字按单词切分，通过特征哈希映射到固定维度
+type Provider struct {
+	*embedding.BaseProvider
+	dimensions int
+}
+
+// 注册提供者
+func init() {
+	embedding.Register("local", NewProvider)
+}
+
+// NewProvider 创建本地哈希向量模型提供者
+func NewProvider(config *embedding.Config) (embedding.Provider, error) {
+	dimensions := config.Dimensions
+	if dimensions <= 0 {
+		dimensions = DefaultDimensions
+		config.Dimensions = dimensions
+	}
+	return &Provider{
+		BaseProvider: embedding.NewBaseProvider(config),
+		dimensions:   dimensions,
+	}, nil
+}
+
+// Embed 生成归一化的哈希向量
+func (p *Provider) Embed(ctx context.Context, text string) ([]float32, error) {
+	features := tokenize(text)
+	if len(features) == 0 {
+		return nil, fmt.Errorf("文本为空，无法生成向量")
+	}
+
+	vec := make([]float32, p.dimensions)
+	for _, f := range features {
+		h := fnv.New64a()
+		h.Write([]byte(f.token))
+		sum := h.Sum64()
+		index := int(sum % uint64(p.dimensions))
+		// 使用最高位决定符号，减少哈希冲突带来的偏差
+		if sum>>63 == 1 {
+			vec[index] -= f.weight
+		} else {
+			vec[index] += f.weight
+		}
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		// 极端情况下所有特征相互抵消，退化为固定向量
+		vec[0] = 1
+		return vec, nil
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] = float32(float64(vec[i]) / norm)
+	}
+	return vec, nil
+}
+
+type feature struct {
+	token  string
+	weight float32
+}
+
+// tokenize 切分文本特征：中文单字权重0.5、双字权重1，其他单词权重1
+func tokenize(text string) []feature {
+	var features []feature
+	var word []rune
+	var han []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			features = append(features, feature{token: "w:" + string(word), weight: 1})
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		for i, r := range han {
+			features = append(features, feature{token: "u:" + string(r), weight: 0.5})
+			if i+1 < len(han) {
+				features = append(features, feature{token: "b:" + string(han[i:i+2]), weight: 1})
+			}
+		}
+		han = han[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return features
+}
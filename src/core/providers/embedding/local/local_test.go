@@ -0,0 +1,59 @@
+package local
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"xiaozhi-server-go/src/core/providers/embedding"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func TestEmbed(t *testing.T) {
+	p, err := embedding.Create("local", &embedding.Config{Type: "local", Dimensions: 128})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("相同文本向量一致且已归一化", func(t *testing.T) {
+		a, err := p.Embed(ctx, "周杰伦 青花瓷")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := p.Embed(ctx, "周杰伦 青花瓷")
+		if len(a) != 128 {
+			t.Fatalf("维度错误: %d", len(a))
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				t.Fatalf("第%d维不一致", i)
+			}
+		}
+		if n := cosine(a, a); math.Abs(n-1) > 1e-5 {
+			t.Errorf("向量未归一化: %f", n)
+		}
+	})
+
+	t.Run("相关文本更相似", func(t *testing.T) {
+		query, _ := p.Embed(ctx, "青花瓷")
+		related, _ := p.Embed(ctx, "青花瓷-周杰伦 中国风")
+		unrelated, _ := p.Embed(ctx, "Hotel California Eagles rock")
+		if cosine(query, related) <= cosine(query, unrelated) {
+			t.Errorf("相似度排序错误: related=%f unrelated=%f", cosine(query, related), cosine(query, unrelated))
+		}
+	})
+
+	t.Run("空文本返回错误", func(t *testing.T) {
+		if _, err := p.Embed(ctx, " ，。"); err == nil {
+			t.Error("期望返回错误")
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers/embedding"
+)
+
+// Provider Ollama向量模型提供者，使用 /api/embeddings 接口
+type Provider struct {
+	*embedding.BaseProvider
+	baseURL    string
+	httpClient *http.Client
+}
+
+type embeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type embeddingResponse struct {
+	Embedding []float32 `json:"embedding"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// 注册提供者
+func init() {
+	embedding.Register("ollama", NewProvider)
+}
+
+// NewProvider 创建Ollama向量模型提供者
+func NewProvider(config *embedding.Config) (embedding.Provider, error) {
+	return &Provider{
+		BaseProvider: embedding.NewBaseProvider(config),
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.ModelName == "" {
+		return fmt.Errorf("missing embedding model_name")
+	}
+
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+	// 兼容填写了 /v1 或 /api 后缀的地址
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	baseURL = strings.TrimSuffix(baseURL, "/v1")
+	baseURL = strings.TrimSuffix(baseURL, "/api")
+	p.baseURL = baseURL
+	return nil
+}
+
+// Embed 调用Ollama生成向量
+func (p *Provider) Embed(ctx context.Context, text string) ([]float32, error) {
+	body, err := json.Marshal(embeddingRequest{
+		Model:  p.Config().ModelName,
+		Prompt: text,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/api/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求Ollama向量接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取Ollama响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama向量接口返回错误: %s %s", resp.Status, string(data))
+	}
+
+	var result embeddingResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("解析Ollama响应失败: %v", err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("Ollama向量接口返回错误: %s", result.Error)
+	}
+	if len(result.Embedding) == 0 {
+		return nil, fmt.Errorf("Ollama向量接口返回为空")
+	}
+	return result.Embedding, nil
+}
@@ -0,0 +1,60 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+
+	"xiaozhi-server-go/src/core/providers/embedding"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Provider OpenAI兼容接口的向量模型提供者
+type Provider struct {
+	*embedding.BaseProvider
+	client *openai.Client
+}
+
+// 注册提供者
+func init() {
+	embedding.Register("openai", NewProvider)
+}
+
+// NewProvider 创建OpenAI向量模型提供者
+func NewProvider(config *embedding.Config) (embedding.Provider, error) {
+	return &Provider{
+		BaseProvider: embedding.NewBaseProvider(config),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.ModelName == "" {
+		return fmt.Errorf("missing embedding model_name")
+	}
+
+	clientConfig := openai.DefaultConfig(config.APIKey)
+	if config.BaseURL != "" {
+		clientConfig.BaseURL = config.BaseURL
+	}
+	p.client = openai.NewClientWithConfig(clientConfig)
+	return nil
+}
+
+// Embed 调用 /embeddings 接口生成向量
+func (p *Provider) Embed(ctx context.Context, text string) ([]float32, error) {
+	config := p.Config()
+	resp, err := p.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input:      []string{text},
+		Model:      openai.EmbeddingModel(config.ModelName),
+		Dimensions: config.Dimensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("请求向量接口失败: %v", err)
+	}
+	if len(resp.Data) == 0 || len(resp.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("向量接口返回为空")
+	}
+	return resp.Data[0].Embedding, nil
+}
@@ -0,0 +1,297 @@
+package imagegen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "golang.org/x/image/webp" // 注册WEBP解码器
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/google/uuid"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// RoutePath 生成图片的下载路由，位于/api下
+	RoutePath = "/images"
+
+	defaultDir       = "tmp/generated"
+	defaultKeepHours = 24
+	cleanupInterval  = time.Hour
+)
+
+// Display 设备屏幕信息，决定下发图片的尺寸和格式
+type Display struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Format string `json:"format"` // jpeg或png
+}
+
+// ParseDisplay 解析设备上报的屏幕信息，如 {"width":240,"height":240,"format":"jpeg"}
+func ParseDisplay(m map[string]interface{}) Display {
+	var d Display
+	if w, ok := m["width"].(float64); ok && w > 0 {
+		d.Width = int(w)
+	}
+	if h, ok := m["height"].(float64); ok && h > 0 {
+		d.Height = int(h)
+	}
+	if f, ok := m["format"].(string); ok {
+		d.Format = normalizeFormat(f)
+	}
+	return d
+}
+
+// Merge 用other中非空的项覆盖当前屏幕信息
+func (d Display) Merge(other Display) Display {
+	if other.Width > 0 && other.Height > 0 {
+		d.Width, d.Height = other.Width, other.Height
+	}
+	if other.Format != "" {
+		d.Format = other.Format
+	}
+	return d
+}
+
+func normalizeFormat(format string) string {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "jpeg", "jpg":
+		return "jpeg"
+	case "png":
+		return "png"
+	}
+	return ""
+}
+
+// Image 生成并保存的图片
+type Image struct {
+	Name          string `json:"name"`
+	URL           string `json:"url"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Format        string `json:"format"`
+	Prompt        string `json:"prompt"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+// Generator 调用提供者生成图片，按设备屏幕缩放转码后保存，返回设备可下载的地址
+type Generator struct {
+	provider Provider
+	config   *configs.ImagesConfig
+	dir      string
+	baseURL  string
+	logger   *utils.Logger
+}
+
+var defaultGenerator atomic.Pointer[Generator]
+
+// SetDefault 设置全局的图片生成器
+func SetDefault(g *Generator) {
+	defaultGenerator.Store(g)
+}
+
+// Default 全局的图片生成器，未配置ImageGen时为nil
+func Default() *Generator {
+	return defaultGenerator.Load()
+}
+
+// NewGenerator 按selected_module.ImageGen创建生成器，未选择时返回nil
+func NewGenerator(config *configs.Config, logger *utils.Logger) (*Generator, error) {
+	name := config.SelectedModule["ImageGen"]
+	if name == "" {
+		return nil, nil
+	}
+	cfg, ok := config.ImageGen[name]
+	if !ok {
+		return nil, fmt.Errorf("未找到ImageGen.%s的配置", name)
+	}
+	provider, err := Create(cfg.Type, &Config{
+		Name:           name,
+		Type:           cfg.Type,
+		ModelName:      cfg.ModelName,
+		BaseURL:        cfg.BaseURL,
+		APIKey:         cfg.APIKey,
+		Sizes:          cfg.Sizes,
+		NegativePrompt: cfg.NegativePrompt,
+		Steps:          cfg.Steps,
+		Timeout:        cfg.Timeout,
+		Extra:          cfg.Extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dir := config.Images.Dir
+	if dir == "" {
+		dir = defaultDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建图片目录失败: %v", err)
+	}
+
+	g := &Generator{
+		provider: provider,
+		config:   &config.Images,
+		dir:      dir,
+		baseURL:  publicBaseURL(config),
+		logger:   logger,
+	}
+	if g.baseURL == "" {
+		logger.Warn("未配置images.public_url，下发给设备的图片地址为相对路径")
+	}
+	return g, nil
+}
+
+// publicBaseURL 设备访问图片的地址前缀，未配置时由web.vision的地址推导
+func publicBaseURL(config *configs.Config) string {
+	base := strings.TrimRight(config.Images.PublicURL, "/")
+	if base == "" {
+		if i := strings.Index(config.Web.VisionURL, "/api/"); i > 0 {
+			base = config.Web.VisionURL[:i]
+		}
+	}
+	return base
+}
+
+// Start 定期删除过期的图片，直到ctx结束
+func (g *Generator) Start(ctx context.Context) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	g.cleanup()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.cleanup()
+		}
+	}
+}
+
+func (g *Generator) cleanup() {
+	keep := g.config.KeepHours
+	if keep <= 0 {
+		keep = defaultKeepHours
+	}
+	deadline := time.Now().Add(-time.Duration(keep) * time.Hour)
+	entries, err := os.ReadDir(g.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || info.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(g.dir, entry.Name())); err != nil {
+			g.logger.Warn("删除过期图片失败: %v", err)
+		}
+	}
+}
+
+// Generate 生成图片，按屏幕尺寸等比缩放（不放大）并转换为屏幕支持的格式
+func (g *Generator) Generate(ctx context.Context, prompt string, display Display) (*Image, error) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return nil, fmt.Errorf("提示词为空")
+	}
+	display = Display{Width: g.config.MaxWidth, Height: g.config.MaxHeight, Format: normalizeFormat(g.config.Format)}.Merge(display)
+	if display.Format == "" {
+		display.Format = "jpeg"
+	}
+
+	timeout := defaultTimeout
+	if p, ok := g.provider.(interface{ Timeout() time.Duration }); ok {
+		timeout = p.Timeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result, err := g.provider.Generate(ctx, &Request{Prompt: prompt, Width: display.Width, Height: display.Height})
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(result.Data))
+	if err != nil {
+		return nil, fmt.Errorf("解析生成的图片失败: %v", err)
+	}
+
+	dst := fitImage(src, display.Width, display.Height)
+	var buf bytes.Buffer
+	if display.Format == "png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("编码图片失败: %v", err)
+	}
+
+	ext := ".jpg"
+	if display.Format == "png" {
+		ext = ".png"
+	}
+	name := uuid.New().String() + ext
+	if err := os.WriteFile(filepath.Join(g.dir, name), buf.Bytes(), 0o644); err != nil {
+		return nil, fmt.Errorf("保存图片失败: %v", err)
+	}
+
+	bounds := dst.Bounds()
+	g.logger.Info("生成图片完成: %s %dx%d, 耗时%v", name, bounds.Dx(), bounds.Dy(), time.Since(start))
+	return &Image{
+		Name:          name,
+		URL:           g.baseURL + "/api" + RoutePath + "/" + name,
+		Width:         bounds.Dx(),
+		Height:        bounds.Dy(),
+		Format:        display.Format,
+		Prompt:        prompt,
+		RevisedPrompt: result.RevisedPrompt,
+	}, nil
+}
+
+// FilePath 图片文件路径，名称不合法或文件不存在时返回false
+func (g *Generator) FilePath(name string) (string, bool) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	path := filepath.Join(g.dir, name)
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+// fitImage 等比缩放到不超过width x height，尺寸为0或图片更小时不缩放
+func fitImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || (w <= width && h <= height) {
+		return src
+	}
+	scale := float64(width) / float64(w)
+	if s := float64(height) / float64(h); s < scale {
+		scale = s
+	}
+	tw, th := int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
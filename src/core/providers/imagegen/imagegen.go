@@ -0,0 +1,164 @@
+package imagegen
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeout 生成一张图片的默认超时
+const defaultTimeout = 120 * time.Second
+
+// Config 图片生成配置结构
+type Config struct {
+	Name           string
+	Type           string
+	ModelName      string
+	BaseURL        string
+	APIKey         string
+	Sizes          []string
+	NegativePrompt string
+	Steps          int
+	Timeout        int
+	Extra          map[string]interface{}
+}
+
+// Request 生成请求，宽高为期望的尺寸，提供者按支持的尺寸就近选择
+type Request struct {
+	Prompt string
+	Width  int
+	Height int
+}
+
+// Result 生成结果
+type Result struct {
+	Data          []byte // 图片内容
+	MIMEType      string // 如image/png
+	RevisedPrompt string // 服务改写后的提示词，可能为空
+}
+
+// Provider 图片生成提供者接口
+type Provider interface {
+	Initialize() error
+	Cleanup() error
+	// Generate 根据提示词生成一张图片
+	Generate(ctx context.Context, req *Request) (*Result, error)
+}
+
+// BaseProvider 图片生成基础实现
+type BaseProvider struct {
+	config *Config
+}
+
+// NewBaseProvider 创建图片生成基础提供者
+func NewBaseProvider(config *Config) *BaseProvider {
+	return &BaseProvider{
+		config: config,
+	}
+}
+
+// Config 获取配置
+func (p *BaseProvider) Config() *Config {
+	return p.config
+}
+
+// Timeout 单次生成的超时
+func (p *BaseProvider) Timeout() time.Duration {
+	if p.config.Timeout > 0 {
+		return time.Duration(p.config.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+// Initialize 初始化提供者
+func (p *BaseProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *BaseProvider) Cleanup() error {
+	return nil
+}
+
+// Factory 图片生成工厂函数类型
+type Factory func(config *Config) (Provider, error)
+
+var factories = make(map[string]Factory)
+
+// Register 注册图片生成提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建图片生成提供者实例
+func Create(name string, config *Config) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的图片生成提供者: %s", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建图片生成提供者失败: %v", err)
+	}
+
+	if err := provider.Initialize(); err != nil {
+		return nil, fmt.Errorf("初始化图片生成提供者失败: %v", err)
+	}
+
+	return provider, nil
+}
+
+// ParseSize 解析WxH格式的尺寸
+func ParseSize(size string) (int, int, bool) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(size)), "x")
+	if !ok {
+		return 0, 0, false
+	}
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// PickSize 从支持的尺寸中选择宽高比最接近的，比例相同时选择不小于期望尺寸的最小一个
+// 期望尺寸未知时返回第一个
+func PickSize(sizes []string, width, height int) string {
+	if len(sizes) == 0 {
+		return ""
+	}
+	if width <= 0 || height <= 0 {
+		return sizes[0]
+	}
+	want := math.Log(float64(width) / float64(height))
+	best := ""
+	bestDiff, bestArea := math.MaxFloat64, 0
+	for _, size := range sizes {
+		w, h, ok := ParseSize(size)
+		if !ok {
+			continue
+		}
+		diff := math.Abs(math.Log(float64(w)/float64(h)) - want)
+		area := w * h
+		switch {
+		case diff < bestDiff-1e-6:
+		case diff > bestDiff+1e-6:
+			continue
+		case bestArea >= width*height && (area < width*height || area > bestArea):
+			// 已选的尺寸足够大，只换成更小但仍足够大的
+			continue
+		case bestArea < width*height && area < bestArea:
+			continue
+		}
+		best, bestDiff, bestArea = size, diff, area
+	}
+	if best == "" {
+		return sizes[0]
+	}
+	return best
+}
@@ -0,0 +1,121 @@
+package imagegen
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+func TestPickSize(t *testing.T) {
+	sizes := []string{"1024x1024", "1792x1024", "1024x1792"}
+	tests := []struct {
+		name          string
+		sizes         []string
+		width, height int
+		want          string
+	}{
+		{"未知尺寸取第一个", sizes, 0, 0, "1024x1024"},
+		{"方屏", sizes, 240, 240, "1024x1024"},
+		{"横屏", sizes, 320, 240, "1792x1024"},
+		{"竖屏", sizes, 240, 320, "1024x1792"},
+		{"同比例选不小于期望的最小尺寸", []string{"256x256", "512x512", "1024x1024"}, 300, 300, "512x512"},
+		{"都小于期望时选最大的", []string{"256x256", "512x512"}, 800, 800, "512x512"},
+		{"没有配置", nil, 240, 240, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PickSize(tt.sizes, tt.width, tt.height); got != tt.want {
+				t.Errorf("PickSize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeProvider struct {
+	*BaseProvider
+	req *Request
+}
+
+func (p *fakeProvider) Generate(ctx context.Context, req *Request) (*Result, error) {
+	p.req = req
+	img := image.NewRGBA(image.Rect(0, 0, 1024, 768))
+	for x := 0; x < 1024; x++ {
+		img.Set(x, x%768, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return &Result{Data: buf.Bytes(), MIMEType: "image/png"}, nil
+}
+
+func TestGenerator(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		images     configs.ImagesConfig
+		display    Display
+		wantWidth  int
+		wantHeight int
+		wantFormat string
+	}{
+		{"按屏幕等比缩小", configs.ImagesConfig{}, Display{Width: 240, Height: 240, Format: "png"}, 240, 180, "png"},
+		{"未上报屏幕时使用默认配置", configs.ImagesConfig{Format: "png", MaxWidth: 512, MaxHeight: 512}, Display{}, 512, 384, "png"},
+		{"不放大且默认jpeg", configs.ImagesConfig{}, Display{Width: 2048, Height: 2048}, 1024, 768, "jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{BaseProvider: NewBaseProvider(&Config{})}
+			images := tt.images
+			g := &Generator{provider: provider, config: &images, dir: t.TempDir(), baseURL: "http://example.com", logger: logger}
+
+			img, err := g.Generate(context.Background(), "一只猫", tt.display)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Width != tt.wantWidth || img.Height != tt.wantHeight || img.Format != tt.wantFormat {
+				t.Errorf("got %dx%d %s, want %dx%d %s", img.Width, img.Height, img.Format, tt.wantWidth, tt.wantHeight, tt.wantFormat)
+			}
+			if want := "http://example.com/api/images/" + img.Name; img.URL != want {
+				t.Errorf("URL = %q, want %q", img.URL, want)
+			}
+
+			path, ok := g.FilePath(img.Name)
+			if !ok {
+				t.Fatalf("FilePath(%q) not found", img.Name)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decode := jpeg.Decode
+			if tt.wantFormat == "png" {
+				decode = png.Decode
+			}
+			if _, err := decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("saved image is not %s: %v", tt.wantFormat, err)
+			}
+		})
+	}
+
+	g := &Generator{dir: t.TempDir()}
+	os.WriteFile(filepath.Join(filepath.Dir(g.dir), "secret"), []byte("x"), 0o644)
+	for _, name := range []string{"", "../secret", ".hidden", "missing.png"} {
+		if _, ok := g.FilePath(name); ok {
+			t.Errorf("FilePath(%q) should be rejected", name)
+		}
+	}
+}
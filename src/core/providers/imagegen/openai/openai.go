@@ -0,0 +1,136 @@
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/core/providers/imagegen"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxDownloadSize 服务只返回图片地址时，下载的最大字节数
+const maxDownloadSize = 20 * 1024 * 1024
+
+// modelSizes 常见模型支持的尺寸，其他模型未配置sizes时使用1024x1024
+var modelSizes = map[string][]string{
+	openai.CreateImageModelDallE2:    {openai.CreateImageSize256x256, openai.CreateImageSize512x512, openai.CreateImageSize1024x1024},
+	openai.CreateImageModelDallE3:    {openai.CreateImageSize1024x1024, openai.CreateImageSize1792x1024, openai.CreateImageSize1024x1792},
+	openai.CreateImageModelGptImage1: {openai.CreateImageSize1024x1024, openai.CreateImageSize1536x1024, openai.CreateImageSize1024x1536},
+}
+
+// Provider OpenAI images接口兼容的图片生成提供者
+type Provider struct {
+	*imagegen.BaseProvider
+	client     *openai.Client
+	httpClient *http.Client
+	sizes      []string
+}
+
+// 注册提供者
+func init() {
+	imagegen.Register("openai", NewProvider)
+}
+
+// NewProvider 创建OpenAI图片生成提供者
+func NewProvider(config *imagegen.Config) (imagegen.Provider, error) {
+	return &Provider{
+		BaseProvider: imagegen.NewBaseProvider(config),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.ModelName == "" {
+		return fmt.Errorf("missing image model_name")
+	}
+
+	clientConfig := openai.DefaultConfig(config.APIKey)
+	if config.BaseURL != "" {
+		clientConfig.BaseURL = config.BaseURL
+	}
+	p.client = openai.NewClientWithConfig(clientConfig)
+	p.httpClient = &http.Client{Timeout: p.Timeout()}
+
+	p.sizes = config.Sizes
+	if len(p.sizes) == 0 {
+		p.sizes = modelSizes[config.ModelName]
+	}
+	if len(p.sizes) == 0 {
+		p.sizes = []string{openai.CreateImageSize1024x1024}
+	}
+	return nil
+}
+
+// Generate 调用 /images/generations 接口生成图片
+func (p *Provider) Generate(ctx context.Context, req *imagegen.Request) (*imagegen.Result, error) {
+	config := p.Config()
+	request := openai.ImageRequest{
+		Prompt: req.Prompt,
+		Model:  config.ModelName,
+		N:      1,
+		Size:   imagegen.PickSize(p.sizes, req.Width, req.Height),
+	}
+	// gpt-image系列总是返回base64，不接受response_format
+	if !strings.HasPrefix(config.ModelName, "gpt-image") {
+		request.ResponseFormat = openai.CreateImageResponseFormatB64JSON
+	}
+	if quality, ok := config.Extra["quality"].(string); ok {
+		request.Quality = quality
+	}
+	if style, ok := config.Extra["style"].(string); ok {
+		request.Style = style
+	}
+
+	resp, err := p.client.CreateImage(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("请求图片生成接口失败: %v", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("图片生成接口返回为空")
+	}
+
+	item := resp.Data[0]
+	var data []byte
+	if item.B64JSON != "" {
+		data, err = base64.StdEncoding.DecodeString(item.B64JSON)
+		if err != nil {
+			return nil, fmt.Errorf("图片base64解码失败: %v", err)
+		}
+	} else if item.URL != "" {
+		// 部分兼容服务忽略response_format，只返回临时地址
+		data, err = p.download(ctx, item.URL)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("图片生成接口没有返回图片")
+	}
+
+	return &imagegen.Result{
+		Data:          data,
+		MIMEType:      http.DetectContentType(data),
+		RevisedPrompt: item.RevisedPrompt,
+	}, nil
+}
+
+func (p *Provider) download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载生成的图片失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载生成的图片失败: HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+}
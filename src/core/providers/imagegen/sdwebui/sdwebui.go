@@ -0,0 +1,157 @@
+package sdwebui
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/core/providers/imagegen"
+)
+
+const (
+	defaultURL   = "http://127.0.0.1:7860"
+	defaultSteps = 20
+	// 模型适合的出图尺寸，期望尺寸按比例缩放到短边不小于minSide、长边不超过maxSide
+	minSide = 512
+	maxSide = 1024
+)
+
+// Provider Stable Diffusion WebUI(及兼容的Forge、SD.Next) /sdapi/v1/txt2img 接口的图片生成提供者
+type Provider struct {
+	*imagegen.BaseProvider
+	endpoint   string
+	httpClient *http.Client
+}
+
+type txt2imgResponse struct {
+	Images []string `json:"images"`
+	Detail string   `json:"detail"`
+	Error  string   `json:"error"`
+}
+
+// 注册提供者
+func init() {
+	imagegen.Register("sdwebui", NewProvider)
+}
+
+// NewProvider 创建Stable Diffusion WebUI图片生成提供者
+func NewProvider(config *imagegen.Config) (imagegen.Provider, error) {
+	return &Provider{
+		BaseProvider: imagegen.NewBaseProvider(config),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	base := strings.TrimRight(p.Config().BaseURL, "/")
+	if base == "" {
+		base = defaultURL
+	}
+	p.endpoint = base + "/sdapi/v1/txt2img"
+	p.httpClient = &http.Client{Timeout: p.Timeout()}
+	return nil
+}
+
+// Generate 调用txt2img接口生成图片，额外配置（如sampler_name、cfg_scale、seed）原样传给接口
+func (p *Provider) Generate(ctx context.Context, req *imagegen.Request) (*imagegen.Result, error) {
+	config := p.Config()
+	payload := make(map[string]interface{}, len(config.Extra)+6)
+	for k, v := range config.Extra {
+		payload[k] = v
+	}
+	width, height := p.size(req.Width, req.Height)
+	steps := config.Steps
+	if steps <= 0 {
+		steps = defaultSteps
+	}
+	payload["prompt"] = req.Prompt
+	payload["negative_prompt"] = config.NegativePrompt
+	payload["steps"] = steps
+	payload["width"] = width
+	payload["height"] = height
+	payload["batch_size"] = 1
+	if config.ModelName != "" {
+		payload["override_settings"] = map[string]interface{}{"sd_model_checkpoint": config.ModelName}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if key := config.APIKey; key != "" {
+		// WebUI的--api-auth使用Basic认证，其他兼容服务使用Bearer
+		if user, pass, ok := strings.Cut(key, ":"); ok {
+			httpReq.SetBasicAuth(user, pass)
+		} else {
+			httpReq.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求txt2img接口失败: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取txt2img响应失败: %v", err)
+	}
+
+	var result txt2imgResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("解析txt2img响应失败(HTTP %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || len(result.Images) == 0 {
+		msg := result.Detail
+		if msg == "" {
+			msg = result.Error
+		}
+		return nil, fmt.Errorf("txt2img接口返回错误(HTTP %d): %s", resp.StatusCode, msg)
+	}
+
+	// 部分版本返回data URL
+	encoded := result.Images[0]
+	if i := strings.Index(encoded, ","); strings.HasPrefix(encoded, "data:") && i > 0 {
+		encoded = encoded[i+1:]
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("图片base64解码失败: %v", err)
+	}
+	return &imagegen.Result{Data: data, MIMEType: http.DetectContentType(data)}, nil
+}
+
+// size 出图尺寸，配置了sizes时从中选择，否则保持期望的宽高比并取8的倍数
+func (p *Provider) size(width, height int) (int, int) {
+	if size := imagegen.PickSize(p.Config().Sizes, width, height); size != "" {
+		if w, h, ok := imagegen.ParseSize(size); ok {
+			return w, h
+		}
+	}
+	if width <= 0 || height <= 0 {
+		return minSide, minSide
+	}
+	scale := float64(minSide) / float64(min(width, height))
+	if long := float64(max(width, height)) * scale; long > maxSide {
+		scale = float64(maxSide) / float64(max(width, height))
+	}
+	return roundTo8(float64(width) * scale), roundTo8(float64(height) * scale)
+}
+
+func roundTo8(v float64) int {
+	n := int(v/8+0.5) * 8
+	if n < 64 {
+		n = 64
+	}
+	return n
+}
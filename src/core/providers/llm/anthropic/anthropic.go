@@ -0,0 +1,356 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	defaultBaseURL   = "https://api.anthropic.com/v1"
+	defaultVersion   = "2023-06-01"
+	defaultMaxTokens = 1024
+)
+
+// Provider Anthropic Messages API提供者，原生支持工具调用和图片输入
+type Provider struct {
+	*llm.BaseProvider
+	client    *http.Client
+	endpoint  string
+	version   string
+	maxTokens int
+}
+
+// 注册提供者
+func init() {
+	llm.Register("anthropic", NewProvider)
+}
+
+// NewProvider 创建Anthropic提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	provider := &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+		version:      defaultVersion,
+		maxTokens:    config.MaxTokens,
+	}
+	if version, ok := config.Extra["anthropic_version"].(string); ok && version != "" {
+		provider.version = version
+	}
+	if provider.maxTokens <= 0 {
+		provider.maxTokens = defaultMaxTokens
+	}
+	return provider, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.APIKey == "" {
+		return fmt.Errorf("missing Anthropic API key")
+	}
+	if config.ModelName == "" {
+		return fmt.Errorf("missing Anthropic model_name")
+	}
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	p.endpoint = strings.TrimSuffix(baseURL, "/") + "/messages"
+	p.client = &http.Client{}
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *Provider) Cleanup() error {
+	return nil
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responses, err := p.ResponseWithFunctions(ctx, sessionID, messages, nil)
+	if err != nil {
+		return nil, err
+	}
+	responseChan := make(chan string, 10)
+	go func() {
+		defer close(responseChan)
+		for response := range responses {
+			if response.Content != "" {
+				responseChan <- response.Content
+			}
+		}
+	}()
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+		if err := p.stream(ctx, messages, tools, responseChan); err != nil {
+			responseChan <- types.Response{
+				Content: fmt.Sprintf("【Anthropic服务响应异常: %v】", err),
+				Error:   err.Error(),
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// stream 发送请求并把流式事件转换为types.Response
+func (p *Provider) stream(ctx context.Context, messages []types.Message, tools []openai.Tool, responseChan chan<- types.Response) error {
+	body, err := json.Marshal(p.buildRequest(ctx, messages, tools))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("x-api-key", p.Config().APIKey)
+	req.Header.Set("anthropic-version", p.version)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr errorEvent
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	// 对话流程每次只处理一个工具调用，只转发第一个tool_use，历史中的tool_use和tool_result也因此一一对应
+	toolIndex := -1
+	toolArgs := false
+	var filter llm.ThinkFilter
+	err = llm.ReadSSE(resp.Body, func(event string, data string) error {
+		switch event {
+		case "content_block_start":
+			var start contentBlockStart
+			if err := json.Unmarshal([]byte(data), &start); err != nil {
+				return err
+			}
+			if start.ContentBlock.Type == "tool_use" && toolIndex < 0 {
+				toolIndex = start.Index
+				responseChan <- types.Response{ToolCalls: []types.ToolCall{{
+					ID:       start.ContentBlock.ID,
+					Type:     "function",
+					Function: types.FunctionCall{Name: start.ContentBlock.Name},
+				}}}
+			}
+		case "content_block_delta":
+			var delta contentBlockDelta
+			if err := json.Unmarshal([]byte(data), &delta); err != nil {
+				return err
+			}
+			switch delta.Delta.Type {
+			case "text_delta":
+				if content := filter.Write(delta.Delta.Text); content != "" {
+					responseChan <- types.Response{Content: content}
+				}
+			case "input_json_delta":
+				if delta.Index == toolIndex && delta.Delta.PartialJSON != "" {
+					toolArgs = true
+					responseChan <- types.Response{ToolCalls: []types.ToolCall{{
+						Function: types.FunctionCall{Arguments: delta.Delta.PartialJSON},
+					}}}
+				}
+			}
+		case "content_block_stop":
+			var stop contentBlockStart
+			if err := json.Unmarshal([]byte(data), &stop); err != nil {
+				return err
+			}
+			// 没有参数的工具不会发送input_json_delta
+			if stop.Index == toolIndex && !toolArgs {
+				toolArgs = true
+				responseChan <- types.Response{ToolCalls: []types.ToolCall{{
+					Function: types.FunctionCall{Arguments: "{}"},
+				}}}
+			}
+		case "error":
+			var apiErr errorEvent
+			if err := json.Unmarshal([]byte(data), &apiErr); err != nil {
+				return err
+			}
+			return fmt.Errorf("%s: %s", apiErr.Error.Type, apiErr.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if content := filter.Flush(); content != "" {
+		responseChan <- types.Response{Content: content}
+	}
+	return nil
+}
+
+// buildRequest 转换为Messages API请求：system单独传递，工具结果放在user消息中
+func (p *Provider) buildRequest(ctx context.Context, messages []types.Message, tools []openai.Tool) *messagesRequest {
+	config := p.Config()
+	request := &messagesRequest{
+		Model:     config.ModelName,
+		MaxTokens: p.maxTokens,
+		Stream:    true,
+	}
+	// 角色显式指定的温度包括0都发送，配置中的0视为未设置
+	if temperature, ok := llm.RequestTemperature(ctx); ok || config.Temperature > 0 {
+		if !ok {
+			temperature = config.Temperature
+		}
+		// Anthropic的温度范围是0~1
+		temperature = min(temperature, 1)
+		request.Temperature = &temperature
+	}
+	if config.TopP > 0 {
+		request.TopP = &config.TopP
+	}
+
+	var system []string
+	for _, msg := range llm.RecentImages(messages, llm.DefaultMaxImages) {
+		role := "user"
+		var blocks []contentBlock
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, msg.Content)
+			}
+			continue
+		case "assistant":
+			role = "assistant"
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				blocks = append(blocks, contentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Function.Name,
+					Input: llm.ToolArguments(tc.Function.Arguments),
+				})
+			}
+		case "tool":
+			blocks = append(blocks, contentBlock{Type: "tool_result", ToolUseID: msg.ToolCallID, Content: msg.Content})
+		default:
+			for _, image := range msg.Images {
+				blocks = append(blocks, contentBlock{Type: "image", Source: &imageSource{
+					Type:      "base64",
+					MediaType: llm.ImageMIMEType(image.Format),
+					Data:      image.Data,
+				}})
+			}
+			if msg.Content != "" {
+				blocks = append(blocks, contentBlock{Type: "text", Text: msg.Content})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		// 连续的同角色消息合并，例如多个工具结果
+		if n := len(request.Messages); n > 0 && request.Messages[n-1].Role == role {
+			request.Messages[n-1].Content = append(request.Messages[n-1].Content, blocks...)
+			continue
+		}
+		request.Messages = append(request.Messages, message{Role: role, Content: blocks})
+	}
+	request.System = strings.Join(system, "\n\n")
+
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		schema := llm.ToolParameters(tool)
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		request.Tools = append(request.Tools, toolDefinition{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	return request
+}
+
+type messagesRequest struct {
+	Model       string           `json:"model"`
+	MaxTokens   int              `json:"max_tokens"`
+	System      string           `json:"system,omitempty"`
+	Messages    []message        `json:"messages"`
+	Tools       []toolDefinition `json:"tools,omitempty"`
+	Temperature *float64         `json:"temperature,omitempty"`
+	TopP        *float64         `json:"top_p,omitempty"`
+	Stream      bool             `json:"stream"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type      string       `json:"type"`
+	Text      string       `json:"text,omitempty"`
+	Source    *imageSource `json:"source,omitempty"`
+	ID        string       `json:"id,omitempty"`
+	Name      string       `json:"name,omitempty"`
+	Input     interface{}  `json:"input,omitempty"` // tool_use必须带input，空对象也要发送
+	ToolUseID string       `json:"tool_use_id,omitempty"`
+	Content   string       `json:"content,omitempty"`
+}
+
+type imageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type toolDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type contentBlockStart struct {
+	Index        int `json:"index"`
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+}
+
+type contentBlockDelta struct {
+	Index int `json:"index"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+}
+
+type errorEvent struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
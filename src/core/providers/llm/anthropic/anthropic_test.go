@@ -0,0 +1,241 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func sse(events ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(events); i += 2 {
+		fmt.Fprintf(&b, "event: %s\ndata: %s\n\n", events[i], events[i+1])
+	}
+	return b.String()
+}
+
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *Provider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	provider, err := llm.Create("anthropic", &llm.Config{
+		Type:      "anthropic",
+		ModelName: "claude-test",
+		BaseURL:   server.URL + "/v1",
+		APIKey:    "test-key",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider.(*Provider)
+}
+
+// collect 按对话流程的方式拼接文字和工具调用
+func collect(t *testing.T, responses <-chan types.Response) (string, types.ToolCall, string) {
+	t.Helper()
+	var content strings.Builder
+	var call types.ToolCall
+	errMsg := ""
+	for response := range responses {
+		content.WriteString(response.Content)
+		if response.Error != "" {
+			errMsg = response.Error
+		}
+		if len(response.ToolCalls) > 0 {
+			tc := response.ToolCalls[0]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.Function.Name = tc.Function.Name
+			}
+			call.Function.Arguments += tc.Function.Arguments
+		}
+	}
+	return content.String(), call, errMsg
+}
+
+func TestResponseWithFunctions(t *testing.T) {
+	tools := []openai.Tool{
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "get_weather",
+			Description: "查询天气",
+			Parameters:  map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}},
+		}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "exit"}},
+	}
+	messages := []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "这是什么", Images: []types.ImageRef{{Format: "png", Data: "aW1n"}}},
+		{Role: "assistant", Content: "一只猫"},
+		{Role: "user", Content: "北京天气"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "toolu_1", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}}}},
+		{Role: "tool", ToolCallID: "toolu_1", Content: "晴"},
+		{Role: "user", Content: "上海呢"},
+	}
+
+	tests := []struct {
+		name        string
+		stream      string
+		wantContent string
+		wantTool    types.ToolCall
+		wantErr     bool
+	}{
+		{
+			name: "文字回复过滤思考标签",
+			stream: sse(
+				"message_start", `{"type":"message_start","message":{"id":"msg_1"}}`,
+				"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"<thi"}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"nk>想一想</think>上海"}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"多云"}}`,
+				"content_block_stop", `{"type":"content_block_stop","index":0}`,
+				"message_stop", `{"type":"message_stop"}`,
+			),
+			wantContent: "上海多云",
+		},
+		{
+			name: "工具调用",
+			stream: sse(
+				"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_2","name":"get_weather","input":{}}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+				"content_block_delta", `{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"上海\"}"}}`,
+				"content_block_stop", `{"type":"content_block_stop","index":0}`,
+				"content_block_start", `{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_3","name":"exit","input":{}}}`,
+				"content_block_stop", `{"type":"content_block_stop","index":1}`,
+				"message_delta", `{"type":"message_delta","delta":{"stop_reason":"tool_use"}}`,
+			),
+			wantTool: types.ToolCall{ID: "toolu_2", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"上海"}`}},
+		},
+		{
+			name: "没有参数的工具调用",
+			stream: sse(
+				"content_block_start", `{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"toolu_4","name":"exit","input":{}}}`,
+				"content_block_stop", `{"type":"content_block_stop","index":0}`,
+			),
+			wantTool: types.ToolCall{ID: "toolu_4", Function: types.FunctionCall{Name: "exit", Arguments: "{}"}},
+		},
+		{
+			name: "流中的错误事件",
+			stream: sse(
+				"error", `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+			),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/messages" || r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+					t.Errorf("请求 %s 缺少认证头", r.URL.Path)
+				}
+				var req messagesRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Error(err)
+					return
+				}
+				if req.System != "你是小智" || !req.Stream || req.MaxTokens != defaultMaxTokens {
+					t.Errorf("system = %q, stream = %v, max_tokens = %d", req.System, req.Stream, req.MaxTokens)
+				}
+				if len(req.Messages) != 5 {
+					t.Errorf("len(messages) = %d, want 5", len(req.Messages))
+					return
+				}
+				if image := req.Messages[0].Content[0]; image.Type != "image" || image.Source.MediaType != "image/png" || image.Source.Data != "aW1n" {
+					t.Errorf("图片 = %+v", image)
+				}
+				if use := req.Messages[3].Content[0]; use.Type != "tool_use" || use.ID != "toolu_1" || use.Input.(map[string]interface{})["city"] != "北京" {
+					t.Errorf("tool_use = %+v", use)
+				}
+				// 工具结果和之后的用户消息合并为一条user消息
+				last := req.Messages[4]
+				if last.Role != "user" || len(last.Content) != 2 || last.Content[1].Text != "上海呢" {
+					t.Errorf("最后一条消息 = %+v", last)
+				} else if result := last.Content[0]; result.Type != "tool_result" || result.ToolUseID != "toolu_1" || result.Content != "晴" {
+					t.Errorf("tool_result = %+v", result)
+				}
+				if len(req.Tools) != 2 || req.Tools[1].InputSchema["type"] != "object" {
+					t.Errorf("tools = %+v", req.Tools)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, tt.stream)
+			})
+
+			responses, err := provider.ResponseWithFunctions(context.Background(), "s1", messages, tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+			content, call, errMsg := collect(t, responses)
+			if tt.wantErr {
+				if errMsg == "" || !strings.Contains(content, "服务响应异常") {
+					t.Errorf("content = %q, error = %q, want 错误", content, errMsg)
+				}
+				return
+			}
+			if errMsg != "" {
+				t.Fatalf("error = %s", errMsg)
+			}
+			if content != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+			if call.ID != tt.wantTool.ID || call.Function != tt.wantTool.Function {
+				t.Errorf("tool call = %+v, want %+v", call, tt.wantTool)
+			}
+		})
+	}
+}
+
+func TestResponseHTTPError(t *testing.T) {
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`)
+	})
+	responses, err := provider.Response(context.Background(), "s1", []types.Message{{Role: "user", Content: "你好"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var content string
+	for chunk := range responses {
+		content += chunk
+	}
+	if !strings.Contains(content, "服务响应异常") || !strings.Contains(content, "invalid x-api-key") {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestBuildRequestTemperature(t *testing.T) {
+	tests := []struct {
+		name   string
+		config float64
+		ctx    context.Context
+		want   *float64
+	}{
+		{name: "未设置温度", ctx: context.Background()},
+		{name: "超过1时截断", config: 1.5, ctx: context.Background(), want: ptr(1)},
+		{name: "角色指定温度0", config: 0.7, ctx: llm.WithTemperature(context.Background(), 0), want: ptr(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := llm.Create("anthropic", &llm.Config{Type: "anthropic", ModelName: "claude-test", APIKey: "test-key", Temperature: tt.config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := provider.(*Provider).buildRequest(tt.ctx, nil, nil).Temperature
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("temperature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
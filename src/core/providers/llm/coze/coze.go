@@ -13,6 +13,13 @@ import (
 	"xiaozhi-server-go/src/core/types"
 )
 
+const (
+	// maxSeedMessages 重建Coze会话时带上的最近历史消息数
+	maxSeedMessages = 20
+	// skippedToolOutput 只转发第一个工具调用，其余调用提交的结果
+	skippedToolOutput = "工具未执行"
+)
+
 type Provider struct {
 	*llm.BaseProvider
 
@@ -22,8 +29,26 @@ type Provider struct {
 	clientId               string
 	publicKey              string
 	privateKey             string
+	systemPromptVariable   string // 通过此自定义变量把系统提示词传给智能体，为空时不传
+	functionPrompt         bool   // 新会话的第一条消息附加工具说明，智能体可用<tool_call>调用本地工具
 	client                 coze.CozeAPI
-	sessionConversationMap sync.Map
+	sessionConversationMap sync.Map // sessionID -> *session
+}
+
+// session 一个会话在Coze上的对话，记录已同步的本地消息，只发送新增的部分
+type session struct {
+	mu             sync.Mutex
+	conversationID string
+	systemPrompt   string
+	synced         int           // 已同步到Coze的本地消息数
+	last           types.Message // 最后一条已同步的消息，用于发现对话被清空或裁剪
+	pending        *pendingAction
+}
+
+// pendingAction 等待提交工具结果的对话
+type pendingAction struct {
+	chatID      string
+	toolCallIDs []string
 }
 
 func init() {
@@ -61,6 +86,13 @@ func NewProvider(config *llm.Config) (llm.Provider, error) {
 	if ok {
 		provider.accessToken = accessToken.(string)
 	}
+	if variable, ok := config.Extra["system_prompt_variable"].(string); ok {
+		provider.systemPromptVariable = variable
+	}
+	provider.functionPrompt = true
+	if functionPrompt, ok := config.Extra["function_prompt"].(bool); ok {
+		provider.functionPrompt = functionPrompt
+	}
 	return provider, nil
 }
 
@@ -99,118 +131,270 @@ func (p *Provider) Initialize() error {
 	return nil
 }
 
+// Reset 归还资源池前清空会话记录，避免每个连接或接口请求的会话一直留在内存中
+func (p *Provider) Reset() error {
+	p.sessionConversationMap.Range(func(key, _ interface{}) bool {
+		p.sessionConversationMap.Delete(key)
+		return true
+	})
+	return nil
+}
+
 // Response types.LLMProvider接口实现
 func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responses, err := p.ResponseWithFunctions(ctx, sessionID, messages, nil)
+	if err != nil {
+		return nil, err
+	}
 	responseChan := make(chan string, 10)
-
 	go func() {
 		defer close(responseChan)
-
-		var lastMsg string
-		if len(messages) > 0 {
-			lastMsg = messages[len(messages)-1].Content
-		}
-
-		conversationId, ok := p.sessionConversationMap.Load(sessionID)
-		if !ok {
-			conversation, err := p.client.Conversations.Create(ctx, &coze.CreateConversationsReq{
-				Messages: []*coze.Message{},
-			})
-			if err != nil {
-				responseChan <- fmt.Sprintf("【Coze服务创建会话失败: %v】", err)
-				return
-			}
-			conversationId = conversation.ID
-			p.sessionConversationMap.Store(sessionID, conversationId)
-		}
-
-		stream, err := p.client.Chat.Stream(ctx, &coze.CreateChatsReq{
-			BotID:  p.botID,
-			UserID: p.userID,
-			Messages: []*coze.Message{
-				coze.BuildUserQuestionObjects([]*coze.MessageObjectString{
-					coze.NewTextMessageObject(lastMsg),
-				}, nil),
-			},
-			ConversationID: conversationId.(string),
-		})
-		if err != nil {
-			responseChan <- fmt.Sprintf("【Coze服务响应异常: %v】", err)
-			return
-		}
-		defer stream.Close()
-
-		for {
-			event, err := stream.Recv()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					fmt.Println("Coze Stream finished")
-				}
-				break
-			}
-
-			if event.Event == coze.ChatEventConversationMessageDelta {
-				responseChan <- event.Message.Content
+		for response := range responses {
+			if response.Content != "" {
+				responseChan <- response.Content
 			}
 		}
 	}()
-
 	return responseChan, nil
 }
 
 // ResponseWithFunctions types.LLMProvider接口实现
+// Coze在服务端保存对话，每次只发送上次之后新增的消息；智能体的端插件调用转换为工具调用，结果在下一次请求时提交
 func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
 	responseChan := make(chan types.Response, 10)
 
 	go func() {
 		defer close(responseChan)
 
-		// 第一次调用 LLM，取最后一条用户消息，附加 tool 提示词
-		if len(messages) == 2 && len(tools) > 0 {
-			lastMsg := messages[len(messages)-1].Content
+		value, _ := p.sessionConversationMap.LoadOrStore(sessionID, &session{})
+		sess := value.(*session)
+		sess.mu.Lock()
+		defer sess.mu.Unlock()
 
-			functionBytes, err := json.Marshal(tools)
-			if err != nil {
-				responseChan <- types.Response{
-					Content: fmt.Sprintf("【序列化工具失败: %v】", err),
-					Error:   err.Error(),
-				}
-				return
-			}
-			functionStr := string(functionBytes)
-			modifyMsg := llm.GetSystemPromptForFunction(functionStr) + lastMsg
-			messages[len(messages)-1].Content = modifyMsg
-		}
-		// 如果最后一个是 role="tool"，则附加到 user 消息中
-		if len(messages) > 1 && messages[len(messages)-1].Role == "tool" {
-			assistantMsg := "\ntool call result: " + messages[len(messages)-1].Content + "\n\n"
-
-			for len(messages) > 1 {
-				if messages[len(messages)-1].Role == "user" {
-					messages[len(messages)-1].Content = assistantMsg + messages[len(messages)-1].Content
-					break
-				}
-				messages = messages[:len(messages)-1]
+		if err := p.chat(ctx, sess, messages, tools, responseChan); err != nil {
+			responseChan <- types.Response{
+				Content: fmt.Sprintf("【Coze服务响应异常: %v】", err),
+				Error:   err.Error(),
 			}
 		}
+	}()
+
+	return responseChan, nil
+}
+
+// chat 发送新增的消息或提交工具结果，并转发回复
+func (p *Provider) chat(ctx context.Context, sess *session, messages []types.Message, tools []openai.Tool, responseChan chan<- types.Response) error {
+	systemPrompt := ""
+	if len(messages) > 0 && messages[0].Role == "system" {
+		systemPrompt = messages[0].Content
+	}
 
-		// 调用普通 Response 接口获取结果流
-		respChan, err := p.Response(ctx, sessionID, messages)
+	// 切换角色、清空或裁剪对话后重建Coze会话，带上最近的历史
+	start := sess.unsynced(messages, systemPrompt)
+	newConversation := start < 0
+	if newConversation {
+		start = lastUserIndex(messages)
+		if start < 0 {
+			return fmt.Errorf("没有用户消息")
+		}
+		conversation, err := p.client.Conversations.Create(ctx, &coze.CreateConversationsReq{
+			Messages: seedMessages(messages[:start]),
+			BotID:    p.botID,
+		})
 		if err != nil {
-			responseChan <- types.Response{
-				Content: fmt.Sprintf("【调用Response失败: %v】", err),
-				Error:   err.Error(),
+			return fmt.Errorf("创建会话失败: %v", err)
+		}
+		sess.conversationID = conversation.ID
+		sess.systemPrompt = systemPrompt
+		sess.pending = nil
+	}
+	delta := messages[start:]
+
+	var stream coze.Stream[coze.ChatEvent]
+	var err error
+	if pending := sess.pending; pending != nil {
+		sess.pending = nil
+		if outputs, asked := toolOutputs(delta, pending); !asked {
+			stream, err = p.client.Chat.StreamSubmitToolOutputs(ctx, &coze.SubmitToolOutputsChatReq{
+				ConversationID: sess.conversationID,
+				ChatID:         pending.chatID,
+				ToolOutputs:    outputs,
+			})
+		} else {
+			// 工具执行后没有请求回复（如播放音乐），用户又提出了新问题，取消等待中的对话
+			_, _ = p.client.Chat.Cancel(ctx, &coze.CancelChatsReq{
+				ConversationID: sess.conversationID,
+				ChatID:         pending.chatID,
+			})
+		}
+	}
+	if stream == nil && err == nil {
+		additional := p.additionalMessages(delta, newConversation, tools)
+		if len(additional) == 0 {
+			return fmt.Errorf("没有新的用户消息")
+		}
+		req := &coze.CreateChatsReq{
+			BotID:          p.botID,
+			UserID:         p.userID,
+			Messages:       additional,
+			ConversationID: sess.conversationID,
+		}
+		if p.systemPromptVariable != "" && systemPrompt != "" {
+			req.CustomVariables = map[string]string{p.systemPromptVariable: systemPrompt}
+		}
+		stream, err = p.client.Chat.Stream(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	sess.synced = len(messages)
+	sess.last = messages[len(messages)-1]
+	return forward(stream, sess, responseChan)
+}
+
+// forward 转发回答，智能体请求调用端插件时转换为工具调用
+func forward(stream coze.Stream[coze.ChatEvent], sess *session, responseChan chan<- types.Response) error {
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
 			}
-			return
+			return err
 		}
 
-		// 透传结果
-		for token := range respChan {
-			responseChan <- types.Response{
-				Content: token,
+		switch event.Event {
+		case coze.ChatEventConversationMessageDelta:
+			if event.Message == nil || event.Message.Content == "" {
+				continue
+			}
+			if event.Message.Type == coze.MessageTypeAnswer || event.Message.Type == coze.MessageTypeUnknown {
+				responseChan <- types.Response{Content: event.Message.Content}
+			}
+		case coze.ChatEventConversationChatRequiresAction:
+			toolCall, err := requireAction(event.Chat, sess)
+			if err != nil {
+				return err
+			}
+			responseChan <- types.Response{ToolCalls: []types.ToolCall{toolCall}}
+			return nil
+		case coze.ChatEventConversationChatFailed:
+			if event.Chat != nil && event.Chat.LastError != nil {
+				return fmt.Errorf("对话失败(%d): %s", event.Chat.LastError.Code, event.Chat.LastError.Msg)
 			}
+			return fmt.Errorf("对话失败")
+		case coze.ChatEventDone:
+			return nil
 		}
-	}()
+	}
+}
 
-	return responseChan, nil
+// requireAction 记录等待提交结果的工具调用，对话流程每次只处理一个，返回第一个
+func requireAction(chat *coze.Chat, sess *session) (types.ToolCall, error) {
+	if chat == nil || chat.RequiredAction == nil || chat.RequiredAction.SubmitToolOutputs == nil ||
+		len(chat.RequiredAction.SubmitToolOutputs.ToolCalls) == 0 {
+		return types.ToolCall{}, fmt.Errorf("requires_action缺少工具调用")
+	}
+	calls := chat.RequiredAction.SubmitToolOutputs.ToolCalls
+	pending := &pendingAction{chatID: chat.ID}
+	for _, call := range calls {
+		pending.toolCallIDs = append(pending.toolCallIDs, call.ID)
+	}
+	sess.pending = pending
+
+	toolCall := types.ToolCall{ID: calls[0].ID, Type: "function"}
+	if calls[0].Function != nil {
+		toolCall.Function.Name = calls[0].Function.Name
+		toolCall.Function.Arguments = calls[0].Function.Arguments
+	}
+	if toolCall.Function.Arguments == "" {
+		toolCall.Function.Arguments = "{}"
+	}
+	return toolCall, nil
+}
+
+// unsynced 返回第一条未同步消息的下标，需要重建会话时返回-1
+func (s *session) unsynced(messages []types.Message, systemPrompt string) int {
+	if s.conversationID == "" || s.systemPrompt != systemPrompt || s.synced == 0 || s.synced > len(messages) {
+		return -1
+	}
+	last := messages[s.synced-1]
+	if last.Role != s.last.Role || last.Content != s.last.Content || last.ToolCallID != s.last.ToolCallID {
+		return -1
+	}
+	return s.synced
+}
+
+// additionalMessages 新增的用户消息和工具结果，assistant消息由Coze生成，已在会话中
+func (p *Provider) additionalMessages(delta []types.Message, newConversation bool, tools []openai.Tool) []*coze.Message {
+	var result []*coze.Message
+	for _, msg := range delta {
+		switch msg.Role {
+		case "user":
+			if msg.Content != "" {
+				result = append(result, coze.BuildUserQuestionText(msg.Content, nil))
+			}
+		case "tool":
+			result = append(result, coze.BuildUserQuestionText("tool call result: "+msg.Content, nil))
+		}
+	}
+	if newConversation && p.functionPrompt && len(tools) > 0 && len(result) > 0 {
+		if functions, err := json.Marshal(tools); err == nil {
+			result[0].Content = llm.GetSystemPromptForFunction(string(functions)) + result[0].Content
+		}
+	}
+	return result
+}
+
+// toolOutputs 按等待中的工具调用整理结果，asked表示工具结果之后用户又提出了新问题
+func toolOutputs(delta []types.Message, pending *pendingAction) (outputs []*coze.ToolOutput, asked bool) {
+	results := make(map[string]string)
+	for _, msg := range delta {
+		switch msg.Role {
+		case "tool":
+			results[msg.ToolCallID] = msg.Content
+		case "user":
+			asked = true
+		}
+	}
+	for _, id := range pending.toolCallIDs {
+		output, ok := results[id]
+		if !ok || output == "" {
+			output = skippedToolOutput
+		}
+		outputs = append(outputs, &coze.ToolOutput{ToolCallID: id, Output: output})
+	}
+	return outputs, asked
+}
+
+// seedMessages 重建会话时带上的历史问答，不含工具调用过程
+func seedMessages(history []types.Message) []*coze.Message {
+	var seed []*coze.Message
+	for _, msg := range history {
+		if msg.Content == "" || len(msg.ToolCalls) > 0 {
+			continue
+		}
+		switch msg.Role {
+		case "user":
+			seed = append(seed, coze.BuildUserQuestionText(msg.Content, nil))
+		case "assistant":
+			seed = append(seed, coze.BuildAssistantAnswer(msg.Content, nil))
+		}
+	}
+	if len(seed) > maxSeedMessages {
+		seed = seed[len(seed)-maxSeedMessages:]
+	}
+	return seed
+}
+
+// lastUserIndex 最后一条用户消息的下标
+func lastUserIndex(messages []types.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return i
+		}
+	}
+	return -1
 }
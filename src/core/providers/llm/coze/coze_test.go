@@ -0,0 +1,233 @@
+package coze
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeCoze 模拟Coze的会话和对话接口，记录收到的请求
+type fakeCoze struct {
+	mu            sync.Mutex
+	conversations int
+	seeded        [][]string
+	chats         [][]string
+	variables     []map[string]string
+	outputs       map[string]string
+	cancelled     []string
+}
+
+func (f *fakeCoze) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body struct {
+		Messages           []struct{ Content string } `json:"messages"`
+		AdditionalMessages []struct{ Content string } `json:"additional_messages"`
+		CustomVariables    map[string]string          `json:"custom_variables"`
+		ToolOutputs        []struct {
+			ToolCallID string `json:"tool_call_id"`
+			Output     string `json:"output"`
+		} `json:"tool_outputs"`
+		ChatID string `json:"chat_id"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.URL.Path {
+	case "/v1/conversation/create":
+		w.Header().Set("Content-Type", "application/json")
+		f.conversations++
+		var seeded []string
+		for _, msg := range body.Messages {
+			seeded = append(seeded, msg.Content)
+		}
+		f.seeded = append(f.seeded, seeded)
+		fmt.Fprintf(w, `{"code":0,"msg":"","data":{"id":"conv_%d"}}`, f.conversations)
+	case "/v3/chat":
+		var contents []string
+		for _, msg := range body.AdditionalMessages {
+			contents = append(contents, msg.Content)
+		}
+		f.chats = append(f.chats, contents)
+		f.variables = append(f.variables, body.CustomVariables)
+		w.Header().Set("Content-Type", "text/event-stream")
+		if last := contents[len(contents)-1]; strings.HasSuffix(last, "放首歌") {
+			fmt.Fprint(w, "event: conversation.chat.requires_action\n"+
+				`data: {"id":"chat_1","conversation_id":"conv_1","status":"requires_action","required_action":{"type":"submit_tool_outputs","submit_tool_outputs":{"tool_calls":[`+
+				`{"id":"call_1","type":"function","function":{"name":"play_music","arguments":"{\"song_name\":\"晴天\"}"}},`+
+				`{"id":"call_2","type":"function","function":{"name":"exit","arguments":""}}]}}}`+"\n\n")
+			fmt.Fprint(w, "event: done\ndata: \"[DONE]\"\n\n")
+			return
+		}
+		writeAnswer(w, "好的")
+	case "/v3/chat/submit_tool_outputs":
+		f.outputs = make(map[string]string)
+		for _, output := range body.ToolOutputs {
+			f.outputs[output.ToolCallID] = output.Output
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		writeAnswer(w, "开始播放")
+	case "/v3/chat/cancel":
+		f.cancelled = append(f.cancelled, body.ChatID)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"code":0,"msg":"","data":{"id":"chat_1","status":"canceled"}}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeAnswer(w http.ResponseWriter, answer string) {
+	fmt.Fprint(w, "event: conversation.chat.created\ndata: {\"id\":\"chat_2\",\"status\":\"created\"}\n\n")
+	for _, r := range answer {
+		fmt.Fprintf(w, "event: conversation.message.delta\ndata: {\"role\":\"assistant\",\"type\":\"answer\",\"content\":%q}\n\n", string(r))
+	}
+	fmt.Fprint(w, "event: conversation.chat.completed\ndata: {\"id\":\"chat_2\",\"status\":\"completed\"}\n\n")
+	fmt.Fprint(w, "event: done\ndata: \"[DONE]\"\n\n")
+}
+
+func TestResponseWithFunctions(t *testing.T) {
+	fake := &fakeCoze{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	provider, err := llm.Create("coze", &llm.Config{
+		Type:    "coze",
+		BaseURL: server.URL,
+		Extra: map[string]interface{}{
+			"bot_id":                 "bot",
+			"user_id":                "user",
+			"personal_access_token":  "token",
+			"system_prompt_variable": "system_prompt",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "play_music"}}}
+
+	dialogue := []types.Message{{Role: "system", Content: "你是小智"}}
+	// send 模拟对话流程：发送对话，把回答或工具调用加入对话
+	send := func(t *testing.T) (string, *types.ToolCall) {
+		t.Helper()
+		responses, err := provider.ResponseWithFunctions(context.Background(), "session", dialogue, tools)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var content strings.Builder
+		var call *types.ToolCall
+		for response := range responses {
+			if response.Error != "" {
+				t.Fatalf("error = %s", response.Error)
+			}
+			content.WriteString(response.Content)
+			if len(response.ToolCalls) > 0 {
+				call = &response.ToolCalls[0]
+			}
+		}
+		if call != nil {
+			dialogue = append(dialogue, types.Message{Role: "assistant", ToolCalls: []types.ToolCall{*call}})
+		} else {
+			dialogue = append(dialogue, types.Message{Role: "assistant", Content: content.String()})
+		}
+		return content.String(), call
+	}
+
+	t.Run("新会话附带工具说明", func(t *testing.T) {
+		dialogue = append(dialogue, types.Message{Role: "user", Content: "你好"})
+		if answer, _ := send(t); answer != "好的" {
+			t.Errorf("answer = %q", answer)
+		}
+		if fake.conversations != 1 || len(fake.chats[0]) != 1 || !strings.Contains(fake.chats[0][0], "<tool_call>") {
+			t.Errorf("conversations = %d, chats = %q", fake.conversations, fake.chats)
+		}
+		if fake.variables[0]["system_prompt"] != "你是小智" {
+			t.Errorf("custom_variables = %v", fake.variables[0])
+		}
+	})
+
+	t.Run("多轮对话只发送新消息", func(t *testing.T) {
+		dialogue = append(dialogue, types.Message{Role: "user", Content: "放首歌"})
+		_, call := send(t)
+		if call == nil || call.ID != "call_1" || call.Function.Name != "play_music" || call.Function.Arguments != `{"song_name":"晴天"}` {
+			t.Fatalf("tool call = %+v", call)
+		}
+		if fake.conversations != 1 || len(fake.chats[1]) != 1 || fake.chats[1][0] != "放首歌" {
+			t.Errorf("conversations = %d, chat = %q", fake.conversations, fake.chats[1])
+		}
+	})
+
+	t.Run("提交工具结果", func(t *testing.T) {
+		dialogue = append(dialogue, types.Message{Role: "tool", ToolCallID: "call_1", Content: "正在播放晴天"})
+		if answer, _ := send(t); answer != "开始播放" {
+			t.Errorf("answer = %q", answer)
+		}
+		if fake.outputs["call_1"] != "正在播放晴天" || fake.outputs["call_2"] != skippedToolOutput {
+			t.Errorf("tool outputs = %v", fake.outputs)
+		}
+	})
+
+	t.Run("切换角色后重建会话", func(t *testing.T) {
+		dialogue[0].Content = "你是英语老师"
+		dialogue = append(dialogue, types.Message{Role: "user", Content: "讲个笑话"})
+		send(t)
+		if fake.conversations != 2 {
+			t.Fatalf("conversations = %d, want 2", fake.conversations)
+		}
+		want := []string{"你好", "好的", "放首歌", "开始播放"}
+		if strings.Join(fake.seeded[1], "|") != strings.Join(want, "|") {
+			t.Errorf("seeded = %q, want %q", fake.seeded[1], want)
+		}
+		if last := fake.chats[len(fake.chats)-1]; len(last) != 1 || !strings.HasSuffix(last[0], "讲个笑话") {
+			t.Errorf("chat = %q", last)
+		}
+		if fake.variables[len(fake.variables)-1]["system_prompt"] != "你是英语老师" {
+			t.Errorf("custom_variables = %v", fake.variables[len(fake.variables)-1])
+		}
+	})
+
+	t.Run("工具执行后直接提问时取消等待的对话", func(t *testing.T) {
+		dialogue = append(dialogue, types.Message{Role: "user", Content: "再放首歌"})
+		if _, call := send(t); call == nil {
+			t.Fatal("没有工具调用")
+		}
+		dialogue = append(dialogue,
+			types.Message{Role: "tool", ToolCallID: "call_1", Content: "正在播放晴天"},
+			types.Message{Role: "user", Content: "声音大一点"},
+		)
+		send(t)
+		if len(fake.cancelled) != 1 || fake.cancelled[0] != "chat_1" {
+			t.Errorf("cancelled = %v", fake.cancelled)
+		}
+		if last := fake.chats[len(fake.chats)-1]; len(last) != 2 || last[1] != "声音大一点" {
+			t.Errorf("chat = %q", last)
+		}
+	})
+
+	t.Run("清空对话后重建会话", func(t *testing.T) {
+		dialogue = []types.Message{{Role: "system", Content: "你是英语老师"}, {Role: "user", Content: "你好"}}
+		send(t)
+		if fake.conversations != 3 || len(fake.seeded[2]) != 0 {
+			t.Errorf("conversations = %d, seeded = %q", fake.conversations, fake.seeded)
+		}
+	})
+
+	t.Run("归还资源池后清空会话", func(t *testing.T) {
+		if err := provider.(*Provider).Reset(); err != nil {
+			t.Fatal(err)
+		}
+		dialogue = append(dialogue, types.Message{Role: "user", Content: "再见"})
+		send(t)
+		if fake.conversations != 4 {
+			t.Errorf("conversations = %d, want 4", fake.conversations)
+		}
+	})
+}
@@ -0,0 +1,373 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+const defaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// unsupportedSchemaKeys Gemini的函数声明不支持的JSON Schema字段
+var unsupportedSchemaKeys = []string{"$schema", "$id", "additionalProperties"}
+
+// Provider Google Gemini generateContent提供者，原生支持函数调用和图片输入
+type Provider struct {
+	*llm.BaseProvider
+	client   *http.Client
+	endpoint string
+}
+
+// 注册提供者
+func init() {
+	llm.Register("gemini", NewProvider)
+}
+
+// NewProvider 创建Gemini提供者
+func NewProvider(config *llm.Config) (llm.Provider, error) {
+	return &Provider{
+		BaseProvider: llm.NewBaseProvider(config),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.APIKey == "" {
+		return fmt.Errorf("missing Gemini API key")
+	}
+	if config.ModelName == "" {
+		return fmt.Errorf("missing Gemini model_name")
+	}
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	p.endpoint = fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse",
+		strings.TrimSuffix(baseURL, "/"), url.PathEscape(config.ModelName))
+	p.client = &http.Client{}
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *Provider) Cleanup() error {
+	return nil
+}
+
+// Response types.LLMProvider接口实现
+func (p *Provider) Response(ctx context.Context, sessionID string, messages []types.Message) (<-chan string, error) {
+	responses, err := p.ResponseWithFunctions(ctx, sessionID, messages, nil)
+	if err != nil {
+		return nil, err
+	}
+	responseChan := make(chan string, 10)
+	go func() {
+		defer close(responseChan)
+		for response := range responses {
+			if response.Content != "" {
+				responseChan <- response.Content
+			}
+		}
+	}()
+	return responseChan, nil
+}
+
+// ResponseWithFunctions types.LLMProvider接口实现
+func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string, messages []types.Message, tools []openai.Tool) (<-chan types.Response, error) {
+	responseChan := make(chan types.Response, 10)
+
+	go func() {
+		defer close(responseChan)
+		if err := p.stream(ctx, messages, tools, responseChan); err != nil {
+			responseChan <- types.Response{
+				Content: fmt.Sprintf("【Gemini服务响应异常: %v】", err),
+				Error:   err.Error(),
+			}
+		}
+	}()
+
+	return responseChan, nil
+}
+
+// stream 发送请求并把流式结果转换为types.Response
+func (p *Provider) stream(ctx context.Context, messages []types.Message, tools []openai.Tool, responseChan chan<- types.Response) error {
+	body, err := json.Marshal(p.buildRequest(ctx, messages, tools))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("x-goog-api-key", p.Config().APIKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var chunk streamChunk
+		if json.Unmarshal(data, &chunk) == nil && chunk.Error != nil {
+			return fmt.Errorf("HTTP %d: %s", resp.StatusCode, chunk.Error.Message)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	// 对话流程每次只处理一个工具调用，只转发第一个functionCall
+	toolCalled := false
+	var filter llm.ThinkFilter
+	err = llm.ReadSSE(resp.Body, func(event string, data string) error {
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("%s: %s", chunk.Error.Status, chunk.Error.Message)
+		}
+		for _, candidate := range chunk.Candidates {
+			for _, part := range candidate.Content.Parts {
+				switch {
+				case part.FunctionCall != nil:
+					if toolCalled {
+						continue
+					}
+					toolCalled = true
+					responseChan <- types.Response{ToolCalls: []types.ToolCall{toolCall(part.FunctionCall)}}
+				case part.Thought:
+					// 思考摘要不朗读
+				case part.Text != "":
+					if content := filter.Write(part.Text); content != "" {
+						responseChan <- types.Response{Content: content}
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if content := filter.Flush(); content != "" {
+		responseChan <- types.Response{Content: content}
+	}
+	return nil
+}
+
+// toolCall Gemini一次返回完整的函数调用，没有ID时生成一个，用于对应之后的函数结果
+func toolCall(call *functionCall) types.ToolCall {
+	id := call.ID
+	if id == "" {
+		id = "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	}
+	arguments := "{}"
+	if len(call.Args) > 0 {
+		if data, err := json.Marshal(call.Args); err == nil {
+			arguments = string(data)
+		}
+	}
+	return types.ToolCall{
+		ID:       id,
+		Type:     "function",
+		Function: types.FunctionCall{Name: call.Name, Arguments: arguments},
+	}
+}
+
+// buildRequest 转换为generateContent请求：system作为systemInstruction，assistant角色为model，函数结果按函数名返回
+func (p *Provider) buildRequest(ctx context.Context, messages []types.Message, tools []openai.Tool) *generateRequest {
+	config := p.Config()
+	request := &generateRequest{}
+	// 角色显式指定的温度包括0都发送，配置中的0视为未设置
+	if temperature, ok := llm.RequestTemperature(ctx); ok || config.Temperature > 0 {
+		if !ok {
+			temperature = config.Temperature
+		}
+		request.GenerationConfig.Temperature = &temperature
+	}
+	if config.TopP > 0 {
+		request.GenerationConfig.TopP = &config.TopP
+	}
+	request.GenerationConfig.MaxOutputTokens = config.MaxTokens
+
+	toolNames := make(map[string]string)
+	var system []part
+	for _, msg := range llm.RecentImages(messages, llm.DefaultMaxImages) {
+		role := "user"
+		var parts []part
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				system = append(system, part{Text: msg.Content})
+			}
+			continue
+		case "assistant":
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, part{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				parts = append(parts, part{FunctionCall: &functionCall{
+					Name: tc.Function.Name,
+					Args: llm.ToolArguments(tc.Function.Arguments),
+				}})
+			}
+		case "tool":
+			parts = append(parts, part{FunctionResponse: &functionResponse{
+				Name:     toolNames[msg.ToolCallID],
+				Response: toolResponse(msg.Content),
+			}})
+		default:
+			for _, image := range msg.Images {
+				parts = append(parts, part{InlineData: &inlineData{
+					MIMEType: llm.ImageMIMEType(image.Format),
+					Data:     image.Data,
+				}})
+			}
+			if msg.Content != "" {
+				parts = append(parts, part{Text: msg.Content})
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		// 连续的同角色消息合并，例如函数结果后紧跟用户消息
+		if n := len(request.Contents); n > 0 && request.Contents[n-1].Role == role {
+			request.Contents[n-1].Parts = append(request.Contents[n-1].Parts, parts...)
+			continue
+		}
+		request.Contents = append(request.Contents, content{Role: role, Parts: parts})
+	}
+	if len(system) > 0 {
+		request.SystemInstruction = &content{Parts: system}
+	}
+
+	var declarations []functionDeclaration
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		declaration := functionDeclaration{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+		}
+		// 没有参数的函数不能声明空的object
+		if schema := cleanSchema(llm.ToolParameters(tool)); schema != nil {
+			if properties, ok := schema["properties"].(map[string]interface{}); !ok || len(properties) > 0 {
+				declaration.Parameters = schema
+			}
+		}
+		declarations = append(declarations, declaration)
+	}
+	if len(declarations) > 0 {
+		request.Tools = []toolSet{{FunctionDeclarations: declarations}}
+	}
+	return request
+}
+
+// toolResponse 函数结果必须是对象，不是JSON对象的结果放在result字段
+func toolResponse(result string) map[string]interface{} {
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &response); err == nil && response != nil {
+		return response
+	}
+	return map[string]interface{}{"result": result}
+}
+
+// cleanSchema 递归删除Gemini不支持的Schema字段
+func cleanSchema(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	for _, key := range unsupportedSchemaKeys {
+		delete(schema, key)
+	}
+	for _, value := range schema {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			cleanSchema(v)
+		case []interface{}:
+			for _, item := range v {
+				if m, ok := item.(map[string]interface{}); ok {
+					cleanSchema(m)
+				}
+			}
+		}
+	}
+	return schema
+}
+
+type generateRequest struct {
+	Contents          []content `json:"contents"`
+	SystemInstruction *content  `json:"systemInstruction,omitempty"`
+	Tools             []toolSet `json:"tools,omitempty"`
+	GenerationConfig  struct {
+		Temperature     *float64 `json:"temperature,omitempty"`
+		TopP            *float64 `json:"topP,omitempty"`
+		MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	} `json:"generationConfig"`
+}
+
+type content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+type part struct {
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+	InlineData       *inlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *functionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *functionResponse `json:"functionResponse,omitempty"`
+}
+
+type inlineData struct {
+	MIMEType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type functionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+type functionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type toolSet struct {
+	FunctionDeclarations []functionDeclaration `json:"functionDeclarations"`
+}
+
+type functionDeclaration struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type streamChunk struct {
+	Candidates []struct {
+		Content      content `json:"content"`
+		FinishReason string  `json:"finishReason"`
+	} `json:"candidates"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
@@ -0,0 +1,195 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"xiaozhi-server-go/src/core/providers/llm"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestResponseWithFunctions(t *testing.T) {
+	tools := []openai.Tool{
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:        "get_weather",
+			Description: "查询天气",
+			Parameters: map[string]interface{}{
+				"$schema":              "http://json-schema.org/draft-07/schema#",
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties":           map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+			},
+		}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{
+			Name:       "exit",
+			Parameters: map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+		}},
+	}
+	messages := []types.Message{
+		{Role: "system", Content: "你是小智"},
+		{Role: "user", Content: "这是什么", Images: []types.ImageRef{{Format: "jpg", Data: "aW1n"}}},
+		{Role: "assistant", Content: "一只猫"},
+		{Role: "user", Content: "北京天气"},
+		{Role: "assistant", ToolCalls: []types.ToolCall{{ID: "call_1", Type: "function", Function: types.FunctionCall{Name: "get_weather", Arguments: `{"city":"北京"}`}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "晴"},
+	}
+
+	tests := []struct {
+		name        string
+		chunks      []string
+		wantContent string
+		wantTool    string
+		wantArgs    string
+		wantErr     bool
+	}{
+		{
+			name: "文字回复过滤思考内容",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"先想想","thought":true}]}}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"<think>内部</th"}]}}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"ink>北京今天"}]}}]}`,
+				`{"candidates":[{"content":{"role":"model","parts":[{"text":"晴"}]},"finishReason":"STOP"}]}`,
+			},
+			wantContent: "北京今天晴",
+		},
+		{
+			name: "函数调用",
+			chunks: []string{
+				`{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"get_weather","args":{"city":"上海"}}},{"functionCall":{"name":"exit","args":{}}}]}}]}`,
+			},
+			wantTool: "get_weather",
+			wantArgs: `{"city":"上海"}`,
+		},
+		{
+			name: "流中的错误",
+			chunks: []string{
+				`{"error":{"code":429,"message":"Resource has been exhausted","status":"RESOURCE_EXHAUSTED"}}`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1beta/models/gemini-test:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+					t.Errorf("请求地址 = %s", r.URL)
+				}
+				if r.Header.Get("x-goog-api-key") != "test-key" {
+					t.Errorf("缺少API key")
+				}
+				var req generateRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Error(err)
+					return
+				}
+				if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "你是小智" {
+					t.Errorf("systemInstruction = %+v", req.SystemInstruction)
+				}
+				if len(req.Contents) != 5 {
+					t.Errorf("len(contents) = %d, want 5", len(req.Contents))
+					return
+				}
+				if image := req.Contents[0].Parts[0].InlineData; image == nil || image.MIMEType != "image/jpeg" {
+					t.Errorf("图片 = %+v", req.Contents[0].Parts[0])
+				}
+				if req.Contents[3].Role != "model" || req.Contents[3].Parts[0].FunctionCall.Args["city"] != "北京" {
+					t.Errorf("函数调用 = %+v", req.Contents[3])
+				}
+				if response := req.Contents[4].Parts[0].FunctionResponse; response == nil || response.Name != "get_weather" || response.Response["result"] != "晴" {
+					t.Errorf("函数结果 = %+v", req.Contents[4].Parts[0])
+				}
+				declarations := req.Tools[0].FunctionDeclarations
+				if len(declarations) != 2 || declarations[1].Parameters != nil {
+					t.Errorf("functionDeclarations = %+v", declarations)
+					return
+				}
+				if _, ok := declarations[0].Parameters["additionalProperties"]; ok {
+					t.Errorf("未删除不支持的字段: %+v", declarations[0].Parameters)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, chunk := range tt.chunks {
+					fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+				}
+			}))
+			defer server.Close()
+
+			provider, err := llm.Create("gemini", &llm.Config{
+				Type:      "gemini",
+				ModelName: "gemini-test",
+				BaseURL:   server.URL + "/v1beta",
+				APIKey:    "test-key",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			responses, err := provider.ResponseWithFunctions(context.Background(), "s1", messages, tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var content strings.Builder
+			var calls []types.ToolCall
+			errMsg := ""
+			for response := range responses {
+				content.WriteString(response.Content)
+				calls = append(calls, response.ToolCalls...)
+				if response.Error != "" {
+					errMsg = response.Error
+				}
+			}
+			if tt.wantErr {
+				if !strings.Contains(errMsg, "RESOURCE_EXHAUSTED") {
+					t.Errorf("error = %q", errMsg)
+				}
+				return
+			}
+			if content.String() != tt.wantContent {
+				t.Errorf("content = %q, want %q", content.String(), tt.wantContent)
+			}
+			if tt.wantTool == "" {
+				if len(calls) != 0 {
+					t.Errorf("tool calls = %+v", calls)
+				}
+				return
+			}
+			if len(calls) != 1 || calls[0].ID == "" || calls[0].Function.Name != tt.wantTool || calls[0].Function.Arguments != tt.wantArgs {
+				t.Errorf("tool calls = %+v", calls)
+			}
+		})
+	}
+}
+
+func TestBuildRequestTemperature(t *testing.T) {
+	tests := []struct {
+		name   string
+		config float64
+		ctx    context.Context
+		want   *float64
+	}{
+		{name: "未设置温度", ctx: context.Background()},
+		{name: "使用配置的温度", config: 0.7, ctx: context.Background(), want: ptr(0.7)},
+		{name: "角色指定温度0", config: 0.7, ctx: llm.WithTemperature(context.Background(), 0), want: ptr(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := llm.Create("gemini", &llm.Config{Type: "gemini", ModelName: "gemini-test", APIKey: "test-key", Temperature: tt.config})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := provider.(*Provider).buildRequest(tt.ctx, nil, nil).GenerationConfig.Temperature
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("temperature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
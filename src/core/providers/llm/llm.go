@@ -1,7 +1,9 @@
 package llm
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"xiaozhi-server-go/src/core/types"
 )
 
@@ -59,6 +61,35 @@ func (p *BaseProvider) SetIdentityFlag(idType string, flag string) {
 	// 默认实现，子类可以覆盖
 }
 
+type temperatureKey struct{}
+
+// WithTemperature 为本次请求指定温度，用于角色覆盖LLM配置中的温度
+func WithTemperature(ctx context.Context, temperature float64) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, temperature)
+}
+
+// Temperature 获取本次请求的温度，没有指定时返回fallback
+func Temperature(ctx context.Context, fallback float64) float64 {
+	if t, ok := RequestTemperature(ctx); ok {
+		return t
+	}
+	return fallback
+}
+
+// RequestTemperature 获取本次请求显式指定的温度，包括0
+func RequestTemperature(ctx context.Context) (float64, bool) {
+	t, ok := ctx.Value(temperatureKey{}).(float64)
+	return t, ok
+}
+
+// OpenAITemperature 获取go-openai请求的温度；go-openai会省略为0的温度，显式指定0时用最小正数代替
+func OpenAITemperature(ctx context.Context, fallback float64) float32 {
+	if t, ok := RequestTemperature(ctx); ok && t == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return float32(Temperature(ctx, fallback))
+}
+
 // Factory LLM工厂函数类型
 type Factory func(config *Config) (Provider, error)
 
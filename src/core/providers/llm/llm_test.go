@@ -0,0 +1,28 @@
+package llm
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestOpenAITemperature(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		fallback float64
+		want     float32
+	}{
+		{name: "使用LLM配置", ctx: context.Background(), fallback: 0.7, want: 0.7},
+		{name: "LLM未配置时省略", ctx: context.Background(), want: 0},
+		{name: "角色覆盖温度", ctx: WithTemperature(context.Background(), 1.2), fallback: 0.7, want: 1.2},
+		{name: "角色显式指定0", ctx: WithTemperature(context.Background(), 0), fallback: 0.7, want: math.SmallestNonzeroFloat32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OpenAITemperature(tt.ctx, tt.fallback); got != tt.want {
+				t.Errorf("temperature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"xiaozhi-server-go/src/core/types"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 原生接口（非OpenAI兼容）的提供者共用的流式解析和消息转换
+
+const (
+	thinkOpenTag  = "<think>"
+	thinkCloseTag = "</think>"
+
+	// DefaultMaxImages 随对话发送的最近图片数
+	DefaultMaxImages = 3
+)
+
+// ReadSSE 逐个读取Server-Sent Events事件，handle返回错误时停止
+func ReadSSE(r io.Reader, handle func(event string, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	event := ""
+	var data []string
+	dispatch := func() error {
+		defer func() { event, data = "", nil }()
+		if len(data) == 0 {
+			return nil
+		}
+		return handle(event, strings.Join(data, "\n"))
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// 注释行，用于保持连接
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// ThinkFilter 过滤流式回复中的<think>...</think>，标签可以被拆在多个分片中
+type ThinkFilter struct {
+	thinking bool
+	pending  string
+}
+
+// Write 输入一个分片，返回可以输出的文字
+func (f *ThinkFilter) Write(chunk string) string {
+	f.pending += chunk
+	var out strings.Builder
+	for {
+		if f.thinking {
+			if idx := strings.Index(f.pending, thinkCloseTag); idx >= 0 {
+				f.pending = f.pending[idx+len(thinkCloseTag):]
+				f.thinking = false
+				continue
+			}
+			// 思考内容直接丢弃，只保留可能是结束标签开头的部分
+			f.pending = f.pending[len(f.pending)-partialTagLen(f.pending, thinkCloseTag):]
+			return out.String()
+		}
+		if idx := strings.Index(f.pending, thinkOpenTag); idx >= 0 {
+			out.WriteString(f.pending[:idx])
+			f.pending = f.pending[idx+len(thinkOpenTag):]
+			f.thinking = true
+			continue
+		}
+		keep := partialTagLen(f.pending, thinkOpenTag)
+		out.WriteString(f.pending[:len(f.pending)-keep])
+		f.pending = f.pending[len(f.pending)-keep:]
+		return out.String()
+	}
+}
+
+// Flush 回复结束时输出残留的文字
+func (f *ThinkFilter) Flush() string {
+	if f.thinking {
+		return ""
+	}
+	rest := f.pending
+	f.pending = ""
+	return rest
+}
+
+// partialTagLen s末尾与tag开头相同的最大长度
+func partialTagLen(s string, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// RecentImages 只保留最近maxImages张有数据的图片，其余消息的图片清空
+func RecentImages(messages []types.Message, maxImages int) []types.Message {
+	result := make([]types.Message, len(messages))
+	copy(result, messages)
+	remaining := maxImages
+	for i := len(result) - 1; i >= 0; i-- {
+		if len(result[i].Images) == 0 {
+			continue
+		}
+		var images []types.ImageRef
+		for j := len(result[i].Images) - 1; j >= 0 && remaining > 0; j-- {
+			if result[i].Images[j].Data != "" {
+				images = append([]types.ImageRef{result[i].Images[j]}, images...)
+				remaining--
+			}
+		}
+		result[i].Images = images
+	}
+	return result
+}
+
+// ImageMIMEType 图片格式对应的MIME类型
+func ImageMIMEType(format string) string {
+	switch strings.ToLower(format) {
+	case "", "jpg", "jpeg":
+		return "image/jpeg"
+	default:
+		return "image/" + strings.ToLower(format)
+	}
+}
+
+// ToolParameters 工具参数的JSON Schema，没有参数时返回nil
+func ToolParameters(tool openai.Tool) map[string]interface{} {
+	if tool.Function == nil || tool.Function.Parameters == nil {
+		return nil
+	}
+	raw, err := json.Marshal(tool.Function.Parameters)
+	if err != nil {
+		return nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil || len(schema) == 0 {
+		return nil
+	}
+	return schema
+}
+
+// ToolArguments 把工具调用的参数字符串解析为对象，解析失败时返回空对象
+func ToolArguments(arguments string) map[string]interface{} {
+	args := map[string]interface{}{}
+	if strings.TrimSpace(arguments) != "" {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+	return args
+}
@@ -93,9 +93,10 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:    p.modelName,
-				Messages: chatMessages,
-				Stream:   true,
+				Model:       p.modelName,
+				Messages:    chatMessages,
+				Stream:      true,
+				Temperature: llm.OpenAITemperature(ctx, p.Config().Temperature),
 			},
 		)
 		if err != nil {
@@ -182,10 +183,11 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:    p.modelName,
-				Messages: chatMessages,
-				Tools:    tools,
-				Stream:   true,
+				Model:       p.modelName,
+				Messages:    chatMessages,
+				Tools:       tools,
+				Stream:      true,
+				Temperature: llm.OpenAITemperature(ctx, p.Config().Temperature),
 			},
 		)
 		if err != nil {
@@ -221,6 +223,9 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 								Arguments: tc.Function.Arguments,
 							},
 						}
+						if tc.Index != nil {
+							toolCalls[i].Index = *tc.Index
+						}
 					}
 					responseChan <- types.Response{
 						ToolCalls: toolCalls,
@@ -75,10 +75,11 @@ func (p *Provider) Response(ctx context.Context, sessionID string, messages []ty
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:     p.Config().ModelName,
-				Messages:  chatMessages,
-				Stream:    true,
-				MaxTokens: p.maxTokens,
+				Model:       p.Config().ModelName,
+				Messages:    chatMessages,
+				Stream:      true,
+				MaxTokens:   p.maxTokens,
+				Temperature: llm.OpenAITemperature(ctx, p.Config().Temperature),
 			},
 		)
 		if err != nil {
@@ -151,10 +152,11 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 		stream, err := p.client.CreateChatCompletionStream(
 			ctx,
 			openai.ChatCompletionRequest{
-				Model:    p.Config().ModelName,
-				Messages: chatMessages,
-				Tools:    tools,
-				Stream:   true,
+				Model:       p.Config().ModelName,
+				Messages:    chatMessages,
+				Tools:       tools,
+				Stream:      true,
+				Temperature: llm.OpenAITemperature(ctx, p.Config().Temperature),
 			},
 		)
 		if err != nil {
@@ -190,6 +192,9 @@ func (p *Provider) ResponseWithFunctions(ctx context.Context, sessionID string,
 								Arguments: tc.Function.Arguments,
 							},
 						}
+						if tc.Index != nil {
+							toolCalls[i].Index = *tc.Index
+						}
 					}
 					chunk.ToolCalls = toolCalls
 				}
@@ -0,0 +1,133 @@
+package httpocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/core/providers/ocr"
+)
+
+const (
+	defaultImageField = "image"
+	defaultTextPath   = "text"
+	// maxResponseSize 识别结果的最大字节数
+	maxResponseSize = 4 * 1024 * 1024
+)
+
+// Provider 本地HTTP OCR服务（如Umi-OCR、PaddleOCR serving）的提供者
+// 请求为JSON，base64图片放在image_field字段，额外配置原样放入请求；从响应的text_path取出文字
+type Provider struct {
+	*ocr.BaseProvider
+	httpClient *http.Client
+}
+
+// 注册提供者
+func init() {
+	ocr.Register("http", NewProvider)
+}
+
+// NewProvider 创建HTTP OCR提供者
+func NewProvider(config *ocr.Config) (ocr.Provider, error) {
+	return &Provider{
+		BaseProvider: ocr.NewBaseProvider(config),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	if p.Config().BaseURL == "" {
+		return fmt.Errorf("missing ocr url")
+	}
+	p.httpClient = &http.Client{Timeout: p.Timeout()}
+	return nil
+}
+
+// Recognize 调用OCR服务识别文字
+func (p *Provider) Recognize(ctx context.Context, img *ocr.Image) (string, error) {
+	config := p.Config()
+	field := config.ImageField
+	if field == "" {
+		field = defaultImageField
+	}
+	payload := make(map[string]interface{}, len(config.Extra)+1)
+	for k, v := range config.Extra {
+		payload[k] = v
+	}
+	payload[field] = base64.StdEncoding.EncodeToString(img.Data)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.BaseURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求OCR服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("读取OCR响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OCR服务返回错误(HTTP %d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	// 纯文本响应直接作为结果
+	if !strings.Contains(resp.Header.Get("Content-Type"), "json") && !json.Valid(respBody) {
+		return string(respBody), nil
+	}
+	var result interface{}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("解析OCR响应失败: %v", err)
+	}
+	path := config.TextPath
+	if path == "" {
+		path = defaultTextPath
+	}
+	return strings.Join(TextAt(result, path), "\n"), nil
+}
+
+// TextAt 按点分隔的路径取出所有文字，路径经过数组时取每个元素，如data.text
+func TextAt(value interface{}, path string) []string {
+	if path == "" {
+		switch v := value.(type) {
+		case string:
+			return []string{v}
+		case []interface{}:
+			var texts []string
+			for _, item := range v {
+				texts = append(texts, TextAt(item, "")...)
+			}
+			return texts
+		}
+		return nil
+	}
+
+	key, rest, _ := strings.Cut(path, ".")
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return TextAt(v[key], rest)
+	case []interface{}:
+		var texts []string
+		for _, item := range v {
+			texts = append(texts, TextAt(item, path)...)
+		}
+		return texts
+	}
+	return nil
+}
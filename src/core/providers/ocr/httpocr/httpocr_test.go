@@ -0,0 +1,68 @@
+package httpocr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"xiaozhi-server-go/src/core/providers/ocr"
+)
+
+func TestTextAt(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		path string
+		want []string
+	}{
+		{"顶层字段", `{"text":"宫保鸡丁 38元"}`, "text", []string{"宫保鸡丁 38元"}},
+		{"Umi-OCR", `{"code":100,"data":[{"text":"第一行","score":0.99},{"text":"第二行"}]}`, "data.text", []string{"第一行", "第二行"}},
+		{"PaddleOCR", `{"results":[{"data":[{"text":"每日三次"},{"text":"每次一片"}]}]}`, "results.data.text", []string{"每日三次", "每次一片"}},
+		{"字符串数组", `{"lines":["a","b"]}`, "lines", []string{"a", "b"}},
+		{"路径不存在", `{"data":{"text":1}}`, "data.text", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.body), &value); err != nil {
+				t.Fatal(err)
+			}
+			if got := TextAt(value, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TextAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecognize(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"code":100,"data":[{"text":"第一行"},{"text":"第二行"}]}`))
+	}))
+	defer server.Close()
+
+	provider, err := ocr.Create("http", &ocr.Config{
+		BaseURL:    server.URL,
+		ImageField: "base64",
+		TextPath:   "data.text",
+		Extra:      map[string]interface{}{"options": map[string]interface{}{"data.format": "text"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := provider.Recognize(context.Background(), &ocr.Image{Data: []byte("img"), Format: "png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "第一行\n第二行" {
+		t.Errorf("Recognize() = %q", text)
+	}
+	if got["base64"] != "aW1n" || got["options"] == nil {
+		t.Errorf("request = %v, want base64 image and extra options", got)
+	}
+}
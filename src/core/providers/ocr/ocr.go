@@ -0,0 +1,102 @@
+package ocr
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// defaultTimeout 识别一张图片的默认超时
+const defaultTimeout = 60 * time.Second
+
+// Config OCR配置结构
+type Config struct {
+	Name       string
+	Type       string
+	ModelName  string
+	BaseURL    string
+	APIKey     string
+	Prompt     string
+	ImageField string
+	TextPath   string
+	Timeout    int
+	Extra      map[string]interface{}
+}
+
+// Image 待识别的图片
+type Image struct {
+	Data   []byte // 图片内容
+	Format string // jpeg、png等
+}
+
+// Provider OCR提供者接口
+type Provider interface {
+	Initialize() error
+	Cleanup() error
+	// Recognize 识别图片中的文字，按原有排版返回
+	Recognize(ctx context.Context, img *Image) (string, error)
+}
+
+// BaseProvider OCR基础实现
+type BaseProvider struct {
+	config *Config
+}
+
+// NewBaseProvider 创建OCR基础提供者
+func NewBaseProvider(config *Config) *BaseProvider {
+	return &BaseProvider{
+		config: config,
+	}
+}
+
+// Config 获取配置
+func (p *BaseProvider) Config() *Config {
+	return p.config
+}
+
+// Timeout 单次识别的超时
+func (p *BaseProvider) Timeout() time.Duration {
+	if p.config.Timeout > 0 {
+		return time.Duration(p.config.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
+
+// Initialize 初始化提供者
+func (p *BaseProvider) Initialize() error {
+	return nil
+}
+
+// Cleanup 清理资源
+func (p *BaseProvider) Cleanup() error {
+	return nil
+}
+
+// Factory OCR工厂函数类型
+type Factory func(config *Config) (Provider, error)
+
+var factories = make(map[string]Factory)
+
+// Register 注册OCR提供者工厂
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Create 创建OCR提供者实例
+func Create(name string, config *Config) (Provider, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的OCR提供者: %s", name)
+	}
+
+	provider, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("创建OCR提供者失败: %v", err)
+	}
+
+	if err := provider.Initialize(); err != nil {
+		return nil, fmt.Errorf("初始化OCR提供者失败: %v", err)
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,86 @@
+package openai
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"xiaozhi-server-go/src/core/providers/ocr"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultPrompt 只要求输出文字，避免模型自行解释
+const defaultPrompt = "请识别图片中的所有文字，按原有的排版和阅读顺序输出，不要翻译、总结或解释。表格按行输出，看不清的字用□代替。"
+
+// Provider OpenAI chat/completions兼容的OCR提供者，适用于qwen-vl-ocr等文字识别模型
+type Provider struct {
+	*ocr.BaseProvider
+	client *openai.Client
+}
+
+// 注册提供者
+func init() {
+	ocr.Register("openai", NewProvider)
+}
+
+// NewProvider 创建OpenAI兼容的OCR提供者
+func NewProvider(config *ocr.Config) (ocr.Provider, error) {
+	return &Provider{
+		BaseProvider: ocr.NewBaseProvider(config),
+	}, nil
+}
+
+// Initialize 初始化提供者
+func (p *Provider) Initialize() error {
+	config := p.Config()
+	if config.ModelName == "" {
+		return fmt.Errorf("missing ocr model_name")
+	}
+	clientConfig := openai.DefaultConfig(config.APIKey)
+	if config.BaseURL != "" {
+		clientConfig.BaseURL = config.BaseURL
+	}
+	p.client = openai.NewClientWithConfig(clientConfig)
+	return nil
+}
+
+// Recognize 把图片和识别提示词发给模型，返回模型输出的文字
+func (p *Provider) Recognize(ctx context.Context, img *ocr.Image) (string, error) {
+	config := p.Config()
+	prompt := config.Prompt
+	if prompt == "" {
+		prompt = defaultPrompt
+	}
+	format := strings.ToLower(img.Format)
+	if format == "" || format == "jpg" {
+		format = "jpeg"
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: config.ModelName,
+		Messages: []openai.ChatCompletionMessage{{
+			Role: openai.ChatMessageRoleUser,
+			MultiContent: []openai.ChatMessagePart{
+				{
+					Type: openai.ChatMessagePartTypeImageURL,
+					ImageURL: &openai.ChatMessageImageURL{
+						URL: fmt.Sprintf("data:image/%s;base64,%s", format, base64.StdEncoding.EncodeToString(img.Data)),
+					},
+				},
+				{
+					Type: openai.ChatMessagePartTypeText,
+					Text: prompt,
+				},
+			},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("请求OCR模型失败: %v", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("OCR模型返回为空")
+	}
+	return resp.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,136 @@
+package ocr
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// defaultSecurity 未配置security时的图片限制，与VLLLM示例配置一致
+var defaultSecurity = configs.SecurityConfig{
+	MaxFileSize:    10 * 1024 * 1024,
+	MaxPixels:      16 * 1024 * 1024,
+	MaxWidth:       4096,
+	MaxHeight:      4096,
+	AllowedFormats: []string{"jpeg", "jpg", "png", "webp", "gif"},
+	EnableDeepScan: true,
+}
+
+// Recognizer 文档模式：校验图片、判断是否按文档识别，并调用OCR提供者识别文字
+type Recognizer struct {
+	name      string
+	provider  Provider
+	processor *image.ImageProcessor
+	logger    *utils.Logger
+}
+
+var defaultRecognizer atomic.Pointer[Recognizer]
+
+// SetDefault 设置全局的文字识别器
+func SetDefault(r *Recognizer) {
+	defaultRecognizer.Store(r)
+}
+
+// Default 全局的文字识别器，未配置OCR时为nil
+func Default() *Recognizer {
+	return defaultRecognizer.Load()
+}
+
+// NewRecognizer 按selected_module.OCR创建识别器，未选择时返回nil
+func NewRecognizer(config *configs.Config, logger *utils.Logger) (*Recognizer, error) {
+	name := config.SelectedModule["OCR"]
+	if name == "" {
+		return nil, nil
+	}
+	cfg, ok := config.OCR[name]
+	if !ok {
+		return nil, fmt.Errorf("未找到OCR.%s的配置", name)
+	}
+	provider, err := Create(cfg.Type, &Config{
+		Name:       name,
+		Type:       cfg.Type,
+		ModelName:  cfg.ModelName,
+		BaseURL:    cfg.BaseURL,
+		APIKey:     cfg.APIKey,
+		Prompt:     cfg.Prompt,
+		ImageField: cfg.ImageField,
+		TextPath:   cfg.TextPath,
+		Timeout:    cfg.Timeout,
+		Extra:      cfg.Extra,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	security := cfg.Security
+	if security.MaxFileSize <= 0 {
+		security = defaultSecurity
+	}
+	processor, err := image.NewImageProcessor(&configs.VLLMConfig{Security: security}, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &Recognizer{
+		name:      name,
+		provider:  provider,
+		processor: processor,
+		logger:    logger,
+	}, nil
+}
+
+// Name 使用的OCR配置名
+func (r *Recognizer) Name() string {
+	return r.name
+}
+
+// Prepare 下载并校验图片，返回base64数据
+func (r *Recognizer) Prepare(ctx context.Context, imageData image.ImageData) (image.ImageData, error) {
+	data, err := r.processor.ProcessImage(ctx, imageData)
+	if err != nil {
+		return image.ImageData{}, fmt.Errorf("图片处理失败: %v", err)
+	}
+	return image.ImageData{Data: data, Format: imageData.Format}, nil
+}
+
+// DetectMode 判断是否按文档识别，imageData需要已经过Prepare
+func (r *Recognizer) DetectMode(mode string, question string, imageData image.ImageData) string {
+	return r.processor.DetectMode(mode, question, imageData)
+}
+
+// Recognize 识别图片中的文字，imageData需要已经过Prepare
+func (r *Recognizer) Recognize(ctx context.Context, imageData image.ImageData) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(imageData.Data)
+	if err != nil {
+		return "", fmt.Errorf("图片base64解码失败: %v", err)
+	}
+	timeout := defaultTimeout
+	if p, ok := r.provider.(interface{ Timeout() time.Duration }); ok {
+		timeout = p.Timeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	text, err := r.provider.Recognize(ctx, &Image{Data: data, Format: imageData.Format})
+	if err != nil {
+		return "", err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", fmt.Errorf("图片中没有识别到文字")
+	}
+	r.logger.Info("识别文字完成: %d字, 耗时%v", len([]rune(text)), time.Since(start))
+	return text, nil
+}
+
+// DocumentPrompt 把用户原来的问题和识别出的文字组合成给LLM的消息
+func DocumentPrompt(question string, text string) string {
+	return fmt.Sprintf("%s\n\n以下是图片中识别出的文字，请按上面的要求朗读、翻译或讲解：\n%s", question, text)
+}
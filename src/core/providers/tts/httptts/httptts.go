@@ -0,0 +1,182 @@
+package httptts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const (
+	// methodForm 以表单方式POST，如CosyVoice的FastAPI服务
+	methodForm = "FORM"
+
+	defaultTextField  = "text"
+	defaultVoiceField = "voice"
+	defaultSampleRate = 24000
+	defaultTimeout    = 60 * time.Second
+	// maxAudioSize 合成音频的最大字节数
+	maxAudioSize = 32 * 1024 * 1024
+)
+
+// Provider 本地HTTP语音合成服务（如Piper、CosyVoice、GPT-SoVITS、OpenAI /v1/audio/speech）的提供者
+// POST请求为JSON，FORM为POST表单，GET放在查询参数；文本放在text_field，音色放在voice_field，额外配置原样放入请求
+// 返回wav或mp3时直接保存，format为pcm时按sample_rate加上wav头
+type Provider struct {
+	*tts.BaseProvider
+	httpClient *http.Client
+}
+
+// NewProvider 创建HTTP TTS提供者
+func NewProvider(config *tts.Config, deleteFile bool) (*Provider, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("missing tts url")
+	}
+	method := strings.ToUpper(config.Method)
+	if method != "" && method != http.MethodGet && method != http.MethodPost && method != methodForm {
+		return nil, fmt.Errorf("不支持的请求方法: %s", config.Method)
+	}
+	timeout := defaultTimeout
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	return &Provider{
+		BaseProvider: tts.NewBaseProvider(config, deleteFile),
+		httpClient:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// ToTTS 调用合成服务，把音频保存到输出目录并返回文件路径
+func (p *Provider) ToTTS(text string) (string, error) {
+	req, err := p.newRequest(text)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求TTS服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAudioSize))
+	if err != nil {
+		return "", fmt.Errorf("读取TTS响应失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("TTS服务返回错误(HTTP %d): %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	ext, data, err := p.audioData(data)
+	if err != nil {
+		return "", err
+	}
+	outputDir := p.Config().OutputDir
+	if outputDir == "" {
+		outputDir = "tmp"
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("创建输出目录失败: %v", err)
+	}
+	tempFile := filepath.Join(outputDir, fmt.Sprintf("http_tts_%d.%s", time.Now().UnixNano(), ext))
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return "", fmt.Errorf("写入音频文件失败: %v", err)
+	}
+	return tempFile, nil
+}
+
+// newRequest 按配置构造合成请求
+func (p *Provider) newRequest(text string) (*http.Request, error) {
+	config := p.Config()
+	textField := config.TextField
+	if textField == "" {
+		textField = defaultTextField
+	}
+	voiceField := config.VoiceField
+	if voiceField == "" {
+		voiceField = defaultVoiceField
+	}
+	params := make(map[string]interface{}, len(config.Extra)+2)
+	for k, v := range config.Extra {
+		params[k] = v
+	}
+	params[textField] = text
+	if config.Voice != "" {
+		params[voiceField] = config.Voice
+	}
+
+	var req *http.Request
+	switch strings.ToUpper(config.Method) {
+	case http.MethodGet:
+		u, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("无效的TTS地址: %v", err)
+		}
+		query := u.Query()
+		for k, v := range params {
+			query.Set(k, fmt.Sprint(v))
+		}
+		u.RawQuery = query.Encode()
+		if req, err = http.NewRequest(http.MethodGet, u.String(), nil); err != nil {
+			return nil, err
+		}
+	case methodForm:
+		form := url.Values{}
+		for k, v := range params {
+			form.Set(k, fmt.Sprint(v))
+		}
+		var err error
+		if req, err = http.NewRequest(http.MethodPost, config.URL, strings.NewReader(form.Encode())); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		body, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		if req, err = http.NewRequest(http.MethodPost, config.URL, bytes.NewReader(body)); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Token)
+	}
+	return req, nil
+}
+
+// audioData 返回音频文件的扩展名和内容，pcm加上wav头，其他格式按文件头识别
+func (p *Provider) audioData(data []byte) (string, []byte, error) {
+	config := p.Config()
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("TTS服务返回的音频为空")
+	}
+	if strings.ToLower(config.Format) == "pcm" {
+		sampleRate := config.SampleRate
+		if sampleRate <= 0 {
+			sampleRate = defaultSampleRate
+		}
+		return "wav", utils.WavBytes(data, sampleRate), nil
+	}
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return "wav", data, nil
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return "mp3", data, nil
+	}
+	return "", nil, fmt.Errorf("TTS服务返回的不是wav或mp3音频: %s", strings.TrimSpace(string(data[:min(len(data), 200)])))
+}
+
+func init() {
+	tts.Register("http", func(config *tts.Config, deleteFile bool) (tts.Provider, error) {
+		return NewProvider(config, deleteFile)
+	})
+}
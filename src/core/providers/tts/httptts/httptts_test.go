@@ -0,0 +1,153 @@
+package httptts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+func TestToTTS(t *testing.T) {
+	wav := utils.WavBytes([]byte{1, 0, 2, 0}, 22050)
+	mp3 := []byte("ID3\x03\x00\x00\x00\x00\x00\x00")
+
+	tests := []struct {
+		name     string
+		config   tts.Config
+		check    func(t *testing.T, r *http.Request)
+		response []byte
+		status   int
+		wantExt  string
+		wantRate int
+		wantErr  string
+	}{
+		{
+			name:   "Piper POST返回wav",
+			config: tts.Config{Voice: "zh_CN-huayan-medium"},
+			check: func(t *testing.T, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				if r.Method != http.MethodPost || body["text"] != "你好" || body["voice"] != "zh_CN-huayan-medium" {
+					t.Errorf("method = %s, body = %v", r.Method, body)
+				}
+			},
+			response: wav,
+			wantExt:  ".wav",
+			wantRate: 22050,
+		},
+		{
+			name: "CosyVoice表单返回pcm",
+			config: tts.Config{
+				Method: "form", TextField: "tts_text", VoiceField: "spk_id", Voice: "中文女",
+				Format: "pcm", SampleRate: 22050, Extra: map[string]interface{}{"speed": 1.2},
+			},
+			check: func(t *testing.T, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				if r.Method != http.MethodPost || r.PostForm.Get("tts_text") != "你好" || r.PostForm.Get("spk_id") != "中文女" || r.PostForm.Get("speed") != "1.2" {
+					t.Errorf("method = %s, form = %v", r.Method, r.PostForm)
+				}
+			},
+			response: []byte{1, 0, 2, 0, 3, 0},
+			wantExt:  ".wav",
+			wantRate: 22050,
+		},
+		{
+			name: "OpenAI speech返回mp3",
+			config: tts.Config{
+				TextField: "input", Voice: "alloy", Token: "sk-test",
+				Extra: map[string]interface{}{"model": "tts-1", "response_format": "mp3"},
+			},
+			check: func(t *testing.T, r *http.Request) {
+				var body map[string]interface{}
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+				if r.Header.Get("Authorization") != "Bearer sk-test" || body["input"] != "你好" || body["model"] != "tts-1" {
+					t.Errorf("header = %v, body = %v", r.Header, body)
+				}
+			},
+			response: mp3,
+			wantExt:  ".mp3",
+		},
+		{
+			name:   "GPT-SoVITS GET查询参数",
+			config: tts.Config{Method: "GET", VoiceField: "ref_audio_path", Voice: "ref.wav", Extra: map[string]interface{}{"text_lang": "zh"}},
+			check: func(t *testing.T, r *http.Request) {
+				query := r.URL.Query()
+				if r.Method != http.MethodGet || query.Get("text") != "你好" || query.Get("ref_audio_path") != "ref.wav" || query.Get("text_lang") != "zh" {
+					t.Errorf("method = %s, query = %v", r.Method, query)
+				}
+			},
+			response: wav,
+			wantExt:  ".wav",
+			wantRate: 22050,
+		},
+		{
+			name:     "服务返回错误",
+			response: []byte(`{"detail":"voice not found"}`),
+			status:   http.StatusBadRequest,
+			wantErr:  "voice not found",
+		},
+		{
+			name:     "返回的不是音频",
+			response: []byte(`{"error":"busy"}`),
+			wantErr:  "busy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.check != nil {
+					tt.check(t, r)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				w.Write(tt.response)
+			}))
+			defer server.Close()
+
+			config := tt.config
+			config.Type = "http"
+			config.URL = server.URL
+			config.OutputDir = t.TempDir()
+			provider, err := tts.Create("http", &config, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, err := provider.ToTTS("你好")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Ext(path) != tt.wantExt {
+				t.Errorf("path = %s, want %s", path, tt.wantExt)
+			}
+			if tt.wantExt != ".wav" {
+				return
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, sampleRate, err := utils.ReadWavPCM(path); err != nil || sampleRate != tt.wantRate || len(data) <= 44 {
+				t.Errorf("sampleRate = %d, err = %v", sampleRate, err)
+			}
+		})
+	}
+}
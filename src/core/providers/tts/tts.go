@@ -11,16 +11,22 @@ import (
 
 // Config TTS配置结构
 type Config struct {
-	Name            string              `yaml:"name"` // TTS提供者名称
-	Type            string              `yaml:"type"`
-	OutputDir       string              `yaml:"output_dir"`
-	Voice           string              `yaml:"voice,omitempty"`
-	Format          string              `yaml:"format,omitempty"`
-	SampleRate      int                 `yaml:"sample_rate,omitempty"`
-	AppID           string              `yaml:"appid"`
-	Token           string              `yaml:"token"`
-	Cluster         string              `yaml:"cluster"`
-	SupportedVoices []configs.VoiceInfo `yaml:"supported_voices"` // 支持的语音列表
+	Name            string                 `yaml:"name"` // TTS提供者名称
+	Type            string                 `yaml:"type"`
+	OutputDir       string                 `yaml:"output_dir"`
+	Voice           string                 `yaml:"voice,omitempty"`
+	Format          string                 `yaml:"format,omitempty"`
+	SampleRate      int                    `yaml:"sample_rate,omitempty"`
+	AppID           string                 `yaml:"appid"`
+	Token           string                 `yaml:"token"`
+	Cluster         string                 `yaml:"cluster"`
+	SupportedVoices []configs.VoiceInfo    `yaml:"supported_voices"` // 支持的语音列表
+	URL             string                 `yaml:"url,omitempty"`
+	Method          string                 `yaml:"method,omitempty"`
+	TextField       string                 `yaml:"text_field,omitempty"`
+	VoiceField      string                 `yaml:"voice_field,omitempty"`
+	Timeout         int                    `yaml:"timeout,omitempty"`
+	Extra           map[string]interface{} `yaml:",inline"` // 额外参数
 }
 
 // Provider TTS提供者接口
@@ -50,11 +50,11 @@ func Create(name string, vlllmConfig *configs.VLLMConfig, logger *utils.Logger)
 		return nil, fmt.Errorf("初始化VLLLM提供者失败: %v", err)
 	}
 
-	logger.Debug("VLLLM提供者创建成功 %v", map[string]interface{}{
-		"name":       name,
-		"type":       config.Type,
-		"model_name": config.ModelName,
-	})
+	logger.DebugKV("VLLLM提供者创建成功",
+		"name", name,
+		"type", config.Type,
+		"model_name", config.ModelName,
+	)
 
 	return provider, nil
 }
@@ -19,10 +19,10 @@ func NewProvider(config *vlllm.Config, logger *utils.Logger) (*vlllm.Provider, e
 		return nil, err
 	}
 
-	logger.Debug("Ollama VLLLM Provider创建成功 %v", map[string]interface{}{
-		"model_name": config.ModelName,
-		"base_url":   config.BaseURL,
-	})
+	logger.DebugKV("Ollama VLLLM Provider创建成功",
+		"model_name", config.ModelName,
+		"base_url", config.BaseURL,
+	)
 
 	return provider, nil
 }
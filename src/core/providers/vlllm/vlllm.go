@@ -118,19 +118,19 @@ func (p *Provider) Initialize() error {
 		if p.config.BaseURL == "" {
 			p.config.BaseURL = "http://localhost:11434" // 默认Ollama地址
 		}
-		p.logger.Debug("Ollama VLLLM初始化成功 %v", map[string]interface{}{
-			"base_url": p.config.BaseURL,
-			"model":    p.config.ModelName,
-		})
+		p.logger.DebugKV("Ollama VLLLM初始化成功",
+			"base_url", p.config.BaseURL,
+			"model", p.config.ModelName,
+		)
 
 	default:
 		return fmt.Errorf("不支持的VLLLM类型: %s", p.config.Type)
 	}
 
-	p.logger.Debug("VLLLM Provider初始化成功 %v", map[string]interface{}{
-		"type":       p.config.Type,
-		"model_name": p.config.ModelName,
-	})
+	p.logger.DebugKV("VLLLM Provider初始化成功",
+		"type", p.config.Type,
+		"model_name", p.config.ModelName,
+	)
 
 	return nil
 }
@@ -139,7 +139,7 @@ func (p *Provider) Initialize() error {
 func (p *Provider) Cleanup() error {
 	// 清理图片处理器
 	if err := p.imageProcessor.Cleanup(); err != nil {
-		p.logger.Warn("清理图片处理器失败", err)
+		p.logger.WarnKV("清理图片处理器失败", err)
 	}
 
 	p.logger.Info("VLLLM Provider清理完成")
@@ -148,67 +148,91 @@ func (p *Provider) Cleanup() error {
 
 // ResponseWithImage 处理包含图片的请求 - 核心方法
 func (p *Provider) ResponseWithImage(ctx context.Context, sessionID string, messages []providers.Message, imageData image.ImageData, text string) (<-chan string, error) {
-	// 处理图片
+	ref, err := p.ProcessImage(ctx, imageData)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]providers.Message, 0, len(messages)+1)
+	history = append(history, messages...)
+	history = append(history, providers.Message{
+		Role:    "user",
+		Content: text,
+		Images:  []providers.ImageRef{ref},
+	})
+	return p.ResponseWithHistory(ctx, sessionID, history)
+}
+
+// ProcessImage 下载并校验图片，返回可以放入对话的图片
+func (p *Provider) ProcessImage(ctx context.Context, imageData image.ImageData) (providers.ImageRef, error) {
 	base64Image, err := p.imageProcessor.ProcessImage(ctx, imageData)
 	if err != nil {
-		return nil, fmt.Errorf("图片处理失败: %v", err)
+		return providers.ImageRef{}, fmt.Errorf("图片处理失败: %v", err)
+	}
+	return providers.ImageRef{Format: imageData.Format, Data: base64Image}, nil
+}
+
+// ResponseWithHistory 按多模态对话生成回复，消息中的图片需要已经过ProcessImage处理
+func (p *Provider) ResponseWithHistory(ctx context.Context, sessionID string, messages []providers.Message) (<-chan string, error) {
+	imageCount := 0
+	for _, msg := range messages {
+		imageCount += len(msg.Images)
+	}
+	if imageCount == 0 {
+		return nil, fmt.Errorf("对话中没有图片")
 	}
 
-	p.logger.Debug("开始调用多模态API %v", map[string]interface{}{
-		"type":       p.config.Type,
-		"model_name": p.config.ModelName,
-		"text":       text,
-		"image_size": len(base64Image),
-	})
+	p.logger.DebugKV("开始调用多模态API",
+		"type", p.config.Type,
+		"model_name", p.config.ModelName,
+		"message_count", len(messages),
+		"image_count", imageCount,
+	)
 
 	// 根据类型调用对应的多模态API
 	switch strings.ToLower(p.config.Type) {
 	case "openai":
-		return p.responseWithOpenAIVision(ctx, messages, base64Image, text, imageData.Format)
+		return p.responseWithOpenAIVision(ctx, messages)
 	case "ollama":
-		return p.responseWithOllamaVision(ctx, messages, base64Image, text, imageData.Format)
+		return p.responseWithOllamaVision(ctx, messages)
 	default:
 		return nil, fmt.Errorf("不支持的VLLLM类型: %s", p.config.Type)
 	}
 }
 
 // responseWithOpenAIVision 使用OpenAI Vision API
-func (p *Provider) responseWithOpenAIVision(ctx context.Context, messages []providers.Message, base64Image string, text string, format string) (<-chan string, error) {
+func (p *Provider) responseWithOpenAIVision(ctx context.Context, messages []providers.Message) (<-chan string, error) {
 	responseChan := make(chan string, 10)
 
 	go func() {
 		defer close(responseChan)
 
-		// 构建OpenAI多模态消息
-		chatMessages := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
-
-		// 添加历史消息
+		// 构建OpenAI多模态消息，带图片的消息拆成文本和图片部分
+		chatMessages := make([]openai.ChatCompletionMessage, 0, len(messages))
 		for _, msg := range messages {
-			chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-				Role:    msg.Role,
-				Content: msg.Content,
-			})
-		}
-
-		// 构建包含图片的多模态消息
-		visionMessage := openai.ChatCompletionMessage{
-			Role: openai.ChatMessageRoleUser,
-			MultiContent: []openai.ChatMessagePart{
-				{
-					Type: openai.ChatMessagePartTypeText,
-					Text: text,
-				},
-				{
+			if len(msg.Images) == 0 {
+				chatMessages = append(chatMessages, openai.ChatCompletionMessage{
+					Role:    msg.Role,
+					Content: msg.Content,
+				})
+				continue
+			}
+			parts := []openai.ChatMessagePart{{
+				Type: openai.ChatMessagePartTypeText,
+				Text: msg.Content,
+			}}
+			for _, img := range msg.Images {
+				parts = append(parts, openai.ChatMessagePart{
 					Type: openai.ChatMessagePartTypeImageURL,
 					ImageURL: &openai.ChatMessageImageURL{
-						URL: fmt.Sprintf("data:image/%s;base64,%s", format, base64Image),
+						URL: fmt.Sprintf("data:image/%s;base64,%s", imageFormat(img.Format), img.Data),
 					},
-				},
-			},
+				})
+			}
+			chatMessages = append(chatMessages, openai.ChatCompletionMessage{
+				Role:         msg.Role,
+				MultiContent: parts,
+			})
 		}
-		// 打印visionMessage的内容
-		p.logger.Debug("构建的OpenAI Vision消息: %v", visionMessage)
-		chatMessages = append(chatMessages, visionMessage)
 
 		// 调用OpenAI Vision API
 		stream, err := p.openaiClient.CreateChatCompletionStream(
@@ -257,30 +281,25 @@ func (p *Provider) responseWithOpenAIVision(ctx context.Context, messages []prov
 }
 
 // responseWithOllamaVision 使用Ollama Vision API
-func (p *Provider) responseWithOllamaVision(ctx context.Context, messages []providers.Message, base64Image string, text string, format string) (<-chan string, error) {
+func (p *Provider) responseWithOllamaVision(ctx context.Context, messages []providers.Message) (<-chan string, error) {
 	responseChan := make(chan string, 10)
 
 	go func() {
 		defer close(responseChan)
 
-		// 构建Ollama请求
-		ollamaMessages := make([]OllamaMessage, 0, len(messages)+1)
-
-		// 添加历史消息
+		// 构建Ollama请求，图片放在所属消息的images中
+		ollamaMessages := make([]OllamaMessage, 0, len(messages))
 		for _, msg := range messages {
-			ollamaMessages = append(ollamaMessages, OllamaMessage{
+			ollamaMessage := OllamaMessage{
 				Role:    msg.Role,
 				Content: msg.Content,
-			})
-		}
-
-		// 添加包含图片的用户消息
-		visionMessage := OllamaMessage{
-			Role:    "user",
-			Content: text,
-			Images:  []string{base64Image}, // Ollama需要纯base64，不需要data URL前缀
+			}
+			for _, img := range msg.Images {
+				// Ollama需要纯base64，不需要data URL前缀
+				ollamaMessage.Images = append(ollamaMessage.Images, img.Data)
+			}
+			ollamaMessages = append(ollamaMessages, ollamaMessage)
 		}
-		ollamaMessages = append(ollamaMessages, visionMessage)
 
 		// 构建请求
 		request := OllamaRequest{
@@ -297,7 +316,7 @@ func (p *Provider) responseWithOllamaVision(ctx context.Context, messages []prov
 		requestBody, err := json.Marshal(request)
 		if err != nil {
 			responseChan <- fmt.Sprintf("【请求序列化失败: %v】", err)
-			p.logger.Error("Ollama请求序列化失败", err)
+			p.logger.ErrorKV("Ollama请求序列化失败", err)
 			return
 		}
 
@@ -306,29 +325,29 @@ func (p *Provider) responseWithOllamaVision(ctx context.Context, messages []prov
 		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
 		if err != nil {
 			responseChan <- fmt.Sprintf("【创建请求失败: %v】", err)
-			p.logger.Error("创建Ollama请求失败", err)
+			p.logger.ErrorKV("创建Ollama请求失败", err)
 			return
 		}
 
 		req.Header.Set("Content-Type", "application/json")
 
-		p.logger.Info("向Ollama发送多模态请求", map[string]interface{}{
-			"url":   url,
-			"model": p.config.ModelName,
-			"text":  text,
+		p.logger.InfoKV("向Ollama发送多模态请求", map[string]interface{}{
+			"url":           url,
+			"model":         p.config.ModelName,
+			"message_count": len(ollamaMessages),
 		})
 
 		resp, err := p.httpClient.Do(req)
 		if err != nil {
 			responseChan <- fmt.Sprintf("【Ollama API调用失败: %v】", err)
-			p.logger.Error("Ollama API调用失败", err)
+			p.logger.ErrorKV("Ollama API调用失败", err)
 			return
 		}
 		defer resp.Body.Close()
 
 		if resp.StatusCode != http.StatusOK {
 			responseChan <- fmt.Sprintf("【Ollama API返回错误: %d】", resp.StatusCode)
-			p.logger.Error("Ollama API返回错误", map[string]interface{}{
+			p.logger.ErrorKV("Ollama API返回错误", map[string]interface{}{
 				"status_code": resp.StatusCode,
 				"status":      resp.Status,
 			})
@@ -345,7 +364,7 @@ func (p *Provider) responseWithOllamaVision(ctx context.Context, messages []prov
 			var response OllamaResponse
 			if err := decoder.Decode(&response); err != nil {
 				if err.Error() != "EOF" {
-					p.logger.Error("解析Ollama响应失败", err)
+					p.logger.ErrorKV("解析Ollama响应失败", err)
 				}
 				break
 			}
@@ -369,6 +388,23 @@ func (p *Provider) responseWithOllamaVision(ctx context.Context, messages []prov
 	return responseChan, nil
 }
 
+// IsErrorResponse 调用失败时流式回复中的提示，如【VLLLM服务响应异常: ...】
+func IsErrorResponse(text string) bool {
+	text = strings.TrimSpace(text)
+	return strings.HasPrefix(text, "【") && strings.HasSuffix(text, "】")
+}
+
+// imageFormat data URL中的图片类型，未知时按jpeg处理
+func imageFormat(format string) string {
+	switch format = strings.ToLower(format); format {
+	case "":
+		return "jpeg"
+	case "jpg":
+		return "jpeg"
+	}
+	return format
+}
+
 // Response 普通文本响应（降级处理）
 func (p *Provider) Response(ctx context.Context, sessionID string, messages []providers.Message) (<-chan string, error) {
 	// 如果没有图片，就作为普通文本处理
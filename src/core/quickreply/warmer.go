@@ -0,0 +1,257 @@
+package quickreply
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/providers/tts"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// pruneGrace 最近用过的缓存文件保留的时长，避免删除连接正在发送的文件
+const pruneGrace = time.Hour
+
+var (
+	gWarmer      *Warmer
+	gWarmerMutex sync.RWMutex
+)
+
+// ttsProvider 预合成需要读取TTS类型和当前音色
+type ttsProvider interface {
+	tts.Provider
+	Config() *tts.Config
+}
+
+// Warmer 预合成唤醒快速回复和角色问候语，按音色缓存为可直接发送的opus帧
+// 启动时、角色变更和切换到新音色时重新预热，并清理不再使用的缓存
+type Warmer struct {
+	config  *configs.Config
+	logger  *utils.Logger
+	factory pool.ResourceFactory
+	trigger chan struct{}
+
+	mu          sync.Mutex
+	extraVoices map[string]bool // 连接中切换到的、不在支持列表里的音色
+}
+
+// NewWarmer 使用selected_module中的TTS创建预热任务，没有配置TTS时返回nil
+func NewWarmer(config *configs.Config, logger *utils.Logger) *Warmer {
+	ttsName := config.SelectedModule["TTS"]
+	factory := pool.NewTTSFactory(ttsName, config, logger)
+	if factory == nil {
+		logger.Warn("未找到TTS配置%s，跳过快速回复预合成", ttsName)
+		return nil
+	}
+	return &Warmer{
+		config:      config,
+		logger:      logger,
+		factory:     factory,
+		trigger:     make(chan struct{}, 1),
+		extraVoices: make(map[string]bool),
+	}
+}
+
+// SetDefault 设置全局预热任务，供角色管理和连接触发
+func SetDefault(w *Warmer) {
+	gWarmerMutex.Lock()
+	defer gWarmerMutex.Unlock()
+	gWarmer = w
+}
+
+func getDefault() *Warmer {
+	gWarmerMutex.RLock()
+	defer gWarmerMutex.RUnlock()
+	return gWarmer
+}
+
+// Refresh 回复词、问候语或音色变化后触发重新预热，未启动预热任务时忽略
+func Refresh() {
+	if w := getDefault(); w != nil {
+		w.Refresh()
+	}
+}
+
+// AddVoice 连接切换到新音色时调用，音色没有缓存时触发预热
+func AddVoice(voice string) {
+	if w := getDefault(); w != nil {
+		w.AddVoice(voice)
+	}
+}
+
+// Start 立即预热一次，之后等待触发，直到ctx结束
+func (w *Warmer) Start(ctx context.Context) {
+	w.Refresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.trigger:
+			start := time.Now()
+			synthesized, removed, err := w.Warm(ctx)
+			if err != nil {
+				w.logger.Warn("快速回复预合成失败: %v", err)
+				continue
+			}
+			w.logger.Info("快速回复预合成完成: 新合成%d条, 清理%d个过期文件, 耗时%v", synthesized, removed, time.Since(start))
+		}
+	}
+}
+
+// Refresh 请求重新预热，多次请求合并为一次
+func (w *Warmer) Refresh() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// AddVoice 记录连接使用的音色，新音色会触发预热
+func (w *Warmer) AddVoice(voice string) {
+	if voice == "" {
+		return
+	}
+	w.mu.Lock()
+	added := !w.extraVoices[voice]
+	w.extraVoices[voice] = true
+	w.mu.Unlock()
+	if added {
+		w.Refresh()
+	}
+}
+
+// Warm 为所有音色合成缺失的回复音频，并删除不再需要的缓存文件
+func (w *Warmer) Warm(ctx context.Context) (int, int, error) {
+	resource, err := w.factory.Create()
+	if err != nil {
+		return 0, 0, fmt.Errorf("创建TTS失败: %v", err)
+	}
+	defer w.factory.Destroy(resource)
+	provider, ok := resource.(ttsProvider)
+	if !ok {
+		return 0, 0, fmt.Errorf("TTS类型错误: %T", resource)
+	}
+	cfg := provider.Config()
+	texts := w.texts()
+	keep := make(map[string]bool)
+
+	synthesized := 0
+	for _, voice := range w.voices(cfg) {
+		if err := provider.SetVoice(voice); err != nil {
+			w.logger.Warn("预合成跳过音色%s: %v", voice, err)
+			continue
+		}
+		// SetVoice会把显示名转换为音色名，缓存以转换后的名称为准
+		cache := utils.NewQuickReplyCache(cfg.Type, cfg.Voice)
+		for _, text := range texts {
+			if ctx.Err() != nil {
+				return synthesized, 0, ctx.Err()
+			}
+			for _, name := range cache.CacheFiles(text) {
+				keep[name] = true
+			}
+			if _, _, ok := cache.FindCachedOpus(text); ok {
+				continue
+			}
+			if err := w.synthesize(provider, cache, text); err != nil {
+				w.logger.Warn("预合成失败(%s, %s): %v", cfg.Voice, text, err)
+				continue
+			}
+			synthesized++
+		}
+	}
+
+	removed, err := utils.PruneQuickReplyCache(utils.QuickReplyCacheDir, keep, pruneGrace)
+	if err != nil {
+		return synthesized, removed, fmt.Errorf("清理过期缓存失败: %v", err)
+	}
+	return synthesized, removed, nil
+}
+
+// synthesize 合成一条文本，保存原始音频和opus帧；已有原始音频（如旧版本的缓存）时直接转码
+func (w *Warmer) synthesize(provider ttsProvider, cache *utils.QuickReplyCache, text string) error {
+	path := cache.FindCachedAudio(text)
+	if path == "" {
+		var err error
+		if path, err = provider.ToTTS(text); err != nil {
+			return err
+		}
+		defer os.Remove(path)
+
+		if err := cache.SaveCachedAudio(text, path); err != nil {
+			return err
+		}
+	}
+	frames, duration, err := utils.AudioToOpusData(path)
+	if err != nil {
+		return fmt.Errorf("音频转Opus失败: %v", err)
+	}
+	return cache.SaveCachedOpus(text, frames, duration)
+}
+
+// texts 需要预合成的文本：全局和各角色的快速回复词，以及角色问候语的各个分句
+func (w *Warmer) texts() []string {
+	var raw []string
+	if w.config.QuickReply {
+		raw = append(raw, w.config.QuickReplyWords...)
+	}
+	var greetings []string
+	if roleDB := database.GetRoleDB(); roleDB != nil {
+		roles, err := roleDB.ListRoles()
+		if err != nil {
+			w.logger.Warn("读取角色失败: %v", err)
+		}
+		for _, role := range roles {
+			if w.config.QuickReply {
+				raw = append(raw, role.QuickReplies()...)
+			}
+			if role.Greeting != "" {
+				greetings = append(greetings, utils.SpeechSegments(role.Greeting)...)
+			}
+		}
+	}
+
+	// 快速回复词整句合成，与SpeakAndPlay的清理方式一致
+	for i, text := range raw {
+		raw[i] = utils.RemoveMarkdownSyntax(utils.RemoveAllEmoji(text))
+	}
+	return uniqueStrings(append(raw, greetings...))
+}
+
+// voices 需要预合成的音色：默认音色、支持列表、角色音色和连接中用过的音色
+func (w *Warmer) voices(cfg *tts.Config) []string {
+	voices := []string{cfg.Voice}
+	for _, v := range cfg.SupportedVoices {
+		voices = append(voices, v.Name)
+	}
+	if roleDB := database.GetRoleDB(); roleDB != nil {
+		roles, _ := roleDB.ListRoles()
+		for _, role := range roles {
+			voices = append(voices, role.Voice)
+		}
+	}
+	w.mu.Lock()
+	for voice := range w.extraVoices {
+		voices = append(voices, voice)
+	}
+	w.mu.Unlock()
+	return uniqueStrings(voices)
+}
+
+func uniqueStrings(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		if item == "" || seen[item] {
+			continue
+		}
+		seen[item] = true
+		result = append(result, item)
+	}
+	return result
+}
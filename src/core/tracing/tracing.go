@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"xiaozhi-server-go/src/configs"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultServiceName = "xiaozhi-server-go"
+
+// span属性键
+const (
+	AttrSessionID = attribute.Key("xiaozhi.session_id")
+	AttrDeviceID  = attribute.Key("xiaozhi.device_id")
+	AttrClientID  = attribute.Key("xiaozhi.client_id")
+	AttrTransport = attribute.Key("xiaozhi.transport")
+	AttrRound     = attribute.Key("xiaozhi.round")
+	AttrTextIndex = attribute.Key("xiaozhi.text_index")
+	AttrText      = attribute.Key("xiaozhi.text")
+	AttrMode      = attribute.Key("xiaozhi.listen_mode")
+	AttrTool      = attribute.Key("xiaozhi.tool")
+	AttrProvider  = attribute.Key("xiaozhi.provider")
+	AttrCached    = attribute.Key("xiaozhi.cached")
+	AttrFrames    = attribute.Key("xiaozhi.frames")
+)
+
+// Init 按配置安装全局TracerProvider，返回的函数在退出时刷新并关闭导出器
+// 未启用时保持otel默认的空实现，span不记录也不产生trace_id
+func Init(ctx context.Context, cfg *configs.TracingConfig) (func(context.Context) error, error) {
+	if cfg == nil || !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("创建追踪资源失败: %v", err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	return provider.Shutdown, nil
+}
+
+// newExporter 创建span导出器
+func newExporter(ctx context.Context, cfg *configs.TracingConfig) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "", "otlp":
+		opts := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("不支持的追踪导出器: %s", cfg.Exporter)
+	}
+}
+
+// Tracer 服务使用的tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(defaultServiceName)
+}
+
+// Start 以ctx中的span为父span开始一个新的span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束span，err不为空时记录错误并标记失败
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID 返回ctx中有效span的trace_id，没有时为空
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+)
+
+// queryHeaders 浏览器无法为WebSocket和信令请求设置自定义头，允许通过查询参数传递
+var queryHeaders = map[string]string{
+	"device-id":        "Device-Id",
+	"client-id":        "Client-Id",
+	"protocol-version": "Protocol-Version",
+	"authorization":    "Authorization",
+	"token":            "Authorization",
+}
+
+// ApplyQueryHeaders 把查询参数中的设备信息补充到请求头，已有请求头时保持不变
+func ApplyQueryHeaders(r *http.Request) {
+	query := r.URL.Query()
+	for param, header := range queryHeaders {
+		value := query.Get(param)
+		if value == "" || r.Header.Get(header) != "" {
+			continue
+		}
+		if header == "Authorization" && !strings.HasPrefix(value, "Bearer ") {
+			value = "Bearer " + value
+		}
+		r.Header.Set(header, value)
+	}
+}
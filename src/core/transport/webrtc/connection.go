@@ -0,0 +1,205 @@
+package webrtc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+const (
+	messageTypeText   = 1
+	messageTypeBinary = 2
+
+	// upstreamSampleRate 上行Opus解码后送入ASR的采样率
+	upstreamSampleRate = 16000
+)
+
+type message struct {
+	messageType int
+	data        []byte
+}
+
+// WebRTCConnection WebRTC连接适配器，文本消息走DataChannel，音频走Opus轨道
+type WebRTCConnection struct {
+	id            string
+	pc            *webrtc.PeerConnection
+	dataChannel   *webrtc.DataChannel
+	audioTrack    *webrtc.TrackLocalStaticSample
+	messages      chan message
+	done          chan struct{}
+	closed        int32
+	lastActive    int64
+	frameDuration int64 // 下行Opus帧时长(ms)，从服务端hello中获取
+	mu            sync.Mutex
+}
+
+// NewWebRTCConnection 创建新的WebRTC连接适配器
+func NewWebRTCConnection(id string, pc *webrtc.PeerConnection, audioTrack *webrtc.TrackLocalStaticSample) *WebRTCConnection {
+	return &WebRTCConnection{
+		id:            id,
+		pc:            pc,
+		audioTrack:    audioTrack,
+		messages:      make(chan message, 256),
+		done:          make(chan struct{}),
+		lastActive:    time.Now().Unix(),
+		frameDuration: 60,
+	}
+}
+
+// bindDataChannel 绑定控制消息通道
+func (c *WebRTCConnection) bindDataChannel(dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	c.dataChannel = dc
+	c.mu.Unlock()
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if msg.IsString {
+			c.push(messageTypeText, rewriteClientHello(msg.Data))
+		} else {
+			c.push(messageTypeBinary, msg.Data)
+		}
+	})
+	dc.OnClose(func() {
+		c.Close()
+	})
+}
+
+// readAudioTrack 读取浏览器上行的Opus轨道，每个RTP包是一帧Opus数据
+func (c *WebRTCConnection) readAudioTrack(track *webrtc.TrackRemote) {
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		if len(packet.Payload) == 0 {
+			continue
+		}
+		c.push(messageTypeBinary, append([]byte(nil), packet.Payload...))
+	}
+}
+
+func (c *WebRTCConnection) push(messageType int, data []byte) {
+	if c.IsClosed() {
+		return
+	}
+	atomic.StoreInt64(&c.lastActive, time.Now().Unix())
+	select {
+	case c.messages <- message{messageType: messageType, data: data}:
+	case <-c.done:
+	default:
+		// 处理不过来时丢弃音频，控制消息不能丢
+		if messageType == messageTypeText {
+			select {
+			case c.messages <- message{messageType: messageType, data: data}:
+			case <-c.done:
+			}
+		}
+	}
+}
+
+// WriteMessage 发送消息，文本走DataChannel，音频按帧写入Opus轨道
+func (c *WebRTCConnection) WriteMessage(messageType int, data []byte) error {
+	if c.IsClosed() {
+		return fmt.Errorf("连接已关闭")
+	}
+	atomic.StoreInt64(&c.lastActive, time.Now().Unix())
+
+	if messageType == messageTypeBinary {
+		duration := time.Duration(atomic.LoadInt64(&c.frameDuration)) * time.Millisecond
+		return c.audioTrack.WriteSample(media.Sample{Data: data, Duration: duration})
+	}
+
+	c.observeServerHello(data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dataChannel == nil || c.dataChannel.ReadyState() != webrtc.DataChannelStateOpen {
+		return fmt.Errorf("DataChannel未打开")
+	}
+	return c.dataChannel.SendText(string(data))
+}
+
+// observeServerHello 从服务端hello中获取下行帧时长，用于音频时间戳
+func (c *WebRTCConnection) observeServerHello(data []byte) {
+	var hello struct {
+		Type        string `json:"type"`
+		AudioParams struct {
+			FrameDuration int64 `json:"frame_duration"`
+		} `json:"audio_params"`
+	}
+	if json.Unmarshal(data, &hello) != nil || hello.Type != "hello" || hello.AudioParams.FrameDuration <= 0 {
+		return
+	}
+	atomic.StoreInt64(&c.frameDuration, hello.AudioParams.FrameDuration)
+}
+
+// rewriteClientHello 上行音频固定来自Opus轨道，下行只能走Opus轨道，覆盖客户端hello中的音频格式
+func rewriteClientHello(data []byte) []byte {
+	var msg map[string]interface{}
+	if json.Unmarshal(data, &msg) != nil || msg["type"] != "hello" {
+		return data
+	}
+	audioParams, _ := msg["audio_params"].(map[string]interface{})
+	if audioParams == nil {
+		audioParams = map[string]interface{}{}
+	}
+	audioParams["format"] = "opus"
+	audioParams["sample_rate"] = upstreamSampleRate
+	audioParams["channels"] = 1
+	audioParams["output_format"] = "opus"
+	msg["audio_params"] = audioParams
+	if rewritten, err := json.Marshal(msg); err == nil {
+		return rewritten
+	}
+	return data
+}
+
+// ReadMessage 读取消息
+func (c *WebRTCConnection) ReadMessage(stopChan <-chan struct{}) (int, []byte, error) {
+	select {
+	case msg := <-c.messages:
+		return msg.messageType, msg.data, nil
+	case <-c.done:
+		return 0, nil, fmt.Errorf("连接已关闭")
+	case <-stopChan:
+		return 0, nil, fmt.Errorf("连接已停止")
+	}
+}
+
+// Close 关闭连接
+func (c *WebRTCConnection) Close() error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		close(c.done)
+		return c.pc.Close()
+	}
+	return nil
+}
+
+// GetID 获取连接ID
+func (c *WebRTCConnection) GetID() string {
+	return c.id
+}
+
+// GetType 获取连接类型
+func (c *WebRTCConnection) GetType() string {
+	return "webrtc"
+}
+
+// IsClosed 检查连接是否已关闭
+func (c *WebRTCConnection) IsClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+// GetLastActiveTime 获取最后活跃时间
+func (c *WebRTCConnection) GetLastActiveTime() time.Time {
+	return time.Unix(atomic.LoadInt64(&c.lastActive), 0)
+}
+
+// IsStale 检查连接是否过期
+func (c *WebRTCConnection) IsStale(timeout time.Duration) bool {
+	return time.Since(c.GetLastActiveTime()) > timeout
+}
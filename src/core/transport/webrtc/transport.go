@@ -0,0 +1,270 @@
+package webrtc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/google/uuid"
+	"github.com/pion/webrtc/v4"
+)
+
+// gatherTimeout 等待ICE候选收集完成的最长时间
+const gatherTimeout = 5 * time.Second
+
+// WebRTCTransport WebRTC传输层实现，浏览器通过HTTP提交offer，一次性拿到包含全部候选的answer
+type WebRTCTransport struct {
+	config            *configs.Config
+	server            *http.Server
+	logger            *utils.Logger
+	connHandler       transport.ConnectionHandlerFactory
+	activeConnections sync.Map
+	api               *webrtc.API
+}
+
+// NewWebRTCTransport 创建新的WebRTC传输层
+func NewWebRTCTransport(config *configs.Config, logger *utils.Logger) (*WebRTCTransport, error) {
+	cfg := &config.Transport.WebRTC
+	settings := webrtc.SettingEngine{}
+	if len(cfg.PublicIPs) > 0 {
+		settings.SetNAT1To1IPs(cfg.PublicIPs, webrtc.ICECandidateTypeHost)
+	}
+	if cfg.UDPPortMin > 0 && cfg.UDPPortMax >= cfg.UDPPortMin {
+		if err := settings.SetEphemeralUDPPortRange(cfg.UDPPortMin, cfg.UDPPortMax); err != nil {
+			return nil, fmt.Errorf("设置UDP端口范围失败: %v", err)
+		}
+	}
+
+	return &WebRTCTransport{
+		config: config,
+		logger: logger,
+		api:    webrtc.NewAPI(webrtc.WithSettingEngine(settings)),
+	}, nil
+}
+
+// Start 启动WebRTC信令服务
+func (t *WebRTCTransport) Start(ctx context.Context) error {
+	cfg := &t.config.Transport.WebRTC
+	addr := fmt.Sprintf("%s:%d", cfg.IP, cfg.Port)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/offer", t.handleOffer)
+
+	t.server = &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	t.logger.Info("启动WebRTC传输层 http://%s/offer", addr)
+
+	// 监听关闭信号
+	go func() {
+		<-ctx.Done()
+		t.Stop()
+	}()
+
+	if err := t.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("WebRTC传输层启动失败: %v", err)
+	}
+
+	return nil
+}
+
+// Stop 停止WebRTC传输层
+func (t *WebRTCTransport) Stop() error {
+	if t.server != nil {
+		t.logger.Info("WebRTC传输层...")
+
+		// 关闭所有活动连接
+		t.activeConnections.Range(func(key, value interface{}) bool {
+			if handler, ok := value.(transport.ConnectionHandler); ok {
+				handler.Close()
+			}
+			t.activeConnections.Delete(key)
+			return true
+		})
+
+		return t.server.Close()
+	}
+	return nil
+}
+
+// SetConnectionHandler 设置连接处理器工厂
+func (t *WebRTCTransport) SetConnectionHandler(handler transport.ConnectionHandlerFactory) {
+	t.connHandler = handler
+}
+
+// GetActiveConnectionCount 获取活跃连接数
+func (t *WebRTCTransport) GetActiveConnectionCount() int {
+	count := 0
+	t.activeConnections.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// GetType 获取传输类型
+func (t *WebRTCTransport) GetType() string {
+	return "webrtc"
+}
+
+// iceServers 转换配置中的STUN/TURN服务器
+func (t *WebRTCTransport) iceServers() []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, 0, len(t.config.Transport.WebRTC.ICEServers))
+	for _, server := range t.config.Transport.WebRTC.ICEServers {
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       server.URLs,
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	return servers
+}
+
+// handleOffer 处理浏览器的SDP offer，设备信息可以放在请求头或查询参数中
+func (t *WebRTCTransport) handleOffer(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Device-Id, Client-Id")
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if t.connHandler == nil {
+		t.logger.Error("连接处理器工厂未设置")
+		http.Error(w, "server not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	var offer webrtc.SessionDescription
+	if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
+		http.Error(w, "invalid offer", http.StatusBadRequest)
+		return
+	}
+	transport.ApplyQueryHeaders(r)
+
+	answer, err := t.accept(offer, r)
+	if err != nil {
+		t.logger.Error("WebRTC协商失败: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answer)
+}
+
+// accept 创建PeerConnection并返回answer，DataChannel打开后再创建连接处理器
+func (t *WebRTCTransport) accept(offer webrtc.SessionDescription, r *http.Request) (*webrtc.SessionDescription, error) {
+	pc, err := t.api.NewPeerConnection(webrtc.Configuration{ICEServers: t.iceServers()})
+	if err != nil {
+		return nil, fmt.Errorf("创建PeerConnection失败: %v", err)
+	}
+
+	audioTrack, err := webrtc.NewTrackLocalStaticSample(
+		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2},
+		"audio", "xiaozhi",
+	)
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("创建音频轨道失败: %v", err)
+	}
+	sender, err := pc.AddTrack(audioTrack)
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("添加音频轨道失败: %v", err)
+	}
+	go func() {
+		// 读取RTCP，保证拥塞控制等拦截器正常工作
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := sender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	clientID := uuid.New().String()
+	conn := NewWebRTCConnection(clientID, pc, audioTrack)
+	// 处理器在DataChannel打开后才创建，先复制请求头，避免请求结束后被复用
+	req := r.Clone(context.Background())
+
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		if track.Kind() == webrtc.RTPCodecTypeAudio {
+			go conn.readAudioTrack(track)
+		}
+	})
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		conn.bindDataChannel(dc)
+		dc.OnOpen(func() {
+			t.startHandler(conn, req)
+		})
+	})
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		t.logger.Debug("WebRTC客户端 %s 连接状态: %s", clientID, state.String())
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			conn.Close()
+		}
+	})
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("设置远端SDP失败: %v", err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("创建answer失败: %v", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		pc.Close()
+		return nil, fmt.Errorf("设置本地SDP失败: %v", err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-time.After(gatherTimeout):
+		t.logger.Warn("WebRTC候选收集超时，使用已收集的候选")
+	}
+
+	t.logger.Info("收到WebRTC连接请求: %s", r.Header.Get("Device-Id"))
+	return pc.LocalDescription(), nil
+}
+
+// startHandler 创建连接处理器，结束时清理资源
+func (t *WebRTCTransport) startHandler(conn *WebRTCConnection, req *http.Request) {
+	clientID := conn.GetID()
+	if _, exists := t.activeConnections.Load(clientID); exists {
+		return
+	}
+
+	handler := t.connHandler.CreateHandler(conn, req)
+	if handler == nil {
+		t.logger.Error("创建连接处理器失败")
+		conn.Close()
+		return
+	}
+
+	t.activeConnections.Store(clientID, handler)
+	t.logger.Info("WebRTC客户端 %s 连接已建立，资源已分配", clientID)
+
+	go func() {
+		defer func() {
+			// 连接结束时清理
+			t.activeConnections.Delete(clientID)
+			handler.Close()
+		}()
+
+		handler.Handle()
+	}()
+}
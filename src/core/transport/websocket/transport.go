@@ -110,6 +110,7 @@ func (t *WebSocketTransport) handleWebSocket(w http.ResponseWriter, r *http.Requ
 	}
 
 	clientID := fmt.Sprintf("%p", conn)
+	transport.ApplyQueryHeaders(r)
 	t.logger.Info("收到WebSocket连接请求: %s", r.Header.Get("Device-Id"))
 	wsConn := NewWebSocketConnection(clientID, conn)
 
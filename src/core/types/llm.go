@@ -67,6 +67,15 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Images     []ImageRef `json:"images,omitempty"` // 用户发送的图片，只有VLLLM使用
+}
+
+// ImageRef 对话中的图片，Data为处理后的base64，不随对话记录保存
+type ImageRef struct {
+	Format      string `json:"format"`
+	Source      string `json:"source,omitempty"`      // 图片来源：device、vision、tool
+	Description string `json:"description,omitempty"` // 识别结果
+	Data        string `json:"-"`
 }
 
 func (m *Message) Print() {
@@ -0,0 +1,362 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// 计量项
+const (
+	MetricLLMTokens   = "llm_tokens"   // LLM输入和输出token，按文本估算
+	MetricTTSChars    = "tts_chars"    // TTS合成字数
+	MetricASRSeconds  = "asr_seconds"  // 送入ASR的音频秒数
+	MetricVisionCalls = "vision_calls" // 识图调用次数
+	MetricImageCalls  = "image_calls"  // 生成图片次数
+)
+
+// Metrics 所有计量项
+var Metrics = []string{MetricLLMTokens, MetricTTSChars, MetricASRSeconds, MetricVisionCalls, MetricImageCalls}
+
+const (
+	DefaultLevel         = "basic"
+	defaultFlushInterval = 10 * time.Second
+	dayLayout            = "2006-01-02"
+)
+
+// Store 用量持久化，由database.UsageDB实现
+type Store interface {
+	AddUsage(deviceID, day, metric string, amount float64) error
+	SumUsage(deviceID, fromDay, toDay string) (map[string]float64, error)
+	GetDeviceLevel(deviceID string) (string, error)
+	SetDeviceLevel(deviceID, level string) error
+}
+
+// ExceededError 超出配额
+type ExceededError struct {
+	DeviceID string
+	Metric   string
+	Period   string // daily或monthly
+	Used     float64
+	Limit    float64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("设备%s超出%s配额: %s 已用%.0f/上限%.0f", e.DeviceID, e.Period, e.Metric, e.Used, e.Limit)
+}
+
+// Snapshot 设备当前的用量和配额
+type Snapshot struct {
+	DeviceID     string             `json:"device_id"`
+	Level        string             `json:"level"`
+	Day          string             `json:"day"`
+	Month        string             `json:"month"`
+	Daily        map[string]float64 `json:"daily"`
+	Monthly      map[string]float64 `json:"monthly"`
+	DailyLimit   map[string]float64 `json:"daily_limit"`
+	MonthlyLimit map[string]float64 `json:"monthly_limit"`
+}
+
+// deviceUsage 设备当天和当月的用量缓存，包括尚未写入数据库的部分
+type deviceUsage struct {
+	day     string
+	level   string
+	daily   map[string]float64
+	monthly map[string]float64
+}
+
+type pendingKey struct {
+	deviceID string
+	day      string
+	metric   string
+}
+
+// Meter 用量计量器，用量先累计在内存中，定时写入数据库
+// 方法对nil接收者安全，未启用用量统计时调用方无需判断
+type Meter struct {
+	config *configs.UsageConfig
+	store  Store
+	logger *utils.Logger
+	now    func() time.Time
+
+	mu      sync.Mutex
+	devices map[string]*deviceUsage
+	pending map[pendingKey]float64
+}
+
+// NewMeter 创建计量器，未启用时返回nil
+func NewMeter(config *configs.UsageConfig, store Store, logger *utils.Logger) *Meter {
+	if config == nil || !config.Enabled || store == nil {
+		return nil
+	}
+	return &Meter{
+		config:  config,
+		store:   store,
+		logger:  logger,
+		now:     time.Now,
+		devices: make(map[string]*deviceUsage),
+		pending: make(map[pendingKey]float64),
+	}
+}
+
+var (
+	gMeter     *Meter
+	gMeterLock sync.RWMutex
+)
+
+// SetDefault 设置全局计量器
+func SetDefault(m *Meter) {
+	gMeterLock.Lock()
+	defer gMeterLock.Unlock()
+	gMeter = m
+}
+
+// Default 全局计量器，未启用时为nil
+func Default() *Meter {
+	gMeterLock.RLock()
+	defer gMeterLock.RUnlock()
+	return gMeter
+}
+
+// Start 定时把用量写入数据库，ctx结束时写入剩余用量
+func (m *Meter) Start(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	interval := defaultFlushInterval
+	if m.config.FlushInterval > 0 {
+		interval = time.Duration(m.config.FlushInterval) * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			m.Flush()
+			return
+		case <-ticker.C:
+			m.Flush()
+		}
+	}
+}
+
+// Record 记录设备的用量
+func (m *Meter) Record(deviceID, metric string, amount float64) {
+	if m == nil || deviceID == "" || amount <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	du, err := m.loadLocked(deviceID)
+	if err != nil {
+		m.logger.Warn("加载设备%s用量失败: %v", deviceID, err)
+		return
+	}
+	du.daily[metric] += amount
+	du.monthly[metric] += amount
+	m.pending[pendingKey{deviceID: deviceID, day: du.day, metric: metric}] += amount
+}
+
+// Check 检查设备是否超出当日或当月配额，超出时返回*ExceededError
+func (m *Meter) Check(deviceID string) error {
+	if m == nil || deviceID == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	du, err := m.loadLocked(deviceID)
+	if err != nil {
+		// 数据库异常时不影响对话
+		m.logger.Warn("加载设备%s用量失败: %v", deviceID, err)
+		return nil
+	}
+	limits := m.config.Levels[du.level]
+	if err := exceeded(deviceID, "daily", du.daily, limits.Daily); err != nil {
+		return err
+	}
+	return exceeded(deviceID, "monthly", du.monthly, limits.Monthly)
+}
+
+// exceeded 按固定顺序检查计量项，便于返回稳定的错误
+func exceeded(deviceID, period string, used, limits map[string]float64) error {
+	for _, metric := range Metrics {
+		if limit := limits[metric]; limit > 0 && used[metric] >= limit {
+			return &ExceededError{DeviceID: deviceID, Metric: metric, Period: period, Used: used[metric], Limit: limit}
+		}
+	}
+	return nil
+}
+
+// Level 设备的用户级别
+func (m *Meter) Level(deviceID string) string {
+	if m == nil {
+		return DefaultLevel
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	du, err := m.loadLocked(deviceID)
+	if err != nil {
+		return m.defaultLevel()
+	}
+	return du.level
+}
+
+// SetLevel 设置设备的用户级别，level为空时恢复默认级别
+func (m *Meter) SetLevel(deviceID, level string) error {
+	if m == nil {
+		return fmt.Errorf("用量统计未启用")
+	}
+	if level != "" {
+		if _, ok := m.config.Levels[level]; !ok {
+			return fmt.Errorf("未配置的用户级别: %s", level)
+		}
+	}
+	if err := m.store.SetDeviceLevel(deviceID, level); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if du, ok := m.devices[deviceID]; ok {
+		du.level = level
+		if level == "" {
+			du.level = m.defaultLevel()
+		}
+	}
+	return nil
+}
+
+// Snapshot 设备当前的用量和配额
+func (m *Meter) Snapshot(deviceID string) (*Snapshot, error) {
+	if m == nil {
+		return nil, fmt.Errorf("用量统计未启用")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	du, err := m.loadLocked(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	limits := m.config.Levels[du.level]
+	return &Snapshot{
+		DeviceID:     deviceID,
+		Level:        du.level,
+		Day:          du.day,
+		Month:        du.day[:7],
+		Daily:        copyTotals(du.daily),
+		Monthly:      copyTotals(du.monthly),
+		DailyLimit:   copyTotals(limits.Daily),
+		MonthlyLimit: copyTotals(limits.Monthly),
+	}, nil
+}
+
+// Flush 把累计的用量写入数据库，写入失败的部分保留到下次
+func (m *Meter) Flush() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushLocked()
+}
+
+func (m *Meter) flushLocked() {
+	for key, amount := range m.pending {
+		if err := m.store.AddUsage(key.deviceID, key.day, key.metric, amount); err != nil {
+			m.logger.Error("写入设备%s的%s用量失败: %v", key.deviceID, key.metric, err)
+			continue
+		}
+		delete(m.pending, key)
+	}
+}
+
+// loadLocked 获取设备的用量缓存，跨天时先写入累计用量再从数据库重新加载
+func (m *Meter) loadLocked(deviceID string) (*deviceUsage, error) {
+	day := m.now().Format(dayLayout)
+	if du, ok := m.devices[deviceID]; ok && du.day == day {
+		return du, nil
+	}
+	if _, ok := m.devices[deviceID]; ok {
+		m.flushLocked()
+		// 跨天后清理其他设备的缓存，避免长期运行时无限增长
+		for id, du := range m.devices {
+			if du.day != day {
+				delete(m.devices, id)
+			}
+		}
+	}
+
+	daily, err := m.store.SumUsage(deviceID, day, day)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := m.store.SumUsage(deviceID, day[:7]+"-01", day)
+	if err != nil {
+		return nil, err
+	}
+	level, err := m.store.GetDeviceLevel(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if level == "" {
+		level = m.defaultLevel()
+	}
+	// 加上尚未写入数据库的用量
+	for key, amount := range m.pending {
+		if key.deviceID != deviceID {
+			continue
+		}
+		if key.day == day {
+			daily[key.metric] += amount
+		}
+		if key.day[:7] == day[:7] {
+			monthly[key.metric] += amount
+		}
+	}
+
+	du := &deviceUsage{day: day, level: level, daily: daily, monthly: monthly}
+	m.devices[deviceID] = du
+	return du, nil
+}
+
+func (m *Meter) defaultLevel() string {
+	if m.config.DefaultLevel != "" {
+		return m.config.DefaultLevel
+	}
+	return DefaultLevel
+}
+
+// OverQuotaMessage 超出配额时播报的内容
+func (m *Meter) OverQuotaMessage() string {
+	if m == nil || m.config.OverQuotaMessage == "" {
+		return "今天的用量已经用完了，明天再来找我吧"
+	}
+	return m.config.OverQuotaMessage
+}
+
+func copyTotals(totals map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(totals))
+	for k, v := range totals {
+		out[k] = v
+	}
+	return out
+}
+
+// EstimateTokens 估算文本的token数：中日韩文字每字约1个token，其他字符约4个一个token
+func EstimateTokens(text string) int {
+	cjk, other := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			cjk++
+		case !unicode.IsSpace(r):
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
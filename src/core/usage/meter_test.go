@@ -0,0 +1,149 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+// memoryStore 内存中的用量存储，key为设备/日期/计量项
+type memoryStore struct {
+	usage  map[[3]string]float64
+	levels map[string]string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{usage: make(map[[3]string]float64), levels: make(map[string]string)}
+}
+
+func (s *memoryStore) AddUsage(deviceID, day, metric string, amount float64) error {
+	s.usage[[3]string{deviceID, day, metric}] += amount
+	return nil
+}
+
+func (s *memoryStore) SumUsage(deviceID, fromDay, toDay string) (map[string]float64, error) {
+	totals := make(map[string]float64)
+	for key, amount := range s.usage {
+		if key[0] == deviceID && key[1] >= fromDay && key[1] <= toDay {
+			totals[key[2]] += amount
+		}
+	}
+	return totals, nil
+}
+
+func (s *memoryStore) GetDeviceLevel(deviceID string) (string, error) {
+	return s.levels[deviceID], nil
+}
+
+func (s *memoryStore) SetDeviceLevel(deviceID, level string) error {
+	if level == "" {
+		delete(s.levels, deviceID)
+	} else {
+		s.levels[deviceID] = level
+	}
+	return nil
+}
+
+func TestMeter(t *testing.T) {
+	logger, err := utils.NewLogger(&utils.LogCfg{LogLevel: "ERROR", LogDir: t.TempDir(), LogFile: "test.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	config := &configs.UsageConfig{
+		Enabled: true,
+		Levels: map[string]configs.UsageLevelConfig{
+			"basic":   {Daily: map[string]float64{MetricLLMTokens: 100}, Monthly: map[string]float64{MetricVisionCalls: 3}},
+			"premium": {Daily: map[string]float64{MetricLLMTokens: 1000}},
+		},
+	}
+	if NewMeter(&configs.UsageConfig{}, newMemoryStore(), logger) != nil {
+		t.Fatal("未启用时应返回nil")
+	}
+	if err := (*Meter)(nil).Check("aa:bb"); err != nil {
+		t.Fatal("nil计量器不应限制用量")
+	}
+
+	store := newMemoryStore()
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.Local)
+	meter := NewMeter(config, store, logger)
+	meter.now = func() time.Time { return now }
+
+	tests := []struct {
+		name    string
+		prepare func()
+		device  string
+		metric  string // 期望超出的计量项，为空表示未超出
+		period  string
+	}{
+		{name: "未超出", prepare: func() { meter.Record("aa:bb", MetricLLMTokens, 99) }, device: "aa:bb"},
+		{name: "超出每日配额", prepare: func() { meter.Record("aa:bb", MetricLLMTokens, 1) },
+			device: "aa:bb", metric: MetricLLMTokens, period: "daily"},
+		{name: "提升级别后解除", prepare: func() {
+			if err := meter.SetLevel("aa:bb", "premium"); err != nil {
+				t.Fatal(err)
+			}
+		}, device: "aa:bb"},
+		{name: "跨天后每日用量清零", prepare: func() {
+			if err := meter.SetLevel("aa:bb", ""); err != nil {
+				t.Fatal(err)
+			}
+			now = now.AddDate(0, 0, 1)
+		}, device: "aa:bb"},
+		{name: "每月配额跨天累计", prepare: func() {
+			meter.Record("cc:dd", MetricVisionCalls, 2)
+			now = now.AddDate(0, 0, 1)
+			meter.Record("cc:dd", MetricVisionCalls, 1)
+		}, device: "cc:dd", metric: MetricVisionCalls, period: "monthly"},
+		{name: "跨月后每月用量清零", prepare: func() { now = now.AddDate(0, 1, 0) }, device: "cc:dd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.prepare()
+			err := meter.Check(tt.device)
+			if tt.metric == "" {
+				if err != nil {
+					t.Fatalf("不应超出配额: %v", err)
+				}
+				return
+			}
+			var exceeded *ExceededError
+			if !errors.As(err, &exceeded) || exceeded.Metric != tt.metric || exceeded.Period != tt.period {
+				t.Fatalf("期望超出%s %s配额, 实际: %v", tt.period, tt.metric, err)
+			}
+		})
+	}
+
+	if err := meter.SetLevel("aa:bb", "gold"); err == nil {
+		t.Error("未配置的级别应返回错误")
+	}
+	meter.Flush()
+	if got := store.usage[[3]string{"aa:bb", "2025-06-10", MetricLLMTokens}]; got != 100 {
+		t.Errorf("写入的用量 = %v, 期望 100", got)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{name: "空文本", text: "", want: 0},
+		{name: "中文", text: "你好世界", want: 4},
+		{name: "英文", text: "hello world", want: 3},
+		{name: "混合", text: "今天weather好", want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.text); got != tt.want {
+				t.Errorf("EstimateTokens(%q) = %d, 期望 %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"sync"
 
 	"github.com/hajimehoshi/go-mp3"
@@ -315,7 +314,13 @@ func ReadPCMDataFromWavFile(filePath string) ([]byte, error) {
 	return pcmData, nil
 }
 
+// AudioToPCMData 将mp3解码为24kHz单声道PCM
 func AudioToPCMData(audioFile string) ([][]byte, float64, error) {
+	return AudioToPCMDataWithRate(audioFile, DefaultAudioParams.SampleRate)
+}
+
+// AudioToPCMDataWithRate 将mp3解码为指定采样率的单声道PCM
+func AudioToPCMDataWithRate(audioFile string, targetSampleRate int) ([][]byte, float64, error) {
 	file, err := os.Open(audioFile)
 	if err != nil {
 		return nil, 0, fmt.Errorf("打开音频文件失败: %v", err)
@@ -329,8 +334,6 @@ func AudioToPCMData(audioFile string) ([][]byte, float64, error) {
 
 	mp3SampleRate := decoder.SampleRate()
 	//fmt.Println("AudioToPCMData 原始MP3采样率:", mp3SampleRate)
-	// 目标采样率设为24kHz
-	targetSampleRate := 24000
 
 	// decoder.Length() 返回解码后的PCM数据总字节数 (16-bit little-endian stereo)
 	pcmBytes := make([]byte, decoder.Length())
@@ -370,8 +373,7 @@ func AudioToPCMData(audioFile string) ([][]byte, float64, error) {
 	var finalSampleRate int
 
 	if mp3SampleRate != targetSampleRate {
-		fmt.Printf("重采样从 %dHz 到 %dHz\n", mp3SampleRate, targetSampleRate)
-		resampledPcmInt16 = resamplePCM(pcmMonoInt16, mp3SampleRate, targetSampleRate)
+		resampledPcmInt16 = ResamplePCM(pcmMonoInt16, mp3SampleRate, targetSampleRate)
 		finalSampleRate = targetSampleRate
 	} else {
 		resampledPcmInt16 = pcmMonoInt16
@@ -393,42 +395,9 @@ func AudioToPCMData(audioFile string) ([][]byte, float64, error) {
 	return [][]byte{monoPcmDataBytes}, duration, nil
 }
 
-// AudioToOpusData 将音频文件转换为Opus数据块
+// AudioToOpusData 将音频文件转换为默认参数(24kHz/60ms)的Opus数据块
 func AudioToOpusData(audioFile string) ([][]byte, float64, error) {
-
-	var pcmData [][]byte
-	var err error
-	var duration float64
-
-	// 获取采样率 (固定使用24000Hz作为Opus编码的采样率)
-	// 如果采样率不是24000Hz，PCMSlicesToOpusData会处理重采样
-	opusSampleRate := 24000
-	channels := 1
-
-	if strings.HasSuffix(audioFile, ".mp3") {
-		// 先将MP3转为PCM
-		pcmData, duration, err = AudioToPCMData(audioFile)
-		if err != nil {
-			return nil, 0, fmt.Errorf("PCM转换失败: %v", err)
-		}
-
-		if len(pcmData) == 0 {
-			return nil, 0, fmt.Errorf("PCM转换结果为空")
-		}
-
-	} else {
-		var singlePcmData []byte
-		singlePcmData, _ = ReadPCMDataFromWavFile(audioFile)
-		pcmData = [][]byte{singlePcmData}
-	}
-
-	// 将PCM转换为Opus
-	opusData, err := PCMSlicesToOpusData(pcmData, opusSampleRate, channels, 0)
-	if err != nil {
-		return nil, 0, fmt.Errorf("PCM转Opus失败: %v", err)
-	}
-
-	return opusData, duration, nil
+	return AudioToFrames(audioFile, DefaultAudioParams)
 }
 
 // CopyAudioFile 复制音频文件
@@ -666,8 +635,13 @@ func MP3ToOpusFile(inputFile, outputFile string, bitrate int) error {
 	return SaveAudioFile(opusData, outputFile)
 }
 
-// PCMSlicesToOpusData 将PCM数据切片批量编码为Opus格式
+// PCMSlicesToOpusData 将PCM数据切片批量编码为60ms帧的Opus格式
 func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitrate int) ([][]byte, error) {
+	return PCMSlicesToOpusFrames(pcmSlices, sampleRate, channels, bitrate, 60)
+}
+
+// PCMSlicesToOpusFrames 将PCM数据切片按指定帧长(ms)批量编码为Opus格式
+func PCMSlicesToOpusFrames(pcmSlices [][]byte, sampleRate int, channels int, bitrate int, frameDuration int) ([][]byte, error) {
 	if len(pcmSlices) == 0 {
 		return nil, fmt.Errorf("PCM数据切片为空")
 	}
@@ -677,13 +651,17 @@ func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitra
 	if !supportedRates[sampleRate] {
 		return nil, fmt.Errorf("采样率 %dHz 不被Opus支持，仅支持8000/12000/16000/24000/48000Hz", sampleRate)
 	}
+	frameSize, ok := opusFrameSizes[frameDuration]
+	if !ok {
+		return nil, fmt.Errorf("帧长 %dms 不被支持，仅支持20/40/60/80/100/120ms", frameDuration)
+	}
 
 	// 创建Opus编码器
 	encoder, err := opus.CreateOpusEncoder(&opus.OpusEncoderConfig{
 		SampleRate:    sampleRate,
 		MaxChannels:   channels,
 		Application:   opus.AppVoIP,
-		FrameDuration: opus.Framesize60Ms, // 使用60ms帧长
+		FrameDuration: frameSize,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("创建Opus编码器失败: %v", err)
@@ -693,8 +671,8 @@ func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitra
 	// 所有编码后的Opus数据包
 	var allOpusPackets [][]byte
 
-	// 计算每帧样本数 (60ms帧)
-	samplesPerFrame := (sampleRate * 60) / 1000 // 60ms帧
+	// 计算每帧样本数
+	samplesPerFrame := (sampleRate * frameDuration) / 1000
 	// 每个样本的字节数 (16位 = 2字节)
 	bytesPerSample := 2 * channels
 	// 每帧字节数
@@ -763,47 +741,3 @@ func PCMSlicesToOpusData(pcmSlices [][]byte, sampleRate int, channels int, bitra
 
 	return allOpusPackets, nil
 }
-
-// resamplePCM 使用线性插值对PCM数据进行重采样
-func resamplePCM(input []int16, inputSampleRate, outputSampleRate int) []int16 {
-	if inputSampleRate == outputSampleRate {
-		return input
-	}
-
-	inputLength := len(input)
-	if inputLength == 0 {
-		return []int16{}
-	}
-
-	// 计算重采样比率
-	ratio := float64(inputSampleRate) / float64(outputSampleRate)
-	outputLength := int(float64(inputLength) / ratio)
-
-	if outputLength == 0 {
-		return []int16{}
-	}
-
-	output := make([]int16, outputLength)
-
-	for i := 0; i < outputLength; i++ {
-		// 计算在输入数组中的位置
-		srcIndex := float64(i) * ratio
-
-		// 获取整数和小数部分
-		index := int(srcIndex)
-		fraction := srcIndex - float64(index)
-
-		if index >= inputLength-1 {
-			// 如果超出边界，使用最后一个样本
-			output[i] = input[inputLength-1]
-		} else {
-			// 线性插值
-			sample1 := float64(input[index])
-			sample2 := float64(input[index+1])
-			interpolated := sample1 + fraction*(sample2-sample1)
-			output[i] = int16(interpolated)
-		}
-	}
-
-	return output
-}
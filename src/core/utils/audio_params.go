@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	opus "github.com/qrtc/opus-go"
+)
+
+// AudioParams 下行音频参数
+type AudioParams struct {
+	Format        string // opus 或 pcm
+	SampleRate    int
+	Channels      int
+	FrameDuration int // 每帧时长(ms)
+}
+
+// DefaultAudioParams 默认下行音频参数，预合成和预转码的opus缓存都使用该参数
+var DefaultAudioParams = AudioParams{Format: "opus", SampleRate: 24000, Channels: 1, FrameDuration: 60}
+
+var (
+	// SupportedOutputSampleRates 下行支持的采样率，从低到高
+	SupportedOutputSampleRates = []int{8000, 16000, 24000, 48000}
+	// opusFrameSizes 下行支持的帧长与编码器参数
+	opusFrameSizes = map[int]opus.FrameSizeType{
+		20:  opus.Framesize20Ms,
+		40:  opus.Framesize40Ms,
+		60:  opus.Framesize60Ms,
+		80:  opus.Framesize80Ms,
+		100: opus.Framesize100Ms,
+		120: opus.Framesize120Ms,
+	}
+)
+
+// NegotiateAudioParams 根据客户端hello中的audio_params协商下行音频参数
+// 只看output_format/output_sample_rate/output_frame_duration，未指定的项保持默认值；
+// 上行的sample_rate/frame_duration只描述设备上传的音频，不参与协商，
+// 否则上传16k的设备每个连接都要转码，也用不上opus缓存；
+// 没有output_format时沿用format，兼容上传pcm就要求下发pcm的旧设备；
+// 格式不支持时回退为opus，采样率取不超过请求值的最高支持采样率（低于8k取8k），帧长不支持时回退为60ms
+func NegotiateAudioParams(audioParams map[string]interface{}) AudioParams {
+	params := DefaultAudioParams
+	if audioParams == nil {
+		return params
+	}
+
+	format, ok := stringParam(audioParams, "output_format")
+	if !ok {
+		format, ok = stringParam(audioParams, "format")
+	}
+	if ok {
+		format = strings.ToLower(format)
+		if format == "opus" || format == "pcm" {
+			params.Format = format
+		}
+	}
+	if rate, ok := numberParam(audioParams, "output_sample_rate"); ok {
+		params.SampleRate = nearestSampleRate(rate)
+	}
+	if duration, ok := numberParam(audioParams, "output_frame_duration"); ok {
+		if _, supported := opusFrameSizes[duration]; supported {
+			params.FrameDuration = duration
+		}
+	}
+	return params
+}
+
+// IsDefault 是否为默认参数，只有默认参数才能直接使用opus缓存
+func (p AudioParams) IsDefault() bool {
+	return p == DefaultAudioParams
+}
+
+// FrameBytes 每帧PCM字节数
+func (p AudioParams) FrameBytes() int {
+	return p.SampleRate * p.FrameDuration / 1000 * 2 * p.Channels
+}
+
+func (p AudioParams) String() string {
+	return fmt.Sprintf("%s/%dHz/%dch/%dms", p.Format, p.SampleRate, p.Channels, p.FrameDuration)
+}
+
+// AudioToFrames 将mp3或wav文件转换为按参数分帧的下行音频数据
+func AudioToFrames(audioFile string, params AudioParams) ([][]byte, float64, error) {
+	var pcmData []byte
+	var duration float64
+	if strings.HasSuffix(strings.ToLower(audioFile), ".mp3") {
+		slices, d, err := AudioToPCMDataWithRate(audioFile, params.SampleRate)
+		if err != nil {
+			return nil, 0, fmt.Errorf("PCM转换失败: %v", err)
+		}
+		if len(slices) == 0 || len(slices[0]) == 0 {
+			return nil, 0, fmt.Errorf("PCM转换结果为空")
+		}
+		pcmData, duration = slices[0], d
+	} else {
+		data, sampleRate, err := ReadWavPCM(audioFile)
+		if err != nil {
+			return nil, 0, err
+		}
+		pcmData = ResamplePCMBytes(data, sampleRate, params.SampleRate)
+		duration = float64(len(pcmData)/2) / float64(params.SampleRate)
+	}
+
+	if params.Format == "pcm" {
+		return SplitPCMFrames(pcmData, params.FrameBytes()), duration, nil
+	}
+	frames, err := PCMSlicesToOpusFrames([][]byte{pcmData}, params.SampleRate, params.Channels, 0, params.FrameDuration)
+	if err != nil {
+		return nil, 0, fmt.Errorf("PCM转Opus失败: %v", err)
+	}
+	return frames, duration, nil
+}
+
+// SplitPCMFrames 将PCM按帧切分，最后一帧补静音
+func SplitPCMFrames(pcmData []byte, frameBytes int) [][]byte {
+	if frameBytes <= 0 {
+		return [][]byte{pcmData}
+	}
+	var frames [][]byte
+	for start := 0; start < len(pcmData); start += frameBytes {
+		frame := make([]byte, frameBytes)
+		copy(frame, pcmData[start:])
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// ReadWavPCM 读取wav文件的单声道16位PCM数据和采样率，立体声会混为单声道
+func ReadWavPCM(filePath string) ([]byte, int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("打开WAV文件失败: %v", err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 44)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, 0, fmt.Errorf("读取WAV头失败: %v", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("不是有效的WAV文件: %s", filePath)
+	}
+	channels := int(binary.LittleEndian.Uint16(header[22:24]))
+	sampleRate := int(binary.LittleEndian.Uint32(header[24:28]))
+	bitsPerSample := int(binary.LittleEndian.Uint16(header[34:36]))
+	if bitsPerSample != 16 {
+		return nil, 0, fmt.Errorf("仅支持16位WAV，当前为%d位", bitsPerSample)
+	}
+
+	pcmData, err := io.ReadAll(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取PCM数据失败: %v", err)
+	}
+	if channels == 2 {
+		stereo := PCMBytesToInt16(pcmData)
+		mono := make([]int16, len(stereo)/2)
+		for i := range mono {
+			mono[i] = int16((int32(stereo[i*2]) + int32(stereo[i*2+1])) / 2)
+		}
+		pcmData = Int16ToPCMBytes(mono)
+	}
+	return pcmData, sampleRate, nil
+}
+
+// WavBytes 为16位单声道PCM加上wav头
+func WavBytes(pcmData []byte, sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcmData)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // 单声道
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcmData)))
+	buf.Write(pcmData)
+	return buf.Bytes()
+}
+
+// nearestSampleRate 取不超过请求值的最高支持采样率
+func nearestSampleRate(rate int) int {
+	result := SupportedOutputSampleRates[0]
+	for _, supported := range SupportedOutputSampleRates {
+		if supported <= rate {
+			result = supported
+		}
+	}
+	return result
+}
+
+func stringParam(m map[string]interface{}, key string) (string, bool) {
+	value, ok := m[key].(string)
+	return value, ok && value != ""
+}
+
+func numberParam(m map[string]interface{}, key string) (int, bool) {
+	value, ok := m[key].(float64)
+	return int(value), ok && value > 0
+}
@@ -7,9 +7,12 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // LogLevel 日志级别
@@ -29,12 +32,27 @@ const (
 var DefaultLogger *Logger
 
 type LogCfg struct {
-	LogFormat string `yaml:"log_format" json:"log_format"`
-	LogLevel  string `yaml:"log_level" json:"log_level"`
-	LogDir    string `yaml:"log_dir" json:"log_dir"`
-	LogFile   string `yaml:"log_file" json:"log_file"`
+	LogFormat    string            `yaml:"log_format" json:"log_format"`
+	LogLevel     string            `yaml:"log_level" json:"log_level"`
+	LogDir       string            `yaml:"log_dir" json:"log_dir"`
+	LogFile      string            `yaml:"log_file" json:"log_file"`
+	ModuleLevels map[string]string `yaml:"module_levels" json:"module_levels"` // 按模块覆盖日志级别，如 mcp: DEBUG
 }
 
+// 日志中固定的字段名，文件中的JSON日志按这些字段检索
+const (
+	FieldModule    = "module"
+	FieldDeviceID  = "device_id"
+	FieldSessionID = "session_id"
+	FieldClientID  = "client_id"
+	FieldTransport = "transport"
+	FieldRound     = "round"
+	FieldTextIndex = "text_index"
+	FieldError     = "error"
+	FieldTraceID   = "trace_id"
+	FieldSpanID    = "span_id"
+)
+
 type colorWriter struct {
 	w  io.Writer
 	mu sync.Mutex
@@ -76,11 +94,17 @@ type Logger struct {
 	mu          sync.RWMutex  // 读写锁保护
 	ticker      *time.Ticker  // 定时器
 	stopCh      chan struct{} // 停止信号
+
+	root    *Logger                // 派生日志记录器共享root的输出和轮转
+	ctxFunc func() context.Context // 返回当前上下文，日志自动附带其中的trace_id
+	attrs   []slog.Attr            // With附加的字段
+	module  string                 // 所属模块
+	level   slog.Level             // 生效的日志级别
 }
 
 // configLogLevelToSlogLevel 将配置中的日志级别转换为slog.Level
 func configLogLevelToSlogLevel(configLevel string) slog.Level {
-	switch configLevel {
+	switch strings.ToUpper(configLevel) {
 	case "DEBUG":
 		return slog.LevelDebug
 	case "INFO":
@@ -108,18 +132,14 @@ func NewLogger(config *LogCfg) (*Logger, error) {
 		return nil, fmt.Errorf("打开日志文件失败: %v", err)
 	}
 
-	// 设置slog级别
-	slogLevel := configLogLevelToSlogLevel(config.LogLevel)
+	// 级别由Logger按模块过滤，处理器不再过滤
+	handlerOptions := &slog.HandlerOptions{Level: slog.LevelDebug}
 
 	// 创建JSON处理器（用于文件输出）
-	jsonHandler := slog.NewJSONHandler(file, &slog.HandlerOptions{
-		Level: slogLevel,
-	})
+	jsonHandler := slog.NewJSONHandler(file, handlerOptions)
 
 	// 创建文本处理器（用于控制台输出）
-	textHandler := slog.NewTextHandler(&colorWriter{w: os.Stdout}, &slog.HandlerOptions{
-		Level: slogLevel,
-	})
+	textHandler := slog.NewTextHandler(&colorWriter{w: os.Stdout}, handlerOptions)
 
 	// 创建logger实例
 	jsonLogger := slog.New(jsonHandler)
@@ -132,6 +152,7 @@ func NewLogger(config *LogCfg) (*Logger, error) {
 		logFile:     file,
 		currentDate: time.Now().Format("2006-01-02"),
 		stopCh:      make(chan struct{}),
+		level:       configLogLevelToSlogLevel(config.LogLevel),
 	}
 
 	// 启动日志轮转检查器
@@ -206,9 +227,8 @@ func (l *Logger) rotateLogFile(newDate string) {
 	l.currentDate = newDate
 
 	// 重新创建JSON处理器
-	slogLevel := configLogLevelToSlogLevel(l.config.LogLevel)
 	jsonHandler := slog.NewJSONHandler(file, &slog.HandlerOptions{
-		Level: slogLevel,
+		Level: slog.LevelDebug,
 	})
 	l.jsonLogger = slog.New(jsonHandler)
 
@@ -265,8 +285,116 @@ func (l *Logger) cleanOldLogs() {
 	}
 }
 
+// With 派生带固定字段的日志记录器，参数为键值对，如 With("device_id", id, "round", 1)
+func (l *Logger) With(args ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := l.derive()
+	child.attrs = append(child.attrs, argsToAttrs(args)...)
+	return child
+}
+
+// Module 派生属于指定模块的日志记录器，日志带module字段，级别使用log.module_levels中的配置
+func (l *Logger) Module(name string) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := l.derive()
+	child.module = name
+	if level, ok := l.config.ModuleLevels[name]; ok {
+		child.level = configLogLevelToSlogLevel(level)
+	}
+	return child
+}
+
+// WithContext 派生日志记录器，日志附带ctx中span的trace_id和span_id
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	return l.WithContextFunc(func() context.Context { return ctx })
+}
+
+// WithContextFunc 派生日志记录器，每次记录时调用fn取当前上下文，适合span随对话轮次变化的场景
+func (l *Logger) WithContextFunc(fn func() context.Context) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := l.derive()
+	child.ctxFunc = fn
+	return child
+}
+
+// derive 复制字段、模块、级别和上下文，共享root的输出
+func (l *Logger) derive() *Logger {
+	return &Logger{
+		config:  l.config,
+		root:    l.base(),
+		ctxFunc: l.ctxFunc,
+		attrs:   append([]slog.Attr(nil), l.attrs...),
+		module:  l.module,
+		level:   l.level,
+	}
+}
+
+// Enabled 是否会记录该级别的日志
+func (l *Logger) Enabled(level slog.Level) bool {
+	return level >= l.level
+}
+
+// argsToAttrs 把键值对转换为slog属性，键不是字符串或缺少值时放入!BADKEY
+func argsToAttrs(args []interface{}) []slog.Attr {
+	var attrs []slog.Attr
+	for len(args) > 0 {
+		if attr, ok := args[0].(slog.Attr); ok {
+			attrs = append(attrs, attr)
+			args = args[1:]
+			continue
+		}
+		key, ok := args[0].(string)
+		if !ok || len(args) < 2 {
+			attrs = append(attrs, slog.Any("!BADKEY", args[0]))
+			args = args[1:]
+			continue
+		}
+		attrs = append(attrs, attrValue(key, args[1]))
+		args = args[2:]
+	}
+	return attrs
+}
+
+// attrValue error类型记录为字符串，避免JSON输出为空对象
+func attrValue(key string, value interface{}) slog.Attr {
+	if err, ok := value.(error); ok && err != nil {
+		return slog.String(key, err.Error())
+	}
+	return slog.Any(key, value)
+}
+
+// isKeyValues 参数是否为键值对形式
+func isKeyValues(args []interface{}) bool {
+	if len(args)%2 != 0 {
+		return false
+	}
+	for i := 0; i < len(args); i += 2 {
+		if _, ok := args[i].(string); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// base 实际持有输出和轮转状态的日志记录器
+func (l *Logger) base() *Logger {
+	if l.root != nil {
+		return l.root
+	}
+	return l
+}
+
 // Close 关闭日志文件
 func (l *Logger) Close() error {
+	if l.root != nil {
+		return nil // 派生的日志记录器不持有文件
+	}
 	// 停止定时器
 	if l.ticker != nil {
 		l.ticker.Stop()
@@ -283,76 +411,107 @@ func (l *Logger) Close() error {
 }
 
 // log 通用日志记录函数（内部使用）
+// fields可以是键值对、单个map或任意值，map按键排序输出
 func (l *Logger) log(level slog.Level, msg string, fields ...interface{}) {
-	// 使用读锁保护并发访问
-	l.mu.RLock()
-	defer l.mu.RUnlock()
+	if !l.Enabled(level) {
+		return
+	}
 
-	// 构建slog属性
-	var attrs []slog.Attr
+	// 使用读锁保护并发访问
+	base := l.base()
+	base.mu.RLock()
+	defer base.mu.RUnlock()
+
+	// 构建slog属性：模块、With字段、本次字段、trace
+	attrs := make([]slog.Attr, 0, len(l.attrs)+len(fields)+3)
+	if l.module != "" {
+		attrs = append(attrs, slog.String(FieldModule, l.module))
+	}
+	attrs = append(attrs, l.attrs...)
 	if len(fields) > 0 && fields[0] != nil {
-		// 处理fields参数
-		if fieldsMap, ok := fields[0].(map[string]interface{}); ok {
-			for k, v := range fieldsMap {
-				attrs = append(attrs, slog.Any(k, v))
+		if fieldsMap, ok := fields[0].(map[string]interface{}); ok && len(fields) == 1 {
+			keys := make([]string, 0, len(fieldsMap))
+			for k := range fieldsMap {
+				keys = append(keys, k)
 			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				attrs = append(attrs, attrValue(k, fieldsMap[k]))
+			}
+		} else if isKeyValues(fields) {
+			attrs = append(attrs, argsToAttrs(fields)...)
 		} else {
-			// 如果不是map，直接作为fields字段
+			// 其他形式直接作为fields字段
 			attrs = append(attrs, slog.Any("fields", fields[0]))
 		}
 	}
 
-	// 同时写入文件（JSON）和控制台（文本）
+	// 附带当前span的trace_id，便于按一次对话检索日志
 	ctx := context.Background()
-	l.jsonLogger.LogAttrs(ctx, level, msg, attrs...)
-	l.textLogger.LogAttrs(ctx, level, msg, attrs...)
+	if l.ctxFunc != nil {
+		if c := l.ctxFunc(); c != nil {
+			ctx = c
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		attrs = append(attrs,
+			slog.String(FieldTraceID, sc.TraceID().String()),
+			slog.String(FieldSpanID, sc.SpanID().String()))
+	}
+
+	// 同时写入文件（JSON）和控制台（文本）
+	base.jsonLogger.LogAttrs(ctx, level, msg, attrs...)
+	base.textLogger.LogAttrs(ctx, level, msg, attrs...)
 }
 
-// Debug 记录调试级别日志
-func (l *Logger) Debug(msg string, args ...interface{}) {
-	if l.config.LogLevel == "DEBUG" {
-		if len(args) > 0 && containsFormatPlaceholders(msg) {
-			formattedMsg := fmt.Sprintf(msg, args...)
-			l.log(slog.LevelDebug, formattedMsg)
-		} else {
-			l.log(slog.LevelDebug, msg, args...)
-		}
+// logf 按printf格式化消息，没有参数时消息原样输出
+func (l *Logger) logf(level slog.Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	msg := format
+	if len(args) > 0 {
+		msg = fmt.Sprintf(format, args...)
 	}
+	l.log(level, msg)
 }
 
-func containsFormatPlaceholders(s string) bool {
-	return strings.Contains(s, "%")
+// Debug 记录调试级别日志，按printf格式化
+func (l *Logger) Debug(format string, args ...interface{}) {
+	l.logf(slog.LevelDebug, format, args...)
 }
 
-// Info 记录信息级别日志
-func (l *Logger) Info(msg string, args ...interface{}) {
-	// 检测是否为格式化模式
-	if len(args) > 0 && containsFormatPlaceholders(msg) {
-		// 格式化模式：类似 Info
-		formattedMsg := fmt.Sprintf(msg, args...)
-		l.log(slog.LevelInfo, formattedMsg)
-	} else {
-		// 结构化模式：原有方式
-		l.log(slog.LevelInfo, msg, args...)
-	}
+// Info 记录信息级别日志，按printf格式化
+func (l *Logger) Info(format string, args ...interface{}) {
+	l.logf(slog.LevelInfo, format, args...)
 }
 
-// Warn 记录警告级别日志
-func (l *Logger) Warn(msg string, args ...interface{}) {
-	if len(args) > 0 && containsFormatPlaceholders(msg) {
-		formattedMsg := fmt.Sprintf(msg, args...)
-		l.log(slog.LevelWarn, formattedMsg)
-	} else {
-		l.log(slog.LevelWarn, msg, args...)
-	}
+// Warn 记录警告级别日志，按printf格式化
+func (l *Logger) Warn(format string, args ...interface{}) {
+	l.logf(slog.LevelWarn, format, args...)
 }
 
-// Error 记录错误级别日志
-func (l *Logger) Error(msg string, args ...interface{}) {
-	if len(args) > 0 && containsFormatPlaceholders(msg) {
-		formattedMsg := fmt.Sprintf(msg, args...)
-		l.log(slog.LevelError, formattedMsg)
-	} else {
-		l.log(slog.LevelError, msg, args...)
-	}
+// Error 记录错误级别日志，按printf格式化
+func (l *Logger) Error(format string, args ...interface{}) {
+	l.logf(slog.LevelError, format, args...)
+}
+
+// DebugKV 记录调试级别的结构化日志，fields为键值对或单个map
+func (l *Logger) DebugKV(msg string, fields ...interface{}) {
+	l.log(slog.LevelDebug, msg, fields...)
+}
+
+// InfoKV 记录信息级别的结构化日志，fields为键值对或单个map
+func (l *Logger) InfoKV(msg string, fields ...interface{}) {
+	l.log(slog.LevelInfo, msg, fields...)
+}
+
+// WarnKV 记录警告级别的结构化日志，fields为键值对或单个map
+func (l *Logger) WarnKV(msg string, fields ...interface{}) {
+	l.log(slog.LevelWarn, msg, fields...)
+}
+
+// ErrorKV 记录错误级别的结构化日志，fields为键值对或单个map
+func (l *Logger) ErrorKV(msg string, fields ...interface{}) {
+	l.log(slog.LevelError, msg, fields...)
 }
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLoggerTraceID(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := NewLogger(&LogCfg{LogLevel: "INFO", LogDir: dir, LogFile: "test.log"})
+	if err != nil {
+		t.Fatalf("创建日志记录器失败: %v", err)
+	}
+	defer logger.Close()
+
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	spanCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	tests := []struct {
+		name    string
+		logger  *Logger
+		msg     string
+		wantIDs bool
+	}{
+		{name: "无上下文", logger: logger, msg: "plain", wantIDs: false},
+		{name: "带span上下文", logger: logger.WithContext(spanCtx), msg: "traced", wantIDs: true},
+		{name: "上下文函数返回nil", logger: logger.WithContextFunc(func() context.Context { return nil }), msg: "nilctx", wantIDs: false},
+	}
+
+	for _, tt := range tests {
+		tt.logger.Info("%s", tt.msg)
+	}
+	// 派生的日志记录器不关闭共享的文件
+	if err := tests[1].logger.Close(); err != nil {
+		t.Fatalf("关闭派生日志记录器失败: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "test.log"))
+	if err != nil {
+		t.Fatalf("读取日志文件失败: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var line string
+			for _, l := range lines {
+				if strings.Contains(l, `"msg":"`+tt.msg+`"`) {
+					line = l
+				}
+			}
+			if line == "" {
+				t.Fatalf("未找到日志: %s", tt.msg)
+			}
+			hasIDs := strings.Contains(line, `"trace_id":"0af7651916cd43dd8448eb211c80319c"`) &&
+				strings.Contains(line, `"span_id":"b7ad6b7169203331"`)
+			if hasIDs != tt.wantIDs {
+				t.Errorf("trace_id = %v, 期望 %v: %s", hasIDs, tt.wantIDs, line)
+			}
+		})
+	}
+}
+
+func TestLoggerFieldsAndModuleLevels(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := NewLogger(&LogCfg{
+		LogLevel:     "INFO",
+		LogDir:       dir,
+		LogFile:      "test.log",
+		ModuleLevels: map[string]string{"mcp": "DEBUG", "pool": "WARN"},
+	})
+	if err != nil {
+		t.Fatalf("创建日志记录器失败: %v", err)
+	}
+	defer logger.Close()
+
+	session := logger.Module("connection").With(FieldDeviceID, "aa:bb", FieldSessionID, "s1")
+	logger.Module("mcp").Debug("mcp-debug")
+	logger.Module("pool").Info("pool-info")
+	logger.Debug("root-debug")
+	session.InfoKV("kv", FieldRound, 3, FieldError, os.ErrNotExist)
+	session.InfoKV("map", map[string]interface{}{"b": 2, "a": 1})
+	session.Info("format %d", 7)
+
+	data, err := os.ReadFile(filepath.Join(dir, "test.log"))
+	if err != nil {
+		t.Fatalf("读取日志文件失败: %v", err)
+	}
+	content := string(data)
+
+	tests := []struct {
+		name     string
+		contains []string
+		absent   string
+	}{
+		{name: "模块级别放宽到DEBUG", contains: []string{`"msg":"mcp-debug","module":"mcp"`}},
+		{name: "模块级别收紧到WARN", absent: `"msg":"pool-info"`},
+		{name: "全局级别过滤DEBUG", absent: `"msg":"root-debug"`},
+		{name: "With字段和键值对", contains: []string{
+			`"msg":"kv","module":"connection","device_id":"aa:bb","session_id":"s1","round":3,"error":"file does not exist"`,
+		}},
+		{name: "map字段按键排序", contains: []string{`"msg":"map","module":"connection","device_id":"aa:bb","session_id":"s1","a":1,"b":2`}},
+		{name: "格式化消息", contains: []string{`"msg":"format 7","module":"connection"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, want := range tt.contains {
+				if !strings.Contains(content, want) {
+					t.Errorf("日志缺少 %s\n%s", want, content)
+				}
+			}
+			if tt.absent != "" && strings.Contains(content, tt.absent) {
+				t.Errorf("日志不应包含 %s", tt.absent)
+			}
+		})
+	}
+}
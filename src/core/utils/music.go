@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -56,6 +57,10 @@ func IsMusicFile(filePath string) bool {
 	if strings.Contains(filePath, "/music/") || strings.Contains(filePath, "\\music\\") {
 		return true
 	}
+	// 导入的歌曲使用相对路径 music/xxx.mp3
+	if strings.HasPrefix(filepath.ToSlash(filepath.Clean(filePath)), "music/") {
+		return true
+	}
 	return false
 }
 
@@ -93,7 +98,7 @@ func GetFileNameFromPath(filePath string) string {
 
 // 根据音乐文件名获取音乐文件路径（模糊匹配）
 func GetMusicFilePathFuzzy(songName string) (string, string, error) {
-	musicDir := "./music"
+	musicDir := DefaultMusicDir
 
 	if songName == "random" || songName == "随机" {
 		// 如果是随机请求，直接返回一个随机音乐文件
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// DefaultMusicDir 默认音乐目录
+	DefaultMusicDir = "./music"
+	// MusicOpusDir 预转码的opus缓存目录
+	MusicOpusDir = "music-opus"
+)
+
+// GetMusicOpusPaths 获取歌曲对应的opus缓存文件和时长文件路径
+func GetMusicOpusPaths(songFilepath string) (string, string) {
+	filename := filepath.Base(songFilepath)
+	filenameWithoutExt := strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	opusFilePath := filepath.Join(MusicOpusDir, filenameWithoutExt+"_.opus")
+	durationFilePath := filepath.Join(MusicOpusDir, filenameWithoutExt+"_.duration")
+	return opusFilePath, durationFilePath
+}
+
+// IsMusicOpusCached 检查歌曲是否已预转码
+func IsMusicOpusCached(songFilepath string) bool {
+	opusFilePath, durationFilePath := GetMusicOpusPaths(songFilepath)
+	if _, err := os.Stat(opusFilePath); err != nil {
+		return false
+	}
+	if _, err := os.Stat(durationFilePath); err != nil {
+		return false
+	}
+	return true
+}
+
+// SaveMusicOpusCache 保存opus帧和时长到缓存目录
+func SaveMusicOpusCache(songFilepath string, audioData [][]byte, duration float64) error {
+	opusFilePath, durationFilePath := GetMusicOpusPaths(songFilepath)
+	return SaveOpusFrames(opusFilePath, durationFilePath, audioData, duration)
+}
+
+// LoadMusicOpusCache 从缓存目录读取opus帧和时长
+func LoadMusicOpusCache(songFilepath string) ([][]byte, float64, error) {
+	opusFilePath, durationFilePath := GetMusicOpusPaths(songFilepath)
+	return LoadOpusFrames(opusFilePath, durationFilePath)
+}
+
+// SaveOpusFrames 保存opus帧（每帧前带4字节小端长度）和时长文件
+func SaveOpusFrames(opusFilePath, durationFilePath string, audioData [][]byte, duration float64) error {
+	if err := os.MkdirAll(filepath.Dir(opusFilePath), 0755); err != nil {
+		return fmt.Errorf("创建opus目录失败: %v", err)
+	}
+
+	size := 0
+	for _, data := range audioData {
+		size += 4 + len(data)
+	}
+	buf := make([]byte, 0, size)
+	lengthBytes := make([]byte, 4)
+	for _, data := range audioData {
+		binary.LittleEndian.PutUint32(lengthBytes, uint32(len(data)))
+		buf = append(buf, lengthBytes...)
+		buf = append(buf, data...)
+	}
+	if err := SaveAudioFile(buf, opusFilePath); err != nil {
+		return fmt.Errorf("保存Opus文件失败: %v", err)
+	}
+
+	if err := os.WriteFile(durationFilePath, []byte(fmt.Sprintf("%f", duration)), 0644); err != nil {
+		return fmt.Errorf("保存duration文件失败: %v", err)
+	}
+	return nil
+}
+
+// LoadOpusFrames 读取SaveOpusFrames保存的opus帧和时长
+func LoadOpusFrames(opusFilePath, durationFilePath string) ([][]byte, float64, error) {
+	opusData, err := os.ReadFile(opusFilePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取Opus文件失败: %v", err)
+	}
+
+	audioData := [][]byte{}
+	offset := 0
+	dataLen := len(opusData)
+	for offset < dataLen {
+		if offset+4 > dataLen {
+			return nil, 0, fmt.Errorf("Opus文件格式错误：缺少足够的长度信息")
+		}
+		length := int(binary.LittleEndian.Uint32(opusData[offset : offset+4]))
+		offset += 4
+
+		if offset+length > dataLen {
+			return nil, 0, fmt.Errorf("Opus文件格式错误：数据长度不足")
+		}
+		audioData = append(audioData, opusData[offset:offset+length])
+		offset += length
+	}
+
+	// 如果解析后的帧数量为0，则使用原始数据作为备选
+	if len(audioData) == 0 {
+		audioData = [][]byte{opusData}
+	}
+
+	durationData, err := os.ReadFile(durationFilePath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取duration文件失败: %v", err)
+	}
+	var duration float64
+	fmt.Sscanf(string(durationData), "%f", &duration)
+
+	return audioData, duration, nil
+}
+
+// TranscodeMusicToOpus 将歌曲转码为opus帧并写入缓存
+func TranscodeMusicToOpus(songFilepath string) ([][]byte, float64, error) {
+	audioData, duration, err := AudioToOpusData(songFilepath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("音频转Opus失败: %v", err)
+	}
+	if err := SaveMusicOpusCache(songFilepath, audioData, duration); err != nil {
+		return audioData, duration, err
+	}
+	return audioData, duration, nil
+}
+
+// RemoveMusicOpusCache 删除歌曲的opus缓存
+func RemoveMusicOpusCache(songFilepath string) error {
+	opusFilePath, durationFilePath := GetMusicOpusPaths(songFilepath)
+	for _, p := range []string{opusFilePath, durationFilePath} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetMusicNamesCache 清空歌曲名缓存，音乐目录变更后调用
+func ResetMusicNamesCache() {
+	musicNames = nil
+}
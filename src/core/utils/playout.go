@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	playoutBaseFrames    = 3  // 最小预缓冲帧数
+	playoutMaxFrames     = 10 // 设备未上报缓冲大小时的最大预缓冲帧数
+	playoutDecayInterval = 50 // 连续多少帧没有欠载后减少一帧额外缓冲
+)
+
+// PlayoutStats 下行音频播放统计
+type PlayoutStats struct {
+	BufferMs       int     `json:"buffer_ms"`        // 当前目标预缓冲时长
+	QueuedMs       int     `json:"queued_ms"`        // 估计设备端尚未播放的音频时长
+	WriteLatencyMs float64 `json:"write_latency_ms"` // 发送耗时的滑动平均
+	Underruns      int     `json:"underruns"`        // 一句话播放中设备缓冲被耗尽的次数
+	Frames         int64   `json:"frames"`           // 已发送帧数
+	DeviceBufferMs int     `json:"device_buffer_ms"` // 设备在hello中上报的缓冲大小，0表示未上报
+}
+
+// PlayoutScheduler 连接级的下行音频节拍器
+// 同一轮回复的多句音频共用一个时钟连续发送，句子之间不重新预缓冲；
+// 预缓冲深度根据发送耗时和欠载次数自适应，不超过设备上报的缓冲大小
+type PlayoutScheduler struct {
+	mu sync.Mutex
+
+	frameDuration time.Duration
+	deviceBuffer  time.Duration
+
+	streaming bool
+	idle      bool          // 一句音频已发完，正在等待下一句
+	start     time.Time     // 设备开始播放的估计时间
+	sent      time.Duration // 自start起已发送的音频时长
+
+	latency      time.Duration // 发送耗时的滑动平均
+	extraFrames  int           // 欠载后增加的预缓冲帧数
+	stableFrames int           // 连续无欠载的帧数
+	underruns    int
+	frames       int64
+}
+
+// NewPlayoutScheduler 创建节拍器，frameDuration为每帧音频时长
+func NewPlayoutScheduler(frameDuration time.Duration) *PlayoutScheduler {
+	return &PlayoutScheduler{frameDuration: frameDuration}
+}
+
+// SetFrameDuration 设置每帧音频时长
+func (s *PlayoutScheduler) SetFrameDuration(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d > 0 {
+		s.frameDuration = d
+	}
+}
+
+// SetDeviceBuffer 设置设备上报的播放缓冲大小，预缓冲不会超过它
+func (s *PlayoutScheduler) SetDeviceBuffer(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deviceBuffer = d
+}
+
+// Delay 发送下一帧前需要等待的时长，设备端缓冲不足目标值时立即发送
+func (s *PlayoutScheduler) Delay(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.streaming {
+		return 0
+	}
+	if wait := s.queued(now) - s.target(); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// OnSent 记录一帧已发送，writeLatency为本次发送耗时
+func (s *PlayoutScheduler) OnSent(now time.Time, writeLatency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch queued := s.queued(now); {
+	case !s.streaming:
+		s.streaming = true
+		s.start = now
+		s.sent = 0
+	case queued < 0 && s.idle:
+		// 句子之间等待合成时设备播完了缓冲，属于正常停顿，从现在重新计时
+		s.start = now.Add(-s.sent)
+	case queued < 0:
+		// 一句话中间的帧发送太晚，设备已经播完缓冲，从现在重新计时并增加预缓冲
+		s.underruns++
+		s.stableFrames = 0
+		if s.extraFrames < s.maxFrames() {
+			s.extraFrames++
+		}
+		s.start = now.Add(-s.sent)
+	default:
+		if s.stableFrames++; s.stableFrames >= playoutDecayInterval && s.extraFrames > 0 {
+			s.extraFrames--
+			s.stableFrames = 0
+		}
+	}
+	s.idle = false
+
+	s.sent += s.frameDuration
+	s.frames++
+	if s.latency == 0 {
+		s.latency = writeLatency
+	} else {
+		s.latency = (s.latency*7 + writeLatency) / 8
+	}
+}
+
+// Idle 一句音频发送完毕，下一帧到来前设备播完缓冲不计为欠载
+func (s *PlayoutScheduler) Idle() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idle = true
+}
+
+// Remaining 估计设备端尚未播放的音频时长
+func (s *PlayoutScheduler) Remaining(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.streaming {
+		return 0
+	}
+	if queued := s.queued(now); queued > 0 {
+		return queued
+	}
+	return 0
+}
+
+// Reset 一轮播放结束或被打断，下一帧重新开始计时
+func (s *PlayoutScheduler) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.streaming = false
+	s.idle = false
+	s.sent = 0
+}
+
+// Stats 当前播放统计
+func (s *PlayoutScheduler) Stats() PlayoutStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queued := time.Duration(0)
+	if s.streaming {
+		if queued = s.queued(time.Now()); queued < 0 {
+			queued = 0
+		}
+	}
+	return PlayoutStats{
+		BufferMs:       int(s.target().Milliseconds()),
+		QueuedMs:       int(queued.Milliseconds()),
+		WriteLatencyMs: float64(s.latency.Microseconds()) / 1000,
+		Underruns:      s.underruns,
+		Frames:         s.frames,
+		DeviceBufferMs: int(s.deviceBuffer.Milliseconds()),
+	}
+}
+
+// queued 已发送但设备尚未播放的时长，负数表示设备已播完
+func (s *PlayoutScheduler) queued(now time.Time) time.Duration {
+	return s.sent - now.Sub(s.start)
+}
+
+// target 目标预缓冲：基础帧数加上覆盖发送耗时的帧数和欠载补偿，不超过上限
+func (s *PlayoutScheduler) target() time.Duration {
+	if s.frameDuration <= 0 {
+		return 0
+	}
+	frames := playoutBaseFrames + s.extraFrames
+	frames += int((2*s.latency + s.frameDuration - 1) / s.frameDuration)
+	if max := s.maxFrames(); frames > max {
+		frames = max
+	}
+	return time.Duration(frames) * s.frameDuration
+}
+
+// maxFrames 预缓冲上限，设备上报缓冲时留出一帧余量
+func (s *PlayoutScheduler) maxFrames() int {
+	max := playoutMaxFrames
+	if s.deviceBuffer > 0 && s.frameDuration > 0 {
+		max = int(s.deviceBuffer/s.frameDuration) - 1
+	}
+	if max < 1 {
+		max = 1
+	}
+	return max
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// sendFrames 按节拍器的等待时间模拟发送n帧，返回结束时间
+func sendFrames(s *PlayoutScheduler, now time.Time, n int, latency time.Duration) time.Time {
+	for i := 0; i < n; i++ {
+		now = now.Add(s.Delay(now))
+		s.OnSent(now, latency)
+	}
+	return now
+}
+
+func TestPlayoutScheduler(t *testing.T) {
+	frame := 60 * time.Millisecond
+	start := time.Unix(0, 0)
+
+	t.Run("句子之间不重新预缓冲", func(t *testing.T) {
+		s := NewPlayoutScheduler(frame)
+		now := sendFrames(s, start, 20, time.Millisecond)
+		// 第二句紧接着发送，时钟连续，缓冲保持在目标值
+		now = sendFrames(s, now, 20, time.Millisecond)
+		stats := s.Stats()
+		if stats.Underruns != 0 || stats.Frames != 40 {
+			t.Fatalf("统计错误: %+v", stats)
+		}
+		if got := s.Remaining(now); got > time.Duration(stats.BufferMs)*time.Millisecond+frame {
+			t.Errorf("设备缓冲超过目标: %v", got)
+		}
+		if elapsed := now.Sub(start); elapsed < 40*frame-time.Duration(stats.BufferMs+60)*time.Millisecond {
+			t.Errorf("发送过快: %v", elapsed)
+		}
+	})
+
+	t.Run("欠载后增加预缓冲", func(t *testing.T) {
+		s := NewPlayoutScheduler(frame)
+		now := sendFrames(s, start, 10, time.Millisecond)
+		before := s.Stats().BufferMs
+		// 一句话中间的帧发送太晚，设备播完了缓冲
+		now = now.Add(2 * time.Second)
+		sendFrames(s, now, 1, time.Millisecond)
+		stats := s.Stats()
+		if stats.Underruns != 1 || stats.BufferMs <= before {
+			t.Errorf("欠载处理错误: %+v, 之前缓冲%dms", stats, before)
+		}
+	})
+
+	t.Run("句子之间的停顿不算欠载", func(t *testing.T) {
+		s := NewPlayoutScheduler(frame)
+		now := sendFrames(s, start, 10, time.Millisecond)
+		before := s.Stats().BufferMs
+		s.Idle()
+		// 下一句合成较慢，设备在等待期间播完了缓冲
+		now = sendFrames(s, now.Add(2*time.Second), 10, time.Millisecond)
+		stats := s.Stats()
+		if stats.Underruns != 0 || stats.BufferMs != before {
+			t.Errorf("停顿处理错误: %+v, 之前缓冲%dms", stats, before)
+		}
+		if got := s.Remaining(now); got <= 0 {
+			t.Errorf("重新计时后应有缓冲: %v", got)
+		}
+	})
+
+	t.Run("发送耗时高时加深缓冲且不超过设备缓冲", func(t *testing.T) {
+		s := NewPlayoutScheduler(frame)
+		s.SetDeviceBuffer(300 * time.Millisecond)
+		sendFrames(s, start, 10, 200*time.Millisecond)
+		if got := s.Stats().BufferMs; got != 240 {
+			t.Errorf("预缓冲应限制为设备缓冲减一帧: %dms", got)
+		}
+	})
+
+	t.Run("重置后重新计时", func(t *testing.T) {
+		s := NewPlayoutScheduler(frame)
+		sendFrames(s, start, 10, time.Millisecond)
+		s.Reset()
+		if s.Remaining(start) != 0 || s.Delay(start) != 0 {
+			t.Error("重置后不应等待")
+		}
+	})
+}
@@ -1,13 +1,19 @@
 package utils
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
+// QuickReplyCacheDir 快速回复和问候语音频缓存目录
+const QuickReplyCacheDir = "wake_replay"
+
 // QuickReplyCache 快速回复缓存配置
 type QuickReplyCache struct {
 	CacheDir    string // 缓存目录，默认为 "wake_replay"
@@ -19,7 +25,7 @@ type QuickReplyCache struct {
 // NewQuickReplyCache 创建快速回复缓存配置
 func NewQuickReplyCache(ttsProvider, voiceName string) *QuickReplyCache {
 	return &QuickReplyCache{
-		CacheDir:    "wake_replay",
+		CacheDir:    QuickReplyCacheDir,
 		TTSProvider: ttsProvider,
 		VoiceName:   voiceName,
 		AudioFormat: "mp3",
@@ -41,6 +47,14 @@ func (qrc *QuickReplyCache) FindCachedAudio(text string) string {
 
 	// 检查文件是否存在
 	if _, err := os.Stat(fullPath); err == nil {
+		touchCacheFile(fullPath)
+		return fullPath
+	}
+
+	// 旧版本的长文本按字节截断命名，找到时改为新文件名继续使用
+	legacyPath := filepath.Join(qrc.CacheDir, qrc.legacyFilename(text))
+	if legacyPath != fullPath && os.Rename(legacyPath, fullPath) == nil {
+		touchCacheFile(fullPath)
 		return fullPath
 	}
 
@@ -67,6 +81,44 @@ func (qrc *QuickReplyCache) SaveCachedAudio(text, sourcePath string) error {
 	return qrc.copyFile(sourcePath, targetPath)
 }
 
+// FindCachedOpus 读取已缓存的opus帧，没有缓存时返回false
+func (qrc *QuickReplyCache) FindCachedOpus(text string) ([][]byte, float64, bool) {
+	opusPath, durationPath := qrc.opusPaths(text)
+	if _, err := os.Stat(opusPath); err != nil {
+		return nil, 0, false
+	}
+	frames, duration, err := LoadOpusFrames(opusPath, durationPath)
+	if err != nil || len(frames) == 0 {
+		return nil, 0, false
+	}
+	touchCacheFile(opusPath)
+	return frames, duration, true
+}
+
+// touchCacheFile 命中缓存时更新修改时间，清理时跳过最近用过的文件
+func touchCacheFile(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// SaveCachedOpus 保存可直接发送的opus帧，连接发送时不必再转码
+func (qrc *QuickReplyCache) SaveCachedOpus(text string, frames [][]byte, duration float64) error {
+	opusPath, durationPath := qrc.opusPaths(text)
+	return SaveOpusFrames(opusPath, durationPath, frames, duration)
+}
+
+// CacheFiles 文本对应的全部缓存文件名（原始音频、opus帧和时长），用于清理过期缓存
+func (qrc *QuickReplyCache) CacheFiles(text string) []string {
+	opusPath, durationPath := qrc.opusPaths(text)
+	return []string{qrc.generateFilename(text), filepath.Base(opusPath), filepath.Base(durationPath)}
+}
+
+// opusPaths opus帧和时长文件路径，与原始音频文件同名
+func (qrc *QuickReplyCache) opusPaths(text string) (string, string) {
+	base := strings.TrimSuffix(qrc.generateFilename(text), "."+qrc.AudioFormat)
+	return filepath.Join(qrc.CacheDir, base+".opus"), filepath.Join(qrc.CacheDir, base+".duration")
+}
+
 // generateFilename 生成快速回复音频文件名
 func (qrc *QuickReplyCache) generateFilename(text string) string {
 	// 对文本进行安全化处理
@@ -84,15 +136,36 @@ func (qrc *QuickReplyCache) generateFilename(text string) string {
 	return filename
 }
 
+// legacyFilename 旧版本生成的文件名，长文本直接截断为50字节
+func (qrc *QuickReplyCache) legacyFilename(text string) string {
+	safe := regexp.MustCompile(`[<>:"/\\|?*\s]+`).ReplaceAllString(text, "_")
+	if len(safe) > 50 {
+		safe = safe[:50]
+	}
+	safe = strings.Trim(safe, "_")
+	if safe == "" {
+		safe = "quick_reply"
+	}
+	return fmt.Sprintf("%s_%s_%s.%s", safe, qrc.TTSProvider, qrc.VoiceName, qrc.AudioFormat)
+}
+
 // sanitizeFilename 清理文件名，移除不安全的字符
 func (qrc *QuickReplyCache) sanitizeFilename(text string) string {
 	// 移除或替换文件名中不安全的字符
 	unsafe := regexp.MustCompile(`[<>:"/\\|?*\s]+`)
 	safe := unsafe.ReplaceAllString(text, "_")
 
-	// 限制文件名长度，避免过长
+	// 限制文件名长度，避免过长；截断时按字符截断并附加哈希，避免长文本重名
 	if len(safe) > 50 {
-		safe = safe[:50]
+		sum := md5.Sum([]byte(text))
+		cut := 0
+		for i := range safe {
+			if i > 40 {
+				break
+			}
+			cut = i
+		}
+		safe = safe[:cut] + "_" + hex.EncodeToString(sum[:])[:8]
 	}
 
 	// 移除首尾的下划线
@@ -128,6 +201,45 @@ func (qrc *QuickReplyCache) copyFile(src, dst string) error {
 	return nil
 }
 
+// PruneQuickReplyCache 删除缓存目录中不在keep里的文件，音色或回复词变更后清理旧缓存
+// grace时间内用过或写入的文件不删除，连接可能还在发送
+func PruneQuickReplyCache(cacheDir string, keep map[string]bool, grace time.Duration) (int, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || keep[entry.Name()] {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || time.Since(info.ModTime()) < grace {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cacheDir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// SpeechSegments 按SystemSpeak的方式切分并清理文本，得到实际送去合成的各段文本
+func SpeechSegments(text string) []string {
+	segments := []string{}
+	for _, item := range SplitByPunctuation(text) {
+		item = RemoveMarkdownSyntax(RemoveAllEmoji(item))
+		if item != "" {
+			segments = append(segments, item)
+		}
+	}
+	return segments
+}
+
 // IsQuickReplyHit 检查文本是否为快速回复词
 func IsQuickReplyHit(text string, quickReplyWords []string) bool {
 	return IsInArray(text, quickReplyWords)
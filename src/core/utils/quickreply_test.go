@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuickReplyOpusCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewQuickReplyCache("edge", "zh-CN-XiaoxiaoNeural")
+	cache.CacheDir = dir
+	other := NewQuickReplyCache("edge", "zh-CN-YunxiNeural")
+	other.CacheDir = dir
+
+	frames := [][]byte{{1, 2, 3}, {4, 5}}
+	if err := cache.SaveCachedOpus("我在呢", frames, 1.2); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SaveCachedOpus("我在呢", frames, 1.2); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("读取opus帧", func(t *testing.T) {
+		got, duration, ok := cache.FindCachedOpus("我在呢")
+		if !ok || len(got) != 2 || string(got[1]) != string(frames[1]) || duration != 1.2 {
+			t.Fatalf("读取缓存错误: %v %v %v", got, duration, ok)
+		}
+		if _, _, ok := cache.FindCachedOpus("你好呀"); ok {
+			t.Error("未缓存的文本不应命中")
+		}
+	})
+
+	t.Run("长文本文件名不重复", func(t *testing.T) {
+		a := cache.generateFilename(strings.Repeat("你好", 30) + "一")
+		b := cache.generateFilename(strings.Repeat("你好", 30) + "二")
+		if a == b || !strings.HasSuffix(a, ".mp3") {
+			t.Errorf("文件名错误: %s %s", a, b)
+		}
+	})
+
+	t.Run("清理其他音色的缓存", func(t *testing.T) {
+		keep := map[string]bool{}
+		for _, name := range cache.CacheFiles("我在呢") {
+			keep[name] = true
+		}
+		if removed, err := PruneQuickReplyCache(dir, keep, time.Hour); err != nil || removed != 0 {
+			t.Fatalf("最近写入的缓存不应清理: %d %v", removed, err)
+		}
+		removed, err := PruneQuickReplyCache(dir, keep, 0)
+		if err != nil || removed != 2 {
+			t.Fatalf("清理数量错误: %d %v", removed, err)
+		}
+		if _, _, ok := other.FindCachedOpus("我在呢"); ok {
+			t.Error("其他音色的缓存应被清理")
+		}
+		if _, err := os.Stat(filepath.Join(dir, cache.CacheFiles("我在呢")[1])); err != nil {
+			t.Errorf("当前音色的缓存被误删: %v", err)
+		}
+	})
+}
+
+func TestQuickReplyLegacyFilename(t *testing.T) {
+	cache := NewQuickReplyCache("edge", "zh-CN-XiaoxiaoNeural")
+	cache.CacheDir = t.TempDir()
+	text := strings.Repeat("欢迎回来", 10)
+	legacyPath := filepath.Join(cache.CacheDir, cache.legacyFilename(text))
+	if err := os.WriteFile(legacyPath, []byte("mp3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := cache.FindCachedAudio(text)
+	if path == "" || filepath.Base(path) != cache.generateFilename(text) {
+		t.Fatalf("旧版本缓存未迁移: %q", path)
+	}
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Errorf("旧文件仍存在: %v", err)
+	}
+}
+
+func TestSpeechSegments(t *testing.T) {
+	got := SpeechSegments("Hello，我是你的**英语老师**！")
+	if len(got) == 0 || strings.Contains(strings.Join(got, ""), "*") {
+		t.Errorf("分句错误: %q", got)
+	}
+}
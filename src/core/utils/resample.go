@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	resampleZeroCrossings = 16   // 滤波器每侧的过零点数，越大过渡带越窄
+	resampleKaiserBeta    = 8.6  // Kaiser窗参数，约-90dB阻带衰减
+	resampleRolloff       = 0.94 // 截止频率相对奈奎斯特频率的比例，留出过渡带
+)
+
+// Resampler 多相加窗sinc重采样器
+// 按输入输出采样率的最简整数比L/M插值抽取，每个相位一组预先计算好的滤波器系数，
+// 降采样时截止频率跟随输出采样率，避免混叠
+type Resampler struct {
+	inRate  int
+	outRate int
+	up      int         // L
+	down    int         // M
+	taps    int         // 每个相位的系数个数
+	phases  [][]float64 // phases[p][j] 对应输入样本 base-taps/2+1+j
+}
+
+var (
+	resamplerCache      = make(map[[2]int]*Resampler)
+	resamplerCacheMutex sync.Mutex
+)
+
+// NewResampler 创建重采样器，系数按采样率对缓存复用
+func NewResampler(inRate, outRate int) *Resampler {
+	key := [2]int{inRate, outRate}
+	resamplerCacheMutex.Lock()
+	defer resamplerCacheMutex.Unlock()
+	if r, ok := resamplerCache[key]; ok {
+		return r
+	}
+
+	g := gcd(inRate, outRate)
+	r := &Resampler{inRate: inRate, outRate: outRate, up: outRate / g, down: inRate / g}
+
+	// 截止频率（相对输入奈奎斯特频率），降采样时按比例降低
+	cutoff := resampleRolloff
+	if r.up < r.down {
+		cutoff *= float64(r.up) / float64(r.down)
+	}
+	halfWidth := int(math.Ceil(resampleZeroCrossings / cutoff))
+	r.taps = 2 * halfWidth
+	r.phases = make([][]float64, r.up)
+	norm := besselI0(resampleKaiserBeta)
+	for p := 0; p < r.up; p++ {
+		frac := float64(p) / float64(r.up)
+		coeffs := make([]float64, r.taps)
+		sum := 0.0
+		for j := 0; j < r.taps; j++ {
+			// 输入样本相对输出时刻的距离
+			x := float64(j-halfWidth+1) - frac
+			ratio := x / float64(halfWidth)
+			if ratio <= -1 || ratio >= 1 {
+				continue
+			}
+			window := besselI0(resampleKaiserBeta*math.Sqrt(1-ratio*ratio)) / norm
+			coeffs[j] = cutoff * sinc(cutoff*x) * window
+			sum += coeffs[j]
+		}
+		// 每个相位直流增益归一化为1
+		for j := range coeffs {
+			coeffs[j] /= sum
+		}
+		r.phases[p] = coeffs
+	}
+
+	resamplerCache[key] = r
+	return r
+}
+
+// Process 重采样一段完整的单声道PCM
+func (r *Resampler) Process(input []int16) []int16 {
+	if r.inRate == r.outRate || len(input) == 0 {
+		return input
+	}
+
+	outLen := int(int64(len(input)) * int64(r.up) / int64(r.down))
+	output := make([]int16, outLen)
+	halfWidth := r.taps / 2
+	for n := 0; n < outLen; n++ {
+		pos := int64(n) * int64(r.down)
+		base := int(pos / int64(r.up))
+		coeffs := r.phases[pos%int64(r.up)]
+
+		start := base - halfWidth + 1
+		acc := 0.0
+		for j, c := range coeffs {
+			i := start + j
+			if i < 0 || i >= len(input) {
+				continue
+			}
+			acc += c * float64(input[i])
+		}
+		output[n] = clampInt16(acc)
+	}
+	return output
+}
+
+// ResamplePCM 使用多相加窗sinc滤波器对单声道16位PCM重采样
+func ResamplePCM(input []int16, inputSampleRate, outputSampleRate int) []int16 {
+	if inputSampleRate == outputSampleRate || inputSampleRate <= 0 || outputSampleRate <= 0 {
+		return input
+	}
+	return NewResampler(inputSampleRate, outputSampleRate).Process(input)
+}
+
+// ResamplePCMBytes 对16位小端单声道PCM字节重采样
+func ResamplePCMBytes(data []byte, inputSampleRate, outputSampleRate int) []byte {
+	if inputSampleRate == outputSampleRate {
+		return data
+	}
+	return Int16ToPCMBytes(ResamplePCM(PCMBytesToInt16(data), inputSampleRate, outputSampleRate))
+}
+
+// PCMBytesToInt16 16位小端PCM字节转为样本
+func PCMBytesToInt16(data []byte) []int16 {
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(uint16(data[i*2]) | uint16(data[i*2+1])<<8)
+	}
+	return samples
+}
+
+// Int16ToPCMBytes 样本转为16位小端PCM字节
+func Int16ToPCMBytes(samples []int16) []byte {
+	data := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		data[i*2] = byte(sample)
+		data[i*2+1] = byte(sample >> 8)
+	}
+	return data
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// besselI0 第一类零阶修正贝塞尔函数，用于Kaiser窗
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+func clampInt16(v float64) int16 {
+	v = math.Round(v)
+	if v > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if v < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(v)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
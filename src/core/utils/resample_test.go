@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+// sineWave 生成指定频率的正弦参考信号
+func sineWave(freq float64, sampleRate, n int, amplitude float64) []int16 {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = int16(amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)))
+	}
+	return samples
+}
+
+// snr 计算输出相对理想参考信号的信噪比(dB)，跳过两端滤波器暖机的样本
+func snr(got []int16, freq float64, sampleRate int, amplitude float64) float64 {
+	skip := sampleRate / 100
+	var signal, noise float64
+	for i := skip; i < len(got)-skip; i++ {
+		ref := amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+		diff := float64(got[i]) - ref
+		signal += ref * ref
+		noise += diff * diff
+	}
+	return 10 * math.Log10(signal/noise)
+}
+
+// rms 计算均方根，跳过两端样本
+func rms(samples []int16, skip int) float64 {
+	var sum float64
+	for _, s := range samples[skip : len(samples)-skip] {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)-2*skip))
+}
+
+func TestResamplePCM(t *testing.T) {
+	const amplitude = 16000.0
+
+	tests := []struct {
+		name    string
+		inRate  int
+		outRate int
+		freq    float64
+		minSNR  float64
+	}{
+		{name: "44.1k降到24k", inRate: 44100, outRate: 24000, freq: 1000, minSNR: 60},
+		{name: "24k降到16k", inRate: 24000, outRate: 16000, freq: 3000, minSNR: 60},
+		{name: "48k降到8k", inRate: 48000, outRate: 8000, freq: 440, minSNR: 60},
+		{name: "16k升到48k", inRate: 16000, outRate: 48000, freq: 2000, minSNR: 60},
+		{name: "22.05k升到24k", inRate: 22050, outRate: 24000, freq: 5000, minSNR: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := sineWave(tt.freq, tt.inRate, tt.inRate/2, amplitude)
+			got := ResamplePCM(input, tt.inRate, tt.outRate)
+			if want := len(input) * tt.outRate / tt.inRate; len(got) != want {
+				t.Fatalf("输出长度错误: %d, 期望 %d", len(got), want)
+			}
+			if value := snr(got, tt.freq, tt.outRate, amplitude); value < tt.minSNR {
+				t.Errorf("信噪比过低: %.1fdB, 期望不低于 %.0fdB", value, tt.minSNR)
+			}
+		})
+	}
+
+	t.Run("超过新奈奎斯特频率的信号被滤除", func(t *testing.T) {
+		// 24k降到16k时，10kHz会混叠成6kHz，线性插值只衰减几dB
+		input := sineWave(10000, 24000, 12000, amplitude)
+		got := ResamplePCM(input, 24000, 16000)
+		attenuation := 20 * math.Log10(rms(got, 160)/(amplitude/math.Sqrt2))
+		if attenuation > -60 {
+			t.Errorf("混叠抑制不足: %.1fdB", attenuation)
+		}
+	})
+
+	t.Run("采样率相同原样返回", func(t *testing.T) {
+		input := sineWave(1000, 16000, 160, amplitude)
+		if got := ResamplePCM(input, 16000, 16000); len(got) != len(input) || got[10] != input[10] {
+			t.Error("相同采样率不应改变数据")
+		}
+	})
+}
+
+func TestNegotiateAudioParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   AudioParams
+	}{
+		{
+			name:   "未上报参数使用默认值",
+			params: nil,
+			want:   DefaultAudioParams,
+		},
+		{
+			name:   "上行参数不影响下行",
+			params: map[string]interface{}{"format": "opus", "sample_rate": float64(16000), "channels": float64(1), "frame_duration": float64(60)},
+			want:   DefaultAudioParams,
+		},
+		{
+			name:   "旧设备只上报format时下行沿用",
+			params: map[string]interface{}{"format": "pcm", "sample_rate": float64(16000), "channels": float64(1), "frame_duration": float64(60)},
+			want:   AudioParams{Format: "pcm", SampleRate: 24000, Channels: 1, FrameDuration: 60},
+		},
+		{
+			name: "下行参数优先",
+			params: map[string]interface{}{"format": "opus", "sample_rate": float64(16000), "frame_duration": float64(60),
+				"output_format": "pcm", "output_sample_rate": float64(48000), "output_frame_duration": float64(40)},
+			want: AudioParams{Format: "pcm", SampleRate: 48000, Channels: 1, FrameDuration: 40},
+		},
+		{
+			name:   "不支持的参数回退",
+			params: map[string]interface{}{"output_format": "aac", "output_sample_rate": float64(44100), "output_frame_duration": float64(30)},
+			want:   AudioParams{Format: "opus", SampleRate: 24000, Channels: 1, FrameDuration: 60},
+		},
+		{
+			name:   "采样率过低取8k",
+			params: map[string]interface{}{"output_sample_rate": float64(4000)},
+			want:   AudioParams{Format: "opus", SampleRate: 8000, Channels: 1, FrameDuration: 60},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NegotiateAudioParams(tt.params); got != tt.want {
+				t.Errorf("协商结果错误: %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
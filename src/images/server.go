@@ -0,0 +1,102 @@
+package images
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/providers/imagegen"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GenerateRequest 生成图片的请求，宽高和格式为目标屏幕，可不填
+type GenerateRequest struct {
+	Prompt string `json:"prompt" example:"一只在草地上奔跑的橘猫"`
+	Width  int    `json:"width"  example:"240"`
+	Height int    `json:"height" example:"240"`
+	Format string `json:"format" example:"jpeg"`
+}
+
+// DefaultImageService 生成图片的下载和管理接口
+type DefaultImageService struct {
+	config *configs.Config
+	logger *utils.Logger
+}
+
+// NewDefaultImageService 构造函数
+func NewDefaultImageService(config *configs.Config, logger *utils.Logger) *DefaultImageService {
+	return &DefaultImageService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册图片相关路由，设备通过图片地址直接下载，不需要token
+func (s *DefaultImageService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	if imagegen.Default() == nil {
+		s.logger.Info("未配置图片生成，跳过图片服务")
+		return nil
+	}
+
+	group := apiGroup.Group(imagegen.RoutePath)
+	group.GET("/:name", s.handleDownload)
+	adminAuth := auth.AdminAuth(s.config, "GET, POST, OPTIONS")
+	group.POST("/generate", adminAuth, s.handleGenerate)
+	group.OPTIONS("/*path", adminAuth)
+
+	s.logger.Info("Image HTTP服务路由注册完成")
+	return nil
+}
+
+// @Summary 下载生成的图片
+// @Description 设备收到的图片地址，过期后返回404
+// @Tags Images
+// @Produce image/jpeg,image/png
+// @Param name path string true "图片文件名"
+// @Success 200 {file} file
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /images/{name} [get]
+func (s *DefaultImageService) handleDownload(c *gin.Context) {
+	path, ok := imagegen.Default().FilePath(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, auth.ErrorResponse{Success: false, Message: "图片不存在或已过期"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.File(path)
+}
+
+// @Summary 生成图片
+// @Description 按提示词生成图片并返回下载地址，用于调试提供者配置
+// @Tags Images
+// @Accept json
+// @Produce json
+// @Param body body GenerateRequest true "提示词和目标屏幕"
+// @Success 200 {object} imagegen.Image
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /images/generate [post]
+func (s *DefaultImageService) handleGenerate(c *gin.Context) {
+	var req GenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Prompt) == "" {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "缺少prompt"})
+		return
+	}
+
+	display := imagegen.ParseDisplay(map[string]interface{}{
+		"width":  float64(req.Width),
+		"height": float64(req.Height),
+		"format": req.Format,
+	})
+	img, err := imagegen.Default().Generate(c.Request.Context(), req.Prompt, display)
+	if err != nil {
+		s.logger.Error("生成图片失败: %v", err)
+		c.JSON(http.StatusBadGateway, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, img)
+}
@@ -0,0 +1,121 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/kb"
+)
+
+const usage = `用法: xiaozhi-server knowledge <命令> [参数]
+
+命令:
+  import   导入txt、markdown、PDF文档，例如: knowledge import -collection manual ./docs
+  list     列出集合，指定-collection时列出集合中的文档
+  delete   删除文档，例如: knowledge delete -collection manual <文档ID>，不指定ID时删除整个集合
+  search   检索集合，例如: knowledge search -collection manual,faq 如何重置设备
+`
+
+// RunCommand 执行knowledge子命令，args不包含"knowledge"本身
+func RunCommand(config *configs.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Print(usage)
+		return fmt.Errorf("缺少子命令")
+	}
+
+	switch args[0] {
+	case "import":
+		fs := flag.NewFlagSet("knowledge import", flag.ContinueOnError)
+		collection := fs.String("collection", "", "集合名")
+		chunkSize := fs.Int("chunk-size", config.KnowledgeBase.ChunkSize, "分块长度（字符数）")
+		chunkOverlap := fs.Int("chunk-overlap", config.KnowledgeBase.ChunkOverlap, "相邻分块重叠的字符数")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *collection == "" || fs.NArg() == 0 {
+			return fmt.Errorf("缺少集合名或文档路径")
+		}
+
+		result, err := kb.IngestPaths(context.Background(), *collection, fs.Args(),
+			kb.ChunkOptions{Size: *chunkSize, Overlap: *chunkOverlap})
+		if result != nil {
+			printJSON(result)
+		}
+		return err
+
+	case "list":
+		fs := flag.NewFlagSet("knowledge list", flag.ContinueOnError)
+		collection := fs.String("collection", "", "集合名")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *collection == "" {
+			printJSON(kb.ListCollections())
+			return nil
+		}
+		docs, err := kb.ListDocuments(*collection)
+		if err != nil {
+			return err
+		}
+		printJSON(docs)
+		return nil
+
+	case "delete":
+		fs := flag.NewFlagSet("knowledge delete", flag.ContinueOnError)
+		collection := fs.String("collection", "", "集合名")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *collection == "" {
+			return fmt.Errorf("缺少集合名")
+		}
+		if fs.NArg() == 0 {
+			if err := kb.DeleteCollection(*collection); err != nil {
+				return err
+			}
+			fmt.Println("已删除集合:", *collection)
+			return nil
+		}
+		for _, id := range fs.Args() {
+			if err := kb.DeleteDocument(*collection, id); err != nil {
+				return err
+			}
+			fmt.Println("已删除:", id)
+		}
+		return nil
+
+	case "search":
+		fs := flag.NewFlagSet("knowledge search", flag.ContinueOnError)
+		collection := fs.String("collection", "", "集合名，多个用逗号分隔")
+		topK := fs.Int("top-k", config.KnowledgeBase.TopK, "返回的分块数")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *collection == "" || fs.NArg() == 0 {
+			return fmt.Errorf("缺少集合名或检索内容")
+		}
+		chunks, err := kb.SearchChunks(context.Background(), strings.Split(*collection, ","),
+			strings.Join(fs.Args(), " "), *topK)
+		if err != nil {
+			return err
+		}
+		printJSON(chunks)
+		return nil
+
+	default:
+		fmt.Print(usage)
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
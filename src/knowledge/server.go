@@ -0,0 +1,246 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/kb"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUploadSize 上传文档的大小上限
+const maxUploadSize = 32 << 20
+
+var (
+	errDocumentTooLarge    = errors.New("文档超过32MB")
+	errUnsupportedDocument = errors.New("只支持txt、markdown、PDF文档")
+)
+
+// TextDocumentRequest 直接提交文本的导入请求
+type TextDocumentRequest struct {
+	Source string `json:"source" binding:"required" example:"faq.md"`
+	Text   string `json:"text"   binding:"required"`
+}
+
+// SearchRequest 检索请求
+type SearchRequest struct {
+	Query string `json:"query" binding:"required" example:"如何重置设备"`
+	TopK  int    `json:"top_k" example:"4"`
+}
+
+// DefaultKnowledgeService 文档知识库管理服务
+type DefaultKnowledgeService struct {
+	config *configs.Config
+	logger *utils.Logger
+}
+
+// NewDefaultKnowledgeService 构造函数
+func NewDefaultKnowledgeService(config *configs.Config, logger *utils.Logger) *DefaultKnowledgeService {
+	return &DefaultKnowledgeService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册知识库相关路由
+func (s *DefaultKnowledgeService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/knowledge", auth.AdminAuth(s.config, "GET, POST, DELETE, OPTIONS"))
+	group.GET("", s.handleListCollections)
+	group.GET("/:collection", s.handleListDocuments)
+	group.POST("/:collection/documents", func(c *gin.Context) { s.handleAddDocument(ctx, c) })
+	group.POST("/:collection/search", s.handleSearch)
+	group.DELETE("/:collection", s.handleDeleteCollection)
+	group.DELETE("/:collection/documents/:id", s.handleDeleteDocument)
+	// OPTIONS请求由AdminAuth直接返回
+	group.OPTIONS("", func(c *gin.Context) {})
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+
+	s.logger.Info("Knowledge HTTP服务路由注册完成")
+	return nil
+}
+
+// @Summary 集合列表
+// @Description 列出所有文档集合及文档、分块数量
+// @Tags Knowledge
+// @Produce json
+// @Success 200 {array} kb.CollectionInfo
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /knowledge [get]
+func (s *DefaultKnowledgeService) handleListCollections(c *gin.Context) {
+	c.JSON(http.StatusOK, kb.ListCollections())
+}
+
+// @Summary 文档列表
+// @Description 列出集合中的文档
+// @Tags Knowledge
+// @Produce json
+// @Param collection path string true "集合名"
+// @Success 200 {array} kb.DocumentInfo
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /knowledge/{collection} [get]
+func (s *DefaultKnowledgeService) handleListDocuments(c *gin.Context) {
+	docs, err := kb.ListDocuments(c.Param("collection"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, docs)
+}
+
+// @Summary 导入文档
+// @Description 上传txt、markdown、PDF文件(multipart字段file)，或提交JSON文本，切分后写入集合，集合不存在时自动创建
+// @Tags Knowledge
+// @Accept multipart/form-data,json
+// @Produce json
+// @Param collection path string true "集合名"
+// @Param file formData file false "文档文件"
+// @Param body body TextDocumentRequest false "文本内容"
+// @Success 200 {object} kb.DocumentInfo
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /knowledge/{collection}/documents [post]
+func (s *DefaultKnowledgeService) handleAddDocument(ctx context.Context, c *gin.Context) {
+	collection := c.Param("collection")
+	if !kb.ValidCollectionName(collection) {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "无效的集合名"})
+		return
+	}
+
+	source, text, err := s.readDocument(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+
+	opts := kb.ChunkOptions{Size: s.config.KnowledgeBase.ChunkSize, Overlap: s.config.KnowledgeBase.ChunkOverlap}
+	info, err := kb.AddDocument(ctx, collection, source, text, opts)
+	if err != nil {
+		s.logger.Error("导入文档失败 %s: %v", source, err)
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	s.logger.Info("导入文档 %s 到集合 %s, 分块数: %d", source, collection, info.Chunks)
+	c.JSON(http.StatusOK, info)
+}
+
+// readDocument 读取上传的文件或JSON文本，返回来源和文本
+func (s *DefaultKnowledgeService) readDocument(c *gin.Context) (string, string, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		var req TextDocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			return "", "", err
+		}
+		return req.Source, req.Text, nil
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", "", err
+	}
+	if header.Size > maxUploadSize {
+		return "", "", errDocumentTooLarge
+	}
+	source := filepath.Base(header.Filename)
+	if !kb.IsSupportedDocument(source) {
+		return "", "", errUnsupportedDocument
+	}
+
+	// PDF需要落盘后交给pdftotext解析，统一写入临时文件
+	file, err := header.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	tmp, err := os.CreateTemp("", "kb-*"+filepath.Ext(source))
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, file)
+	tmp.Close()
+	if err != nil {
+		return "", "", err
+	}
+
+	text, err := kb.ReadDocument(tmp.Name())
+	if err != nil {
+		return "", "", err
+	}
+	return source, text, nil
+}
+
+// @Summary 检索集合
+// @Description 在集合中检索相关分块，用于调试知识库效果
+// @Tags Knowledge
+// @Accept json
+// @Produce json
+// @Param collection path string true "集合名，多个用逗号分隔"
+// @Param body body SearchRequest true "检索内容"
+// @Success 200 {array} kb.Chunk
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /knowledge/{collection}/search [post]
+func (s *DefaultKnowledgeService) handleSearch(c *gin.Context) {
+	var req SearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "请求参数错误: " + err.Error()})
+		return
+	}
+	if req.TopK <= 0 {
+		req.TopK = s.config.KnowledgeBase.TopK
+	}
+
+	chunks, err := kb.SearchChunks(c.Request.Context(), strings.Split(c.Param("collection"), ","), req.Query, req.TopK)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, chunks)
+}
+
+// @Summary 删除集合
+// @Description 删除整个文档集合
+// @Tags Knowledge
+// @Produce json
+// @Param collection path string true "集合名"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /knowledge/{collection} [delete]
+func (s *DefaultKnowledgeService) handleDeleteCollection(c *gin.Context) {
+	collection := c.Param("collection")
+	if err := kb.DeleteCollection(collection); err != nil {
+		c.JSON(http.StatusNotFound, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "collection": collection})
+}
+
+// @Summary 删除文档
+// @Description 从集合中删除文档及其所有分块
+// @Tags Knowledge
+// @Produce json
+// @Param collection path string true "集合名"
+// @Param id path string true "文档ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /knowledge/{collection}/documents/{id} [delete]
+func (s *DefaultKnowledgeService) handleDeleteDocument(c *gin.Context) {
+	id := c.Param("id")
+	if err := kb.DeleteDocument(c.Param("collection"), id); err != nil {
+		c.JSON(http.StatusNotFound, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id})
+}
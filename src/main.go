@@ -7,6 +7,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
@@ -15,19 +17,33 @@ import (
 	"syscall"
 	"time"
 
+	"xiaozhi-server-go/src/chatapi"
 	"xiaozhi-server-go/src/configs"
 	"xiaozhi-server-go/src/configs/database"
 	cfg "xiaozhi-server-go/src/configs/server"
 	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/auth/store"
 	"xiaozhi-server-go/src/core/pool"
+	"xiaozhi-server-go/src/core/providers/imagegen"
+	"xiaozhi-server-go/src/core/providers/ocr"
+	"xiaozhi-server-go/src/core/quickreply"
+	"xiaozhi-server-go/src/core/tracing"
 	"xiaozhi-server-go/src/core/transport"
+	"xiaozhi-server-go/src/core/transport/webrtc"
 	"xiaozhi-server-go/src/core/transport/websocket"
+	"xiaozhi-server-go/src/core/usage"
 	"xiaozhi-server-go/src/core/utils"
 	_ "xiaozhi-server-go/src/docs"
+	"xiaozhi-server-go/src/images"
+	"xiaozhi-server-go/src/knowledge"
+	"xiaozhi-server-go/src/music"
+	"xiaozhi-server-go/src/mcpserver"
+	"xiaozhi-server-go/src/roles"
 	"xiaozhi-server-go/src/ota"
+	"xiaozhi-server-go/src/quota"
 	"xiaozhi-server-go/src/task"
 	"xiaozhi-server-go/src/vision"
+	"xiaozhi-server-go/src/webconsole"
 	"xiaozhi-server-go/src/core/kb"
 
 	swaggerFiles "github.com/swaggo/files"
@@ -37,13 +53,24 @@ import (
 	_ "xiaozhi-server-go/src/core/providers/asr/deepgram"
 	_ "xiaozhi-server-go/src/core/providers/asr/doubao"
 	_ "xiaozhi-server-go/src/core/providers/asr/gosherpa"
+	_ "xiaozhi-server-go/src/core/providers/asr/whisper"
+	_ "xiaozhi-server-go/src/core/providers/embedding/local"
+	_ "xiaozhi-server-go/src/core/providers/embedding/ollama"
+	_ "xiaozhi-server-go/src/core/providers/embedding/openai"
+	_ "xiaozhi-server-go/src/core/providers/imagegen/openai"
+	_ "xiaozhi-server-go/src/core/providers/imagegen/sdwebui"
+	_ "xiaozhi-server-go/src/core/providers/llm/anthropic"
 	_ "xiaozhi-server-go/src/core/providers/llm/coze"
+	_ "xiaozhi-server-go/src/core/providers/llm/gemini"
 	_ "xiaozhi-server-go/src/core/providers/llm/ollama"
 	_ "xiaozhi-server-go/src/core/providers/llm/openai"
+	_ "xiaozhi-server-go/src/core/providers/ocr/httpocr"
+	_ "xiaozhi-server-go/src/core/providers/ocr/openai"
 	_ "xiaozhi-server-go/src/core/providers/tts/deepgram"
 	_ "xiaozhi-server-go/src/core/providers/tts/doubao"
 	_ "xiaozhi-server-go/src/core/providers/tts/edge"
 	_ "xiaozhi-server-go/src/core/providers/tts/gosherpa"
+	_ "xiaozhi-server-go/src/core/providers/tts/httptts"
 	_ "xiaozhi-server-go/src/core/providers/vlllm/ollama"
 	_ "xiaozhi-server-go/src/core/providers/vlllm/openai"
 
@@ -51,15 +78,24 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
-func LoadConfigAndLogger() (*configs.Config, *utils.Logger, error) {
-	// 初始化数据库连接
-	_, _, err := database.InitDB()
+// initDatabase 连接数据库，数据库配置只从配置文件、环境变量和--set读取
+func initDatabase(opts *configs.LoadOptions) error {
+	dbConfig, err := configs.LoadDatabaseConfig(opts)
 	if err != nil {
-		fmt.Println("数据库连接失败: %v", err)
+		return err
+	}
+	if _, _, err := database.InitDB(dbConfig); err != nil {
+		return fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return nil
+}
 
+func LoadConfigAndLogger(opts *configs.LoadOptions) (*configs.Config, *utils.Logger, error) {
+	if err := initDatabase(opts); err != nil {
+		return nil, nil, err
 	}
-	// 加载配置,默认使用.config.yaml
-	config, configPath, err := configs.LoadConfig(database.GetServerConfigDB())
+	// 按默认值、配置文件、数据库、环境变量、--set的顺序加载配置
+	config, configPath, err := configs.LoadConfig(database.GetServerConfigDB(), opts)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -74,6 +110,16 @@ func LoadConfigAndLogger() (*configs.Config, *utils.Logger, error) {
 
 	database.SetLogger(logger)
 
+	// 首次启动时把配置文件中的角色导入数据库
+	if roleDB := database.GetRoleDB(); roleDB != nil {
+		ttsType := config.TTS[config.SelectedModule["TTS"]].Type
+		if n, err := roleDB.SeedLegacyRoles(config.Roles, ttsType); err != nil {
+			logger.Warn("导入角色失败: %v", err)
+		} else if n > 0 {
+			logger.Info("已从配置文件导入%d个角色", n)
+		}
+	}
+
 	return config, logger, nil
 }
 
@@ -108,13 +154,15 @@ func StartTransportServer(
 	groupCtx context.Context,
 ) (*transport.TransportManager, error) {
 	// 初始化资源池管理器
-	poolManager, err := pool.NewPoolManager(config, logger)
+	poolManager, err := pool.NewPoolManager(config, logger.Module("pool"))
 	if err != nil {
-		logger.Error(fmt.Sprintf("初始化资源池管理器失败: %v", err))
+		logger.Error("初始化资源池管理器失败: %v", err)
 		return nil, fmt.Errorf("初始化资源池管理器失败: %v", err)
 	}
+	pool.SetDefault(poolManager)
 
-	// 初始化任务管理器
+	// 初始化任务管理器，各用户级别的任务配额可在usage.levels中配置
+	task.SetLevelLimits(taskLevelLimits(config.Usage.Levels))
 	taskMgr := task.NewTaskManager(task.ResourceConfig{
 		MaxWorkers:        12,
 		MaxTasksPerClient: 20,
@@ -122,7 +170,7 @@ func StartTransportServer(
 	taskMgr.Start()
 
 	// 创建传输管理器
-	transportManager := transport.NewTransportManager(config, logger)
+	transportManager := transport.NewTransportManager(config, logger.Module("transport"))
 
 	// 创建连接处理器工厂
 	handlerFactory := transport.NewDefaultConnectionHandlerFactory(
@@ -137,13 +185,25 @@ func StartTransportServer(
 
 	// 检查WebSocket传输层配置
 	if config.Transport.WebSocket.Enabled {
-		wsTransport := websocket.NewWebSocketTransport(config, logger)
+		wsTransport := websocket.NewWebSocketTransport(config, logger.Module("transport"))
 		wsTransport.SetConnectionHandler(handlerFactory)
 		transportManager.RegisterTransport("websocket", wsTransport)
 		enabledTransports = append(enabledTransports, "WebSocket")
 		logger.Debug("WebSocket传输层已注册")
 	}
 
+	// 检查WebRTC传输层配置
+	if config.Transport.WebRTC.Enabled {
+		rtcTransport, err := webrtc.NewWebRTCTransport(config, logger.Module("transport"))
+		if err != nil {
+			return nil, fmt.Errorf("创建WebRTC传输层失败: %v", err)
+		}
+		rtcTransport.SetConnectionHandler(handlerFactory)
+		transportManager.RegisterTransport("webrtc", rtcTransport)
+		enabledTransports = append(enabledTransports, "WebRTC")
+		logger.Debug("WebRTC传输层已注册")
+	}
+
 	if len(enabledTransports) == 0 {
 		return nil, fmt.Errorf("没有启用任何传输层")
 	}
@@ -179,6 +239,7 @@ func StartTransportServer(
 }
 
 func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.Group, groupCtx context.Context) (*http.Server, error) {
+	logger = logger.Module("http")
 	// 初始化Gin引擎
 	if config.Log.LogLevel == "debug" {
 		gin.SetMode(gin.DebugMode)
@@ -193,7 +254,7 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 	// 启动OTA服务
 	otaService := ota.NewDefaultOTAService(config.Web.Websocket)
 	if err := otaService.Start(groupCtx, router, apiGroup); err != nil {
-		logger.Error("OTA 服务启动失败", err)
+		logger.ErrorKV("OTA 服务启动失败", err)
 		return nil, err
 	}
 
@@ -210,13 +271,68 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 		}
 	}
 
+	// 启动音乐库管理服务
+	musicService := music.NewDefaultMusicService(config, logger)
+	if err := musicService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("Music 服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动文档知识库管理服务
+	knowledgeService := knowledge.NewDefaultKnowledgeService(config, logger)
+	if err := knowledgeService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("Knowledge 服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动角色管理服务
+	roleService := roles.NewDefaultRoleService(config, logger)
+	if err := roleService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("Role 服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动对外MCP服务
+	mcpServerService := mcpserver.NewDefaultMCPServerService(config, logger)
+	if err := mcpServerService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("MCP 服务启动失败 %v", err)
+		return nil, err
+	}
+
+	// 启动OpenAI兼容的对话和语音接口
+	chatAPIService := chatapi.NewDefaultChatAPIService(config, logger)
+	if err := chatAPIService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("OpenAI兼容接口注册失败 %v", err)
+		return nil, err
+	}
+
+	usageService := quota.NewDefaultUsageService(config, logger)
+	if err := usageService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("用量管理服务注册失败 %v", err)
+		return nil, err
+	}
+
+	// 生成图片的下载服务
+	imageService := images.NewDefaultImageService(config, logger)
+	if err := imageService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("图片服务注册失败 %v", err)
+		return nil, err
+	}
+
+	// 启动浏览器测试控制台
+	consoleService := webconsole.NewDefaultConsoleService(config, logger)
+	if err := consoleService.Start(groupCtx, router, apiGroup); err != nil {
+		logger.Error("测试控制台注册失败 %v", err)
+		return nil, err
+	}
+
 	cfgServer, err := cfg.NewDefaultCfgService(config, logger)
 	if err != nil {
 		logger.Error("配置服务初始化失败 %v", err)
 		return nil, err
 	}
 	if err := cfgServer.Start(groupCtx, router, apiGroup); err != nil {
-		logger.Error("配置服务启动失败", err)
+		logger.ErrorKV("配置服务启动失败", err)
 		return nil, err
 	}
 
@@ -230,7 +346,7 @@ func StartHttpServer(config *configs.Config, logger *utils.Logger, g *errgroup.G
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	g.Go(func() error {
-		logger.Info(fmt.Sprintf("Gin 服务已启动，访问地址: http://0.0.0.0:%d", config.Web.Port))
+		logger.Info("Gin 服务已启动，访问地址: http://0.0.0.0:%d", config.Web.Port)
 
 		// 在单独的 goroutine 中监听关闭信号
 		go func() {
@@ -291,6 +407,18 @@ func GracefulShutdown(cancel context.CancelFunc, logger *utils.Logger, g *errgro
 	}
 }
 
+// taskLevelLimits 从用量配置中取出各用户级别的任务配额
+func taskLevelLimits(levels map[string]configs.UsageLevelConfig) map[task.UserLevel]task.LevelLimits {
+	limits := make(map[task.UserLevel]task.LevelLimits, len(levels))
+	for name, level := range levels {
+		limits[task.UserLevel(name)] = task.LevelLimits{
+			MaxTotalTasks:      level.MaxTasks,
+			MaxConcurrentTasks: level.MaxConcurrentTasks,
+		}
+	}
+	return limits
+}
+
 func startServices(
 	config *configs.Config,
 	logger *utils.Logger,
@@ -298,6 +426,32 @@ func startServices(
 	g *errgroup.Group,
 	groupCtx context.Context,
 ) error {
+	// 用量统计和配额，需在传输层之前初始化
+	if usageDB := database.GetUsageDB(); usageDB != nil {
+		if meter := usage.NewMeter(&config.Usage, usageDB, logger.Module("usage")); meter != nil {
+			usage.SetDefault(meter)
+			go meter.Start(groupCtx)
+			logger.Info("用量统计已启用, 默认级别: %s", config.Usage.DefaultLevel)
+		}
+	}
+
+	// 图片生成，未选择ImageGen时不启用
+	if generator, err := imagegen.NewGenerator(config, logger.Module("imagegen")); err != nil {
+		logger.Warn("图片生成初始化失败: %v", err)
+	} else if generator != nil {
+		imagegen.SetDefault(generator)
+		go generator.Start(groupCtx)
+		logger.Info("图片生成已启用: %s", config.SelectedModule["ImageGen"])
+	}
+
+	// 文字识别，未选择OCR时拍到的文字图片仍交给VLLLM
+	if recognizer, err := ocr.NewRecognizer(config, logger.Module("ocr")); err != nil {
+		logger.Warn("文字识别初始化失败: %v", err)
+	} else if recognizer != nil {
+		ocr.SetDefault(recognizer)
+		logger.Info("文字识别已启用: %s", recognizer.Name())
+	}
+
 	// 启动传输层服务
 	if _, err := StartTransportServer(config, logger, authManager, g, groupCtx); err != nil {
 		return fmt.Errorf("启动传输层服务失败: %w", err)
@@ -308,12 +462,47 @@ func startServices(
 		return fmt.Errorf("启动 Http 服务失败: %w", err)
 	}
 
+	// 后台预合成快速回复和角色问候语，角色或音色变化时重新预热
+	if warmer := quickreply.NewWarmer(config, logger); warmer != nil {
+		quickreply.SetDefault(warmer)
+		go warmer.Start(groupCtx)
+	}
+
 	return nil
 }
 
+// runConfigCommand 执行config子命令，数据库不可用时只检查配置文件、环境变量和--set
+func runConfigCommand(opts *configs.LoadOptions, args []string) error {
+	var dbi configs.ConfigDBInterface
+	if err := initDatabase(opts); err != nil {
+		fmt.Println("⚠️ 未使用数据库中的配置:", err)
+	} else {
+		dbi = database.GetServerConfigDB()
+	}
+	return configs.RunCommand(dbi, opts, args)
+}
+
 func main() {
+	// 全局参数: --config 配置文件, --set key.path=value
+	opts, args, err := configs.ParseFlags(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+
+	// 子命令: xiaozhi-server config validate|show|db-set|db-clear
+	if len(args) > 0 && args[0] == "config" {
+		if err := runConfigCommand(opts, args[1:]); err != nil {
+			fmt.Println("config命令执行失败:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 加载配置和初始化日志系统
-	config, logger, err := LoadConfigAndLogger()
+	config, logger, err := LoadConfigAndLogger(opts)
 	if err != nil {
 		fmt.Println("加载配置或初始化日志系统失败:", err)
 		os.Exit(1)
@@ -327,16 +516,48 @@ func main() {
 	// 	return
 	// }
 
-	// 加载知识库
-	kb.Load(config)
+	// 加载音乐和文档知识库，失败时播放音乐退回文件名模糊匹配
+	if err := kb.Load(config); err != nil {
+		logger.Warn("音乐知识库加载失败，将使用文件名模糊匹配: %v", err)
+	}
+
+	// 子命令: xiaozhi-server music import|list|delete
+	if len(args) > 0 && args[0] == "music" {
+		if err := music.RunCommand(config, args[1:]); err != nil {
+			logger.Error("music命令执行失败: %v", err)
+			os.Exit(1)
+		}
+		logger.Close()
+		return
+	}
+
+	// 子命令: xiaozhi-server knowledge import|list|delete|search
+	if len(args) > 0 && args[0] == "knowledge" {
+		if err := knowledge.RunCommand(config, args[1:]); err != nil {
+			logger.Error("knowledge命令执行失败: %v", err)
+			os.Exit(1)
+		}
+		logger.Close()
+		return
+	}
 
 	// 初始化认证管理器
 	authManager, err := initAuthManager(config, logger)
 	if err != nil {
-		logger.Error("初始化认证管理器失败:", err)
+		logger.ErrorKV("初始化认证管理器失败:", err)
 		os.Exit(1)
 	}
 
+	// 初始化链路追踪，未启用时为空实现
+	shutdownTracing, err := tracing.Init(context.Background(), &config.Tracing)
+	if err != nil {
+		logger.Error("初始化链路追踪失败: %v", err)
+		os.Exit(1)
+	}
+	if config.Tracing.Enabled {
+		logger.Info("链路追踪已启用, 导出器: %s", config.Tracing.Exporter)
+	}
+
 	// 创建可取消的上下文
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -359,6 +580,13 @@ func main() {
 		authManager.Close()
 	}
 
+	// 导出剩余的span
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("关闭链路追踪失败: %v", err)
+	}
+	shutdownCancel()
+
 	logger.Info("程序已成功退出")
 	logger.Close()
 }
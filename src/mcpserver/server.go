@@ -0,0 +1,290 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core"
+	"xiaozhi-server-go/src/core/auth"
+	coremcp "xiaozhi-server-go/src/core/mcp"
+	"xiaozhi-server-go/src/core/types"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	serverName    = "xiaozhi-server"
+	serverVersion = "1.0.0"
+
+	// deviceToolTimeout 调用设备端工具的超时时间
+	deviceToolTimeout = 30 * time.Second
+	// speakTimeout 等待设备连接开始播报的超时时间
+	speakTimeout = 10 * time.Second
+)
+
+// DefaultMCPServerService 对外的MCP服务，把在线设备暴露给外部智能体
+type DefaultMCPServerService struct {
+	config    *configs.Config
+	logger    *utils.Logger
+	mcpServer *server.MCPServer
+	sseServer *server.SSEServer
+}
+
+// NewDefaultMCPServerService 构造函数
+func NewDefaultMCPServerService(config *configs.Config, logger *utils.Logger) *DefaultMCPServerService {
+	return &DefaultMCPServerService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册MCP路由，同时支持SSE和Streamable HTTP两种传输
+func (s *DefaultMCPServerService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	if !s.config.MCPServer.Enabled {
+		s.logger.Info("MCP服务未启用")
+		return nil
+	}
+	if len(s.tokens()) == 0 {
+		s.logger.Warn("MCP服务未配置token，跳过")
+		return nil
+	}
+
+	s.mcpServer = server.NewMCPServer(serverName, serverVersion, server.WithToolCapabilities(false))
+	s.registerTools()
+
+	basePath := strings.TrimSuffix(apiGroup.BasePath(), "/") + "/mcp"
+	s.sseServer = server.NewSSEServer(s.mcpServer,
+		server.WithStaticBasePath(basePath),
+		server.WithUseFullURLForMessageEndpoint(false),
+		server.WithAppendQueryToMessageEndpoint(),
+		server.WithKeepAlive(true),
+	)
+
+	group := apiGroup.Group("/mcp", s.tokenAuth)
+	group.GET("/sse", gin.WrapH(s.sseServer.SSEHandler()))
+	group.POST("/message", gin.WrapH(s.sseServer.MessageHandler()))
+	group.POST("", s.handleStreamable)
+	group.GET("", func(c *gin.Context) {
+		// 不提供服务端主动推送的流
+		c.Status(http.StatusMethodNotAllowed)
+	})
+	group.OPTIONS("", func(c *gin.Context) {})
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+
+	s.logger.Info("MCP服务路由注册完成: %s/sse, %s", basePath, basePath)
+	return nil
+}
+
+// tokens 允许访问的token，未单独配置时使用server.token
+func (s *DefaultMCPServerService) tokens() []string {
+	if len(s.config.MCPServer.Tokens) > 0 {
+		return s.config.MCPServer.Tokens
+	}
+	if s.config.Server.Token != "" {
+		return []string{s.config.Server.Token}
+	}
+	return nil
+}
+
+// tokenAuth 校验Bearer token，SSE客户端无法设置请求头时可使用token查询参数
+func (s *DefaultMCPServerService) tokenAuth(c *gin.Context) {
+	if c.Request.Method == http.MethodOptions {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Mcp-Session-Id")
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token = c.Query("token")
+	}
+	for _, allowed := range s.tokens() {
+		if auth.TokenEqual(token, allowed) {
+			c.Next()
+			return
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, auth.ErrorResponse{Success: false, Message: "无效的MCP token"})
+}
+
+// handleStreamable Streamable HTTP传输，每个POST请求直接返回JSON-RPC响应
+func (s *DefaultMCPServerService) handleStreamable(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "读取请求失败"})
+		return
+	}
+
+	response := s.mcpServer.HandleMessage(c.Request.Context(), body)
+	if response == nil {
+		// 通知类消息没有响应
+		c.Status(http.StatusAccepted)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// registerTools 注册设备相关工具
+func (s *DefaultMCPServerService) registerTools() {
+	s.mcpServer.AddTool(mcp.NewTool("list_devices",
+		mcp.WithDescription("列出当前在线的小智设备"),
+	), s.handleListDevices)
+
+	s.mcpServer.AddTool(mcp.NewTool("speak_on_device",
+		mcp.WithDescription("让指定设备播报一段文本，会打断设备当前的播报"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithString("text", mcp.Required(), mcp.Description("要播报的文本")),
+	), s.handleSpeak)
+
+	s.mcpServer.AddTool(mcp.NewTool("list_device_tools",
+		mcp.WithDescription("列出指定设备端上报的MCP工具"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+	), s.handleListDeviceTools)
+
+	s.mcpServer.AddTool(mcp.NewTool("call_device_tool",
+		mcp.WithDescription("通过设备的MCP连接调用设备端工具，如调节音量、拍照"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithString("tool_name", mcp.Required(), mcp.Description("工具名称，来自list_device_tools")),
+		mcp.WithObject("arguments", mcp.Description("工具参数")),
+	), s.handleCallDeviceTool)
+
+	s.mcpServer.AddTool(mcp.NewTool("get_conversation",
+		mcp.WithDescription("读取指定设备最近的对话记录"),
+		mcp.WithString("device_id", mcp.Required(), mcp.Description("设备ID")),
+		mcp.WithNumber("limit", mcp.Description("返回的消息条数，默认20")),
+	), s.handleGetConversation)
+}
+
+func (s *DefaultMCPServerService) handleListDevices(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return jsonResult(core.ListDevices())
+}
+
+func (s *DefaultMCPServerService) handleSpeak(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, errResult := s.connection(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	text, err := request.RequireString("text")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, speakTimeout)
+	defer cancel()
+	if err := conn.Speak(ctx, text); err != nil {
+		return mcp.NewToolResultErrorFromErr("播报失败", err), nil
+	}
+	return mcp.NewToolResultText("已开始播报"), nil
+}
+
+func (s *DefaultMCPServerService) handleListDeviceTools(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, errResult := s.connection(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	tools, err := conn.DeviceTools()
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	result := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Function == nil {
+			continue
+		}
+		result = append(result, map[string]interface{}{
+			"name":        tool.Function.Name,
+			"description": tool.Function.Description,
+			"parameters":  tool.Function.Parameters,
+		})
+	}
+	return jsonResult(result)
+}
+
+func (s *DefaultMCPServerService) handleCallDeviceTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, errResult := s.connection(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	name, err := request.RequireString("tool_name")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	args, _ := request.GetArguments()["arguments"].(map[string]interface{})
+
+	ctx, cancel := context.WithTimeout(ctx, deviceToolTimeout)
+	defer cancel()
+	result, err := conn.CallDeviceTool(ctx, name, args)
+	if err != nil {
+		return mcp.NewToolResultErrorFromErr("调用设备工具失败", err), nil
+	}
+	return toCallToolResult(result)
+}
+
+func (s *DefaultMCPServerService) handleGetConversation(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, errResult := s.connection(request)
+	if errResult != nil {
+		return errResult, nil
+	}
+	return jsonResult(conn.Conversation(request.GetInt("limit", 20)))
+}
+
+// connection 按device_id参数查找在线连接
+func (s *DefaultMCPServerService) connection(request mcp.CallToolRequest) (*core.ConnectionHandler, *mcp.CallToolResult) {
+	deviceID, err := request.RequireString("device_id")
+	if err != nil {
+		return nil, mcp.NewToolResultError(err.Error())
+	}
+	conn, ok := core.GetConnection(deviceID)
+	if !ok {
+		return nil, mcp.NewToolResultError(fmt.Sprintf("设备 %s 不在线", deviceID))
+	}
+	return conn, nil
+}
+
+// toCallToolResult 将设备端工具结果转换为MCP内容，图片和音频原样返回
+func toCallToolResult(result interface{}) (*mcp.CallToolResult, error) {
+	action, ok := result.(types.ActionResponse)
+	if !ok {
+		return jsonResult(result)
+	}
+	switch value := action.Result.(type) {
+	case string:
+		return mcp.NewToolResultText(value), nil
+	case types.ActionResponseCall:
+		toolResult, ok := value.Args.(coremcp.ToolResult)
+		if !ok {
+			return jsonResult(value.Args)
+		}
+		contents := make([]mcp.Content, 0, len(toolResult.Contents))
+		for _, content := range toolResult.Contents {
+			switch content.Type {
+			case coremcp.ContentTypeImage:
+				contents = append(contents, mcp.NewImageContent(content.Data, content.MIMEType))
+			case coremcp.ContentTypeAudio:
+				contents = append(contents, mcp.NewAudioContent(content.Data, content.MIMEType))
+			default:
+				contents = append(contents, mcp.NewTextContent(content.Text))
+			}
+		}
+		return &mcp.CallToolResult{Content: contents}, nil
+	}
+	return jsonResult(action.Result)
+}
+
+func jsonResult(value interface{}) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("序列化结果失败: %v", err)
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
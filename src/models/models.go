@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	//"gorm.io/gorm"
 	"gorm.io/datatypes"
 )
@@ -21,7 +23,7 @@ type SystemConfig struct {
 // 用户
 type User struct {
 	ID       uint   `gorm:"primaryKey"`
-	Username string `gorm:"uniqueIndex;not null"`
+	Username string `gorm:"uniqueIndex;size:191;not null"`
 	Password string // 建议加密
 	Role     string // 可选值：admin/user
 	Setting  UserSetting
@@ -42,7 +44,7 @@ type UserSetting struct {
 // 模块配置（可选）
 type ModuleConfig struct {
 	ID          uint   `gorm:"primaryKey"`
-	Name        string `gorm:"uniqueIndex;not null"` // 模块名
+	Name        string `gorm:"uniqueIndex;size:191;not null"` // 模块名
 	Type        string
 	ConfigJSON  datatypes.JSON
 	Public      bool
@@ -54,3 +56,10 @@ type ServerConfig struct {
 	ID     uint   `gorm:"primaryKey"`
 	CfgStr string `gorm:"type:text"`
 }
+
+// SchemaMigration 已执行的数据库结构变更版本
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:64"`
+	AppliedAt time.Time
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Role 角色定义，切换角色时提示词、音色、问候语等一起生效
+type Role struct {
+	ID              uint           `gorm:"primaryKey"                    json:"id"`
+	Name            string         `gorm:"uniqueIndex;size:191;not null" json:"name"`
+	Description     string         `                                     json:"description"`
+	Prompt          string         `gorm:"type:text"                     json:"prompt"`
+	Voice           string         `                                     json:"voice"`             // TTS音色，空表示使用默认音色
+	Greeting        string         `                                     json:"greeting"`          // 切换到该角色后的问候语
+	AllowedTools    datatypes.JSON `                                     json:"allowed_tools"`     // 允许调用的工具，空表示不限制
+	QuickReplyWords datatypes.JSON `                                     json:"quick_reply_words"` // 唤醒词快速回复，空表示使用全局配置
+	Temperature     *float64       `                                     json:"temperature"`       // LLM温度，空表示使用LLM配置
+	KnowledgeBase   datatypes.JSON `                                     json:"knowledge_base"`    // 可检索的知识库集合
+	Hotwords        datatypes.JSON `                                     json:"hotwords"`          // 语音识别热词，可写成"词:权重"
+	CreatedAt       time.Time      `                                     json:"created_at"`
+	UpdatedAt       time.Time      `                                     json:"updated_at"`
+}
+
+// DeviceRole 设备当前使用的角色，重连后恢复
+type DeviceRole struct {
+	DeviceID  string    `gorm:"primaryKey;type:varchar(255)" json:"device_id"`
+	RoleName  string    `gorm:"not null"                     json:"role"`
+	UpdatedAt time.Time `                                    json:"updated_at"`
+}
+
+// Tools 允许调用的工具列表
+func (r *Role) Tools() []string {
+	return jsonStrings(r.AllowedTools)
+}
+
+// AllowsTool 判断角色是否允许调用工具，未限制时全部允许，本地工具可以省略local_前缀
+// always为不受角色限制、始终可用的工具
+func (r *Role) AllowsTool(name string, always ...string) bool {
+	allowed := r.Tools()
+	if len(allowed) == 0 {
+		return true
+	}
+
+	short := strings.TrimPrefix(name, "local_")
+	for _, item := range append(allowed, always...) {
+		if item == name || item == short {
+			return true
+		}
+	}
+	return false
+}
+
+// QuickReplies 唤醒词快速回复列表
+func (r *Role) QuickReplies() []string {
+	return jsonStrings(r.QuickReplyWords)
+}
+
+// Collections 可检索的知识库集合
+func (r *Role) Collections() []string {
+	return jsonStrings(r.KnowledgeBase)
+}
+
+// HotwordList 语音识别热词列表
+func (r *Role) HotwordList() []string {
+	return jsonStrings(r.Hotwords)
+}
+
+// StringsJSON 将字符串列表转为JSON字段，空列表返回nil
+func StringsJSON(list []string) datatypes.JSON {
+	if len(list) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(list)
+	return datatypes.JSON(data)
+}
+
+func jsonStrings(data datatypes.JSON) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil
+	}
+	return list
+}
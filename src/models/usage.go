@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// UsageRecord 按设备、日期和计量项汇总的用量
+// 设备ID为OpenAI兼容接口时形如 api:<user>
+type UsageRecord struct {
+	ID        uint      `gorm:"primaryKey"                                                json:"-"`
+	DeviceID  string    `gorm:"uniqueIndex:idx_usage_day;type:varchar(255);not null"     json:"device_id"`
+	Day       string    `gorm:"uniqueIndex:idx_usage_day;type:varchar(10);not null;index" json:"day"` // 2006-01-02
+	Metric    string    `gorm:"uniqueIndex:idx_usage_day;type:varchar(32);not null"      json:"metric"`
+	Amount    float64   `                                                                 json:"amount"`
+	UpdatedAt time.Time `                                                                 json:"updated_at"`
+}
+
+// DeviceLevel 设备的用户级别，决定用量配额
+type DeviceLevel struct {
+	DeviceID  string    `gorm:"primaryKey;type:varchar(255)" json:"device_id"`
+	Level     string    `gorm:"not null"                     json:"level"`
+	UpdatedAt time.Time `                                    json:"updated_at"`
+}
@@ -0,0 +1,86 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/kb"
+	"xiaozhi-server-go/src/core/utils"
+)
+
+const usage = `用法: xiaozhi-server music <命令> [参数]
+
+命令:
+  import   扫描音乐目录并导入知识库
+  list     列出知识库中的歌曲
+  delete   删除歌曲，例如: music delete -remove-file <id>
+`
+
+// RunCommand 执行music子命令，args不包含"music"本身
+func RunCommand(config *configs.Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Print(usage)
+		return fmt.Errorf("缺少子命令")
+	}
+
+	switch args[0] {
+	case "import":
+		fs := flag.NewFlagSet("music import", flag.ContinueOnError)
+		dir := fs.String("dir", utils.DefaultMusicDir, "音乐目录")
+		enrich := fs.Bool("enrich", false, "使用LLM补全情绪、场景、流派等标签")
+		transcode := fs.Bool("transcode", true, "预转码到music-opus目录")
+		force := fs.Bool("force", false, "已入库的歌曲也重新处理")
+		prune := fs.Bool("prune", false, "删除文件已不存在的歌曲")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		result, err := Import(context.Background(), config, kb.IngestOptions{
+			MusicDir:  *dir,
+			Enrich:    *enrich,
+			Transcode: *transcode,
+			Force:     *force,
+			Prune:     *prune,
+		})
+		if result != nil {
+			printJSON(result)
+		}
+		return err
+
+	case "list":
+		printJSON(kb.List())
+		return nil
+
+	case "delete":
+		fs := flag.NewFlagSet("music delete", flag.ContinueOnError)
+		removeFile := fs.Bool("remove-file", false, "同时删除音乐文件")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return fmt.Errorf("缺少歌曲ID")
+		}
+		for _, id := range fs.Args() {
+			if err := kb.DeleteSong(id, *removeFile); err != nil {
+				return err
+			}
+			fmt.Println("已删除:", id)
+		}
+		return nil
+
+	default:
+		fmt.Print(usage)
+		return fmt.Errorf("未知的子命令: %s", args[0])
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
@@ -0,0 +1,171 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/kb"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportStatus 导入任务状态
+type ImportStatus struct {
+	Running    bool             `json:"running"`
+	StartedAt  time.Time        `json:"started_at,omitempty"`
+	FinishedAt time.Time        `json:"finished_at,omitempty"`
+	Options    kb.IngestOptions `json:"options"`
+	Result     *kb.IngestResult `json:"result,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// DefaultMusicService 音乐库管理服务
+type DefaultMusicService struct {
+	config *configs.Config
+	logger *utils.Logger
+
+	mu     sync.Mutex
+	status ImportStatus
+}
+
+// NewDefaultMusicService 构造函数
+func NewDefaultMusicService(config *configs.Config, logger *utils.Logger) *DefaultMusicService {
+	return &DefaultMusicService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册音乐库相关路由
+func (s *DefaultMusicService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	group := apiGroup.Group("/music", auth.AdminAuth(s.config, "GET, POST, DELETE, OPTIONS"))
+	group.GET("", s.handleList)
+	group.GET("/import", s.handleImportStatus)
+	group.POST("/import", func(c *gin.Context) { s.handleImport(ctx, c) })
+	group.DELETE("/:id", s.handleDelete)
+	// OPTIONS请求由AdminAuth直接返回
+	group.OPTIONS("", func(c *gin.Context) {})
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+
+	s.logger.Info("Music HTTP服务路由注册完成")
+	return nil
+}
+
+// @Summary 歌曲列表
+// @Description 列出音乐知识库中的所有歌曲
+// @Tags Music
+// @Produce json
+// @Success 200 {array} kb.SongEntry
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /music [get]
+func (s *DefaultMusicService) handleList(c *gin.Context) {
+	c.JSON(http.StatusOK, kb.List())
+}
+
+// @Summary 导入状态
+// @Description 查询最近一次音乐导入任务的状态和结果
+// @Tags Music
+// @Produce json
+// @Success 200 {object} ImportStatus
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /music/import [get]
+func (s *DefaultMusicService) handleImportStatus(c *gin.Context) {
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+	c.JSON(http.StatusOK, status)
+}
+
+// @Summary 导入音乐目录
+// @Description 扫描音乐目录，读取ID3信息，可选LLM补全标签和预转码，后台执行
+// @Tags Music
+// @Accept json
+// @Produce json
+// @Param body body kb.IngestOptions false "导入选项"
+// @Success 202 {object} ImportStatus
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 409 {object} auth.ErrorResponse
+// @Router /music/import [post]
+func (s *DefaultMusicService) handleImport(ctx context.Context, c *gin.Context) {
+	opts := kb.IngestOptions{Transcode: true}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&opts); err != nil {
+			c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "请求参数错误: " + err.Error()})
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if s.status.Running {
+		s.mu.Unlock()
+		c.JSON(http.StatusConflict, auth.ErrorResponse{Success: false, Message: "已有导入任务正在执行"})
+		return
+	}
+	s.status = ImportStatus{Running: true, StartedAt: time.Now(), Options: opts}
+	status := s.status
+	s.mu.Unlock()
+
+	go s.runImport(ctx, opts)
+	c.JSON(http.StatusAccepted, status)
+}
+
+func (s *DefaultMusicService) runImport(ctx context.Context, opts kb.IngestOptions) {
+	result, err := Import(ctx, s.config, opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.Running = false
+	s.status.FinishedAt = time.Now()
+	s.status.Result = result
+	if err != nil {
+		s.status.Error = err.Error()
+		s.logger.Error("音乐导入失败: %v", err)
+		return
+	}
+	s.logger.Info("音乐导入完成: 新增%d, 更新%d, 跳过%d, 失败%d",
+		len(result.Added), len(result.Updated), len(result.Skipped), len(result.Failed))
+}
+
+// @Summary 删除歌曲
+// @Description 从知识库删除歌曲并清理opus缓存，remove_file=true时同时删除音乐文件
+// @Tags Music
+// @Produce json
+// @Param id path string true "歌曲ID"
+// @Param remove_file query bool false "是否删除音乐文件"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /music/{id} [delete]
+func (s *DefaultMusicService) handleDelete(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := kb.Get(id); !ok {
+		c.JSON(http.StatusNotFound, auth.ErrorResponse{Success: false, Message: "歌曲不存在"})
+		return
+	}
+
+	removeFile := c.Query("remove_file") == "true"
+	if err := kb.DeleteSong(id, removeFile); err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id})
+}
+
+// Import 按选项导入音乐目录，需要时创建LLM标签补全器
+func Import(ctx context.Context, config *configs.Config, opts kb.IngestOptions) (*kb.IngestResult, error) {
+	var enricher kb.SongEnricher
+	if opts.Enrich {
+		e, err := kb.NewLLMEnricherFromConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("创建LLM标签补全器失败: %v", err)
+		}
+		enricher = e
+	}
+	return kb.ImportMusicDir(ctx, opts, enricher)
+}
@@ -0,0 +1,200 @@
+package quota
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/usage"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const dayLayout = "2006-01-02"
+
+// ReportResponse 用量报表
+type ReportResponse struct {
+	From  string                  `json:"from"  example:"2025-06-01"`
+	To    string                  `json:"to"    example:"2025-06-30"`
+	Items []database.UsageSummary `json:"items"`
+}
+
+// DeviceLevelRequest 设置设备用户级别的请求，level为空表示恢复默认级别
+type DeviceLevelRequest struct {
+	Level string `json:"level" example:"premium"`
+}
+
+// LevelResponse 用户级别及其配额
+type LevelResponse struct {
+	Name               string             `json:"name"                 example:"basic"`
+	Default            bool               `json:"default"`
+	Daily              map[string]float64 `json:"daily"`
+	Monthly            map[string]float64 `json:"monthly"`
+	MaxTasks           int                `json:"max_tasks"`
+	MaxConcurrentTasks int                `json:"max_concurrent_tasks"`
+}
+
+// DefaultUsageService 用量报表和用户级别管理服务
+type DefaultUsageService struct {
+	config *configs.Config
+	logger *utils.Logger
+}
+
+// NewDefaultUsageService 构造函数
+func NewDefaultUsageService(config *configs.Config, logger *utils.Logger) *DefaultUsageService {
+	return &DefaultUsageService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册用量相关路由
+func (s *DefaultUsageService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	if usage.Default() == nil || database.GetUsageDB() == nil {
+		s.logger.Info("用量统计未启用，跳过用量管理服务")
+		return nil
+	}
+
+	group := apiGroup.Group("/usage", auth.AdminAuth(s.config, "GET, PUT, DELETE, OPTIONS"))
+	group.GET("/report", s.handleReport)
+	group.GET("/levels", s.handleLevels)
+	group.GET("/devices/:device_id", s.handleDevice)
+	group.PUT("/devices/:device_id/level", s.handleSetLevel)
+	group.DELETE("/devices/:device_id/level", s.handleResetLevel)
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+
+	s.logger.Info("Usage HTTP服务路由注册完成")
+	return nil
+}
+
+// @Summary 用量报表
+// @Description 按设备和计量项汇总一段时间内的用量，默认为本月
+// @Tags Usage
+// @Produce json
+// @Param from query string false "开始日期，如2025-06-01"
+// @Param to query string false "结束日期，如2025-06-30"
+// @Param device query string false "只看某个设备"
+// @Success 200 {object} ReportResponse
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /usage/report [get]
+func (s *DefaultUsageService) handleReport(c *gin.Context) {
+	now := time.Now()
+	from := c.DefaultQuery("from", now.Format("2006-01")+"-01")
+	to := c.DefaultQuery("to", now.Format(dayLayout))
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse(dayLayout, day); err != nil {
+			c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "日期格式应为YYYY-MM-DD: " + day})
+			return
+		}
+	}
+
+	// 先写入内存中累计的用量
+	usage.Default().Flush()
+	items, err := database.GetUsageDB().Report(from, to, c.Query("device"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	if items == nil {
+		items = []database.UsageSummary{}
+	}
+	c.JSON(http.StatusOK, ReportResponse{From: from, To: to, Items: items})
+}
+
+// @Summary 用户级别列表
+// @Description 列出配置的用户级别及其配额
+// @Tags Usage
+// @Produce json
+// @Success 200 {array} LevelResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /usage/levels [get]
+func (s *DefaultUsageService) handleLevels(c *gin.Context) {
+	defaultLevel := s.config.Usage.DefaultLevel
+	if defaultLevel == "" {
+		defaultLevel = usage.DefaultLevel
+	}
+	levels := make([]LevelResponse, 0, len(s.config.Usage.Levels))
+	for name, level := range s.config.Usage.Levels {
+		levels = append(levels, LevelResponse{
+			Name:               name,
+			Default:            name == defaultLevel,
+			Daily:              level.Daily,
+			Monthly:            level.Monthly,
+			MaxTasks:           level.MaxTasks,
+			MaxConcurrentTasks: level.MaxConcurrentTasks,
+		})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Name < levels[j].Name })
+	c.JSON(http.StatusOK, levels)
+}
+
+// @Summary 设备用量
+// @Description 设备的用户级别、当日和当月用量及配额
+// @Tags Usage
+// @Produce json
+// @Param device_id path string true "设备ID，OpenAI兼容接口的调用方为api:<user>"
+// @Success 200 {object} usage.Snapshot
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /usage/devices/{device_id} [get]
+func (s *DefaultUsageService) handleDevice(c *gin.Context) {
+	snapshot, err := usage.Default().Snapshot(c.Param("device_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// @Summary 设置设备用户级别
+// @Description 设置设备的用户级别，决定用量和异步任务配额，level为空时恢复默认级别
+// @Tags Usage
+// @Accept json
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Param body body DeviceLevelRequest true "用户级别"
+// @Success 200 {object} usage.Snapshot
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /usage/devices/{device_id}/level [put]
+func (s *DefaultUsageService) handleSetLevel(c *gin.Context) {
+	var req DeviceLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "请求格式错误: " + err.Error()})
+		return
+	}
+	s.setLevel(c, strings.TrimSpace(req.Level))
+}
+
+// @Summary 恢复设备默认级别
+// @Tags Usage
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} usage.Snapshot
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /usage/devices/{device_id}/level [delete]
+func (s *DefaultUsageService) handleResetLevel(c *gin.Context) {
+	s.setLevel(c, "")
+}
+
+func (s *DefaultUsageService) setLevel(c *gin.Context, level string) {
+	deviceID := c.Param("device_id")
+	meter := usage.Default()
+	if err := meter.SetLevel(deviceID, level); err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	s.logger.Info("设置设备%s的用户级别: %q", deviceID, level)
+	snapshot, err := meter.Snapshot(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
@@ -0,0 +1,278 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/configs/database"
+	"xiaozhi-server-go/src/core/auth"
+	"xiaozhi-server-go/src/core/quickreply"
+	"xiaozhi-server-go/src/core/utils"
+	"xiaozhi-server-go/src/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleRequest 新建或更新角色的请求
+type RoleRequest struct {
+	Name            string   `json:"name"              binding:"required" example:"英语老师"`
+	Description     string   `json:"description"`
+	Prompt          string   `json:"prompt"            binding:"required"`
+	Voice           string   `json:"voice"             example:"zh-CN-XiaoyiNeural"`
+	Greeting        string   `json:"greeting"          example:"Hello, 我是你的英语老师"`
+	AllowedTools    []string `json:"allowed_tools"     example:"get_time,search_knowledge"`
+	QuickReplyWords []string `json:"quick_reply_words"`
+	Temperature     *float64 `json:"temperature"       example:"0.7"`
+	KnowledgeBase   []string `json:"knowledge_base"    example:"english"`
+	Hotwords        []string `json:"hotwords"          example:"Lily,phonics:2"`
+}
+
+// DeviceRoleRequest 设置设备角色的请求，role为空表示恢复默认
+type DeviceRoleRequest struct {
+	Role string `json:"role" example:"英语老师"`
+}
+
+// DefaultRoleService 角色管理服务
+type DefaultRoleService struct {
+	config *configs.Config
+	logger *utils.Logger
+}
+
+// NewDefaultRoleService 构造函数
+func NewDefaultRoleService(config *configs.Config, logger *utils.Logger) *DefaultRoleService {
+	return &DefaultRoleService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册角色相关路由
+func (s *DefaultRoleService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	if database.GetRoleDB() == nil {
+		s.logger.Warn("数据库未初始化，跳过角色管理服务")
+		return nil
+	}
+
+	adminAuth := auth.AdminAuth(s.config, "GET, POST, PUT, DELETE, OPTIONS")
+	group := apiGroup.Group("/roles", adminAuth)
+	group.GET("", s.handleList)
+	group.POST("", s.handleCreate)
+	group.GET("/:name", s.handleGet)
+	group.PUT("/:name", s.handleUpdate)
+	group.DELETE("/:name", s.handleDelete)
+	group.OPTIONS("", func(c *gin.Context) {})
+	group.OPTIONS("/*path", func(c *gin.Context) {})
+
+	devices := apiGroup.Group("/devices", adminAuth)
+	devices.GET("/:device_id/role", s.handleGetDeviceRole)
+	devices.PUT("/:device_id/role", s.handleSetDeviceRole)
+	devices.OPTIONS("/*path", func(c *gin.Context) {})
+
+	s.logger.Info("Role HTTP服务路由注册完成")
+	return nil
+}
+
+// @Summary 角色列表
+// @Description 列出所有角色定义
+// @Tags Role
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /roles [get]
+func (s *DefaultRoleService) handleList(c *gin.Context) {
+	roles, err := database.GetRoleDB().ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// @Summary 角色详情
+// @Tags Role
+// @Produce json
+// @Param name path string true "角色名"
+// @Success 200 {object} models.Role
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /roles/{name} [get]
+func (s *DefaultRoleService) handleGet(c *gin.Context) {
+	role, err := database.GetRoleDB().GetRole(c.Param("name"))
+	if err != nil {
+		s.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// @Summary 新建角色
+// @Description 新建角色，包括提示词、音色、问候语、允许的工具、快速回复、温度、知识库和识别热词
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param body body RoleRequest true "角色定义"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /roles [post]
+func (s *DefaultRoleService) handleCreate(c *gin.Context) {
+	role, ok := s.bindRole(c)
+	if !ok {
+		return
+	}
+	if _, err := database.GetRoleDB().GetRole(role.Name); err == nil {
+		c.JSON(http.StatusConflict, auth.ErrorResponse{Success: false, Message: "角色已存在"})
+		return
+	}
+	if err := database.GetRoleDB().CreateRole(role); err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	s.logger.Info("新建角色: %s", role.Name)
+	quickreply.Refresh() // 问候语、回复词或音色可能变化
+	c.JSON(http.StatusOK, role)
+}
+
+// @Summary 更新角色
+// @Description 整体更新角色定义，允许改名，使用该角色的设备下次切换或重连时生效
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param name path string true "角色名"
+// @Param body body RoleRequest true "角色定义"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /roles/{name} [put]
+func (s *DefaultRoleService) handleUpdate(c *gin.Context) {
+	role, ok := s.bindRole(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	if role.Name != name {
+		if _, err := database.GetRoleDB().GetRole(role.Name); err == nil {
+			c.JSON(http.StatusConflict, auth.ErrorResponse{Success: false, Message: "角色已存在"})
+			return
+		}
+	}
+	if err := database.GetRoleDB().UpdateRole(name, role); err != nil {
+		s.writeError(c, err)
+		return
+	}
+	s.logger.Info("更新角色: %s", name)
+	quickreply.Refresh()
+	c.JSON(http.StatusOK, role)
+}
+
+// @Summary 删除角色
+// @Description 删除角色，使用该角色的设备恢复默认设置
+// @Tags Role
+// @Produce json
+// @Param name path string true "角色名"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /roles/{name} [delete]
+func (s *DefaultRoleService) handleDelete(c *gin.Context) {
+	name := c.Param("name")
+	if err := database.GetRoleDB().DeleteRole(name); err != nil {
+		s.writeError(c, err)
+		return
+	}
+	s.logger.Info("删除角色: %s", name)
+	quickreply.Refresh()
+	c.JSON(http.StatusOK, gin.H{"success": true, "name": name})
+}
+
+// @Summary 设备当前角色
+// @Tags Role
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} auth.ErrorResponse
+// @Router /devices/{device_id}/role [get]
+func (s *DefaultRoleService) handleGetDeviceRole(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	name, err := database.GetRoleDB().GetDeviceRole(deviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device_id": deviceID, "role": name})
+}
+
+// @Summary 设置设备角色
+// @Description 设置设备使用的角色，设备下次连接时生效，role为空表示恢复默认
+// @Tags Role
+// @Accept json
+// @Produce json
+// @Param device_id path string true "设备ID"
+// @Param body body DeviceRoleRequest true "角色名"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} auth.ErrorResponse
+// @Failure 401 {object} auth.ErrorResponse
+// @Failure 404 {object} auth.ErrorResponse
+// @Router /devices/{device_id}/role [put]
+func (s *DefaultRoleService) handleSetDeviceRole(c *gin.Context) {
+	var req DeviceRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "请求参数错误: " + err.Error()})
+		return
+	}
+	if req.Role != "" {
+		if _, err := database.GetRoleDB().GetRole(req.Role); err != nil {
+			s.writeError(c, err)
+			return
+		}
+	}
+
+	deviceID := c.Param("device_id")
+	if err := database.GetRoleDB().SetDeviceRole(deviceID, req.Role); err != nil {
+		c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "device_id": deviceID, "role": req.Role})
+}
+
+// bindRole 解析请求体为角色模型，失败时直接返回400
+func (s *DefaultRoleService) bindRole(c *gin.Context) (*models.Role, bool) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "请求参数错误: " + err.Error()})
+		return nil, false
+	}
+	if strings.Contains(req.Name, "@") {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "角色名不能包含@"})
+		return nil, false
+	}
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		c.JSON(http.StatusBadRequest, auth.ErrorResponse{Success: false, Message: "temperature应在0到2之间"})
+		return nil, false
+	}
+
+	return &models.Role{
+		Name:            strings.TrimSpace(req.Name),
+		Description:     req.Description,
+		Prompt:          req.Prompt,
+		Voice:           req.Voice,
+		Greeting:        req.Greeting,
+		AllowedTools:    models.StringsJSON(req.AllowedTools),
+		QuickReplyWords: models.StringsJSON(req.QuickReplyWords),
+		Temperature:     req.Temperature,
+		KnowledgeBase:   models.StringsJSON(req.KnowledgeBase),
+		Hotwords:        models.StringsJSON(req.Hotwords),
+	}, true
+}
+
+func (s *DefaultRoleService) writeError(c *gin.Context, err error) {
+	if errors.Is(err, database.ErrRoleNotFound) {
+		c.JSON(http.StatusNotFound, auth.ErrorResponse{Success: false, Message: err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, auth.ErrorResponse{Success: false, Message: err.Error()})
+}
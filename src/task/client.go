@@ -61,15 +61,54 @@ func (cm *ClientManager) RemoveClient(clientID string) {
 	}
 }
 
-// NewResourceQuota creates a new resource quota instance
-// TODO: Add configuration for max tasks
-//
-// TODO	不同级别的用户可以设置不同的配额
+// LevelLimits 一个用户级别的任务配额
+type LevelLimits struct {
+	MaxTotalTasks      int // 每日任务数
+	MaxConcurrentTasks int // 同时运行的任务数
+}
+
+var (
+	levelLimitsMu sync.RWMutex
+	levelLimits   = map[UserLevel]LevelLimits{
+		UserLevelBasic:    {MaxTotalTasks: 100, MaxConcurrentTasks: 5},
+		UserLevelPremium:  {MaxTotalTasks: 500, MaxConcurrentTasks: 15},
+		UserLevelBusiness: {MaxTotalTasks: 2000, MaxConcurrentTasks: 50},
+	}
+)
+
+// SetLevelLimits 按配置覆盖各级别的任务配额，未配置或为0的项保留默认值
+func SetLevelLimits(limits map[UserLevel]LevelLimits) {
+	levelLimitsMu.Lock()
+	defer levelLimitsMu.Unlock()
+	for level, limit := range limits {
+		current := levelLimits[level]
+		if limit.MaxTotalTasks > 0 {
+			current.MaxTotalTasks = limit.MaxTotalTasks
+		}
+		if limit.MaxConcurrentTasks > 0 {
+			current.MaxConcurrentTasks = limit.MaxConcurrentTasks
+		}
+		levelLimits[level] = current
+	}
+}
+
+// limitsFor 级别的任务配额，未知级别使用basic
+func limitsFor(level UserLevel) LevelLimits {
+	levelLimitsMu.RLock()
+	defer levelLimitsMu.RUnlock()
+	if limit, ok := levelLimits[level]; ok {
+		return limit
+	}
+	return levelLimits[UserLevelBasic]
+}
+
+// NewResourceQuota creates a new resource quota instance with basic level limits
 func NewResourceQuota() *ResourceQuota {
 	now := time.Now()
+	limit := limitsFor(UserLevelBasic)
 	quota := &ResourceQuota{
-		MaxTotalTasks:      100, // Default daily total limit
-		MaxConcurrentTasks: 10,  // Default concurrent limit
+		MaxTotalTasks:      limit.MaxTotalTasks,
+		MaxConcurrentTasks: limit.MaxConcurrentTasks,
 		TotalUsedQuota:     0,
 		TotalRunningTasks:  0,
 		UserLevel:          UserLevelBasic,
@@ -96,17 +135,9 @@ func (rq *ResourceQuota) SetUserLevel(level UserLevel) {
 	rq.UserLevel = level
 
 	// 根据用户级别设置不同的配额
-	switch level {
-	case UserLevelBasic:
-		rq.MaxTotalTasks = 100
-		rq.MaxConcurrentTasks = 5
-	case UserLevelPremium:
-		rq.MaxTotalTasks = 500
-		rq.MaxConcurrentTasks = 15
-	case UserLevelBusiness:
-		rq.MaxTotalTasks = 2000
-		rq.MaxConcurrentTasks = 50
-	}
+	limit := limitsFor(level)
+	rq.MaxTotalTasks = limit.MaxTotalTasks
+	rq.MaxConcurrentTasks = limit.MaxConcurrentTasks
 }
 
 func (rq *ResourceQuota) CheckAndResetDailyQuota() {
@@ -38,6 +38,16 @@ func (tm *TaskManager) Stop() {
 	tm.scheduledTasks.Stop()
 }
 
+// SetClientLevel 设置客户端的用户级别，按级别限制任务配额
+func (tm *TaskManager) SetClientLevel(clientID string, level UserLevel) error {
+	ctx, err := tm.clientManager.GetClientContext(clientID)
+	if err != nil {
+		return fmt.Errorf("failed to get client context: %v", err)
+	}
+	ctx.ResourceQuota.SetUserLevel(level)
+	return nil
+}
+
 // SubmitTask submits a task for execution
 func (tm *TaskManager) SubmitTask(clientID string, task *Task) error {
 	// 检查任务类型是否已注册
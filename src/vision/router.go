@@ -0,0 +1,247 @@
+package vision
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/providers/vlllm"
+)
+
+// 路由策略
+const (
+	PolicySelected   = "selected"    // selected_module.VLLLM优先，其他模型按名称依次兜底
+	PolicyLocalFirst = "local_first" // 本地模型优先，全部失败后使用云端模型
+
+	defaultRetryInterval = time.Minute
+)
+
+// ProviderStatus 模型的健康状态，由GET /api/vision返回
+type ProviderStatus struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	Model     string    `json:"model"`
+	Local     bool      `json:"local"`
+	Healthy   bool      `json:"healthy"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// providerEntry 一个VLLLM配置，创建失败时provider为nil
+type providerEntry struct {
+	name      string
+	config    configs.VLLMConfig
+	local     bool
+	provider  *vlllm.Provider
+	healthy   bool
+	lastError string
+	checkedAt time.Time
+}
+
+// router 在多个VLLLM之间选择，记录每个模型的健康状态
+type router struct {
+	mu         sync.RWMutex
+	entries    map[string]*providerEntry
+	names      []string // 按名称排序
+	selected   string
+	policy     string
+	sizeRoutes []configs.VisionSizeRoute
+}
+
+func newRouter(config *configs.Config) *router {
+	policy := strings.ToLower(config.VisionRouting.Policy)
+	if policy != PolicyLocalFirst {
+		policy = PolicySelected
+	}
+	return &router{
+		entries:    make(map[string]*providerEntry),
+		selected:   config.SelectedModule["VLLLM"],
+		policy:     policy,
+		sizeRoutes: config.VisionRouting.SizeRoutes,
+	}
+}
+
+// add 登记一个模型，err不为nil时标记为不可用
+func (r *router) add(name string, config configs.VLLMConfig, provider *vlllm.Provider, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := &providerEntry{
+		name:      name,
+		config:    config,
+		local:     isLocal(config),
+		provider:  provider,
+		healthy:   err == nil && provider != nil,
+		checkedAt: time.Now(),
+	}
+	if err != nil {
+		entry.lastError = err.Error()
+	}
+	if _, exists := r.entries[name]; !exists {
+		r.names = append(r.names, name)
+		sort.Strings(r.names)
+	}
+	r.entries[name] = entry
+}
+
+func (r *router) has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.entries[name]
+	return ok
+}
+
+// candidates 按路由顺序返回可用的模型
+func (r *router) candidates(model string, imageSize int) []*providerEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	local := make(map[string]bool, len(r.entries))
+	for name, entry := range r.entries {
+		local[name] = entry.local
+	}
+	order := routeOrder(r.names, local, r.selected, r.policy, r.sizeRoutes, model, imageSize)
+
+	result := make([]*providerEntry, 0, len(order))
+	for _, name := range order {
+		if entry := r.entries[name]; entry.healthy && entry.provider != nil {
+			copied := *entry
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+// markUnhealthy 调用失败后标记为不可用，等待健康检查恢复
+func (r *router) markUnhealthy(name string, err error) (changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[name]
+	if !ok {
+		return false
+	}
+	changed = entry.healthy
+	entry.healthy = false
+	entry.lastError = err.Error()
+	entry.checkedAt = time.Now()
+	return changed
+}
+
+// markHealthy 健康检查通过，provider为nil时沿用已有实例
+func (r *router) markHealthy(name string, provider *vlllm.Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.entries[name]
+	if !ok {
+		return
+	}
+	if provider != nil {
+		entry.provider = provider
+	}
+	entry.healthy = entry.provider != nil
+	entry.lastError = ""
+	entry.checkedAt = time.Now()
+}
+
+// unhealthy 需要重新检查的模型
+func (r *router) unhealthy() []*providerEntry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []*providerEntry
+	for _, name := range r.names {
+		if entry := r.entries[name]; !entry.healthy {
+			copied := *entry
+			result = append(result, &copied)
+		}
+	}
+	return result
+}
+
+// status 所有模型的状态，按名称排序
+func (r *router) status() []ProviderStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]ProviderStatus, 0, len(r.names))
+	for _, name := range r.names {
+		entry := r.entries[name]
+		result = append(result, ProviderStatus{
+			Name:      name,
+			Type:      entry.config.Type,
+			Model:     entry.config.ModelName,
+			Local:     entry.local,
+			Healthy:   entry.healthy,
+			Error:     entry.lastError,
+			CheckedAt: entry.checkedAt,
+		})
+	}
+	return result
+}
+
+// providers 所有已创建的模型实例
+func (r *router) providers() map[string]*vlllm.Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]*vlllm.Provider, len(r.entries))
+	for name, entry := range r.entries {
+		if entry.provider != nil {
+			result[name] = entry.provider
+		}
+	}
+	return result
+}
+
+// routeOrder 候选顺序：请求指定的模型，其次按图片大小匹配的模型，其余按策略排列
+func routeOrder(names []string, local map[string]bool, selected, policy string, sizeRoutes []configs.VisionSizeRoute, model string, imageSize int) []string {
+	order := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	push := func(name string) {
+		if _, ok := local[name]; ok && !seen[name] {
+			seen[name] = true
+			order = append(order, name)
+		}
+	}
+
+	push(model)
+	for _, route := range sizeRoutes {
+		if imageSize <= route.MaxSize {
+			push(route.Provider)
+			break
+		}
+	}
+
+	rest := make([]string, 0, len(names))
+	if _, ok := local[selected]; ok {
+		rest = append(rest, selected)
+	}
+	for _, name := range names {
+		if name != selected {
+			rest = append(rest, name)
+		}
+	}
+	if policy == PolicyLocalFirst {
+		sort.SliceStable(rest, func(i, j int) bool { return local[rest[i]] && !local[rest[j]] })
+	}
+	for _, name := range rest {
+		push(name)
+	}
+	return order
+}
+
+// isLocal 未配置地址的ollama，或地址为本机、内网的模型视为本地模型
+func isLocal(config configs.VLLMConfig) bool {
+	if config.BaseURL == "" {
+		return strings.EqualFold(config.Type, "ollama")
+	}
+	u, err := url.Parse(config.BaseURL)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
@@ -0,0 +1,134 @@
+package vision
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/providers/vlllm"
+)
+
+func TestRouteOrder(t *testing.T) {
+	names := []string{"cloud_a", "cloud_b", "local_a"}
+	local := map[string]bool{"cloud_a": false, "cloud_b": false, "local_a": true}
+	sizeRoutes := []configs.VisionSizeRoute{
+		{MaxSize: 100, Provider: "local_a"},
+		{MaxSize: 1000, Provider: "cloud_b"},
+	}
+
+	tests := []struct {
+		name       string
+		selected   string
+		policy     string
+		sizeRoutes []configs.VisionSizeRoute
+		model      string
+		imageSize  int
+		want       []string
+	}{
+		{
+			name:     "选中模型优先其余按名称",
+			selected: "cloud_b",
+			policy:   PolicySelected,
+			want:     []string{"cloud_b", "cloud_a", "local_a"},
+		},
+		{
+			name:     "本地优先",
+			selected: "cloud_b",
+			policy:   PolicyLocalFirst,
+			want:     []string{"local_a", "cloud_b", "cloud_a"},
+		},
+		{
+			name:     "请求指定模型最先",
+			selected: "cloud_b",
+			policy:   PolicyLocalFirst,
+			model:    "cloud_a",
+			want:     []string{"cloud_a", "local_a", "cloud_b"},
+		},
+		{
+			name:       "按图片大小匹配第一条路由",
+			selected:   "cloud_a",
+			policy:     PolicySelected,
+			sizeRoutes: sizeRoutes,
+			imageSize:  500,
+			want:       []string{"cloud_b", "cloud_a", "local_a"},
+		},
+		{
+			name:       "小图走本地模型",
+			selected:   "cloud_a",
+			policy:     PolicySelected,
+			sizeRoutes: sizeRoutes,
+			imageSize:  50,
+			want:       []string{"local_a", "cloud_a", "cloud_b"},
+		},
+		{
+			name:     "未知模型忽略",
+			selected: "missing",
+			policy:   PolicySelected,
+			model:    "missing",
+			want:     []string{"cloud_a", "cloud_b", "local_a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := routeOrder(names, local, tt.selected, tt.policy, tt.sizeRoutes, tt.model, tt.imageSize)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("routeOrder() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterHealth(t *testing.T) {
+	r := newRouter(&configs.Config{SelectedModule: map[string]string{"VLLLM": "cloud"}})
+	r.add("cloud", configs.VLLMConfig{Type: "openai", BaseURL: "https://api.example.com/v1"}, &vlllm.Provider{}, nil)
+	r.add("local", configs.VLLMConfig{Type: "ollama"}, &vlllm.Provider{}, nil)
+
+	tests := []struct {
+		name string
+		run  func()
+		want []string
+	}{
+		{
+			name: "全部可用",
+			run:  func() {},
+			want: []string{"cloud", "local"},
+		},
+		{
+			name: "不可用时跳过",
+			run: func() {
+				if !r.markUnhealthy("cloud", errors.New("timeout")) {
+					t.Error("markUnhealthy() = false, 期望状态变化")
+				}
+			},
+			want: []string{"local"},
+		},
+		{
+			name: "重复标记不触发变化",
+			run: func() {
+				if r.markUnhealthy("cloud", errors.New("timeout")) {
+					t.Error("markUnhealthy() = true, 期望无变化")
+				}
+			},
+			want: []string{"local"},
+		},
+		{
+			name: "健康检查后恢复",
+			run:  func() { r.markHealthy("cloud", nil) },
+			want: []string{"cloud", "local"},
+		},
+	}
+	// 子测试依次修改同一个router
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run()
+			var got []string
+			for _, entry := range r.candidates("", 0) {
+				got = append(got, entry.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("candidates() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
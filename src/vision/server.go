@@ -11,10 +11,14 @@ import (
 	"time"
 
 	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core"
 	"xiaozhi-server-go/src/core/auth"
 	"xiaozhi-server-go/src/core/image"
+	"xiaozhi-server-go/src/core/pool"
 	"xiaozhi-server-go/src/core/providers"
+	"xiaozhi-server-go/src/core/providers/ocr"
 	"xiaozhi-server-go/src/core/providers/vlllm"
+	"xiaozhi-server-go/src/core/usage"
 	"xiaozhi-server-go/src/core/utils"
 
 	"github.com/gin-gonic/gin"
@@ -28,16 +32,16 @@ const (
 type DefaultVisionService struct {
 	logger    *utils.Logger
 	config    *configs.Config
-	vlllmMap  map[string]*vlllm.Provider // 支持多个VLLLM provider
-	authToken *auth.AuthToken            // 认证工具
+	router    *router         // 支持多个VLLLM provider
+	authToken *auth.AuthToken // 认证工具
 }
 
 // NewDefaultVisionService 构造函数
 func NewDefaultVisionService(config *configs.Config, logger *utils.Logger) (*DefaultVisionService, error) {
 	service := &DefaultVisionService{
-		logger:   logger,
-		config:   config,
-		vlllmMap: make(map[string]*vlllm.Provider),
+		logger: logger,
+		config: config,
+		router: newRouter(config),
 	}
 
 	service.authToken = auth.NewAuthToken(config.Server.Token)
@@ -50,50 +54,34 @@ func NewDefaultVisionService(config *configs.Config, logger *utils.Logger) (*Def
 	return service, nil
 }
 
-// initVLLMProviders 初始化VLLLM providers
+// initVLLMProviders 加载VLLLM下的所有配置，创建失败的标记为不可用，由健康检查重试
 func (s *DefaultVisionService) initVLLMProviders() error {
-	// 先看配置中的VLLLM provider
-	selected_vlllm := s.config.SelectedModule["VLLLM"]
-	if selected_vlllm == "" {
+	if len(s.config.VLLLM) == 0 {
 		s.logger.Warn("请设置好VLLLM provider配置")
 		return fmt.Errorf("请设置好VLLLM provider配置")
 	}
 
-	vlllmConfig := s.config.VLLLM[selected_vlllm]
-
-	// 创建VLLLM provider配置
-	providerConfig := &vlllm.Config{
-		Type:        vlllmConfig.Type,
-		ModelName:   vlllmConfig.ModelName,
-		BaseURL:     vlllmConfig.BaseURL,
-		APIKey:      vlllmConfig.APIKey,
-		Temperature: vlllmConfig.Temperature,
-		MaxTokens:   vlllmConfig.MaxTokens,
-		TopP:        vlllmConfig.TopP,
-		Security:    vlllmConfig.Security,
+	healthy := 0
+	for name, vlllmConfig := range s.config.VLLLM {
+		provider, err := vlllm.Create(vlllmConfig.Type, &vlllmConfig, s.logger)
+		if err != nil {
+			s.logger.Warn("VLLLM provider %s 不可用: %v", name, err)
+			s.router.add(name, vlllmConfig, nil, err)
+			continue
+		}
+		s.router.add(name, vlllmConfig, provider, nil)
+		healthy++
+		s.logger.Info("VLLLM provider %s 初始化成功", name)
 	}
 
-	// 创建provider实例
-	provider, err := vlllm.NewProvider(providerConfig, s.logger)
-	if err != nil {
-		s.logger.Warn(fmt.Sprintf("创建VLLLM provider 失败: %v", err))
-
+	for _, route := range s.config.VisionRouting.SizeRoutes {
+		if !s.router.has(route.Provider) {
+			s.logger.Warn("vision_routing.size_routes中的VLLLM %s 不存在", route.Provider)
+		}
 	}
-
-	// 初始化provider
-	if err := provider.Initialize(); err != nil {
-		s.logger.Warn(fmt.Sprintf("初始化VLLLM provider失败: %v", err))
-
+	if healthy == 0 {
+		s.logger.Warn("没有可用的VLLLM provider，等待健康检查恢复")
 	}
-
-	s.vlllmMap[selected_vlllm] = provider
-	s.logger.Info(fmt.Sprintf("VLLLM provider %s 初始化成功", selected_vlllm))
-
-	if len(s.vlllmMap) == 0 {
-		s.logger.Error("没有可用的VLLLM provider，请检查配置")
-		return fmt.Errorf("没有可用的VLLLM provider")
-	}
-
 	return nil
 }
 
@@ -104,6 +92,8 @@ func (s *DefaultVisionService) Start(ctx context.Context, engine *gin.Engine, ap
 	apiGroup.POST("/vision", s.handlePost)
 	apiGroup.OPTIONS("/vision", s.handleOptions)
 
+	go s.retryUnhealthy(ctx)
+
 	s.logger.Info("Vision HTTP服务路由注册完成")
 	return nil
 }
@@ -115,20 +105,32 @@ func (s *DefaultVisionService) handleOptions(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-// handleGet 处理GET请求（状态检查）
+// handleGet 处理GET请求（状态检查），返回每个模型的健康状态
 func (s *DefaultVisionService) handleGet(c *gin.Context) {
 	s.logger.Info("收到Vision状态检查请求 get")
 	s.addCORSHeaders(c)
 
+	providers := s.router.status()
+	healthy := 0
+	for _, provider := range providers {
+		if provider.Healthy {
+			healthy++
+		}
+	}
+
 	// 检查Vision服务状态
 	var message string
-	if len(s.vlllmMap) > 0 {
-		message = fmt.Sprintf("MCP Vision 接口运行正常，共有 %d 个可用的视觉分析模型", len(s.vlllmMap))
+	if healthy > 0 {
+		message = fmt.Sprintf("MCP Vision 接口运行正常，共有 %d 个可用的视觉分析模型", healthy)
 	} else {
 		message = "MCP Vision 接口运行不正常，没有可用的VLLLM provider"
 	}
 
-	c.String(http.StatusOK, message)
+	c.JSON(http.StatusOK, VisionStatusResponse{
+		Message:   message,
+		Policy:    s.router.policy,
+		Providers: providers,
+	})
 }
 
 // handlePost 处理POST请求（图片分析）
@@ -147,7 +149,7 @@ func (s *DefaultVisionService) handlePost(c *gin.Context) {
 
 	if !authResult.IsValid {
 		s.respondError(c, http.StatusUnauthorized, "无效的认证token或设备ID不匹配")
-		s.logger.Warn(fmt.Sprintf("Vision认证失败: %s", authResult.DeviceID))
+		s.logger.Warn("Vision认证失败: %s", authResult.DeviceID)
 		return
 	}
 
@@ -155,38 +157,32 @@ func (s *DefaultVisionService) handlePost(c *gin.Context) {
 	req, err := s.parseMultipartRequest(c, deviceID)
 	if err != nil {
 		s.respondError(c, http.StatusBadRequest, err.Error())
-		s.logger.Warn(fmt.Sprintf("Vision请求解析失败: %v", err))
+		s.logger.Warn("Vision请求解析失败: %v", err)
 		return
 	}
 
-	s.logger.Debug("收到Vision分析请求 %v", map[string]interface{}{
-		"device_id":  req.DeviceID,
-		"client_id":  req.ClientID,
-		"question":   req.Question,
-		"image_size": len(req.Image),
-		"image_path": req.ImagePath,
-	})
+	s.logger.DebugKV("收到Vision分析请求",
+		"device_id", req.DeviceID,
+		"client_id", req.ClientID,
+		"question", req.Question,
+		"image_size", len(req.Image),
+		"image_path", req.ImagePath,
+	)
 
 	// 处理图片分析
-	result, err := s.processVisionRequest(req)
-
-	// 返回成功响应
-	response := VisionResponse{
-		Success: true,
-		Result:  result,
-	}
-
+	result, model, err := s.processVisionRequest(req)
 	if err != nil {
 		s.respondError(c, http.StatusInternalServerError, err.Error())
-		s.logger.Warn(fmt.Sprintf("Vision请求处理失败: %v", err))
-		// 返回成功响应
-		response.Success = false
-		response.Message = err.Error()
-		response.Result = "" // 清空结果
+		s.logger.Warn("Vision请求处理失败: %v", err)
+		return
 	}
 
-	s.logger.Info("Vision分析结果%t: %s", response.Success, response.Result)
-	c.JSON(http.StatusOK, response)
+	s.logger.Info("Vision分析结果(%s): %s", model, result)
+	c.JSON(http.StatusOK, VisionResponse{
+		Success: true,
+		Result:  result,
+		Model:   model,
+	})
 }
 
 // verifyAuth 验证认证token
@@ -200,19 +196,19 @@ func (s *DefaultVisionService) verifyAuth(c *gin.Context) (*AuthVerifyResult, er
 	token := authHeader[7:] // 移除"Bearer "前缀
 
 	// 打印认证token
-	s.logger.Debug(fmt.Sprintf("收到认证token: %s", token))
+	s.logger.Debug("收到认证token: %s", token)
 
 	// 验证token（注意VerifyToken返回3个值）
 	isValid, deviceID, err := s.authToken.VerifyToken(token)
 	if err != nil || !isValid {
-		s.logger.Warn(fmt.Sprintf("认证token验证失败: %v", err))
+		s.logger.Warn("认证token验证失败: %v", err)
 		return nil, fmt.Errorf("无效的认证token或token已过期")
 	}
 
 	// 检查设备ID匹配
 	requestDeviceID := c.GetHeader("Device-Id")
 	if requestDeviceID != deviceID {
-		s.logger.Warn(fmt.Sprintf("设备ID与token不匹配: 请求设备ID=%s, token设备ID=%s", requestDeviceID, deviceID))
+		s.logger.Warn("设备ID与token不匹配: 请求设备ID=%s, token设备ID=%s", requestDeviceID, deviceID)
 		return nil, fmt.Errorf("设备ID与token不匹配")
 	}
 
@@ -235,13 +231,13 @@ func (s *DefaultVisionService) parseMultipartRequest(c *gin.Context, deviceID st
 	if c.Request.MultipartForm != nil {
 		// 打印所有文本字段
 		for key, values := range c.Request.MultipartForm.Value {
-			s.logger.Info(fmt.Sprintf("文本字段 %s: %v", key, values))
+			s.logger.Info("文本字段 %s: %v", key, values)
 		}
 		// 打印所有文件字段
 		for key, files := range c.Request.MultipartForm.File {
-			s.logger.Info(fmt.Sprintf("文件字段 %s: 共%d个文件", key, len(files)))
+			s.logger.Info("文件字段 %s: 共%d个文件", key, len(files))
 			for i, file := range files {
-				s.logger.Info(fmt.Sprintf("  文件%d: %s (大小: %d bytes)", i+1, file.Filename, file.Size))
+				s.logger.Info("  文件%d: %s (大小: %d bytes)", i+1, file.Filename, file.Size)
 			}
 		}
 	}
@@ -252,6 +248,15 @@ func (s *DefaultVisionService) parseMultipartRequest(c *gin.Context, deviceID st
 		return nil, fmt.Errorf("缺少问题字段")
 	}
 
+	// 可选的mode字段：auto、document、general
+	mode := c.Request.FormValue("mode")
+
+	// 可选的model字段指定VLLLM配置名
+	model := c.Request.FormValue("model")
+	if model != "" && !s.router.has(model) {
+		return nil, fmt.Errorf("未知的视觉分析模型: %s", model)
+	}
+
 	// 获取图片文件
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
@@ -287,6 +292,8 @@ func (s *DefaultVisionService) parseMultipartRequest(c *gin.Context, deviceID st
 
 	return &VisionRequest{
 		Question:  question,
+		Model:     model,
+		Mode:      mode,
 		Image:     imageData,
 		DeviceID:  deviceID,
 		ClientID:  c.GetHeader("Client-Id"),
@@ -310,18 +317,12 @@ func (s *DefaultVisionService) saveImageToFile(imageData []byte, deviceID string
 		return "", fmt.Errorf("保存图片文件失败: %v", err)
 	}
 
-	s.logger.Info(fmt.Sprintf("图片已保存到: %s", filepath))
+	s.logger.Info("图片已保存到: %s", filepath)
 	return filepath, nil
 }
 
-// processVisionRequest 处理视觉分析请求
-func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string, error) {
-	// 选择VLLLM provider
-	provider := s.selectProvider("")
-	if provider == nil {
-		return "", fmt.Errorf("没有可用的视觉分析模型")
-	}
-
+// processVisionRequest 按路由顺序调用VLLLM，失败的模型标记为不可用并换下一个，返回结果和使用的模型
+func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string, string, error) {
 	// 将图片转换为base64
 	imageBase64 := base64.StdEncoding.EncodeToString(req.Image)
 
@@ -331,11 +332,78 @@ func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string,
 		Format: s.detectImageFormat(req.Image),
 	}
 	s.logger.Debug("处理图片数据: %s, 格式: %s", req.ClientID, imageData.Format)
-	// 调用VLLLM provider
-	messages := []providers.Message{} // 空的历史消息
-	responseChan, err := provider.ResponseWithImage(context.Background(), "", messages, imageData, req.Question)
+
+	// 文档模式返回识别出的文字和原来的问题，由设备会话中的LLM朗读、翻译或讲解
+	if result, model, ok := s.recognizeDocument(req, imageData); ok {
+		s.addToConversation(req, imageData, result)
+		return result, model, nil
+	}
+
+	candidates := s.router.candidates(req.Model, len(req.Image))
+	if len(candidates) == 0 {
+		return "", "", fmt.Errorf("没有可用的视觉分析模型")
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		ref, err := candidate.provider.ProcessImage(context.Background(), imageData)
+		if err != nil {
+			// 图片超出该模型的安全限制，不影响模型的健康状态
+			lastErr = err
+			continue
+		}
+		result, err := s.analyze(candidate.provider, ref, req.Question)
+		if err != nil {
+			lastErr = err
+			if s.router.markUnhealthy(candidate.name, err) {
+				s.logger.Warn("VLLLM provider %s 调用失败，标记为不可用: %v", candidate.name, err)
+			}
+			continue
+		}
+		s.logger.Info("VLLLM(%s)分析结果: %s", candidate.name, result)
+		s.addToConversation(req, imageData, result)
+		return result, candidate.name, nil
+	}
+	return "", "", fmt.Errorf("调用VLLLM失败: %v", lastErr)
+}
+
+// recognizeDocument 配置了OCR且判断为文档模式时识别文字，识别失败时返回false改用VLLLM
+func (s *DefaultVisionService) recognizeDocument(req *VisionRequest, imageData image.ImageData) (string, string, bool) {
+	recognizer := ocr.Default()
+	if recognizer == nil || req.Model != "" {
+		return "", "", false
+	}
+	if recognizer.DetectMode(req.Mode, req.Question, imageData) != image.ModeDocument {
+		return "", "", false
+	}
+	text, err := recognizer.Recognize(context.Background(), imageData)
 	if err != nil {
-		return "", fmt.Errorf("调用VLLLM失败: %v", err)
+		s.logger.Warn("OCR %s 识别失败，改用VLLLM: %v", recognizer.Name(), err)
+		return "", "", false
+	}
+	usage.Default().Record(req.DeviceID, usage.MetricVisionCalls, 1)
+	s.logger.Info("OCR(%s)识别结果: %s", recognizer.Name(), text)
+	return ocr.DocumentPrompt(req.Question, text), "ocr:" + recognizer.Name(), true
+}
+
+// addToConversation 设备在线时把图片和结果加入它当前的对话，后续可以接着追问
+func (s *DefaultVisionService) addToConversation(req *VisionRequest, imageData image.ImageData, result string) {
+	if req.DeviceID == "" {
+		return
+	}
+	if conn, ok := core.GetConnection(req.DeviceID); ok {
+		if err := conn.AddVisionResult(context.Background(), req.Question, imageData, result); err != nil {
+			s.logger.Warn("识图结果加入设备%s的对话失败: %v", req.DeviceID, err)
+		}
+	}
+}
+
+// analyze 调用一个VLLLM并收集完整回复，不带历史消息
+func (s *DefaultVisionService) analyze(provider *vlllm.Provider, ref providers.ImageRef, question string) (string, error) {
+	messages := []providers.Message{{Role: "user", Content: question, Images: []providers.ImageRef{ref}}}
+	responseChan, err := provider.ResponseWithHistory(context.Background(), "", messages)
+	if err != nil {
+		return "", err
 	}
 
 	// 收集所有响应内容
@@ -343,26 +411,61 @@ func (s *DefaultVisionService) processVisionRequest(req *VisionRequest) (string,
 	for content := range responseChan {
 		result.WriteString(content)
 	}
-	s.logger.Info(fmt.Sprintf("VLLLM分析结果: %s", result.String()))
-
+	if vlllm.IsErrorResponse(result.String()) {
+		return "", fmt.Errorf("%s", strings.Trim(strings.TrimSpace(result.String()), "【】"))
+	}
+	if result.Len() == 0 {
+		return "", fmt.Errorf("VLLLM返回为空")
+	}
 	return result.String(), nil
 }
 
-// selectProvider 选择VLLLM provider
-func (s *DefaultVisionService) selectProvider(modelName string) *vlllm.Provider {
-	// 如果指定了模型名，尝试找到对应的provider
-	if modelName != "" {
-		if provider, exists := s.vlllmMap[modelName]; exists {
-			return provider
+// retryUnhealthy 定期用连通性检查重试不可用的模型，通过后恢复路由
+func (s *DefaultVisionService) retryUnhealthy(ctx context.Context) {
+	interval := defaultRetryInterval
+	if d, err := time.ParseDuration(s.config.VisionRouting.RetryInterval); err == nil && d > 0 {
+		interval = d
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkUnhealthy(ctx)
 		}
 	}
+}
 
-	// 否则返回第一个可用的provider
-	for _, provider := range s.vlllmMap {
-		return provider
+func (s *DefaultVisionService) checkUnhealthy(ctx context.Context) {
+	entries := s.router.unhealthy()
+	if len(entries) == 0 {
+		return
+	}
+	connConfig, err := pool.ConfigFromYAML(&s.config.ConnectivityCheck)
+	if err != nil {
+		connConfig = pool.DefaultConnectivityConfig()
 	}
+	checker := pool.NewHealthChecker(s.config, connConfig, s.logger)
 
-	return nil
+	for _, entry := range entries {
+		if err := checker.CheckVLLLM(ctx, entry.name, pool.FunctionalCheck); err != nil {
+			s.router.markUnhealthy(entry.name, err)
+			continue
+		}
+		// 创建失败的模型需要重新创建实例
+		var provider *vlllm.Provider
+		if entry.provider == nil {
+			provider, err = vlllm.Create(entry.config.Type, &entry.config, s.logger)
+			if err != nil {
+				s.router.markUnhealthy(entry.name, err)
+				continue
+			}
+		}
+		s.router.markHealthy(entry.name, provider)
+		s.logger.Info("VLLLM provider %s 已恢复", entry.name)
+	}
 }
 
 // isValidImageFile 检查是否为有效的图片文件
@@ -449,9 +552,9 @@ func (s *DefaultVisionService) respondError(c *gin.Context, statusCode int, mess
 
 // Cleanup 清理资源
 func (s *DefaultVisionService) Cleanup() error {
-	for name, provider := range s.vlllmMap {
+	for name, provider := range s.router.providers() {
 		if err := provider.Cleanup(); err != nil {
-			s.logger.Warn(fmt.Sprintf("清理VLLLM provider %s 失败: %v", name, err))
+			s.logger.Warn("清理VLLLM provider %s 失败: %v", name, err)
 		}
 	}
 	s.logger.Info("Vision服务清理完成")
@@ -3,6 +3,8 @@ package vision
 // VisionRequest Vision分析请求结构（从multipart表单解析）
 type VisionRequest struct {
 	Question  string // 问题文本（从表单字段获取）
+	Model     string // 指定的VLLLM配置名（可选）
+	Mode      string // 识别模式：auto、document、general（可选）
 	Image     []byte // 图片数据（从文件字段获取）
 	DeviceID  string // 设备ID（从请求头获取）
 	ClientID  string // 客户端ID（从请求头获取）
@@ -14,11 +16,14 @@ type VisionResponse struct {
 	Success bool   `json:"success"`           // 是否成功
 	Result  string `json:"result,omitempty"`  // 分析结果（成功时）
 	Message string `json:"message,omitempty"` // 错误信息（失败时）
+	Model   string `json:"model,omitempty"`   // 实际使用的VLLLM配置名
 }
 
 // VisionStatusResponse Vision状态响应结构
 type VisionStatusResponse struct {
-	Message string // 状态信息（纯文本）
+	Message   string           `json:"message"`   // 状态信息
+	Policy    string           `json:"policy"`    // 路由策略
+	Providers []ProviderStatus `json:"providers"` // 每个模型的健康状态
 }
 
 // AuthVerifyResult 认证验证结果
@@ -0,0 +1,101 @@
+package webconsole
+
+import (
+	"context"
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"xiaozhi-server-go/src/configs"
+	"xiaozhi-server-go/src/core/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// ConsoleConfig 控制台需要的传输层信息
+type ConsoleConfig struct {
+	WebSocketPort int                       `json:"websocket_port" example:"8000"`
+	WebRTCEnabled bool                      `json:"webrtc_enabled"`
+	WebRTCPort    int                       `json:"webrtc_port"    example:"8002"`
+	ICEServers    []configs.ICEServerConfig `json:"ice_servers"`
+}
+
+// DefaultConsoleService 内置的浏览器测试控制台，同时提供web.static_dir中的静态文件
+type DefaultConsoleService struct {
+	config *configs.Config
+	logger *utils.Logger
+}
+
+// NewDefaultConsoleService 构造函数
+func NewDefaultConsoleService(config *configs.Config, logger *utils.Logger) *DefaultConsoleService {
+	return &DefaultConsoleService{
+		config: config,
+		logger: logger,
+	}
+}
+
+// Start 注册控制台路由，/console为内置控制台，其他未匹配的路径从static_dir查找
+func (s *DefaultConsoleService) Start(ctx context.Context, engine *gin.Engine, apiGroup *gin.RouterGroup) error {
+	if !s.config.Web.Enabled {
+		s.logger.Info("Web界面未启用，跳过测试控制台")
+		return nil
+	}
+
+	files, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return err
+	}
+	engine.StaticFS("/console", http.FS(files))
+	apiGroup.GET("/console/config", s.handleConfig)
+
+	if dir := s.config.Web.StaticDir; dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			s.logger.Warn("web.static_dir %s 不是有效目录，跳过", dir)
+		} else {
+			engine.NoRoute(s.serveStatic(dir))
+			s.logger.Info("静态文件目录: %s", dir)
+		}
+	}
+
+	s.logger.Info("测试控制台路由注册完成: /console/")
+	return nil
+}
+
+// @Summary 控制台配置
+// @Description 返回控制台连接WebSocket和WebRTC所需的端口与ICE服务器
+// @Tags Console
+// @Produce json
+// @Success 200 {object} ConsoleConfig
+// @Router /console/config [get]
+func (s *DefaultConsoleService) handleConfig(c *gin.Context) {
+	transport := &s.config.Transport
+	c.JSON(http.StatusOK, ConsoleConfig{
+		WebSocketPort: transport.WebSocket.Port,
+		WebRTCEnabled: transport.WebRTC.Enabled,
+		WebRTCPort:    transport.WebRTC.Port,
+		ICEServers:    transport.WebRTC.ICEServers,
+	})
+}
+
+// serveStatic 从目录提供静态文件，目录请求返回其中的index.html
+func (s *DefaultConsoleService) serveStatic(dir string) gin.HandlerFunc {
+	fileServer := http.FileServer(http.Dir(dir))
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		name := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(c.Request.URL.Path, "/")))
+		if _, err := os.Stat(name); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		fileServer.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,533 @@
+// 小智测试控制台：通过WebSocket或WebRTC使用小智hello/listen/abort协议
+(function () {
+  'use strict';
+
+  const INPUT_SAMPLE_RATE = 16000;
+  const OUTPUT_SAMPLE_RATE = 24000;
+  const FRAME_DURATION = 60;
+  const FRAME_SIZE = INPUT_SAMPLE_RATE * FRAME_DURATION / 1000;
+
+  const $ = (id) => document.getElementById(id);
+  const settingIds = ['transport', 'wsUrl', 'rtcUrl', 'deviceId', 'clientId', 'token', 'listenMode'];
+
+  const state = {
+    transport: null, // websocket或webrtc的发送封装
+    connected: false,
+    listening: false,
+    useOpus: false,
+    sessionId: '',
+    // WebSocket模式下的音频
+    micContext: null,
+    micStream: null,
+    micNode: null,
+    encoder: null,
+    decoder: null,
+    playContext: null,
+    playTime: 0,
+    playSources: [],
+    // WebRTC模式下的麦克风轨道
+    rtcTrack: null,
+    partialEl: null,
+  };
+
+  // ---------- 界面 ----------
+
+  function logEvent(kind, text) {
+    const el = document.createElement('div');
+    el.className = 'event ' + kind;
+    const time = document.createElement('span');
+    time.className = 'time';
+    time.textContent = new Date().toLocaleTimeString();
+    el.appendChild(time);
+    el.appendChild(document.createTextNode(text));
+    $('events').appendChild(el);
+    $('events').scrollTop = $('events').scrollHeight;
+  }
+
+  function addMessage(role, text, partial) {
+    // 中间结果和随后的最终结果显示在同一条消息里
+    let el = state.partialEl && state.partialEl.classList.contains(role) ? state.partialEl : null;
+    if (!el) {
+      el = document.createElement('div');
+      $('messages').appendChild(el);
+    }
+    el.className = 'message ' + role + (partial ? ' partial' : '');
+    el.textContent = text;
+    state.partialEl = partial ? el : null;
+    $('messages').scrollTop = $('messages').scrollHeight;
+  }
+
+  function setStatus(text, cls) {
+    $('status').textContent = text;
+    $('status').className = 'status ' + cls;
+  }
+
+  function setConnected(connected) {
+    state.connected = connected;
+    $('connectBtn').disabled = connected;
+    $('disconnectBtn').disabled = !connected;
+    ['listenBtn', 'abortBtn', 'textInput', 'sendBtn'].forEach((id) => { $(id).disabled = !connected; });
+    settingIds.forEach((id) => { $(id).disabled = connected; });
+    setStatus(connected ? '已连接' : '未连接', connected ? 'online' : 'offline');
+    if (!connected) {
+      setListening(false);
+    }
+  }
+
+  function setListening(listening) {
+    state.listening = listening;
+    const manual = $('listenMode').value === 'manual';
+    $('listenBtn').textContent = listening ? (manual ? '松开结束' : '停止说话') : (manual ? '按住说话' : '开始说话');
+    $('listenBtn').classList.toggle('active', listening);
+    if (state.connected) {
+      setStatus(listening ? '正在聆听' : '已连接', listening ? 'listening' : 'online');
+    }
+    if (state.rtcTrack) {
+      state.rtcTrack.enabled = listening;
+    }
+  }
+
+  function loadSettings() {
+    const saved = JSON.parse(localStorage.getItem('xiaozhi-console') || '{}');
+    const host = location.hostname || 'localhost';
+    const defaults = {
+      transport: 'websocket',
+      wsUrl: 'ws://' + host + ':8000/',
+      rtcUrl: 'http://' + host + ':8002/offer',
+      deviceId: randomMac(),
+      clientId: crypto.randomUUID ? crypto.randomUUID() : String(Date.now()),
+      token: '',
+      listenMode: 'auto',
+    };
+    settingIds.forEach((id) => { $(id).value = saved[id] || defaults[id]; });
+    return fetch('/api/console/config').then((res) => res.ok ? res.json() : null).then((cfg) => {
+      if (!cfg) {
+        return;
+      }
+      state.iceServers = cfg.ice_servers || [];
+      if (!saved.wsUrl && cfg.websocket_port) {
+        $('wsUrl').value = 'ws://' + host + ':' + cfg.websocket_port + '/';
+      }
+      if (!saved.rtcUrl && cfg.webrtc_port) {
+        $('rtcUrl').value = 'http://' + host + ':' + cfg.webrtc_port + '/offer';
+      }
+      const rtcOption = $('transport').querySelector('option[value="webrtc"]');
+      rtcOption.disabled = !cfg.webrtc_enabled;
+      if (!cfg.webrtc_enabled && $('transport').value === 'webrtc') {
+        $('transport').value = 'websocket';
+      }
+    }).catch(() => {});
+  }
+
+  function saveSettings() {
+    const values = {};
+    settingIds.forEach((id) => { values[id] = $(id).value; });
+    localStorage.setItem('xiaozhi-console', JSON.stringify(values));
+  }
+
+  function randomMac() {
+    const bytes = [];
+    for (let i = 0; i < 6; i++) {
+      bytes.push(Math.floor(Math.random() * 256).toString(16).padStart(2, '0'));
+    }
+    return bytes.join(':');
+  }
+
+  function identityQuery() {
+    const params = new URLSearchParams({ 'device-id': $('deviceId').value, 'client-id': $('clientId').value });
+    if ($('token').value) {
+      params.set('token', $('token').value);
+    }
+    return params.toString();
+  }
+
+  // ---------- 协议 ----------
+
+  function sendJSON(msg) {
+    if (!state.transport) {
+      return;
+    }
+    logEvent('out', '→ ' + JSON.stringify(msg));
+    state.transport.sendText(JSON.stringify(msg));
+  }
+
+  function sendHello(transport) {
+    const format = state.useOpus ? 'opus' : 'pcm';
+    sendJSON({
+      type: 'hello',
+      version: 1,
+      transport: transport,
+      audio_params: {
+        format: format,
+        sample_rate: INPUT_SAMPLE_RATE,
+        channels: 1,
+        frame_duration: FRAME_DURATION,
+        output_format: format,
+        output_sample_rate: OUTPUT_SAMPLE_RATE,
+        output_frame_duration: FRAME_DURATION,
+      },
+    });
+  }
+
+  function handleText(text) {
+    let msg;
+    try {
+      msg = JSON.parse(text);
+    } catch (e) {
+      logEvent('error', '← ' + text);
+      return;
+    }
+    const kind = ['stt', 'llm', 'tts'].includes(msg.type) ? msg.type : 'in';
+    logEvent(kind, '← ' + text);
+
+    switch (msg.type) {
+      case 'hello':
+        state.sessionId = msg.session_id || '';
+        break;
+      case 'stt':
+        if (msg.text) {
+          addMessage('user', msg.text, !!msg.interim);
+        }
+        break;
+      case 'tts':
+        if (msg.state === 'sentence_start' && msg.text) {
+          addMessage('assistant', msg.text, false);
+        } else if (msg.state === 'stop' && $('listenMode').value !== 'manual' && state.listening) {
+          // 自动模式下播报结束后继续聆听
+          sendJSON({ type: 'listen', state: 'start', mode: $('listenMode').value });
+        }
+        break;
+      case 'mcp':
+        // 控制台没有设备端工具，回复空工具列表，避免服务端等待
+        replyMCP(msg.payload);
+        break;
+    }
+  }
+
+  function replyMCP(payload) {
+    if (!payload || payload.id === undefined) {
+      return;
+    }
+    let result = {};
+    if (payload.method === 'initialize') {
+      result = { protocolVersion: '2024-11-05', capabilities: { tools: {} }, serverInfo: { name: 'xiaozhi-web-console', version: '1.0.0' } };
+    } else if (payload.method === 'tools/list') {
+      result = { tools: [] };
+    }
+    sendJSON({ type: 'mcp', payload: { jsonrpc: '2.0', id: payload.id, result: result } });
+  }
+
+  // ---------- WebSocket ----------
+
+  async function connectWebSocket() {
+    state.useOpus = await opusSupported();
+    $('codecInfo').textContent = state.useOpus ? '音频编码: Opus (WebCodecs)' : '浏览器不支持WebCodecs Opus，使用PCM';
+
+    const url = $('wsUrl').value + ($('wsUrl').value.includes('?') ? '&' : '?') + identityQuery();
+    const ws = new WebSocket(url);
+    ws.binaryType = 'arraybuffer';
+    state.transport = {
+      sendText: (text) => ws.readyState === WebSocket.OPEN && ws.send(text),
+      sendAudio: (data) => ws.readyState === WebSocket.OPEN && ws.send(data),
+      close: () => ws.close(),
+    };
+    ws.onopen = () => {
+      logEvent('in', 'WebSocket已连接');
+      setConnected(true);
+      setupPlayback();
+      sendHello('websocket');
+    };
+    ws.onmessage = (event) => {
+      if (typeof event.data === 'string') {
+        handleText(event.data);
+      } else {
+        playAudio(new Uint8Array(event.data));
+      }
+    };
+    ws.onerror = () => logEvent('error', 'WebSocket错误');
+    ws.onclose = () => {
+      logEvent('in', 'WebSocket已断开');
+      cleanup();
+    };
+  }
+
+  async function opusSupported() {
+    if (!window.AudioEncoder || !window.AudioDecoder) {
+      return false;
+    }
+    try {
+      const enc = await AudioEncoder.isConfigSupported({ codec: 'opus', sampleRate: INPUT_SAMPLE_RATE, numberOfChannels: 1 });
+      const dec = await AudioDecoder.isConfigSupported({ codec: 'opus', sampleRate: OUTPUT_SAMPLE_RATE, numberOfChannels: 1 });
+      return enc.supported && dec.supported;
+    } catch (e) {
+      return false;
+    }
+  }
+
+  async function startMicrophone() {
+    if (state.micNode) {
+      return;
+    }
+    state.micStream = await navigator.mediaDevices.getUserMedia({
+      audio: { channelCount: 1, echoCancellation: true, noiseSuppression: true, autoGainControl: true },
+    });
+    state.micContext = new AudioContext({ sampleRate: INPUT_SAMPLE_RATE });
+    await state.micContext.audioWorklet.addModule('recorder-worklet.js');
+    const source = state.micContext.createMediaStreamSource(state.micStream);
+    state.micNode = new AudioWorkletNode(state.micContext, 'recorder-processor', { processorOptions: { frameSize: FRAME_SIZE } });
+    source.connect(state.micNode);
+
+    if (state.useOpus) {
+      state.encoder = new AudioEncoder({
+        output: (chunk) => {
+          const data = new Uint8Array(chunk.byteLength);
+          chunk.copyTo(data);
+          state.transport && state.transport.sendAudio(data);
+        },
+        error: (e) => logEvent('error', 'Opus编码失败: ' + e.message),
+      });
+      state.encoder.configure({ codec: 'opus', sampleRate: INPUT_SAMPLE_RATE, numberOfChannels: 1, opus: { frameDuration: FRAME_DURATION * 1000 } });
+    }
+
+    let timestamp = 0;
+    state.micNode.port.onmessage = (event) => {
+      if (!state.listening || !state.transport) {
+        return;
+      }
+      const samples = event.data;
+      if (state.encoder) {
+        state.encoder.encode(new AudioData({
+          format: 'f32', sampleRate: INPUT_SAMPLE_RATE, numberOfFrames: samples.length, numberOfChannels: 1, timestamp: timestamp, data: samples,
+        }));
+        timestamp += FRAME_DURATION * 1000;
+      } else {
+        state.transport.sendAudio(floatToInt16(samples).buffer);
+      }
+    };
+  }
+
+  function setupPlayback() {
+    state.playContext = new AudioContext();
+    state.playTime = 0;
+    if (state.useOpus) {
+      state.decoder = new AudioDecoder({
+        output: (audioData) => {
+          const samples = new Float32Array(audioData.numberOfFrames);
+          audioData.copyTo(samples, { planeIndex: 0, format: 'f32-planar' });
+          schedule(samples, audioData.sampleRate);
+          audioData.close();
+        },
+        error: (e) => logEvent('error', 'Opus解码失败: ' + e.message),
+      });
+      state.decoder.configure({ codec: 'opus', sampleRate: OUTPUT_SAMPLE_RATE, numberOfChannels: 1 });
+    }
+  }
+
+  let decodeTimestamp = 0;
+  function playAudio(data) {
+    if (state.decoder) {
+      state.decoder.decode(new EncodedAudioChunk({ type: 'key', timestamp: decodeTimestamp, data: data }));
+      decodeTimestamp += FRAME_DURATION * 1000;
+    } else {
+      const pcm = new Int16Array(data.buffer, data.byteOffset, data.byteLength >> 1);
+      const samples = new Float32Array(pcm.length);
+      for (let i = 0; i < pcm.length; i++) {
+        samples[i] = pcm[i] / 32768;
+      }
+      schedule(samples, OUTPUT_SAMPLE_RATE);
+    }
+  }
+
+  function schedule(samples, sampleRate) {
+    const ctx = state.playContext;
+    if (!ctx || samples.length === 0) {
+      return;
+    }
+    const buffer = ctx.createBuffer(1, samples.length, sampleRate);
+    buffer.copyToChannel(samples, 0);
+    const source = ctx.createBufferSource();
+    source.buffer = buffer;
+    source.connect(ctx.destination);
+    state.playTime = Math.max(state.playTime, ctx.currentTime + 0.05);
+    source.start(state.playTime);
+    state.playTime += buffer.duration;
+    state.playSources.push(source);
+    source.onended = () => { state.playSources = state.playSources.filter((s) => s !== source); };
+  }
+
+  function stopPlayback() {
+    state.playSources.forEach((source) => { try { source.stop(); } catch (e) { /* 已结束 */ } });
+    state.playSources = [];
+    state.playTime = 0;
+  }
+
+  function floatToInt16(samples) {
+    const out = new Int16Array(samples.length);
+    for (let i = 0; i < samples.length; i++) {
+      const s = Math.max(-1, Math.min(1, samples[i]));
+      out[i] = s < 0 ? s * 0x8000 : s * 0x7fff;
+    }
+    return out;
+  }
+
+  // ---------- WebRTC ----------
+
+  async function connectWebRTC() {
+    state.useOpus = true;
+    $('codecInfo').textContent = '音频: WebRTC Opus，浏览器负责回声消除';
+
+    const pc = new RTCPeerConnection({ iceServers: state.iceServers || [] });
+    const stream = await navigator.mediaDevices.getUserMedia({
+      audio: { channelCount: 1, echoCancellation: true, noiseSuppression: true, autoGainControl: true },
+    });
+    state.micStream = stream;
+    state.rtcTrack = stream.getAudioTracks()[0];
+    state.rtcTrack.enabled = false;
+    pc.addTrack(state.rtcTrack, stream);
+    pc.ontrack = (event) => { $('remoteAudio').srcObject = event.streams[0] || new MediaStream([event.track]); };
+
+    const dc = pc.createDataChannel('xiaozhi');
+    state.transport = {
+      sendText: (text) => dc.readyState === 'open' && dc.send(text),
+      sendAudio: () => {},
+      close: () => pc.close(),
+    };
+    dc.onopen = () => {
+      logEvent('in', 'WebRTC已连接');
+      setConnected(true);
+      sendHello('webrtc');
+    };
+    dc.onmessage = (event) => { if (typeof event.data === 'string') { handleText(event.data); } };
+    dc.onclose = () => {
+      logEvent('in', 'WebRTC已断开');
+      cleanup();
+    };
+    pc.onconnectionstatechange = () => {
+      logEvent('in', 'WebRTC连接状态: ' + pc.connectionState);
+      if (pc.connectionState === 'failed') {
+        cleanup();
+      }
+    };
+
+    await pc.setLocalDescription(await pc.createOffer());
+    await waitIceGathering(pc);
+    const url = $('rtcUrl').value + ($('rtcUrl').value.includes('?') ? '&' : '?') + identityQuery();
+    const res = await fetch(url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(pc.localDescription),
+    });
+    if (!res.ok) {
+      throw new Error('信令失败: ' + res.status + ' ' + await res.text());
+    }
+    await pc.setRemoteDescription(await res.json());
+  }
+
+  function waitIceGathering(pc) {
+    if (pc.iceGatheringState === 'complete') {
+      return Promise.resolve();
+    }
+    return new Promise((resolve) => {
+      const timer = setTimeout(resolve, 3000);
+      pc.addEventListener('icegatheringstatechange', () => {
+        if (pc.iceGatheringState === 'complete') {
+          clearTimeout(timer);
+          resolve();
+        }
+      });
+    });
+  }
+
+  // ---------- 操作 ----------
+
+  function cleanup() {
+    if (state.transport) {
+      const transport = state.transport;
+      state.transport = null;
+      transport.close();
+    }
+    stopPlayback();
+    if (state.encoder && state.encoder.state !== 'closed') { state.encoder.close(); }
+    if (state.decoder && state.decoder.state !== 'closed') { state.decoder.close(); }
+    if (state.micStream) { state.micStream.getTracks().forEach((t) => t.stop()); }
+    if (state.micContext) { state.micContext.close(); }
+    if (state.playContext) { state.playContext.close(); }
+    Object.assign(state, { encoder: null, decoder: null, micStream: null, micContext: null, micNode: null, playContext: null, rtcTrack: null });
+    setConnected(false);
+  }
+
+  async function connect() {
+    saveSettings();
+    try {
+      if ($('transport').value === 'webrtc') {
+        await connectWebRTC();
+      } else {
+        await connectWebSocket();
+      }
+    } catch (e) {
+      logEvent('error', '连接失败: ' + e.message);
+      cleanup();
+    }
+  }
+
+  async function startListening() {
+    try {
+      if (!state.rtcTrack) {
+        await startMicrophone();
+      }
+    } catch (e) {
+      logEvent('error', '无法打开麦克风: ' + e.message);
+      return;
+    }
+    setListening(true);
+    sendJSON({ type: 'listen', state: 'start', mode: $('listenMode').value });
+  }
+
+  function stopListening() {
+    setListening(false);
+    sendJSON({ type: 'listen', state: 'stop', mode: $('listenMode').value });
+  }
+
+  $('connectBtn').onclick = connect;
+  $('disconnectBtn').onclick = cleanup;
+  $('clearBtn').onclick = () => { $('events').innerHTML = ''; };
+  $('abortBtn').onclick = () => {
+    stopPlayback();
+    sendJSON({ type: 'abort' });
+  };
+  $('listenBtn').onpointerdown = () => {
+    if ($('listenMode').value === 'manual') {
+      stopPlayback();
+      startListening();
+    }
+  };
+  $('listenBtn').onpointerup = () => {
+    if ($('listenMode').value === 'manual' && state.listening) {
+      stopListening();
+    }
+  };
+  $('listenBtn').onclick = () => {
+    if ($('listenMode').value === 'manual') {
+      return;
+    }
+    if (state.listening) {
+      stopListening();
+    } else {
+      startListening();
+    }
+  };
+  $('listenMode').onchange = () => setListening(false);
+  $('textForm').onsubmit = (event) => {
+    event.preventDefault();
+    const text = $('textInput').value.trim();
+    if (!text) {
+      return;
+    }
+    addMessage('user', text, false);
+    sendJSON({ type: 'listen', state: 'detect', text: text });
+    $('textInput').value = '';
+  };
+
+  loadSettings();
+  setConnected(false);
+})();
@@ -0,0 +1,30 @@
+// 麦克风采集：按帧长切分单声道PCM后发回主线程
+class RecorderProcessor extends AudioWorkletProcessor {
+  constructor(options) {
+    super();
+    this.frameSize = options.processorOptions.frameSize;
+    this.buffer = new Float32Array(this.frameSize);
+    this.offset = 0;
+  }
+
+  process(inputs) {
+    const input = inputs[0] && inputs[0][0];
+    if (!input) {
+      return true;
+    }
+    let pos = 0;
+    while (pos < input.length) {
+      const count = Math.min(this.frameSize - this.offset, input.length - pos);
+      this.buffer.set(input.subarray(pos, pos + count), this.offset);
+      this.offset += count;
+      pos += count;
+      if (this.offset === this.frameSize) {
+        this.port.postMessage(this.buffer.slice(0));
+        this.offset = 0;
+      }
+    }
+    return true;
+  }
+}
+
+registerProcessor('recorder-processor', RecorderProcessor);